@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/cli"
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// positionTolerance is how far the sourcetable position may be from the
+// ARP, in km, before it is reported. STR coordinates are often rounded to
+// two decimals.
+const positionTolerance = 2.0
+
+func main() {
+	// Parse command line flags
+	caster := cli.RegisterClientFlags(flag.CommandLine, "NTRIP caster address (e.g., rtk2go.com)", "Mountpoint to audit")
+	duration := flag.Duration("duration", time.Minute, "Maximum time to listen for station messages")
+	output := flag.String("output", "text", "Output format (text, json)")
+	flag.Parse()
+
+	if *output != "text" && *output != "json" {
+		fmt.Printf("Error: unknown output format: %s\n", *output)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	client, err := caster.NewClient()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Set up signal handling for graceful shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	ctx, cancelListen := context.WithTimeout(ctx, *duration)
+	defer cancelListen()
+
+	a := newAudit(caster.Mountpoint)
+
+	// The sourcetable entry is what the caster claims about the base
+	if st, err := client.GetSourcetable(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not fetch the sourcetable: %v\n", err)
+	} else {
+		a.str = st.Find(caster.Mountpoint)
+	}
+
+	stream, err := client.ConnectContext(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", caster.Mountpoint, err)
+		os.Exit(1)
+	}
+	defer stream.Close()
+
+	// Closing the stream unblocks the read when the time is up
+	go func() {
+		<-ctx.Done()
+		stream.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening to %s for up to %v...\n", caster.Mountpoint, *duration)
+	rtcmParser := parser.NewRTCMParser()
+	buffer := make([]byte, 4096)
+	for !a.complete() {
+		n, err := stream.Read(buffer)
+		for _, message := range rtcmParser.Process(buffer[:n]) {
+			a.add(message)
+		}
+		if err != nil {
+			if ctx.Err() == nil && err != io.EOF {
+				fmt.Fprintf(os.Stderr, "Warning: stream ended: %v\n", err)
+			}
+			break
+		}
+	}
+	a.elapsed = time.Since(a.started).Round(time.Second)
+
+	if err := writeReport(os.Stdout, a.report(), *output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// audit collects what a base station sends about itself
+type audit struct {
+	mount    string
+	started  time.Time
+	elapsed  time.Duration
+	str      *ntrip.MountPoint
+	counts   map[int]int
+	station  *parser.StationARP
+	antenna  *parser.AntennaDescriptor
+	receiver *parser.ReceiverDescriptor
+	biases   *parser.GLONASSBiases
+	errors   []string
+}
+
+// newAudit creates an audit of a mountpoint
+func newAudit(mount string) *audit {
+	return &audit{mount: mount, started: time.Now(), counts: make(map[int]int)}
+}
+
+// add records a message, keeping the latest of each kind of description
+func (a *audit) add(message parser.RTCMMessage) {
+	a.counts[message.MessageType]++
+
+	// Only the station's description of itself is decoded
+	switch message.MessageType {
+	case 1005, 1006, 1007, 1008, 1033, 1230:
+	default:
+		return
+	}
+
+	decoded, err := message.Decode()
+	if err != nil {
+		a.errors = append(a.errors, fmt.Sprintf("%d: %v", message.MessageType, err))
+		return
+	}
+
+	switch m := decoded.(type) {
+	case *parser.StationARP:
+		a.station = m
+	case *parser.AntennaDescriptor:
+		a.antenna = m
+	case *parser.ReceiverDescriptor:
+		a.receiver = m
+	case *parser.GLONASSBiases:
+		a.biases = m
+	}
+}
+
+// complete reports whether everything the base describes itself with has
+// been received: the ARP, the antenna and receiver descriptors and, for a
+// GLONASS base, the code-phase biases
+func (a *audit) complete() bool {
+	if a.station == nil || a.antenna == nil || a.receiver == nil {
+		return false
+	}
+	return !a.station.GLONASS || a.biases != nil
+}
+
+// report is the result of an audit
+type report struct {
+	Mount       string                     `json:"mount"`
+	Duration    string                     `json:"duration"`
+	Messages    map[int]int                `json:"messages"`
+	Station     *parser.StationARP         `json:"station,omitempty"`
+	Position    *position.Position         `json:"position,omitempty"` // ARP as latitude, longitude and height
+	Antenna     *parser.AntennaDescriptor  `json:"antenna,omitempty"`
+	Receiver    *parser.ReceiverDescriptor `json:"receiver,omitempty"`
+	Biases      *parser.GLONASSBiases      `json:"glonass_biases,omitempty"`
+	Sourcetable *ntrip.MountPoint          `json:"sourcetable,omitempty"`
+	Warnings    []string                   `json:"warnings"`
+}
+
+// report summarises the audit and checks the base's claims for consistency
+func (a *audit) report() *report {
+	r := &report{
+		Mount:       a.mount,
+		Duration:    a.elapsed.String(),
+		Messages:    a.counts,
+		Station:     a.station,
+		Antenna:     a.antenna,
+		Receiver:    a.receiver,
+		Biases:      a.biases,
+		Sourcetable: a.str,
+		Warnings:    append([]string{}, a.errors...),
+	}
+	warn := func(format string, args ...interface{}) {
+		r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	if a.str == nil {
+		warn("mountpoint is not in the sourcetable")
+	}
+
+	if s := a.station; s == nil {
+		warn("no 1005/1006 station position received")
+	} else if s.X == 0 && s.Y == 0 && s.Z == 0 {
+		warn("station position is 0,0,0")
+	} else {
+		lat, lon, height := position.FromECEF(s.X, s.Y, s.Z)
+		r.Position = &position.Position{Latitude: lat, Longitude: lon, Altitude: height}
+		if a.str != nil {
+			if d := position.DistanceKm(lat, lon, a.str.Latitude, a.str.Longitude); d > positionTolerance {
+				warn("sourcetable position is %.1f km from the station position", d)
+			}
+		}
+	}
+
+	if a.antenna == nil && a.receiver == nil {
+		warn("no 1007/1008/1033 antenna descriptor received")
+	}
+	if a.antenna != nil && a.receiver != nil && a.antenna.Descriptor != a.receiver.Antenna {
+		warn("antenna %q in 1007/1008 differs from %q in 1033", a.antenna.Descriptor, a.receiver.Antenna)
+	}
+	if a.station != nil && a.station.GLONASS && a.biases == nil {
+		warn("GLONASS is indicated but no 1230 code-phase biases were received")
+	}
+
+	// Every message carries the station ID; they should agree
+	ids := map[int]bool{}
+	if a.station != nil {
+		ids[a.station.StationID] = true
+	}
+	if a.antenna != nil {
+		ids[a.antenna.StationID] = true
+	}
+	if a.receiver != nil {
+		ids[a.receiver.StationID] = true
+	}
+	if a.biases != nil {
+		ids[a.biases.StationID] = true
+	}
+	if len(ids) > 1 {
+		warn("station IDs differ between messages")
+	}
+
+	return r
+}
+
+// writeReport writes the audit report in the given format
+func writeReport(w io.Writer, r *report, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Mountpoint:  %s (listened %s)\n", r.Mount, r.Duration)
+
+	types := make([]int, 0, len(r.Messages))
+	for t := range r.Messages {
+		types = append(types, t)
+	}
+	sort.Ints(types)
+	counts := make([]string, len(types))
+	for i, t := range types {
+		counts[i] = fmt.Sprintf("%d(%d)", t, r.Messages[t])
+	}
+	fmt.Fprintf(&sb, "Messages:    %s\n", strings.Join(counts, " "))
+
+	if s := r.Station; s != nil {
+		fmt.Fprintf(&sb, "Station ID:  %d\n", s.StationID)
+		fmt.Fprintf(&sb, "ARP (ECEF):  X %.4f  Y %.4f  Z %.4f m\n", s.X, s.Y, s.Z)
+		if r.Position != nil {
+			fmt.Fprintf(&sb, "ARP:         %.8f, %.8f, %.3f m\n", r.Position.Latitude, r.Position.Longitude, r.Position.Altitude)
+		}
+		if s.HasHeight {
+			fmt.Fprintf(&sb, "Ant. height: %.4f m\n", s.AntennaHeight)
+		}
+		fmt.Fprintf(&sb, "Systems:     %s\n", systems(s))
+		fmt.Fprintf(&sb, "ITRF year:   %d\n", s.ITRFYear)
+	}
+	if a := r.Antenna; a != nil {
+		fmt.Fprintf(&sb, "Antenna:     %q setup %d serial %q\n", a.Descriptor, a.SetupID, a.Serial)
+	}
+	if rc := r.Receiver; rc != nil {
+		fmt.Fprintf(&sb, "Receiver:    %q firmware %q serial %q\n", rc.Receiver, rc.Firmware, rc.ReceiverSerial)
+	}
+	if b := r.Biases; b != nil {
+		biases := make([]string, len(b.Biases))
+		for i, bias := range b.Biases {
+			biases[i] = fmt.Sprintf("%s %.2f m", bias.Signal, bias.Bias)
+		}
+		fmt.Fprintf(&sb, "GLO biases:  %s (aligned %t)\n", strings.Join(biases, ", "), b.Aligned)
+	}
+	if st := r.Sourcetable; st != nil {
+		fmt.Fprintf(&sb, "STR:         %s %s %s %.2f, %.2f\n", st.Format, st.NavSystem, st.Country, st.Latitude, st.Longitude)
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&sb, "Warning:     %s\n", warning)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// systems lists the constellations a station says it provides
+func systems(s *parser.StationARP) string {
+	var names []string
+	if s.GPS {
+		names = append(names, "GPS")
+	}
+	if s.GLONASS {
+		names = append(names, "GLO")
+	}
+	if s.Galileo {
+		names = append(names, "GAL")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// payload packs fields given as (bits, value) pairs into an RTCM payload
+func payload(fields ...int64) []byte {
+	var data []byte
+	pos := 0
+	for i := 0; i < len(fields); i += 2 {
+		bits, value := int(fields[i]), fields[i+1]
+		for b := bits - 1; b >= 0; b-- {
+			if pos%8 == 0 {
+				data = append(data, 0)
+			}
+			if uint64(value)>>uint(b)&1 == 1 {
+				data[pos/8] |= 1 << uint(7-pos%8)
+			}
+			pos++
+		}
+	}
+	return data
+}
+
+// text packs a counted string as payload fields
+func text(s string) []int64 {
+	fields := []int64{8, int64(len(s))}
+	for i := 0; i < len(s); i++ {
+		fields = append(fields, 8, int64(s[i]))
+	}
+	return fields
+}
+
+// message wraps a payload with the message type in its first 12 bits
+func message(fields ...int64) parser.RTCMMessage {
+	return parser.RTCMMessage{MessageType: int(fields[1]), Payload: payload(fields...), Valid: true}
+}
+
+// station is a 1006 for a GPS+GLONASS base in London
+func station(id int64) parser.RTCMMessage {
+	return message(12, 1006, 12, id, 6, 14, 1, 1, 1, 1, 1, 0, 1, 0,
+		38, 39786678176, 2, 0, 38, -83329146, 2, 0, 38, 49683976747, 16, 15000)
+}
+
+func receiver(antenna string) parser.RTCMMessage {
+	fields := []int64{12, 1033, 12, 7}
+	fields = append(fields, text(antenna)...)
+	fields = append(fields, 8, 0)
+	fields = append(fields, text("")...)
+	fields = append(fields, text("SEPT POLARX5")...)
+	fields = append(fields, text("5.4.0")...)
+	fields = append(fields, text("3056789")...)
+	return message(fields...)
+}
+
+func antenna(descriptor string) parser.RTCMMessage {
+	fields := append([]int64{12, 1008, 12, 7}, text(descriptor)...)
+	fields = append(fields, 8, 0)
+	return message(append(fields, text("123")...)...)
+}
+
+func TestAuditComplete(t *testing.T) {
+	a := newAudit("BASE")
+	a.str = &ntrip.MountPoint{Name: "BASE", Format: "RTCM 3.3", Latitude: 51.5, Longitude: -0.12}
+
+	a.add(station(7))
+	a.add(parser.RTCMMessage{MessageType: 1077, Payload: payload(12, 1077)})
+	a.add(antenna("TRM59800.00     NONE"))
+	a.add(receiver("TRM59800.00     NONE"))
+	if a.complete() {
+		t.Fatal("A GLONASS base is not complete without 1230")
+	}
+	a.add(message(12, 1230, 12, 7, 1, 1, 3, 0, 4, 0xF, 16, 0, 16, 0, 16, 0, 16, 0))
+	if !a.complete() {
+		t.Fatal("Expected the audit to be complete")
+	}
+
+	r := a.report()
+	if len(r.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", r.Warnings)
+	}
+	if r.Position == nil || r.Position.Latitude < 51.49 || r.Position.Latitude > 51.51 {
+		t.Errorf("Expected the ARP near London, got %+v", r.Position)
+	}
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, r, "text"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{"1006(1) 1008(1) 1033(1) 1077(1) 1230(1)", "Station ID:  7", "Ant. height: 1.5000 m",
+		"Systems:     GPS+GLO", `Receiver:    "SEPT POLARX5" firmware "5.4.0"`, "L2 P 0.00 m"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in the report:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := writeReport(&buf, r, "json"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var decoded struct {
+		Station struct {
+			StationID int `json:"station_id"`
+		} `json:"station"`
+		Receiver struct {
+			Firmware string `json:"firmware"`
+		} `json:"receiver"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if decoded.Station.StationID != 7 || decoded.Receiver.Firmware != "5.4.0" {
+		t.Errorf("Unexpected JSON report %s", buf.String())
+	}
+}
+
+func TestAuditWarnings(t *testing.T) {
+	a := newAudit("BASE")
+	a.str = &ntrip.MountPoint{Name: "BASE", Latitude: 48.85, Longitude: 2.35}
+	a.add(station(8))
+	a.add(antenna("ADVNULLANTENNA"))
+	a.add(receiver("TRM59800.00     NONE"))
+	a.add(parser.RTCMMessage{MessageType: 1033, Payload: payload(12, 1033, 12, 7, 8, 200)})
+
+	warnings := strings.Join(a.report().Warnings, "\n")
+	for _, want := range []string{"1033: message too short", "sourcetable position is 34", "differs from",
+		"no 1230", "station IDs differ"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("Expected a warning containing %q, got:\n%s", want, warnings)
+		}
+	}
+
+	warnings = strings.Join(newAudit("MISSING").report().Warnings, "\n")
+	if !strings.Contains(warnings, "not in the sourcetable") || !strings.Contains(warnings, "no 1005/1006") {
+		t.Errorf("Expected missing data warnings, got:\n%s", warnings)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -13,15 +14,20 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/bramburn/go_ntrip/internal/ntrip"
+	"github.com/bramburn/go_ntrip/internal/device"
 	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/port"
 	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 )
 
+// roverGGAMaxAge is how old the rover's last GGA may be and still be uploaded
+const roverGGAMaxAge = 30 * time.Second
+
 func main() {
 	// Parse command line flags
 	address := flag.String("address", "", "NTRIP server address (e.g., 192.168.0.64)")
-	port := flag.String("port", "2101", "NTRIP server port")
+	casterPort := flag.String("port", "2101", "NTRIP server port")
 	username := flag.String("user", "", "Username for NTRIP server")
 	password := flag.String("pass", "", "Password for NTRIP server")
 	mountpoint := flag.String("mount", "", "Mountpoint name")
@@ -29,6 +35,9 @@ func main() {
 	minFixQuality := flag.Int("min-fix", 4, "Minimum fix quality (4=RTK Fixed, 5=Float RTK)")
 	sampleCount := flag.Int("samples", 60, "Number of samples to collect")
 	timeout := flag.Duration("timeout", 10*time.Minute, "Timeout for connection")
+	portName := flag.String("device", "", "Upload the GGA of the rover on this serial port (required by VRS mountpoints)")
+	baudRate := flag.Int("baud", 38400, "Baud rate of -device")
+	ggaInterval := flag.Duration("gga-interval", ntrip.DefaultGGAInterval, "Interval between GGA uploads")
 	flag.Parse()
 
 	// Check required parameters
@@ -68,11 +77,32 @@ func main() {
 	}
 
 	// Construct URL
-	url := fmt.Sprintf("http://%s:%s", *address, *port)
+	url := fmt.Sprintf("http://%s:%s", *address, *casterPort)
 
 	// Create NTRIP client
 	client := ntrip.NewClient(url, *username, *password, *mountpoint)
 
+	// Upload the rover's own GGA sentences
+	if *portName != "" {
+		gnssDevice := device.NewTOPGNSSDevice(port.NewGNSSSerialPort())
+		if err := gnssDevice.Connect(*portName, *baudRate); err != nil {
+			fmt.Printf("Error connecting to GNSS device: %v\n", err)
+			os.Exit(1)
+		}
+		defer gnssDevice.Disconnect()
+
+		rover := ntrip.NewRoverGGA(roverGGAMaxAge)
+		if err := gnssDevice.MonitorNMEA(device.DefaultMonitorConfig(device.ProtocolNMEA, device.SentenceHandler(rover.Update))); err != nil {
+			fmt.Printf("Error monitoring GNSS device: %v\n", err)
+			os.Exit(1)
+		}
+		defer gnssDevice.StopMonitoring()
+
+		client.GGASource = rover
+		client.GGAInterval = *ggaInterval
+		fmt.Printf("Uploading the GGA of %s every %v\n", *portName, *ggaInterval)
+	}
+
 	// Create context with timeout and cancellation
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
 	defer cancel()
@@ -86,16 +116,12 @@ func main() {
 		cancel()
 	}()
 
-	// Connect to NTRIP server
+	// Open a session that reconnects when the link drops
 	fmt.Printf("Connecting to NTRIP server at %s...\n", url)
-	stream, err := client.Connect(ctx)
-	if err != nil {
-		fmt.Printf("Error connecting to NTRIP server: %v\n", err)
-		os.Exit(1)
-	}
+	stream := ntrip.NewSession(ctx, client, ntrip.DefaultSessionConfig())
 	defer stream.Close()
+	go ntrip.LogEvents(stream, log.New(os.Stdout, "\n", 0))
 
-	fmt.Println("Connected to NTRIP server.")
 	fmt.Printf("Collecting position samples (minimum fix quality: %s)...\n",
 		position.GetFixQualityDescription(*minFixQuality))
 	fmt.Printf("Will collect %d samples. Press Ctrl+C to stop early.\n", *sampleCount)
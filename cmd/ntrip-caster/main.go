@@ -3,101 +3,99 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
-	"github.com/bramburn/gnssgo/pkg/caster"
-	"github.com/sirupsen/logrus"
+	"github.com/bramburn/go_ntrip/pkg/caster"
 )
 
 func main() {
 	// Parse command-line flags
-	port := flag.Int("port", 2101, "Port to listen on")
-	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+	configPath := flag.String("config", "", "JSON file with mountpoints, source passwords and users")
+	listen := flag.String("listen", "", "Address to listen on (overrides the config file, default :2101)")
 	flag.Parse()
 
-	// Configure logger
-	logger := logrus.New()
-	level, err := logrus.ParseLevel(*logLevel)
-	if err != nil {
-		logger.Fatalf("Invalid log level: %v", err)
+	if *configPath == "" {
+		fmt.Println("Error: -config is required")
+		flag.Usage()
+		os.Exit(1)
 	}
-	logger.SetLevel(level)
-	logger.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-	})
 
-	// Create a new source service
-	svc := caster.NewInMemorySourceService()
+	logger := log.New(os.Stderr, "", log.LstdFlags)
 
-	// Add some example mounts to the sourcetable
-	svc.Sourcetable = caster.Sourcetable{
-		Casters: []caster.CasterEntry{
-			{
-				Host:       "localhost",
-				Port:       *port,
-				Identifier: "GNSSGO NTRIP Caster",
-				Operator:   "GNSSGO",
-				NMEA:       true,
-				Country:    "USA",
-				Latitude:   37.7749,
-				Longitude:  -122.4194,
-			},
-		},
-		Networks: []caster.NetworkEntry{
-			{
-				Identifier:          "GNSSGO",
-				Operator:            "GNSSGO",
-				Authentication:      "B",
-				Fee:                 false,
-				NetworkInfoURL:      "https://github.com/bramburn/gnssgo",
-				StreamInfoURL:       "https://github.com/bramburn/gnssgo",
-				RegistrationAddress: "admin@example.com",
-			},
-		},
-		Mounts: []caster.StreamEntry{
-			{
-				Name:           "RTCM33",
-				Identifier:     "RTCM33",
-				Format:         "RTCM 3.3",
-				FormatDetails:  "1004(1),1005/1006(5),1008(5),1012(1),1019(5),1020(5),1033(5),1042(5),1044(5),1045(5),1046(5)",
-				Carrier:        "2",
-				NavSystem:      "GPS+GLO+GAL+BDS+QZSS",
-				Network:        "GNSSGO",
-				CountryCode:    "USA",
-				Latitude:       37.7749,
-				Longitude:      -122.4194,
-				NMEA:           true,
-				Solution:       false,
-				Generator:      "GNSSGO",
-				Compression:    "none",
-				Authentication: "B",
-				Fee:            false,
-				Bitrate:        9600,
-			},
-		},
+	config, err := loadConfig(*configPath, *listen)
+	if err != nil {
+		logger.Fatalf("Error: %v", err)
 	}
 
 	// Create the caster
-	caster := caster.NewCaster(fmt.Sprintf(":%d", *port), svc, logger)
+	ntripCaster, err := caster.New(config)
+	if err != nil {
+		logger.Fatalf("Error: %v", err)
+	}
+	ntripCaster.Logger = logger
 
-	// Start the caster in a goroutine
+	// Reload the configuration on SIGHUP and stop on SIGINT/SIGTERM
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		logger.Infof("Starting NTRIP caster on port %d", *port)
-		if err := caster.ListenAndServe(); err != nil {
-			logger.Fatalf("Caster error: %v", err)
+		for sig := range sigCh {
+			if sig != syscall.SIGHUP {
+				logger.Println("Shutting down caster...")
+				ntripCaster.Close()
+				return
+			}
+
+			config, err := loadConfig(*configPath, *listen)
+			if err != nil {
+				logger.Printf("Reload failed, keeping current configuration: %v", err)
+				continue
+			}
+			if err := ntripCaster.Reload(config); err != nil {
+				logger.Printf("Reload failed, keeping current configuration: %v", err)
+				continue
+			}
+			logger.Printf("Reloaded %s: %d mountpoints, %d users", *configPath, len(config.Mounts), len(config.Users))
 		}
 	}()
 
-	// Wait for interrupt signal
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	// Serve the admin API; its address is fixed at startup like the caster's
+	if config.Admin != nil {
+		adminServer := &http.Server{Addr: config.Admin.Listen, Handler: ntripCaster.AdminHandler()}
+		defer adminServer.Close()
+		go func() {
+			logger.Printf("Admin API listening on %s", config.Admin.Listen)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatalf("Admin API error: %v", err)
+			}
+		}()
+	}
+
+	logger.Printf("Starting NTRIP caster on %s with %d mountpoints", listenAddress(config), len(config.Mounts))
+	if err := ntripCaster.ListenAndServe(); err != nil {
+		logger.Fatalf("Caster error: %v", err)
+	}
+}
+
+// loadConfig reads the configuration file and applies the -listen override
+func loadConfig(path, listen string) (*caster.Config, error) {
+	config, err := caster.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if listen != "" {
+		config.Listen = listen
+	}
+	return config, nil
+}
 
-	// Shutdown the caster
-	logger.Info("Shutting down caster...")
-	if err := caster.Shutdown(nil); err != nil {
-		logger.Errorf("Error shutting down caster: %v", err)
+// listenAddress returns the address the caster will listen on
+func listenAddress(config *caster.Config) string {
+	if config.Listen == "" {
+		return caster.DefaultListen
 	}
+	return config.Listen
 }
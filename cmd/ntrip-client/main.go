@@ -3,38 +3,56 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log"
+	neturl "net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/bramburn/go_ntrip/internal/ntrip"
+	"github.com/bramburn/go_ntrip/internal/cli"
+	"github.com/bramburn/go_ntrip/internal/pipeline"
 	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 )
 
 func main() {
 	// Parse command line flags
-	address := flag.String("address", "", "NTRIP server address (e.g., 192.168.0.64)")
-	port := flag.String("port", "2101", "NTRIP server port")
-	username := flag.String("user", "", "Username for NTRIP server")
-	password := flag.String("pass", "", "Password for NTRIP server")
-	mountpoint := flag.String("mount", "", "Mountpoint name")
+	caster := cli.RegisterClientFlags(flag.CommandLine, "NTRIP server address (e.g., 192.168.0.64)", "Mountpoint name (\"auto\" selects the nearest suitable mountpoint)")
+	latitude := flag.Float64("lat", 0, "Rover latitude in decimal degrees (used with -mount auto)")
+	longitude := flag.Float64("lon", 0, "Rover longitude in decimal degrees (used with -mount auto)")
+	format := flag.String("format", "RTCM 3", "Required correction format (used with -mount auto)")
+	navSystems := flag.String("nav", "", "Required navigation systems, e.g. GPS+GLO (used with -mount auto)")
+	noFee := flag.Bool("no-fee", false, "Skip mountpoints that charge a fee (used with -mount auto)")
+	sendGGA := flag.Bool("gga", false, "Upload a GGA built from -lat/-lon (required by VRS mountpoints)")
+	ggaInterval := flag.Duration("gga-interval", ntrip.DefaultGGAInterval, "Interval between GGA uploads")
 	outputFile := flag.String("output", "", "Output file path (default: ./base_position.json)")
 	timeout := flag.Duration("timeout", 60*time.Second, "Timeout for connection")
+	stallTimeout := flag.Duration("stall-timeout", ntrip.DefaultStallTimeout, "Reconnect when no RTCM frame arrives for this long")
+	backups := flag.String("backup", "", "Comma-separated backup sources in priority order ([ntrips://][user:pass@]host:port/MOUNT)")
+	maxSilence := flag.Duration("max-silence", ntrip.DefaultMaxSilence, "Switch to a backup when the active source is silent for this long")
+	maxAge := flag.Duration("max-age", ntrip.DefaultMaxCorrectionAge, "Switch to a backup when the active source's latest observations are this old")
+	recovery := flag.Duration("recovery", ntrip.DefaultRecoveryPeriod, "Time the primary must be healthy before switching back")
+	rewriteFile := flag.String("rewrite", "", "JSON rewrite configuration applied to the corrections (see rtcm-filter)")
+	convert := flag.String("convert", "", "Convert observations to msm4 or legacy (1004/1012) for the receiver")
 	flag.Parse()
 
 	// Check required parameters
-	if *address == "" {
-		fmt.Println("Error: NTRIP server address is required")
+	client, err := caster.NewClient()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	if *mountpoint == "" {
-		fmt.Println("Error: Mountpoint is required")
+	if (caster.Mountpoint == "auto" || *sendGGA) && *latitude == 0 && *longitude == 0 {
+		fmt.Println("Error: -lat and -lon are required with -mount auto and -gga")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -48,11 +66,29 @@ func main() {
 		*outputFile = filepath.Join(filepath.Dir(execPath), "base_position.json")
 	}
 
-	// Construct URL
-	url := fmt.Sprintf("http://%s:%s", *address, *port)
-
-	// Create NTRIP client
-	client := ntrip.NewClient(url, *username, *password, *mountpoint)
+	// Filter, rewrite and convert the corrections before they are used
+	var stages pipeline.Chain
+	if *rewriteFile != "" {
+		rewriteConfig, err := pipeline.LoadRewriteConfig(*rewriteFile)
+		var rewriter *pipeline.Rewriter
+		if err == nil {
+			rewriter, err = pipeline.NewRewriter(*rewriteConfig)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		stages = append(stages, rewriter)
+	}
+	if *convert != "" {
+		converter, err := pipeline.NewConverter(*convert)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		stages = append(stages, converter)
+	}
 
 	// Create context with timeout and cancellation
 	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
@@ -67,16 +103,74 @@ func main() {
 		cancel()
 	}()
 
-	// Connect to NTRIP server
-	fmt.Printf("Connecting to NTRIP server at %s...\n", url)
-	stream, err := client.Connect(ctx)
-	if err != nil {
-		fmt.Printf("Error connecting to NTRIP server: %v\n", err)
-		os.Exit(1)
+	// Select the nearest suitable mountpoint if requested
+	if caster.Mountpoint == "auto" {
+		filter := ntrip.MountFilter{
+			Format:     *format,
+			ExcludeFee: *noFee,
+		}
+		if *navSystems != "" {
+			filter.NavSystems = strings.Split(*navSystems, "+")
+		}
+
+		rover := &position.Position{Latitude: *latitude, Longitude: *longitude}
+		fmt.Printf("Selecting nearest mountpoint from sourcetable at %s...\n", client.URL)
+		mount, err := client.NearestMount(ctx, rover, filter)
+		if err != nil {
+			fmt.Printf("Error selecting mountpoint: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Selected mountpoint %s (%s, %s), baseline %.1f km\n",
+			mount.Name, mount.Identifier, mount.Country, mount.Distance)
+		client.Mountpoint = mount.Name
+		*sendGGA = *sendGGA || mount.NMEA
+	}
+
+	// Upload the rover position for VRS and network RTK mountpoints
+	if *sendGGA {
+		client.GGASource = ntrip.FixedGGA{
+			Position: &position.Position{Latitude: *latitude, Longitude: *longitude},
+		}
+		client.GGAInterval = *ggaInterval
+		fmt.Printf("Uploading GGA every %v\n", *ggaInterval)
+	}
+
+	// Open a session that reconnects when the link drops
+	fmt.Printf("Connecting to NTRIP server at %s...\n", client.URL)
+	sessionConfig := ntrip.DefaultSessionConfig()
+	sessionConfig.StallTimeout = *stallTimeout
+
+	var stream io.ReadCloser
+	if *backups == "" {
+		session := ntrip.NewSession(ctx, client, sessionConfig)
+		go ntrip.LogEvents(session, log.New(os.Stdout, "\n", 0))
+		stream = session
+	} else {
+		sources := []ntrip.FailoverSource{{Client: client}}
+		for _, spec := range strings.Split(*backups, ",") {
+			backup, err := parseSource(strings.TrimSpace(spec), client)
+			if err != nil {
+				fmt.Printf("Error: invalid backup source %q: %v\n", spec, err)
+				os.Exit(1)
+			}
+			sources = append(sources, ntrip.FailoverSource{Client: backup})
+		}
+
+		failover := ntrip.NewFailover(ctx, sources, ntrip.FailoverConfig{
+			Session:          sessionConfig,
+			MaxSilence:       *maxSilence,
+			MaxCorrectionAge: *maxAge,
+			RecoveryPeriod:   *recovery,
+		})
+		go logFailoverEvents(failover)
+		stream = failover
+	}
+	if len(stages) > 0 {
+		stream = pipeline.NewReader(stream, stages)
 	}
 	defer stream.Close()
 
-	fmt.Println("Connected to NTRIP server.")
 	fmt.Println("Waiting for position data...")
 
 	// Read RTCM data
@@ -90,6 +184,13 @@ func main() {
 			n, err := stream.Read(buffer)
 			if err != nil {
 				fmt.Printf("Error reading from NTRIP stream: %v\n", err)
+				var notFound *ntrip.ErrMountpointNotFound
+				if errors.As(err, &notFound) && len(notFound.Alternatives) > 0 {
+					fmt.Println("Available mountpoints:")
+					for _, m := range notFound.Alternatives {
+						fmt.Printf("  %-20s %-10s %s\n", m.Name, m.Format, m.Identifier)
+					}
+				}
 				return
 			}
 			if n > 0 {
@@ -100,6 +201,48 @@ func main() {
 	}
 }
 
+// parseSource builds a client for a backup source given as
+// [ntrips://][user:pass@]host:port/MOUNT. TLS, proxy and GGA settings are
+// copied from the primary client.
+func parseSource(spec string, primary *ntrip.Client) (*ntrip.Client, error) {
+	if !strings.Contains(spec, "://") {
+		spec = "http://" + spec
+	}
+	u, err := neturl.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := strings.Trim(u.Path, "/")
+	if u.Host == "" || mount == "" {
+		return nil, fmt.Errorf("expected host:port/MOUNT")
+	}
+
+	username := u.User.Username()
+	password, _ := u.User.Password()
+	u.User = nil
+	u.Path = ""
+
+	client := ntrip.NewClient(u.String(), username, password, mount)
+	client.Protocol = primary.Protocol
+	client.TLSConfig = primary.TLSConfig
+	client.Proxy = primary.Proxy
+	client.GGASource = primary.GGASource
+	client.GGAInterval = primary.GGAInterval
+	return client, nil
+}
+
+// logFailoverEvents prints source switches until the stream ends
+func logFailoverEvents(failover *ntrip.Failover) {
+	for event := range failover.Events() {
+		if event.To < 0 {
+			fmt.Printf("\nNo healthy correction source (%s)\n", event.Reason)
+			continue
+		}
+		fmt.Printf("\nUsing correction source %d: %s (%s)\n", event.To+1, event.Source, event.Reason)
+	}
+}
+
 // savePosition saves the position to a JSON file
 func savePosition(pos *position.Position, filePath string) error {
 	// Create directory if it doesn't exist
@@ -4,15 +4,16 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 	"time"
 
-	"github.com/bramburn/go_ntrip/internal/ntrip"
 	"github.com/bramburn/go_ntrip/internal/position"
 	"github.com/bramburn/go_ntrip/internal/rtk"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 )
 
 func main() {
@@ -84,16 +85,12 @@ func main() {
 		cancel()
 	}()
 
-	// Connect to NTRIP server
+	// Open a session that reconnects when the link drops
 	fmt.Printf("Connecting to NTRIP server at %s...\n", url)
-	stream, err := client.Connect(ctx)
-	if err != nil {
-		fmt.Printf("Error connecting to NTRIP server: %v\n", err)
-		os.Exit(1)
-	}
+	stream := ntrip.NewSession(ctx, client, ntrip.DefaultSessionConfig())
 	defer stream.Close()
+	go ntrip.LogEvents(stream, log.New(os.Stdout, "\n", 0))
 
-	fmt.Println("Connected to NTRIP server.")
 	fmt.Printf("Processing RTCM data (minimum fix quality: %s)...\n",
 		position.GetFixQualityDescription(*minFixQuality))
 	fmt.Printf("Will collect %d samples. Press Ctrl+C to stop early.\n", *sampleCount)
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+func testSourcetable() *ntrip.Sourcetable {
+	return &ntrip.Sourcetable{Mounts: []ntrip.MountPoint{
+		{Name: "BRUX", Identifier: "Brussels", Format: "RTCM 3.3", NavSystem: "GPS+GLO", Country: "BEL", Latitude: 50.8, Longitude: 4.36, Authentication: "B", Bitrate: 9600},
+		{Name: "WTZR", Identifier: "Wettzell", Format: "RTCM 3.3", NavSystem: "GPS", Country: "DEU", Latitude: 49.14, Longitude: 12.88, Fee: true, Bitrate: 4800},
+	}}
+}
+
+func TestWriteSourcetableCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSourcetable(&buf, testSourcetable(), "csv"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d lines", len(lines))
+	}
+	if !strings.HasPrefix(lines[0], "name,identifier,format,") {
+		t.Errorf("Unexpected header %q", lines[0])
+	}
+	if lines[1] != "BRUX,Brussels,RTCM 3.3,,0,GPS+GLO,,BEL,50.8,4.36,false,false,,,B,false,9600," {
+		t.Errorf("Unexpected row %q", lines[1])
+	}
+}
+
+func TestWriteSourcetableJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSourcetable(&buf, testSourcetable(), "json"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded struct {
+		Mounts []struct {
+			Name    string  `json:"name"`
+			Bitrate int     `json:"bitrate"`
+			Lat     float64 `json:"latitude"`
+		} `json:"mounts"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(decoded.Mounts) != 2 || decoded.Mounts[1].Name != "WTZR" || decoded.Mounts[1].Bitrate != 4800 {
+		t.Errorf("Unexpected decoded mounts %+v", decoded.Mounts)
+	}
+}
+
+func TestWriteSourcetableTable(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSourcetable(&buf, testSourcetable(), "table"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.HasPrefix(output, "NAME") {
+		t.Errorf("Expected header row, got %q", output)
+	}
+	if !strings.Contains(output, "WTZR") || !strings.Contains(output, "49.14") {
+		t.Errorf("Expected WTZR row, got %q", output)
+	}
+}
+
+func TestWriteChanges(t *testing.T) {
+	previous := testSourcetable()
+	current := testSourcetable()
+	current.Mounts[0].Bitrate = 4800
+	current.Mounts = current.Mounts[:1]
+
+	changes := ntrip.DiffSourcetables(previous, current)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := writeChanges(&buf, now, changes, "csv"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "2024-05-01T12:00:00Z,changed,BRUX,bitrate,9600,4800\n2024-05-01T12:00:00Z,removed,WTZR,,,\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := writeChanges(&buf, now, changes, "json"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	first := strings.Split(buf.String(), "\n")[0]
+	if !strings.Contains(first, `"time":"2024-05-01T12:00:00Z"`) || !strings.Contains(first, `"change":"changed"`) {
+		t.Errorf("Unexpected JSON change %q", first)
+	}
+}
+
+func TestWithinRadius(t *testing.T) {
+	antwerp := &position.Position{Latitude: 51.22, Longitude: 4.40}
+
+	mounts := withinRadius(testSourcetable(), antwerp, 100)
+	if len(mounts) != 1 || mounts[0].Name != "BRUX" {
+		t.Errorf("Expected only BRUX within 100 km, got %+v", mounts)
+	}
+}
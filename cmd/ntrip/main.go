@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/bramburn/go_ntrip/pkg/ntrip"
+	"github.com/bramburn/go_ntrip/pkg/ntrip/rtk"
 )
 
 func main() {
@@ -21,28 +22,18 @@ func main() {
 	duration := flag.Int("duration", 60, "Duration to run in seconds")
 	flag.Parse()
 
-	// Create a new NTRIP client
-	client, err := ntrip.NewClient(*ntripServer, *ntripPort, *ntripUser, *ntripPassword, *ntripMountpoint)
-	if err != nil {
-		log.Fatalf("Failed to create NTRIP client: %v", err)
-	}
-
-	// Connect to the NTRIP server
-	err = client.Connect()
-	if err != nil {
-		log.Fatalf("Failed to connect to NTRIP server: %v", err)
-	}
-	defer client.Disconnect()
+	// Create a new NTRIP client; the RTK processor streams the corrections
+	client := ntrip.NewClient(fmt.Sprintf("http://%s:%s", *ntripServer, *ntripPort), *ntripUser, *ntripPassword, *ntripMountpoint)
 
 	// Connect to the GNSS receiver
-	receiver, err := ntrip.NewGNSSReceiver(*gnssPort)
+	receiver, err := rtk.NewGNSSReceiver(*gnssPort)
 	if err != nil {
 		log.Fatalf("Failed to connect to GNSS receiver: %v", err)
 	}
 	defer receiver.Close()
 
 	// Start the RTK processing
-	processor, err := ntrip.NewRTKProcessor(receiver, client)
+	processor, err := rtk.NewRTKProcessor(receiver, client)
 	if err != nil {
 		log.Fatalf("Failed to create RTK processor: %v", err)
 	}
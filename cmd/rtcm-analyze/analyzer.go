@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+// gapFactor is how many nominal intervals an interval must exceed to count
+// as a gap
+const gapFactor = 1.5
+
+// latencyLimit is the mean epoch-to-arrival latency above which a
+// constellation is reported. RTK degrades noticeably beyond it.
+const latencyLimit = time.Second
+
+// systemOrder is the order constellations are reported in
+var systemOrder = []string{"GPS", "GLO", "GAL", "BDS", "QZS", "SBAS", "IRN"}
+
+// analyzer accumulates the timing and content of an RTCM stream. Live
+// streams are timed by arrival. Recorded streams are timed by their
+// observation epochs, since they are read faster than they were sent, and
+// have no latency.
+type analyzer struct {
+	recorded   bool
+	first      time.Time // Time of the first timed message
+	now        time.Time // Time of the latest timed message
+	types      map[int]*typeStats
+	systems    map[string]*systemStats
+	stationIDs map[int]bool
+	station    *parser.StationARP
+	frames     parser.RTCMStats
+}
+
+// typeStats accumulates the messages of one type
+type typeStats struct {
+	count     int
+	errors    int           // Messages that could not be decoded
+	last      time.Time     // Arrival of the latest message, or epoch of the latest observations
+	epoch     time.Time     // Epoch of the latest observations
+	intervals map[int64]int // Intervals between messages in milliseconds, with how often each occurred
+	longest   time.Duration
+}
+
+// systemStats accumulates the observations of one constellation
+type systemStats struct {
+	epoch      time.Time
+	satellites map[int]bool // Satellites of the latest epoch
+	seen       map[int]bool
+	signals    map[string]bool
+	latency    latencyStats
+}
+
+// latencyStats accumulates the delay from observation epoch to arrival
+type latencyStats struct {
+	count               int
+	sum, min, max, last time.Duration
+}
+
+// newAnalyzer creates an analyzer of a live or recorded stream
+func newAnalyzer(recorded bool) *analyzer {
+	return &analyzer{
+		recorded:   recorded,
+		types:      make(map[int]*typeStats),
+		systems:    make(map[string]*systemStats),
+		stationIDs: make(map[int]bool),
+	}
+}
+
+// decodable reports whether the analyzer decodes a message type
+func decodable(messageType int) bool {
+	switch messageType {
+	case 1005, 1006, 1007, 1008, 1033, 1230:
+		return true
+	}
+	return parser.IsMSM(messageType) || parser.IsLegacyObservation(messageType)
+}
+
+// add records a message that arrived at the given time
+func (a *analyzer) add(message parser.RTCMMessage, arrival time.Time) {
+	ts := a.types[message.MessageType]
+	if ts == nil {
+		ts = &typeStats{intervals: make(map[int64]int)}
+		a.types[message.MessageType] = ts
+	}
+	ts.count++
+
+	var decoded interface{}
+	if decodable(message.MessageType) {
+		var err error
+		if decoded, err = message.Decode(); err != nil {
+			decoded = nil
+			ts.errors++
+		}
+	}
+
+	at := arrival
+	if a.recorded {
+		// Messages are timed by the latest epoch before them
+		at = a.now
+	}
+	switch m := decoded.(type) {
+	case *parser.MSM:
+		a.stationIDs[m.StationID] = true
+		ref := arrival
+		if a.recorded {
+			ref = a.now
+			if ref.IsZero() {
+				ref = arrival
+			}
+		}
+		epoch := m.Time(ref)
+		if a.recorded {
+			at = epoch
+		}
+		a.addObservations(m, epoch, arrival)
+
+		// The messages of an epoch that did not fit one message follow
+		// each other and are not an interval
+		sameEpoch := epoch.Equal(ts.epoch)
+		ts.epoch = epoch
+		if sameEpoch {
+			return
+		}
+	case *parser.StationARP:
+		a.station = m
+		a.stationIDs[m.StationID] = true
+	case *parser.AntennaDescriptor:
+		a.stationIDs[m.StationID] = true
+	case *parser.ReceiverDescriptor:
+		a.stationIDs[m.StationID] = true
+	case *parser.GLONASSBiases:
+		a.stationIDs[m.StationID] = true
+	}
+
+	if at.IsZero() {
+		return
+	}
+	if !ts.last.IsZero() {
+		interval := at.Sub(ts.last)
+		ts.intervals[interval.Milliseconds()]++
+		if interval > ts.longest {
+			ts.longest = interval
+		}
+	}
+	ts.last = at
+	if a.first.IsZero() {
+		a.first = at
+	}
+	if at.After(a.now) {
+		a.now = at
+	}
+}
+
+// addObservations records the satellites, signals and latency of
+// observations
+func (a *analyzer) addObservations(m *parser.MSM, epoch, arrival time.Time) {
+	ss := a.systems[m.System]
+	if ss == nil {
+		ss = &systemStats{seen: make(map[int]bool), signals: make(map[string]bool)}
+		a.systems[m.System] = ss
+	}
+	if !epoch.Equal(ss.epoch) {
+		ss.epoch = epoch
+		ss.satellites = make(map[int]bool)
+	}
+	for _, sat := range m.Satellites {
+		ss.satellites[sat.PRN] = true
+		ss.seen[sat.PRN] = true
+		for _, sig := range sat.Signals {
+			ss.signals[sig.Code] = true
+		}
+	}
+
+	if !a.recorded {
+		ss.latency.add(arrival.Sub(epoch))
+	}
+}
+
+// add records one latency
+func (l *latencyStats) add(latency time.Duration) {
+	if l.count == 0 || latency < l.min {
+		l.min = latency
+	}
+	if l.count == 0 || latency > l.max {
+		l.max = latency
+	}
+	l.count++
+	l.sum += latency
+	l.last = latency
+}
+
+// report is the result of an analysis. Times are in seconds.
+type report struct {
+	Source         string                `json:"source"`
+	Duration       float64               `json:"duration"`
+	Frames         uint64                `json:"frames"`
+	CRCErrors      uint64                `json:"crc_errors"`
+	DiscardedBytes uint64                `json:"discarded_bytes"`
+	Messages       []messageReport       `json:"messages"`
+	Constellations []constellationReport `json:"constellations"`
+	StationIDs     []int                 `json:"station_ids"`
+	Station        *parser.StationARP    `json:"station,omitempty"`
+	Position       *position.Position    `json:"position,omitempty"` // ARP as latitude, longitude and height
+	Warnings       []string              `json:"warnings"`
+}
+
+// messageReport describes the messages of one type
+type messageReport struct {
+	Type       int     `json:"type"`
+	Count      int     `json:"count"`
+	Errors     int     `json:"decode_errors"`
+	Interval   float64 `json:"interval"`    // Median interval
+	Jitter     float64 `json:"jitter"`      // Standard deviation of the intervals outside gaps
+	Gaps       int     `json:"gaps"`        // Intervals longer than gapFactor median intervals
+	Missed     int     `json:"missed"`      // Messages the gaps are estimated to have lost
+	LongestGap float64 `json:"longest_gap"` // Longest interval
+	Age        float64 `json:"age"`         // Time since the latest message
+}
+
+// constellationReport describes the observations of one constellation
+type constellationReport struct {
+	System     string         `json:"system"`
+	Satellites int            `json:"satellites"` // In the latest epoch
+	Seen       int            `json:"satellites_seen"`
+	Signals    []string       `json:"signals"`
+	Latency    *latencyReport `json:"latency,omitempty"`
+}
+
+// latencyReport summarises the epoch-to-arrival latency
+type latencyReport struct {
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Last float64 `json:"last"`
+}
+
+// report summarises the stream at the given time and flags what would
+// degrade a rover's solution
+func (a *analyzer) report(source string, now time.Time) *report {
+	if a.recorded {
+		now = a.now
+	}
+	r := &report{
+		Source:         source,
+		Frames:         a.frames.Frames,
+		CRCErrors:      a.frames.CRCErrors,
+		DiscardedBytes: a.frames.DiscardedBytes,
+		Messages:       []messageReport{},
+		Constellations: []constellationReport{},
+		StationIDs:     []int{},
+		Station:        a.station,
+		Warnings:       []string{},
+	}
+	if !a.first.IsZero() {
+		r.Duration = now.Sub(a.first).Seconds()
+	}
+	warn := func(format string, args ...interface{}) {
+		r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	types := make([]int, 0, len(a.types))
+	for t := range a.types {
+		types = append(types, t)
+	}
+	sort.Ints(types)
+	for _, t := range types {
+		mr := a.types[t].report(t)
+		if !a.types[t].last.IsZero() {
+			mr.Age = now.Sub(a.types[t].last).Seconds()
+		}
+		r.Messages = append(r.Messages, mr)
+		if mr.Gaps > 0 {
+			warn("%d: %d gaps, about %d messages missed, longest %.1f s", t, mr.Gaps, mr.Missed, mr.LongestGap)
+		}
+		if mr.Errors > 0 {
+			warn("%d: %d messages could not be decoded", t, mr.Errors)
+		}
+	}
+
+	for _, system := range systemOrder {
+		ss := a.systems[system]
+		if ss == nil {
+			continue
+		}
+		cr := constellationReport{System: system, Satellites: len(ss.satellites), Seen: len(ss.seen), Signals: []string{}}
+		for code := range ss.signals {
+			cr.Signals = append(cr.Signals, code)
+		}
+		sort.Strings(cr.Signals)
+		if l := ss.latency; l.count > 0 {
+			mean := l.sum / time.Duration(l.count)
+			cr.Latency = &latencyReport{Mean: mean.Seconds(), Min: l.min.Seconds(), Max: l.max.Seconds(), Last: l.last.Seconds()}
+			switch {
+			case mean > latencyLimit:
+				warn("%s observations arrive %.2f s after their epoch on average", system, mean.Seconds())
+			case l.min < 0:
+				warn("%s observations arrive before their epoch; check the local clock", system)
+			}
+		}
+		r.Constellations = append(r.Constellations, cr)
+	}
+
+	for id := range a.stationIDs {
+		r.StationIDs = append(r.StationIDs, id)
+	}
+	sort.Ints(r.StationIDs)
+	if len(r.StationIDs) > 1 {
+		warn("messages carry different station IDs")
+	}
+
+	if s := a.station; s == nil {
+		warn("no 1005/1006 station position received")
+	} else if s.X == 0 && s.Y == 0 && s.Z == 0 {
+		warn("station position is 0,0,0")
+	} else {
+		lat, lon, height := position.FromECEF(s.X, s.Y, s.Z)
+		r.Position = &position.Position{Latitude: lat, Longitude: lon, Altitude: height}
+	}
+
+	if a.frames.CRCErrors > 0 {
+		warn("%d frames failed the CRC check", a.frames.CRCErrors)
+	}
+	return r
+}
+
+// report summarises the intervals of a message type. The median interval
+// is taken as nominal, so that gaps do not distort it.
+func (ts *typeStats) report(messageType int) messageReport {
+	mr := messageReport{Type: messageType, Count: ts.count, Errors: ts.errors, LongestGap: ts.longest.Seconds()}
+
+	intervals := make([]int64, 0, len(ts.intervals))
+	total := 0
+	for ms, n := range ts.intervals {
+		intervals = append(intervals, ms)
+		total += n
+	}
+	if total == 0 {
+		return mr
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+
+	var median int64
+	for i, seen := 0, 0; i < len(intervals); i++ {
+		seen += ts.intervals[intervals[i]]
+		if 2*seen >= total {
+			median = intervals[i]
+			break
+		}
+	}
+	mr.Interval = float64(median) / 1000
+
+	var n int
+	var sum, sumSq float64
+	for _, ms := range intervals {
+		count := ts.intervals[ms]
+		if median > 0 && float64(ms) > gapFactor*float64(median) {
+			mr.Gaps += count
+			mr.Missed += count * int(math.Round(float64(ms)/float64(median))-1)
+			continue
+		}
+		s := float64(ms) / 1000
+		n += count
+		sum += float64(count) * s
+		sumSq += float64(count) * s * s
+	}
+	if n > 1 {
+		mean := sum / float64(n)
+		mr.Jitter = math.Sqrt(math.Max(0, sumSq/float64(n)-mean*mean))
+	}
+	if mr.Gaps == 0 {
+		mr.LongestGap = 0
+	}
+	return mr
+}
+
+// writeReport writes the report as JSON or as tables
+func writeReport(w io.Writer, r *report, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Source:      %s (%.0f s)\n", r.Source, r.Duration)
+	fmt.Fprintf(&sb, "Frames:      %d, %d CRC errors, %d bytes discarded\n", r.Frames, r.CRCErrors, r.DiscardedBytes)
+	ids := make([]string, len(r.StationIDs))
+	for i, id := range r.StationIDs {
+		ids[i] = fmt.Sprint(id)
+	}
+	fmt.Fprintf(&sb, "Station ID:  %s\n", strings.Join(ids, ", "))
+	if r.Position != nil {
+		fmt.Fprintf(&sb, "ARP:         %.8f, %.8f, %.3f m\n", r.Position.Latitude, r.Position.Longitude, r.Position.Altitude)
+	}
+
+	sb.WriteString("\n")
+	tw := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Type\tCount\tInterval\tJitter\tGaps\tMissed\tLongest\tAge\t")
+	for _, m := range r.Messages {
+		fmt.Fprintf(tw, "%d\t%d\t%.3f\t%.3f\t%d\t%d\t%.1f\t%.1f\t\n",
+			m.Type, m.Count, m.Interval, m.Jitter, m.Gaps, m.Missed, m.LongestGap, m.Age)
+	}
+	tw.Flush()
+
+	if len(r.Constellations) > 0 {
+		sb.WriteString("\n")
+		tw = tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "GNSS\tSats\tSeen\tLatency mean/min/max\tSignals")
+		for _, c := range r.Constellations {
+			latency := "-"
+			if l := c.Latency; l != nil {
+				latency = fmt.Sprintf("%.3f/%.3f/%.3f s", l.Mean, l.Min, l.Max)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", c.System, c.Satellites, c.Seen, latency, strings.Join(c.Signals, " "))
+		}
+		tw.Flush()
+	}
+
+	if len(r.Warnings) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(&sb, "Warning:     %s\n", warning)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// start is the epoch of the first observations in the tests
+var start = time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+
+// encoded wraps an encoded payload as a received message
+func encoded(t *testing.T, payload []byte, err error) parser.RTCMMessage {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	return parser.RTCMMessage{MessageType: int(payload[0])<<4 | int(payload[1])>>4, Payload: payload, Valid: true}
+}
+
+// observations is a GPS MSM4 of station 7 at the given time. Satellites
+// are listed by PRN, each with L1 C/A and L2C.
+func observations(t *testing.T, station int, epoch time.Time, multiple bool, prns ...int) parser.RTCMMessage {
+	t.Helper()
+
+	gps := epoch.Add(parser.LeapSeconds * time.Second)
+	week := time.Date(gps.Year(), gps.Month(), gps.Day()-int(gps.Weekday()), 0, 0, 0, 0, time.UTC)
+	m := &parser.MSM{System: "GPS", StationID: station, Epoch: uint32(gps.Sub(week).Milliseconds()), MultipleMessage: multiple}
+	for _, prn := range prns {
+		sat := parser.MSMSatellite{ID: prn}
+		for _, id := range []int{2, 15} {
+			sat.Signals = append(sat.Signals, parser.MSMSignal{ID: id, PseudoRange: 21e6, HasPseudoRange: true, CNR: 45})
+		}
+		m.Satellites = append(m.Satellites, sat)
+	}
+	payload, err := parser.EncodeMSM(m, 4)
+	return encoded(t, payload, err)
+}
+
+// arp is a 1005 of station 7 in London
+func arp(t *testing.T) parser.RTCMMessage {
+	t.Helper()
+
+	payload, err := parser.EncodeStationARP(&parser.StationARP{StationID: 7, GPS: true, X: 3978667.8176, Y: -8332.9146, Z: 4968397.6747})
+	return encoded(t, payload, err)
+}
+
+// stream feeds ten seconds of 1 Hz observations, missing seconds 5 and 6,
+// and a 1005 every 4 s to an analyzer. Observations arrive latency after
+// their epoch; the first epoch is split over two messages.
+func stream(t *testing.T, a *analyzer, latency time.Duration, arrival func(time.Time) time.Time) {
+	t.Helper()
+
+	for i := 0; i < 10; i++ {
+		epoch := start.Add(time.Duration(i) * time.Second)
+		at := arrival(epoch.Add(latency))
+		switch {
+		case i == 0:
+			a.add(observations(t, 7, epoch, true, 1, 2), at)
+			a.add(observations(t, 7, epoch, false, 3), at.Add(5*time.Millisecond))
+		case i != 5 && i != 6:
+			a.add(observations(t, 7, epoch, false, 1, 2, 4), at)
+		}
+		if i%4 == 0 {
+			a.add(arp(t), at)
+		}
+	}
+}
+
+func TestAnalyzeLive(t *testing.T) {
+	a := newAnalyzer(false)
+	stream(t, a, 300*time.Millisecond, func(at time.Time) time.Time { return at })
+	r := a.report("test", start.Add(10*time.Second))
+
+	if len(r.Messages) != 2 {
+		t.Fatalf("Expected 2 message types, got %+v", r.Messages)
+	}
+	msm, station := r.Messages[1], r.Messages[0]
+	if msm.Type != 1074 || msm.Count != 9 || msm.Interval != 1 || msm.Gaps != 1 || msm.Missed != 2 || msm.LongestGap != 3 {
+		t.Errorf("Unexpected 1074 report %+v", msm)
+	}
+	if math.Abs(msm.Age-0.7) > 1e-9 {
+		t.Errorf("Expected the latest 1074 0.7 s old, got %v", msm.Age)
+	}
+	if station.Type != 1005 || station.Count != 3 || station.Interval != 4 || station.Gaps != 0 || station.Jitter != 0 {
+		t.Errorf("Unexpected 1005 report %+v", station)
+	}
+
+	if len(r.Constellations) != 1 {
+		t.Fatalf("Expected GPS only, got %+v", r.Constellations)
+	}
+	gps := r.Constellations[0]
+	if gps.System != "GPS" || gps.Satellites != 3 || gps.Seen != 4 || !reflect.DeepEqual(gps.Signals, []string{"1C", "2S"}) {
+		t.Errorf("Unexpected GPS report %+v", gps)
+	}
+	if l := gps.Latency; l == nil || math.Abs(l.Mean-0.3) > 0.001 || l.Min != 0.3 || math.Abs(l.Max-0.305) > 1e-9 {
+		t.Errorf("Unexpected latency %+v", gps.Latency)
+	}
+
+	if !reflect.DeepEqual(r.StationIDs, []int{7}) || r.Position == nil || math.Abs(r.Position.Latitude-51.5) > 0.1 {
+		t.Errorf("Unexpected station %v at %+v", r.StationIDs, r.Position)
+	}
+	if len(r.Warnings) != 1 || !strings.Contains(r.Warnings[0], "1074: 1 gaps") {
+		t.Errorf("Expected a warning about the gap, got %q", r.Warnings)
+	}
+}
+
+func TestAnalyzeRecorded(t *testing.T) {
+	// A file is read at once, so only the epochs give the timing
+	read := time.Now()
+	a := newAnalyzer(true)
+	stream(t, a, 0, func(time.Time) time.Time { return read })
+	r := a.report("test", read)
+
+	msm, station := r.Messages[1], r.Messages[0]
+	if msm.Interval != 1 || msm.Gaps != 1 || msm.Missed != 2 || msm.Age != 0 {
+		t.Errorf("Unexpected 1074 report %+v", msm)
+	}
+	if station.Count != 3 || station.Interval != 4 {
+		t.Errorf("Unexpected 1005 report %+v", station)
+	}
+	if r.Duration != 9 || r.Constellations[0].Latency != nil {
+		t.Errorf("Expected 9 s without latency, got %v and %+v", r.Duration, r.Constellations[0].Latency)
+	}
+}
+
+func TestAnalyzeWarnings(t *testing.T) {
+	a := newAnalyzer(false)
+	for i := 0; i < 3; i++ {
+		epoch := start.Add(time.Duration(i) * time.Second)
+		a.add(observations(t, 7+i%2, epoch, false, 1), epoch.Add(1500*time.Millisecond))
+	}
+	a.add(parser.RTCMMessage{MessageType: 1005, Payload: []byte{0x3E, 0xD0}}, start)
+	a.frames.CRCErrors = 2
+
+	var warnings []string
+	for _, w := range a.report("test", start).Warnings {
+		warnings = append(warnings, strings.SplitN(w, " ", 2)[1])
+	}
+	want := []string{
+		"1 messages could not be decoded",
+		"observations arrive 1.50 s after their epoch on average",
+		"carry different station IDs",
+		"1005/1006 station position received",
+		"frames failed the CRC check",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("Expected warnings %q, got %q", want, warnings)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	a := newAnalyzer(false)
+	stream(t, a, 300*time.Millisecond, func(at time.Time) time.Time { return at })
+	r := a.report("caster:2101/BASE", start.Add(10*time.Second))
+
+	var buf bytes.Buffer
+	if err := writeReport(&buf, r, "json"); err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+	var decoded report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, r) {
+		t.Errorf("Expected %+v, got %+v", r, &decoded)
+	}
+
+	buf.Reset()
+	if err := writeReport(&buf, r, "table"); err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+	for _, want := range []string{"caster:2101/BASE", "Station ID:  7", "1074", "GPS", "1C 2S", "Warning:"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/cli"
+	"github.com/bramburn/go_ntrip/internal/device"
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/port"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+func main() {
+	// Parse command line flags
+	caster := cli.RegisterClientFlags(flag.CommandLine, "Read from this NTRIP caster", "Mountpoint to analyse")
+	portName := flag.String("device", "", "Read from this serial port (e.g., COM3 or /dev/ttyUSB0)")
+	baudRate := flag.Int("baud", 38400, "Baud rate of -device")
+	input := flag.String("in", "-", "Recorded RTCM file, - for a live stream on standard input")
+	duration := flag.Duration("duration", 0, "Stop after this long, 0 to run until the stream ends or Ctrl+C")
+	output := flag.String("output", "table", "Output format (table, json)")
+	refresh := flag.Duration("refresh", time.Second, "Interval between table updates, 0 to print only the final table")
+	flag.Parse()
+
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format: %s\n", *output)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Set up signal handling for graceful shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if *duration > 0 {
+		var cancelDuration context.CancelFunc
+		ctx, cancelDuration = context.WithTimeout(ctx, *duration)
+		defer cancelDuration()
+	}
+
+	// Open the source: a mountpoint, a serial port, a file or standard input
+	var source io.ReadCloser = os.Stdin
+	name, recorded := "standard input", false
+	switch {
+	case caster.Address != "":
+		client, err := caster.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		source = ntrip.NewSession(ctx, client, ntrip.DefaultSessionConfig())
+		name = caster.String()
+	case *portName != "":
+		gnssDevice := device.NewTOPGNSSDevice(port.NewGNSSSerialPort())
+		if err := gnssDevice.Connect(*portName, *baudRate); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		source = deviceSource{gnssDevice}
+		name = fmt.Sprintf("%s at %d baud", *portName, *baudRate)
+	case *input != "-":
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		source = file
+		name, recorded = *input, true
+	}
+	defer source.Close()
+
+	// Closing the source unblocks the read on shutdown
+	go func() {
+		<-ctx.Done()
+		source.Close()
+	}()
+
+	// Frames are read in the background and stamped with their arrival
+	type arrival struct {
+		messages []parser.RTCMMessage
+		stats    parser.RTCMStats
+		at       time.Time
+	}
+	arrivals := make(chan arrival, 64)
+	go func() {
+		defer close(arrivals)
+		rtcmParser := parser.NewRTCMParser()
+		buffer := make([]byte, 4096)
+		for {
+			n, err := source.Read(buffer)
+			if n > 0 {
+				arrivals <- arrival{rtcmParser.Process(buffer[:n]), rtcmParser.Stats(), time.Now()}
+			}
+			if err != nil {
+				if ctx.Err() == nil && err != io.EOF {
+					fmt.Fprintf(os.Stderr, "Warning: stream ended: %v\n", err)
+				}
+				return
+			}
+		}
+	}()
+
+	a := newAnalyzer(recorded)
+	live := *output == "table" && *refresh > 0 && !recorded
+	var ticks <-chan time.Time
+	if live {
+		ticker := time.NewTicker(*refresh)
+		defer ticker.Stop()
+		ticks = ticker.C
+	} else {
+		fmt.Fprintf(os.Stderr, "Analysing %s...\n", name)
+	}
+
+loop:
+	for {
+		select {
+		case frames, ok := <-arrivals:
+			if !ok {
+				break loop
+			}
+			for _, message := range frames.messages {
+				a.add(message, frames.at)
+			}
+			a.frames = frames.stats
+		case <-ticks:
+			fmt.Print(clearScreen)
+			writeReport(os.Stdout, a.report(name, time.Now()), "table")
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	if live {
+		fmt.Print(clearScreen)
+	}
+	if err := writeReport(os.Stdout, a.report(name, time.Now()), *output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// deviceSource adapts a GNSS device to an io.ReadCloser
+type deviceSource struct {
+	device device.GNSSDevice
+}
+
+// Read reads raw data from the device
+func (s deviceSource) Read(p []byte) (int, error) {
+	return s.device.ReadRaw(p)
+}
+
+// Close disconnects the device
+func (s deviceSource) Close() error {
+	return s.device.Disconnect()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bramburn/go_ntrip/internal/cli"
+	"github.com/bramburn/go_ntrip/internal/pipeline"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+func main() {
+	// Parse command line flags
+	configFile := flag.String("config", "", "JSON rewrite configuration; the flags below override it")
+	allow := flag.String("allow", "", "Comma-separated message types to pass, all if empty (e.g., 1005,1077,1087)")
+	deny := flag.String("deny", "", "Comma-separated message types to drop (e.g., 4094,1013)")
+	arp := flag.String("arp", "", "Surveyed ARP written into 1005/1006 as lat,lon,height")
+	station := flag.Int("station", -1, "Reference station ID to renumber the stream to")
+	interval := flag.Int("interval", 0, "Pass only observation epochs on multiples of this many seconds")
+	convert := flag.String("convert", "", "Convert observations to msm4 or legacy (1004/1012)")
+	input := flag.String("in", "-", "Input file, - for standard input")
+	output := flag.String("out", "-", "Output file, - for standard output")
+	caster := cli.RegisterClientFlags(flag.CommandLine, "Read from this NTRIP caster instead of -in", "Mountpoint to read")
+	flag.Parse()
+
+	config := &pipeline.RewriteConfig{}
+	if *configFile != "" {
+		var err error
+		if config, err = pipeline.LoadRewriteConfig(*configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := applyFlags(config, *allow, *deny, *arp, *station, *interval); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	rewriter, err := pipeline.NewRewriter(*config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	stages := pipeline.Chain{rewriter}
+	if *convert != "" {
+		converter, err := pipeline.NewConverter(*convert)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		stages = append(stages, converter)
+	}
+
+	// Set up signal handling for graceful shutdown
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// Open the source: a mountpoint, a file or standard input
+	var source io.ReadCloser = os.Stdin
+	switch {
+	case caster.Address != "":
+		client, err := caster.NewClient()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			flag.Usage()
+			os.Exit(1)
+		}
+		source = ntrip.NewSession(ctx, client, ntrip.DefaultSessionConfig())
+	case *input != "-":
+		file, err := os.Open(*input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		source = file
+	}
+	defer source.Close()
+
+	// Closing the source unblocks the copy on shutdown
+	go func() {
+		<-ctx.Done()
+		source.Close()
+	}()
+
+	var sink io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		sink = file
+	}
+
+	_, err = io.Copy(sink, pipeline.NewReader(source, stages))
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+
+	stats := rewriter.Stats()
+	fmt.Fprintf(os.Stderr, "Frames in %d, out %d, dropped %d, rewritten %d\n",
+		stats.In, stats.Out, stats.Dropped, stats.Rewritten)
+}
+
+// applyFlags overrides the configuration with the flags that were set
+func applyFlags(config *pipeline.RewriteConfig, allow, deny, arp string, station, interval int) error {
+	var err error
+	if allow != "" {
+		if config.Allow, err = parseTypes(allow); err != nil {
+			return fmt.Errorf("-allow: %v", err)
+		}
+	}
+	if deny != "" {
+		if config.Deny, err = parseTypes(deny); err != nil {
+			return fmt.Errorf("-deny: %v", err)
+		}
+	}
+	if arp != "" {
+		fields := strings.Split(arp, ",")
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			if values[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+				break
+			}
+		}
+		if len(fields) != 3 || err != nil {
+			return fmt.Errorf("-arp: expected lat,lon,height, got %q", arp)
+		}
+		config.ARP = &pipeline.ARPConfig{Latitude: values[0], Longitude: values[1], Height: values[2]}
+	}
+	if station >= 0 {
+		config.StationID = &station
+	}
+	if interval > 0 {
+		config.ObservationInterval = interval
+	}
+	return config.Validate()
+}
+
+// parseTypes parses a comma-separated list of message types
+func parseTypes(list string) ([]int, error) {
+	var types []int
+	for _, field := range strings.Split(list, ",") {
+		t, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid message type %q", field)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
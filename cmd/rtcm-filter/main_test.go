@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/pipeline"
+)
+
+func TestApplyFlags(t *testing.T) {
+	config := &pipeline.RewriteConfig{Deny: []int{4094}, ObservationInterval: 5}
+	if err := applyFlags(config, "1005, 1077", "", "51.5,-0.12,45", 12, 0); err != nil {
+		t.Fatalf("applyFlags failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(config.Allow, []int{1005, 1077}) || !reflect.DeepEqual(config.Deny, []int{4094}) {
+		t.Errorf("Unexpected types %v, %v", config.Allow, config.Deny)
+	}
+	if config.ARP == nil || config.ARP.Latitude != 51.5 || config.ARP.Longitude != -0.12 || config.ARP.Height != 45 {
+		t.Errorf("Unexpected ARP %+v", config.ARP)
+	}
+	if config.StationID == nil || *config.StationID != 12 || config.ObservationInterval != 5 {
+		t.Errorf("Unexpected station %v and interval %d", config.StationID, config.ObservationInterval)
+	}
+
+	for _, tt := range []struct {
+		allow, arp string
+		station    int
+		interval   int
+	}{
+		{allow: "1005,x", station: -1},
+		{arp: "51.5,-0.12", station: -1},
+		{station: 5000},
+		{station: -1, interval: 7},
+	} {
+		if err := applyFlags(&pipeline.RewriteConfig{}, tt.allow, "", tt.arp, tt.station, tt.interval); err == nil {
+			t.Errorf("Expected an error for %+v", tt)
+		}
+	}
+}
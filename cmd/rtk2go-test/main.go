@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/bramburn/go_ntrip/pkg/ntrip"
+	"github.com/bramburn/go_ntrip/pkg/ntrip/rtk"
 )
 
 // RTK status constants
@@ -151,13 +152,13 @@ func main() {
 	// Start the RTK processor
 	consoleLogger.Println("Starting RTK processor...")
 
-	// Create a ntrip.GNSSReceiver for the RTK processor
-	ntripReceiver, err := ntrip.NewGNSSReceiver(*gnssPort)
+	// Create an rtk.GNSSReceiver for the RTK processor
+	ntripReceiver, err := rtk.NewGNSSReceiver(*gnssPort)
 	if err != nil {
 		consoleLogger.Fatalf("Failed to create NTRIP receiver: %v", err)
 	}
 
-	rtkProcessor, err := ntrip.NewRTKProcessor(ntripReceiver, ntripClient)
+	rtkProcessor, err := rtk.NewRTKProcessor(ntripReceiver, ntripClient)
 	if err != nil {
 		consoleLogger.Fatalf("Failed to create RTK processor: %v", err)
 	}
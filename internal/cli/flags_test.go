@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+func TestClientFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := RegisterClientFlags(fs, "Caster", "Mountpoint")
+	err := fs.Parse([]string{"-address", "caster.example", "-port", "443", "-user", "rover", "-pass", "secret",
+		"-mount", "BASE", "-protocol", "rev1", "-tls", "-proxy", "socks5://proxy:1080"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	client, err := f.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if client.URL != "ntrips://caster.example:443" || client.Username != "rover" || client.Password != "secret" ||
+		client.Mountpoint != "BASE" || client.Protocol != ntrip.ProtocolRev1 || client.Proxy != "socks5://proxy:1080" || client.TLSConfig == nil {
+		t.Errorf("Unexpected client %+v", client)
+	}
+	if f.String() != "caster.example:443/BASE" {
+		t.Errorf("Unexpected name %s", f)
+	}
+}
+
+func TestClientFlagsErrors(t *testing.T) {
+	tests := map[string][]string{
+		"no address":       {"-mount", "BASE"},
+		"no mountpoint":    {"-address", "caster.example"},
+		"unknown protocol": {"-address", "caster.example", "-mount", "BASE", "-protocol", "rev3"},
+		"missing CA file":  {"-address", "caster.example", "-mount", "BASE", "-ca", "missing.pem"},
+	}
+	for name, args := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		f := RegisterClientFlags(fs, "", "")
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("%s: Parse failed: %v", name, err)
+		}
+		if _, err := f.NewClient(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
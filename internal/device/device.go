@@ -67,6 +67,26 @@ type DataHandler interface {
 	HandleUBX(message parser.UBXMessage)
 }
 
+// SentenceHandler is a DataHandler that passes each raw NMEA sentence to a
+// function, such as the Update method of an ntrip.RoverGGA
+type SentenceHandler func(sentence string)
+
+// HandleNMEA passes the sentence on as received, so that the receiving
+// function can check its checksum
+func (h SentenceHandler) HandleNMEA(sentence parser.NMEASentence) {
+	h(sentence.Raw)
+}
+
+// HandleRTCM handles RTCM messages
+func (h SentenceHandler) HandleRTCM(message parser.RTCMMessage) {
+	// Not used for NMEA sentences
+}
+
+// HandleUBX handles UBX messages
+func (h SentenceHandler) HandleUBX(message parser.UBXMessage) {
+	// Not used for NMEA sentences
+}
+
 // MonitorConfig holds configuration for monitoring
 type MonitorConfig struct {
 	Protocol     string        // Protocol to monitor (NMEA, RTCM, UBX)
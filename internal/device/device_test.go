@@ -0,0 +1,28 @@
+package device_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/device"
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+func TestSentenceHandlerKeepsChecksum(t *testing.T) {
+	rover := ntrip.NewRoverGGA(time.Minute)
+	handler := device.SentenceHandler(rover.Update)
+	nmeaParser := parser.NewNMEAParser()
+
+	// A GGA corrupted on the serial line (545.4 m read as 548.4 m) keeps
+	// its original checksum and must be rejected
+	handler.HandleNMEA(nmeaParser.Parse("$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,548.4,M,46.9,M,,*59"))
+	if gga, err := rover.GGA(); err == nil {
+		t.Fatalf("Expected corrupted GGA to be rejected, got %s", gga)
+	}
+
+	handler.HandleNMEA(nmeaParser.Parse("$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*59"))
+	if _, err := rover.GGA(); err != nil {
+		t.Errorf("Expected valid GGA to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package ephemeris
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// gpsEpoch is the start of GPS week 0
+var gpsEpoch = time.Date(1980, 1, 6, 0, 0, 0, 0, time.UTC)
+
+const week = 7 * 24 * time.Hour
+
+// validity is how long either side of its reference time a broadcast
+// ephemeris may be used, per GNSS
+var validity = map[string]time.Duration{
+	"GPS": 2 * time.Hour,
+	"QZS": 2 * time.Hour,
+	"GAL": 4 * time.Hour,
+	"BDS": 6 * time.Hour,
+	"GLO": 30 * time.Minute,
+}
+
+// prefixes are the RINEX letters of each GNSS
+var prefixes = map[string]string{"GPS": "G", "GLO": "R", "GAL": "E", "QZS": "J", "BDS": "C"}
+
+// Satellite identifies a satellite by GNSS and PRN, or slot for GLONASS
+type Satellite struct {
+	System string // "GPS", "GLO", "GAL", "QZS" or "BDS"
+	PRN    int
+}
+
+// String returns the RINEX name of the satellite, e.g. "G05" or "J01"
+func (s Satellite) String() string {
+	prn := s.PRN
+	if s.System == "QZS" {
+		prn -= 192
+	}
+	return fmt.Sprintf("%s%02d", prefixes[s.System], prn)
+}
+
+// State is the position, velocity and clock of a satellite at an instant
+type State struct {
+	Position   [3]float64 // ECEF in metres
+	Velocity   [3]float64 // ECEF in m/s
+	ClockBias  float64    // Satellite clock offset from system time in seconds
+	ClockDrift float64    // s/s
+}
+
+// Ephemeris is a broadcast ephemeris placed in time. The times of the
+// broadcast messages only give the week or the day they fall in, so they
+// are resolved against the time the message was received.
+type Ephemeris struct {
+	Satellite Satellite
+	IOD       int       // IODE, Galileo IODnav, BeiDou AODE; tb in 15 minute units for GLONASS
+	Reference time.Time // toe, or tb for GLONASS, in UTC
+	From      time.Time // Start of the validity window
+	To        time.Time // End of the validity window
+	Healthy   bool
+
+	kepler  *parser.Ephemeris
+	glonass *parser.GLONASSEphemeris
+	toc     time.Time // Clock reference time in UTC
+}
+
+// New places a decoded 1019, 1020, 1042, 1044, 1045 or 1046 in time. ref
+// is when the message was received and needs only be within a few days.
+func New(decoded interface{}, ref time.Time) (*Ephemeris, error) {
+	ref = ref.UTC()
+
+	var e *Ephemeris
+	switch eph := decoded.(type) {
+	case *parser.Ephemeris:
+		e = &Ephemeris{
+			Satellite: Satellite{System: eph.System, PRN: eph.PRN},
+			IOD:       eph.IODE,
+			Healthy:   eph.Health == 0,
+			kepler:    eph,
+		}
+		start := weekStart(eph.System, eph.Week, ref)
+		e.Reference = nearWeek(start.Add(seconds(eph.Toe)), ref)
+		e.toc = nearWeek(start.Add(seconds(eph.Toc)), e.Reference)
+	case *parser.GLONASSEphemeris:
+		e = &Ephemeris{
+			Satellite: Satellite{System: "GLO", PRN: eph.Slot},
+			IOD:       eph.Tb / 900,
+			Healthy:   eph.Health == 0,
+			glonass:   eph,
+		}
+		// GLONASS time is UTC(SU) + 3 h and tb is the time of day
+		offset := 3 * time.Hour
+		moscow := ref.Add(offset)
+		day := time.Date(moscow.Year(), moscow.Month(), moscow.Day(), 0, 0, 0, 0, time.UTC)
+		tb := day.Add(time.Duration(eph.Tb) * time.Second)
+		if diff := tb.Sub(moscow); diff > 12*time.Hour {
+			tb = tb.AddDate(0, 0, -1)
+		} else if diff < -12*time.Hour {
+			tb = tb.AddDate(0, 0, 1)
+		}
+		e.Reference = tb.Add(-offset)
+		e.toc = e.Reference
+	default:
+		return nil, fmt.Errorf("not an ephemeris: %T", decoded)
+	}
+
+	window := validity[e.Satellite.System]
+	if e.kepler != nil && e.kepler.FitInterval {
+		window *= 2
+	}
+	e.From = e.Reference.Add(-window)
+	e.To = e.Reference.Add(window)
+	return e, nil
+}
+
+// Valid reports whether t is within the validity window
+func (e *Ephemeris) Valid(t time.Time) bool {
+	return !t.Before(e.From) && !t.After(e.To)
+}
+
+// State computes the satellite position, velocity and clock at t
+func (e *Ephemeris) State(t time.Time) State {
+	if e.glonass != nil {
+		return glonassState(e.glonass, t.Sub(e.Reference).Seconds())
+	}
+	return keplerState(e.kepler, t.Sub(e.Reference).Seconds(), t.Sub(e.toc).Seconds())
+}
+
+// weekStart returns the UTC time at which a broadcast week of a GNSS
+// started, resolving the GPS and QZSS 1024 week rollover against ref
+func weekStart(system string, w int, ref time.Time) time.Time {
+	// Galileo and BeiDou time are GPS time with a week offset; BeiDou
+	// time is also 14 s behind
+	offset := -parser.LeapSeconds * time.Second
+	switch system {
+	case "GAL":
+		w += 1024
+	case "BDS":
+		w += 1356
+		offset += 14 * time.Second
+	default:
+		current := int(ref.Sub(gpsEpoch) / week)
+		w += (current - w + 512) / 1024 * 1024
+	}
+	return gpsEpoch.Add(time.Duration(w)*week + offset)
+}
+
+// nearWeek moves t by whole weeks to within half a week of ref. A time of
+// week just after midnight on Sunday can belong to the week after the
+// broadcast week number.
+func nearWeek(t, ref time.Time) time.Time {
+	if diff := t.Sub(ref); diff > week/2 {
+		return t.Add(-week)
+	} else if diff < -week/2 {
+		return t.Add(week)
+	}
+	return t
+}
+
+// seconds converts seconds to a duration
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,192 @@
+package ephemeris
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// circular returns a GPS ephemeris of an unperturbed circular orbit
+// crossing its highest latitude at toe
+func circular(prn, iode int, toe float64) *parser.Ephemeris {
+	return &parser.Ephemeris{
+		MessageType: 1019,
+		System:      "GPS",
+		PRN:         prn,
+		Week:        2345 % 1024,
+		IODE:        iode,
+		Toe:         toe,
+		Toc:         toe,
+		SqrtA:       math.Sqrt(26560e3),
+		I0:          55 * math.Pi / 180,
+		M0:          math.Pi / 2,
+	}
+}
+
+func norm(v [3]float64) float64 {
+	return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+}
+
+func TestWeekResolution(t *testing.T) {
+	// GPS week 2345 started on 2024-12-15; the broadcast week is modulo 1024
+	ref := time.Date(2024, 12, 17, 12, 0, 0, 0, time.UTC)
+	e, err := New(circular(1, 10, 2*86400), ref)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	want := time.Date(2024, 12, 17, 0, 0, 0, 0, time.UTC).Add(-parser.LeapSeconds * time.Second)
+	if !e.Reference.Equal(want) {
+		t.Errorf("Expected toe %v, got %v", want, e.Reference)
+	}
+	if !e.From.Equal(want.Add(-2*time.Hour)) || !e.To.Equal(want.Add(2*time.Hour)) {
+		t.Errorf("Unexpected validity window %v to %v", e.From, e.To)
+	}
+	if e.Satellite.String() != "G01" || e.IOD != 10 || !e.Healthy {
+		t.Errorf("Unexpected ephemeris %+v", e)
+	}
+
+	// A toe at the start of the next week belongs after the broadcast week
+	e, _ = New(circular(1, 11, 0), time.Date(2024, 12, 21, 23, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 12, 22, 0, 0, 0, 0, time.UTC).Add(-parser.LeapSeconds * time.Second); !e.Reference.Equal(want) {
+		t.Errorf("Expected toe %v, got %v", want, e.Reference)
+	}
+
+	// Galileo weeks count from GPS week 1024, BeiDou weeks from 1356 and
+	// BeiDou time is 14 s behind GPS time
+	gal := circular(1, 1, 0)
+	gal.System, gal.Week = "GAL", 2345-1024
+	if e, _ := New(gal, ref); !e.Reference.Equal(time.Date(2024, 12, 15, 0, 0, -parser.LeapSeconds, 0, time.UTC)) {
+		t.Errorf("Unexpected Galileo toe %v", e.Reference)
+	}
+	bds := circular(1, 1, 0)
+	bds.System, bds.Week = "BDS", 2345-1356
+	if e, _ := New(bds, ref); !e.Reference.Equal(time.Date(2024, 12, 15, 0, 0, 14-parser.LeapSeconds, 0, time.UTC)) {
+		t.Errorf("Unexpected BeiDou toe %v", e.Reference)
+	}
+}
+
+func TestKeplerState(t *testing.T) {
+	ref := time.Date(2024, 12, 17, 12, 0, 0, 0, time.UTC)
+	eph := circular(1, 10, 2*86400)
+	eph.Af0, eph.Af1, eph.Af2 = 1e-4, 1e-11, 1e-18
+	e, _ := New(eph, ref)
+
+	// At toe the satellite is at its highest latitude
+	state := e.State(e.Reference)
+	if r := norm(state.Position); math.Abs(r-26560e3) > 1e-3 {
+		t.Errorf("Expected radius 26560 km, got %.3f m", r)
+	}
+	if z := 26560e3 * math.Sin(eph.I0); math.Abs(state.Position[2]-z) > 1e-3 {
+		t.Errorf("Expected z %.3f, got %.3f", z, state.Position[2])
+	}
+
+	// The inertial velocity of a circular orbit is sqrt(GM/a)
+	for _, offset := range []time.Duration{0, 20 * time.Minute, -90 * time.Minute} {
+		state := e.State(e.Reference.Add(offset))
+		p, v := state.Position, state.Velocity
+		inertial := [3]float64{v[0] - 7.2921151467e-5*p[1], v[1] + 7.2921151467e-5*p[0], v[2]}
+		if want := math.Sqrt(3.986005e14 / 26560e3); math.Abs(norm(inertial)-want) > 0.01 {
+			t.Errorf("At %v expected inertial speed %.3f, got %.3f", offset, want, norm(inertial))
+		}
+		if r := norm(p); math.Abs(r-26560e3) > 1e-3 {
+			t.Errorf("At %v expected radius 26560 km, got %.3f m", offset, r)
+		}
+	}
+
+	// Without eccentricity the clock is the polynomial alone
+	state = e.State(e.Reference.Add(100 * time.Second))
+	if want := 1e-4 + 1e-11*100 + 1e-18*100*100; math.Abs(state.ClockBias-want) > 1e-15 {
+		t.Errorf("Expected clock bias %g, got %g", want, state.ClockBias)
+	}
+	if want := 1e-11 + 2e-18*100; math.Abs(state.ClockDrift-want) > 1e-20 {
+		t.Errorf("Expected clock drift %g, got %g", want, state.ClockDrift)
+	}
+}
+
+func TestBeiDouGEO(t *testing.T) {
+	// A geostationary orbit stays over the same point
+	ref := time.Date(2024, 12, 17, 12, 0, 0, 0, time.UTC)
+	eph := &parser.Ephemeris{
+		MessageType: 1042,
+		System:      "BDS",
+		PRN:         3,
+		Week:        2345 - 1356,
+		Toe:         2 * 86400,
+		Toc:         2 * 86400,
+		SqrtA:       math.Sqrt(math.Cbrt(3.986004418e14 / (7.292115e-5 * 7.292115e-5))),
+		I0:          -5 * math.Pi / 180, // Cancels the tilt of the GEO frame
+		Omega0:      7.292115e-5 * 2 * 86400,
+	}
+	e, _ := New(eph, ref)
+
+	start := e.State(e.Reference)
+	later := e.State(e.Reference.Add(time.Hour))
+	if z := start.Position[2]; math.Abs(z) > 1 {
+		t.Errorf("Expected an equatorial position, got z %.3f", z)
+	}
+	for i := range start.Position {
+		if math.Abs(later.Position[i]-start.Position[i]) > 1 {
+			t.Errorf("Expected a fixed position, moved from %v to %v", start.Position, later.Position)
+			break
+		}
+	}
+}
+
+func TestGLONASSState(t *testing.T) {
+	// A circular orbit given as an ECEF state vector at tb, 12:00 Moscow time
+	radius := 25510e3
+	inclination := 64.8 * math.Pi / 180
+	speed := math.Sqrt(glonassGM / radius)
+	eph := &parser.GLONASSEphemeris{
+		Slot:     4,
+		Tb:       12 * 3600,
+		Position: [3]float64{radius, 0, 0},
+		Velocity: [3]float64{0, speed*math.Cos(inclination) - glonassRotation*radius, speed * math.Sin(inclination)},
+		TauN:     2e-5,
+		GammaN:   1e-12,
+	}
+	e, err := New(eph, time.Date(2024, 12, 17, 8, 50, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if want := time.Date(2024, 12, 17, 9, 0, 0, 0, time.UTC); !e.Reference.Equal(want) {
+		t.Errorf("Expected tb %v, got %v", want, e.Reference)
+	}
+	if e.Satellite.String() != "R04" || e.IOD != 48 {
+		t.Errorf("Unexpected ephemeris %+v", e)
+	}
+
+	state := e.State(e.Reference)
+	if state.Position != eph.Position || state.Velocity != eph.Velocity {
+		t.Errorf("Expected the broadcast state at tb, got %+v", state)
+	}
+
+	// J2 moves the orbit by kilometres, not tens of kilometres, in 15 minutes
+	for _, offset := range []time.Duration{15 * time.Minute, -15 * time.Minute, 1234 * time.Second} {
+		state := e.State(e.Reference.Add(offset))
+		if r := norm(state.Position); math.Abs(r-radius) > 10e3 {
+			t.Errorf("At %v expected radius near %.0f, got %.0f", offset, radius, r)
+		}
+		if z := state.Position[2]; offset > 0 && z <= 0 || offset < 0 && z >= 0 {
+			t.Errorf("At %v the satellite moved the wrong way: z %.0f", offset, z)
+		}
+	}
+
+	// Integrating out and back returns to the broadcast state
+	out := e.State(e.Reference.Add(15 * time.Minute))
+	back := glonassState(&parser.GLONASSEphemeris{Position: out.Position, Velocity: out.Velocity}, -900)
+	for i := range back.Position {
+		if math.Abs(back.Position[i]-eph.Position[i]) > 1e-3 {
+			t.Errorf("Expected to return to %v, got %v", eph.Position, back.Position)
+			break
+		}
+	}
+
+	state = e.State(e.Reference.Add(100 * time.Second))
+	if want := -2e-5 + 1e-12*100; math.Abs(state.ClockBias-want) > 1e-18 {
+		t.Errorf("Expected clock bias %g, got %g", want, state.ClockBias)
+	}
+}
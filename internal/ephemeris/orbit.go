@@ -0,0 +1,167 @@
+package ephemeris
+
+import (
+	"math"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Earth constants each GNSS defines its orbits with
+var (
+	gravitational = map[string]float64{"GPS": 3.986005e14, "QZS": 3.986005e14, "GAL": 3.986004418e14, "BDS": 3.986004418e14}
+	earthRotation = map[string]float64{"GPS": 7.2921151467e-5, "QZS": 7.2921151467e-5, "GAL": 7.2921151467e-5, "BDS": 7.292115e-5}
+)
+
+// PZ-90 constants of the GLONASS orbit model
+const (
+	glonassGM       = 3.9860044e14
+	glonassJ2       = 1.0826257e-3
+	glonassRadius   = 6378136.0
+	glonassRotation = 7.292115e-5
+	glonassStep     = 60.0 // Integration step in seconds
+)
+
+// velocityStep is the time either side of an epoch used to difference
+// Keplerian positions into a velocity, in seconds
+const velocityStep = 0.001
+
+// keplerState evaluates a GPS, Galileo, BeiDou or QZSS ephemeris tk
+// seconds after toe and dt seconds after toc, following IS-GPS-200 with
+// the BeiDou GEO rotation of the BDS ICD
+func keplerState(eph *parser.Ephemeris, tk, dt float64) State {
+	position, eccentric := keplerPosition(eph, tk)
+	before, _ := keplerPosition(eph, tk-velocityStep)
+	after, _ := keplerPosition(eph, tk+velocityStep)
+
+	state := State{Position: position}
+	for i := range state.Velocity {
+		state.Velocity[i] = (after[i] - before[i]) / (2 * velocityStep)
+	}
+
+	// Clock polynomial with the relativistic correction for eccentricity
+	gm := gravitational[eph.System]
+	relativistic := -2 * math.Sqrt(gm) / (parser.SpeedOfLight * parser.SpeedOfLight) * eph.E * eph.SqrtA * math.Sin(eccentric)
+	state.ClockBias = eph.Af0 + eph.Af1*dt + eph.Af2*dt*dt + relativistic
+	state.ClockDrift = eph.Af1 + 2*eph.Af2*dt
+	return state
+}
+
+// keplerPosition returns the ECEF position tk seconds after toe and the
+// eccentric anomaly
+func keplerPosition(eph *parser.Ephemeris, tk float64) ([3]float64, float64) {
+	gm := gravitational[eph.System]
+	omegaE := earthRotation[eph.System]
+
+	a := eph.SqrtA * eph.SqrtA
+	n := math.Sqrt(gm/(a*a*a)) + eph.DeltaN
+	m := eph.M0 + n*tk
+
+	// Solve Kepler's equation for the eccentric anomaly
+	e := m
+	for i := 0; i < 30; i++ {
+		delta := (e - eph.E*math.Sin(e) - m) / (1 - eph.E*math.Cos(e))
+		e -= delta
+		if math.Abs(delta) < 1e-14 {
+			break
+		}
+	}
+
+	v := math.Atan2(math.Sqrt(1-eph.E*eph.E)*math.Sin(e), math.Cos(e)-eph.E)
+	phi := v + eph.Omega
+	sin2, cos2 := math.Sin(2*phi), math.Cos(2*phi)
+	u := phi + eph.Cus*sin2 + eph.Cuc*cos2
+	r := a*(1-eph.E*math.Cos(e)) + eph.Crs*sin2 + eph.Crc*cos2
+	i := eph.I0 + eph.IDot*tk + eph.Cis*sin2 + eph.Cic*cos2
+	x, y := r*math.Cos(u), r*math.Sin(u)
+
+	if eph.System == "BDS" && (eph.PRN <= 5 || eph.PRN >= 59) {
+		// GEO satellites are computed in an inertial-like frame, tilted
+		// by -5 degrees and rotated into ECEF
+		omega := eph.Omega0 + eph.OmegaDot*tk - omegaE*eph.Toe
+		xg := x*math.Cos(omega) - y*math.Cos(i)*math.Sin(omega)
+		yg := x*math.Sin(omega) + y*math.Cos(i)*math.Cos(omega)
+		zg := y * math.Sin(i)
+
+		sinTilt, cosTilt := math.Sin(-5*math.Pi/180), math.Cos(-5*math.Pi/180)
+		sinRot, cosRot := math.Sin(omegaE*tk), math.Cos(omegaE*tk)
+		return [3]float64{
+			xg*cosRot + yg*sinRot*cosTilt + zg*sinRot*sinTilt,
+			-xg*sinRot + yg*cosRot*cosTilt + zg*cosRot*sinTilt,
+			-yg*sinTilt + zg*cosTilt,
+		}, e
+	}
+
+	omega := eph.Omega0 + (eph.OmegaDot-omegaE)*tk - omegaE*eph.Toe
+	return [3]float64{
+		x*math.Cos(omega) - y*math.Cos(i)*math.Sin(omega),
+		x*math.Sin(omega) + y*math.Cos(i)*math.Cos(omega),
+		y * math.Sin(i),
+	}, e
+}
+
+// glonassState integrates a GLONASS state vector tk seconds from tb with
+// fourth order Runge-Kutta, as the GLONASS ICD prescribes
+func glonassState(eph *parser.GLONASSEphemeris, tk float64) State {
+	var x [6]float64
+	copy(x[:3], eph.Position[:])
+	copy(x[3:], eph.Velocity[:])
+
+	step := glonassStep
+	if tk < 0 {
+		step = -step
+	}
+	for remaining := tk; remaining != 0; {
+		if math.Abs(remaining) < glonassStep {
+			step = remaining
+		}
+		x = rungeKutta(x, eph.Acceleration, step)
+		remaining -= step
+	}
+
+	state := State{
+		ClockBias:  -eph.TauN + eph.GammaN*tk,
+		ClockDrift: eph.GammaN,
+	}
+	copy(state.Position[:], x[:3])
+	copy(state.Velocity[:], x[3:])
+	return state
+}
+
+// rungeKutta advances a state vector by one step
+func rungeKutta(x [6]float64, acc [3]float64, h float64) [6]float64 {
+	k1 := derivative(x, acc)
+	k2 := derivative(add(x, k1, h/2), acc)
+	k3 := derivative(add(x, k2, h/2), acc)
+	k4 := derivative(add(x, k3, h), acc)
+	for i := range x {
+		x[i] += h / 6 * (k1[i] + 2*k2[i] + 2*k3[i] + k4[i])
+	}
+	return x
+}
+
+// add returns x + h·k
+func add(x, k [6]float64, h float64) [6]float64 {
+	for i := range x {
+		x[i] += h * k[i]
+	}
+	return x
+}
+
+// derivative gives the rate of change of a GLONASS state vector in the
+// rotating PZ-90 frame, with the J2 term and lunisolar acceleration
+func derivative(x [6]float64, acc [3]float64) [6]float64 {
+	r2 := x[0]*x[0] + x[1]*x[1] + x[2]*x[2]
+	r3 := r2 * math.Sqrt(r2)
+	omega2 := glonassRotation * glonassRotation
+
+	a := 1.5 * glonassJ2 * glonassGM * glonassRadius * glonassRadius / r2 / r3
+	b := 5 * x[2] * x[2] / r2
+	c := -glonassGM/r3 - a*(1-b)
+
+	return [6]float64{
+		x[3], x[4], x[5],
+		(c+omega2)*x[0] + 2*glonassRotation*x[4] + acc[0],
+		(c+omega2)*x[1] - 2*glonassRotation*x[3] + acc[1],
+		(c-2*a)*x[2] + acc[2],
+	}
+}
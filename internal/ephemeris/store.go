@@ -0,0 +1,142 @@
+package ephemeris
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// ErrNoEphemeris is returned when no valid ephemeris is known for a
+// satellite at the requested time
+var ErrNoEphemeris = errors.New("no valid ephemeris")
+
+// Store keeps the broadcast ephemerides of every satellite, keyed by
+// satellite and issue of data. It is safe for concurrent use.
+type Store struct {
+	mutex       sync.RWMutex
+	ephemerides map[Satellite]map[int]*Ephemeris
+}
+
+// NewStore creates an empty ephemeris store
+func NewStore() *Store {
+	return &Store{ephemerides: make(map[Satellite]map[int]*Ephemeris)}
+}
+
+// Add stores an ephemeris, replacing one with the same issue of data, and
+// drops the satellite's ephemerides that are no longer valid at its
+// reference time. It reports whether the ephemeris was new.
+func (s *Store) Add(e *Ephemeris) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	byIOD, ok := s.ephemerides[e.Satellite]
+	if !ok {
+		byIOD = make(map[int]*Ephemeris)
+		s.ephemerides[e.Satellite] = byIOD
+	}
+
+	for iod, old := range byIOD {
+		if !old.Valid(e.Reference) {
+			delete(byIOD, iod)
+		}
+	}
+
+	old, ok := byIOD[e.IOD]
+	byIOD[e.IOD] = e
+	return !ok || !old.Reference.Equal(e.Reference)
+}
+
+// AddMessage decodes an ephemeris message received at ref and stores it.
+// It reports whether the ephemeris was new.
+func (s *Store) AddMessage(message parser.RTCMMessage, ref time.Time) (bool, error) {
+	decoded, err := message.Decode()
+	if err != nil {
+		return false, err
+	}
+	e, err := New(decoded, ref)
+	if err != nil {
+		return false, err
+	}
+	return s.Add(e), nil
+}
+
+// Get returns the valid ephemeris of a satellite whose reference time is
+// closest to t
+func (s *Store) Get(sat Satellite, t time.Time) (*Ephemeris, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var best *Ephemeris
+	var bestDistance time.Duration
+	for _, e := range s.ephemerides[sat] {
+		if !e.Valid(t) {
+			continue
+		}
+		distance := t.Sub(e.Reference)
+		if distance < 0 {
+			distance = -distance
+		}
+		if best == nil || distance < bestDistance {
+			best, bestDistance = e, distance
+		}
+	}
+	return best, best != nil
+}
+
+// State computes the position, velocity and clock of a satellite at t
+func (s *Store) State(sat Satellite, t time.Time) (State, error) {
+	e, ok := s.Get(sat, t)
+	if !ok {
+		return State{}, ErrNoEphemeris
+	}
+	return e.State(t), nil
+}
+
+// Satellites lists the satellites with a valid ephemeris at t, ordered by
+// GNSS and PRN
+func (s *Store) Satellites(t time.Time) []Satellite {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var satellites []Satellite
+	for sat, byIOD := range s.ephemerides {
+		for _, e := range byIOD {
+			if e.Valid(t) {
+				satellites = append(satellites, sat)
+				break
+			}
+		}
+	}
+
+	sort.Slice(satellites, func(i, j int) bool {
+		if satellites[i].System != satellites[j].System {
+			return satellites[i].System < satellites[j].System
+		}
+		return satellites[i].PRN < satellites[j].PRN
+	})
+	return satellites
+}
+
+// Prune removes the ephemerides whose validity ended before t and returns
+// how many were removed
+func (s *Store) Prune(t time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	removed := 0
+	for sat, byIOD := range s.ephemerides {
+		for iod, e := range byIOD {
+			if e.To.Before(t) {
+				delete(byIOD, iod)
+				removed++
+			}
+		}
+		if len(byIOD) == 0 {
+			delete(s.ephemerides, sat)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,69 @@
+package ephemeris
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+func TestStore(t *testing.T) {
+	ref := time.Date(2024, 12, 17, 12, 0, 0, 0, time.UTC)
+	store := NewStore()
+	g01 := Satellite{System: "GPS", PRN: 1}
+
+	// toe 00:00 and 02:00 GPS time on the 17th
+	first, _ := New(circular(1, 10, 2*86400), ref)
+	second, _ := New(circular(1, 11, 2*86400+7200), ref)
+	if !store.Add(first) || !store.Add(second) {
+		t.Fatal("Expected both ephemerides to be new")
+	}
+
+	// The same issue of data again is not new
+	again, _ := New(circular(1, 11, 2*86400+7200), ref)
+	if store.Add(again) {
+		t.Error("Expected a repeated ephemeris not to be new")
+	}
+
+	if e, ok := store.Get(g01, first.Reference.Add(30*time.Minute)); !ok || e.IOD != 10 {
+		t.Errorf("Expected IOD 10 half an hour after its toe, got %+v", e)
+	}
+	if e, ok := store.Get(g01, second.Reference.Add(-30*time.Minute)); !ok || e.IOD != 11 {
+		t.Errorf("Expected IOD 11 half an hour before its toe, got %+v", e)
+	}
+	if _, err := store.State(g01, second.Reference.Add(3*time.Hour)); !errors.Is(err, ErrNoEphemeris) {
+		t.Errorf("Expected no ephemeris after the window, got %v", err)
+	}
+	if _, err := store.State(Satellite{System: "GAL", PRN: 1}, ref); !errors.Is(err, ErrNoEphemeris) {
+		t.Errorf("Expected no ephemeris for an unknown satellite, got %v", err)
+	}
+
+	// tb 09:00 Moscow time is 06:00 UTC
+	glo, _ := New(&parser.GLONASSEphemeris{Slot: 7, Tb: 9 * 3600, Position: [3]float64{25510e3, 0, 0}}, ref)
+	store.Add(glo)
+	satellites := store.Satellites(first.Reference)
+	if len(satellites) != 1 || satellites[0] != g01 {
+		t.Errorf("Expected only G01 at the first toe, got %v", satellites)
+	}
+	if satellites := store.Satellites(glo.Reference); len(satellites) != 1 || satellites[0].String() != "R07" {
+		t.Errorf("Expected only R07 at tb, got %v", satellites)
+	}
+
+	// A new ephemeris drops those no longer valid at its toe
+	third, _ := New(circular(1, 12, 2*86400+4*3600), ref)
+	store.Add(third)
+	if e, ok := store.Get(g01, first.Reference); ok && e.IOD == 10 {
+		t.Error("Expected IOD 10 to have been dropped")
+	}
+
+	if removed := store.Prune(third.To.Add(time.Second)); removed != 2 {
+		t.Errorf("Expected to prune 2 ephemerides, pruned %d", removed)
+	}
+	if removed := store.Prune(glo.To.Add(time.Second)); removed != 1 {
+		t.Errorf("Expected to prune 1 ephemeris, pruned %d", removed)
+	}
+	if satellites := store.Satellites(third.Reference); len(satellites) != 0 {
+		t.Errorf("Expected an empty store, got %v", satellites)
+	}
+}
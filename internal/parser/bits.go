@@ -0,0 +1,164 @@
+package parser
+
+import "errors"
+
+// ErrShortMessage is returned when a payload ends before all of its fields
+var ErrShortMessage = errors.New("message too short")
+
+// BitReader reads the big-endian bit fields of an RTCM 3 payload. Reading
+// past the end of the payload returns zero values and sets an error that
+// is reported by Err, so a message can be decoded field by field and
+// checked once.
+type BitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// NewBitReader creates a reader positioned at the first bit of data
+func NewBitReader(data []byte) *BitReader {
+	return &BitReader{data: data}
+}
+
+// Uint reads an unsigned field of up to 64 bits
+func (r *BitReader) Uint(bits int) uint64 {
+	if !r.available(bits) {
+		return 0
+	}
+
+	var value uint64
+	for i := r.pos; i < r.pos+bits; i++ {
+		value = value<<1 | uint64(r.data[i/8]>>(7-uint(i%8))&1)
+	}
+	r.pos += bits
+	return value
+}
+
+// Int reads a two's complement field of up to 64 bits
+func (r *BitReader) Int(bits int) int64 {
+	value := r.Uint(bits)
+	if bits < 64 && value&(1<<uint(bits-1)) != 0 {
+		return int64(value) - int64(1)<<uint(bits)
+	}
+	return int64(value)
+}
+
+// SignMagnitude reads a field whose first bit is the sign and whose
+// remaining bits are the magnitude, as used by the GLONASS ephemeris
+func (r *BitReader) SignMagnitude(bits int) int64 {
+	negative := r.Bool()
+	value := int64(r.Uint(bits - 1))
+	if negative {
+		return -value
+	}
+	return value
+}
+
+// Bool reads a one-bit flag
+func (r *BitReader) Bool() bool {
+	return r.Uint(1) == 1
+}
+
+// String reads a character field of n bytes
+func (r *BitReader) String(n int) string {
+	if !r.available(8 * n) {
+		return ""
+	}
+
+	chars := make([]byte, n)
+	for i := range chars {
+		chars[i] = byte(r.Uint(8))
+	}
+	return string(chars)
+}
+
+// Skip moves past bits that are not needed
+func (r *BitReader) Skip(bits int) {
+	if r.available(bits) {
+		r.pos += bits
+	}
+}
+
+// Pos returns the number of bits read so far
+func (r *BitReader) Pos() int {
+	return r.pos
+}
+
+// Err returns ErrShortMessage if a read went past the end of the payload
+func (r *BitReader) Err() error {
+	return r.err
+}
+
+// available reports whether the next bits are within the payload and
+// records an error if they are not
+func (r *BitReader) available(bits int) bool {
+	if r.err != nil {
+		return false
+	}
+	if r.pos+bits > 8*len(r.data) {
+		r.err = ErrShortMessage
+		return false
+	}
+	return true
+}
+
+// BitWriter builds the big-endian bit fields of an RTCM 3 payload. The
+// zero value is an empty payload ready to use.
+type BitWriter struct {
+	data []byte
+	pos  int
+}
+
+// Uint appends an unsigned field of up to 64 bits
+func (w *BitWriter) Uint(bits int, value uint64) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if value>>uint(i)&1 == 1 {
+			w.data[w.pos/8] |= 1 << uint(7-w.pos%8)
+		}
+		w.pos++
+	}
+}
+
+// Int appends a two's complement field of up to 64 bits
+func (w *BitWriter) Int(bits int, value int64) {
+	w.Uint(bits, uint64(value))
+}
+
+// SignMagnitude appends a field whose first bit is the sign and whose
+// remaining bits are the magnitude
+func (w *BitWriter) SignMagnitude(bits int, value int64) {
+	w.Bool(value < 0)
+	if value < 0 {
+		value = -value
+	}
+	w.Uint(bits-1, uint64(value))
+}
+
+// Bool appends a one-bit flag
+func (w *BitWriter) Bool(value bool) {
+	if value {
+		w.Uint(1, 1)
+	} else {
+		w.Uint(1, 0)
+	}
+}
+
+// String appends the characters of s, one byte each
+func (w *BitWriter) String(s string) {
+	for i := 0; i < len(s); i++ {
+		w.Uint(8, uint64(s[i]))
+	}
+}
+
+// Pos returns the number of bits written so far
+func (w *BitWriter) Pos() int {
+	return w.pos
+}
+
+// Bytes returns the payload, padded with zero bits to a whole byte
+func (w *BitWriter) Bytes() []byte {
+	return w.data
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -10,6 +11,7 @@ type NMEASentence struct {
 	Fields   []string // Data fields
 	Valid    bool     // Whether the sentence is valid
 	Checksum string   // Checksum value
+	Raw      string   // Sentence as received, checksum unverified
 }
 
 // NMEAParser provides functionality to parse NMEA sentences
@@ -24,6 +26,7 @@ func NewNMEAParser() *NMEAParser {
 func (p *NMEAParser) Parse(sentence string) NMEASentence {
 	result := NMEASentence{
 		Valid: false,
+		Raw:   sentence,
 	}
 
 	// Check for minimum length
@@ -133,3 +136,29 @@ func (p *NMEAParser) GetFixType(fixType string) string {
 		return fixType
 	}
 }
+
+// NMEAChecksum computes the NMEA checksum of a sentence as two upper-case
+// hex digits. The leading '$' and anything from '*' onwards are ignored,
+// so both the bare body and a complete sentence can be passed.
+func NMEAChecksum(sentence string) string {
+	sentence = strings.TrimPrefix(sentence, "$")
+	if idx := strings.Index(sentence, "*"); idx != -1 {
+		sentence = sentence[:idx]
+	}
+
+	var checksum byte
+	for i := 0; i < len(sentence); i++ {
+		checksum ^= sentence[i]
+	}
+
+	return fmt.Sprintf("%02X", checksum)
+}
+
+// String rebuilds the sentence text with a freshly computed checksum
+func (s NMEASentence) String() string {
+	body := s.Type
+	if len(s.Fields) > 0 {
+		body += "," + strings.Join(s.Fields, ",")
+	}
+	return "$" + body + "*" + NMEAChecksum(body)
+}
@@ -0,0 +1,328 @@
+package parser_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+func TestNMEAParser(t *testing.T) {
+	p := parser.NewNMEAParser()
+
+	// Test valid NMEA sentence
+	sentence := "$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47"
+	parsed := p.Parse(sentence)
+
+	if !parsed.Valid {
+		t.Error("Expected valid NMEA sentence, got invalid")
+	}
+
+	if parsed.Type != "GNGGA" {
+		t.Errorf("Expected type GNGGA, got %s", parsed.Type)
+	}
+
+	if len(parsed.Fields) != 14 {
+		t.Errorf("Expected 14 fields, got %d", len(parsed.Fields))
+	}
+
+	if parsed.Fields[0] != "123519" {
+		t.Errorf("Expected time 123519, got %s", parsed.Fields[0])
+	}
+
+	if parsed.Checksum != "47" {
+		t.Errorf("Expected checksum 47, got %s", parsed.Checksum)
+	}
+
+	// Test invalid NMEA sentence
+	invalidSentence := "INVALID"
+	invalidParsed := p.Parse(invalidSentence)
+
+	if invalidParsed.Valid {
+		t.Error("Expected invalid NMEA sentence, got valid")
+	}
+}
+
+func TestNMEAFormatting(t *testing.T) {
+	p := parser.NewNMEAParser()
+
+	// Test time formatting
+	time := "123519.00"
+	formattedTime := p.FormatTime(time)
+	expected := "12:35:19.00"
+
+	if formattedTime != expected {
+		t.Errorf("Expected formatted time %s, got %s", expected, formattedTime)
+	}
+
+	// Test date formatting
+	date := "230521"
+	formattedDate := p.FormatDate(date)
+	expectedDate := "23/05/2021"
+
+	if formattedDate != expectedDate {
+		t.Errorf("Expected formatted date %s, got %s", expectedDate, formattedDate)
+	}
+
+	// Test fix quality
+	quality := "1"
+	fixQuality := p.GetFixQuality(quality)
+	expectedQuality := "GPS Fix (1)"
+
+	if fixQuality != expectedQuality {
+		t.Errorf("Expected fix quality %s, got %s", expectedQuality, fixQuality)
+	}
+}
+
+func TestRTCMParser(t *testing.T) {
+	p := parser.NewRTCMParser()
+
+	// Create a simple RTCM message for testing
+	// RTCM message with preamble 0xD3, length 10, type 1074 (0x432 = 0100 0011 0010)
+	// Message type is encoded as (byte[3] << 4) | (byte[4] >> 4)
+	// So for 1074 (0x432), we need byte[3]=0x43 and byte[4]=0x20
+	data := rtcmFrame([]byte{0x43, 0x20, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08})
+
+	messages := p.Process(data)
+
+	if len(messages) != 1 {
+		t.Errorf("Expected 1 RTCM message, got %d", len(messages))
+		return
+	}
+
+	msg := messages[0]
+
+	if !msg.Valid {
+		t.Error("Expected valid RTCM message, got invalid")
+	}
+
+	if msg.MessageType != 1074 {
+		t.Errorf("Expected message type 1074, got %d", msg.MessageType)
+	}
+
+	if msg.Length != 10 {
+		t.Errorf("Expected length 10, got %d", msg.Length)
+	}
+
+	if !bytes.Equal(msg.Frame, data) {
+		t.Errorf("Expected frame %x, got %x", data, msg.Frame)
+	}
+
+	// Test message description
+	description := p.GetMessageDescription(1074)
+	expectedDesc := "GPS MSM4"
+
+	if description != expectedDesc {
+		t.Errorf("Expected description %s, got %s", expectedDesc, description)
+	}
+}
+
+// rtcmFrame wraps a payload in an RTCM 3 frame with its CRC-24Q
+func rtcmFrame(payload []byte) []byte {
+	frame := []byte{0xD3, byte(len(payload)>>8) & 0x03, byte(len(payload))}
+	frame = append(frame, payload...)
+	crc := parser.CRC24Q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// rtcmTypeFrame builds a frame of the given message type and payload length
+func rtcmTypeFrame(messageType, length int) []byte {
+	payload := make([]byte, length)
+	payload[0] = byte(messageType >> 4)
+	payload[1] = byte(messageType << 4)
+	for i := 2; i < length; i++ {
+		payload[i] = byte(i * 37)
+	}
+	return rtcmFrame(payload)
+}
+
+func TestCRC24Q(t *testing.T) {
+	// Check value of CRC-24Q (CRC-24/LTE-A)
+	if crc := parser.CRC24Q([]byte("123456789")); crc != 0xCDE703 {
+		t.Errorf("Expected 0xCDE703, got 0x%06X", crc)
+	}
+
+	// The empty frame some casters send as a keep-alive
+	keepAlive := []byte{0xD3, 0x00, 0x00, 0x47, 0xEA, 0x4B}
+	if crc := parser.CRC24Q(keepAlive[:3]); crc != 0x47EA4B {
+		t.Errorf("Expected 0x47EA4B, got 0x%06X", crc)
+	}
+	messages := parser.NewRTCMParser().Process(keepAlive)
+	if len(messages) != 1 || messages[0].Length != 0 {
+		t.Errorf("Expected one empty message, got %+v", messages)
+	}
+}
+
+func TestRTCMParserCorruption(t *testing.T) {
+	station := rtcmTypeFrame(1005, 19)
+	observations := rtcmTypeFrame(1077, 120)
+	bias := rtcmTypeFrame(1230, 8)
+
+	// flipBit corrupts one bit of a copy of the frame
+	flipBit := func(frame []byte, bit int) []byte {
+		corrupt := append([]byte(nil), frame...)
+		corrupt[bit/8] ^= 1 << (7 - bit%8)
+		return corrupt
+	}
+	concat := func(parts ...[]byte) []byte {
+		var data []byte
+		for _, part := range parts {
+			data = append(data, part...)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name      string
+		capture   []byte
+		types     []int
+		crcErrors bool
+		discarded int
+	}{
+		{
+			name:    "clean",
+			capture: concat(station, observations, bias),
+			types:   []int{1005, 1077, 1230},
+		},
+		{
+			name:      "payload bit error",
+			capture:   concat(station, flipBit(observations, 200), bias),
+			types:     []int{1005, 1230},
+			crcErrors: true,
+			discarded: len(observations),
+		},
+		{
+			name:      "CRC bit error",
+			capture:   concat(station, observations, flipBit(bias, len(bias)*8-1), station),
+			types:     []int{1005, 1077, 1005},
+			crcErrors: true,
+			discarded: len(bias),
+		},
+		{
+			// The length now claims 1023 bytes, far more than the capture
+			name:      "corrupt length",
+			capture:   concat(flipBit(station, 14), observations, bias),
+			types:     []int{1077, 1230},
+			crcErrors: true,
+			discarded: len(station),
+		},
+		{
+			name:      "shortened length",
+			capture:   concat(flipBit(observations, 17), station, bias),
+			types:     []int{1005, 1230},
+			crcErrors: true,
+			discarded: len(observations),
+		},
+		{
+			name:      "truncated frame",
+			capture:   concat(station, observations[:50], bias, station),
+			types:     []int{1005, 1230, 1005},
+			crcErrors: true,
+			discarded: 50,
+		},
+		{
+			name:      "noise with preambles",
+			capture:   concat([]byte{0xD3, 0x00, 0x05, 0xD3, 0xFF, 0x12}, station, []byte{0xD3}, bias),
+			types:     []int{1005, 1230},
+			crcErrors: true,
+			discarded: 7,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, chunk := range []int{len(tt.capture), 1, 7} {
+			t.Run(tt.name, func(t *testing.T) {
+				p := parser.NewRTCMParser()
+				var types []int
+				for i := 0; i < len(tt.capture); i += chunk {
+					end := i + chunk
+					if end > len(tt.capture) {
+						end = len(tt.capture)
+					}
+					for _, msg := range p.Process(tt.capture[i:end]) {
+						if !msg.Valid {
+							t.Errorf("Unexpected invalid frame %x", msg.Frame)
+						}
+						types = append(types, msg.MessageType)
+					}
+				}
+
+				if fmt.Sprint(types) != fmt.Sprint(tt.types) {
+					t.Errorf("Chunks of %d: expected types %v, got %v", chunk, tt.types, types)
+				}
+				stats := p.Stats()
+				if stats.Frames != uint64(len(tt.types)) || (stats.CRCErrors > 0) != tt.crcErrors || stats.DiscardedBytes != uint64(tt.discarded) {
+					t.Errorf("Chunks of %d: unexpected stats %+v", chunk, stats)
+				}
+			})
+		}
+	}
+}
+
+func TestUBXParser(t *testing.T) {
+	p := parser.NewUBXParser()
+
+	// Create a simple UBX message for testing
+	// UBX message with header 0xB5 0x62, class 0x01, ID 0x07, length 4
+	data := []byte{0xB5, 0x62, 0x01, 0x07, 0x04, 0x00, 0x01, 0x02, 0x03, 0x04, 0xAA, 0xBB}
+
+	messages := p.Process(data)
+
+	if len(messages) != 1 {
+		t.Errorf("Expected 1 UBX message, got %d", len(messages))
+		return
+	}
+
+	msg := messages[0]
+
+	if !msg.Valid {
+		t.Error("Expected valid UBX message, got invalid")
+	}
+
+	if msg.Class != 0x01 {
+		t.Errorf("Expected class 0x01, got 0x%02X", msg.Class)
+	}
+
+	if msg.ID != 0x07 {
+		t.Errorf("Expected ID 0x07, got 0x%02X", msg.ID)
+	}
+
+	if msg.Length != 4 {
+		t.Errorf("Expected length 4, got %d", msg.Length)
+	}
+
+	// Test class description
+	classDesc := p.GetClassDescription(0x01)
+	expectedClassDesc := "NAV (Navigation Results)"
+
+	if classDesc != expectedClassDesc {
+		t.Errorf("Expected class description %s, got %s", expectedClassDesc, classDesc)
+	}
+
+	// Test message description
+	msgDesc := p.GetMessageDescription(0x01, 0x07)
+	expectedMsgDesc := "NAV-PVT (Navigation Position Velocity Time Solution)"
+
+	if msgDesc != expectedMsgDesc {
+		t.Errorf("Expected message description %s, got %s", expectedMsgDesc, msgDesc)
+	}
+}
+
+func TestNMEAChecksum(t *testing.T) {
+	sentence := "$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*59"
+
+	// Body only and complete sentence give the same checksum
+	if got := parser.NMEAChecksum(sentence); got != "59" {
+		t.Errorf("Expected checksum 59, got %s", got)
+	}
+	if got := parser.NMEAChecksum("GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,"); got != "59" {
+		t.Errorf("Expected checksum 59, got %s", got)
+	}
+
+	// String rebuilds the sentence with a valid checksum
+	p := parser.NewNMEAParser()
+	if got := p.Parse(sentence).String(); got != sentence {
+		t.Errorf("Expected %s, got %s", sentence, got)
+	}
+}
@@ -1,16 +1,66 @@
 package parser
 
+import (
+	"errors"
+	"fmt"
+)
+
 // RTCMMessage represents a parsed RTCM message
 type RTCMMessage struct {
 	MessageType int    // RTCM message type
 	Length      int    // Message length
 	Payload     []byte // Message payload
+	Frame       []byte // Complete frame including preamble, length and CRC
 	Valid       bool   // Whether the message is valid
 }
 
-// RTCMParser provides functionality to parse RTCM messages
+// ErrUnsupportedMessage is returned by Decode for message types without a
+// typed decoder
+var ErrUnsupportedMessage = errors.New("unsupported message type")
+
+// Decode returns the typed content of the message: a *StationARP for
+// 1005/1006, *AntennaDescriptor for 1007/1008, *ReceiverDescriptor for
+// 1033, *GLONASSBiases for 1230 or *MSM for MSM1-MSM7
+func (m RTCMMessage) Decode() (interface{}, error) {
+	if IsMSM(m.MessageType) {
+		return DecodeMSM(m.Payload)
+	}
+
+	switch m.MessageType {
+	case 1001, 1002, 1003, 1004, 1009, 1010, 1011, 1012:
+		return DecodeLegacyObservations(m.Payload)
+	case 1005, 1006:
+		return DecodeStationARP(m.Payload)
+	case 1007, 1008:
+		return DecodeAntennaDescriptor(m.Payload)
+	case 1019, 1042, 1044, 1045, 1046:
+		return DecodeEphemeris(m.Payload)
+	case 1020:
+		return DecodeGLONASSEphemeris(m.Payload)
+	case 1033:
+		return DecodeReceiverDescriptor(m.Payload)
+	case 1230:
+		return DecodeGLONASSBiases(m.Payload)
+	default:
+		return nil, ErrUnsupportedMessage
+	}
+}
+
+// RTCMStats counts what an RTCMParser has seen
+type RTCMStats struct {
+	Frames         uint64 // Frames that passed the CRC check
+	CRCErrors      uint64 // Corrupt frames dropped
+	DiscardedBytes uint64 // Bytes skipped while searching for frames
+}
+
+// RTCMParser provides functionality to parse RTCM messages. Only frames
+// with a valid CRC-24Q are returned. After a failed check the parser
+// rescans from the byte following the rejected preamble, and it stops
+// waiting for a frame once a complete valid frame follows it, so a corrupt
+// length field cannot swallow the good frames behind it.
 type RTCMParser struct {
 	buffer []byte // Buffer to store partial messages
+	stats  RTCMStats
 }
 
 // NewRTCMParser creates a new RTCM parser
@@ -29,54 +79,146 @@ func (p *RTCMParser) Process(data []byte) []RTCMMessage {
 
 	// Process RTCM messages
 	for len(p.buffer) >= 3 {
-		// Check for RTCM signature (preamble byte 0xD3 followed by 2 bytes)
-		if p.buffer[0] == 0xD3 {
-			// Get message length from bytes 2-3 (10 bits)
-			if len(p.buffer) < 6 {
-				break // Not enough data yet
+		if !p.header(0) {
+			p.skip(1)
+			continue
+		}
+
+		totalLength := p.frameLength(0)
+		if len(p.buffer) < totalLength {
+			// A corrupt length makes a frame look longer than it is; rather
+			// than wait for it, give up on it once a complete frame follows
+			if next := p.nextFrame(); next > 0 {
+				p.stats.CRCErrors++
+				p.skip(next)
+				continue
 			}
+			break // Wait for more data
+		}
 
-			// Extract length (10 bits from bytes 1-2)
-			length := (int(p.buffer[1]&0x03) << 8) | int(p.buffer[2])
-			totalLength := length + 6 // Add header and CRC
+		if !p.checkCRC(0, totalLength) {
+			// Not a frame, or a corrupt one: resynchronise on the next preamble
+			p.stats.CRCErrors++
+			p.skip(1)
+			continue
+		}
 
-			if len(p.buffer) >= totalLength {
-				// We have a complete message
-				messageType := (int(p.buffer[3]) << 4) | (int(p.buffer[4]) >> 4)
+		length := totalLength - 6
+		message := RTCMMessage{
+			Length:  length,
+			Payload: make([]byte, length),
+			Valid:   true,
+		}
+		if length >= 2 {
+			message.MessageType = (int(p.buffer[3]) << 4) | (int(p.buffer[4]) >> 4)
+		}
 
-				// Create message
-				message := RTCMMessage{
-					MessageType: messageType,
-					Length:      length,
-					Payload:     make([]byte, length),
-					Valid:       true,
-				}
+		// Copy payload and the complete frame
+		copy(message.Payload, p.buffer[3:3+length])
+		message.Frame = append([]byte(nil), p.buffer[:totalLength]...)
+		messages = append(messages, message)
+		p.stats.Frames++
 
-				// Copy payload
-				copy(message.Payload, p.buffer[3:3+length])
+		// Remove processed message from buffer
+		p.buffer = p.buffer[totalLength:]
+	}
 
-				// Add to result
-				messages = append(messages, message)
+	return messages
+}
 
-				// Remove processed message from buffer
-				p.buffer = p.buffer[totalLength:]
-			} else {
-				break // Wait for more data
-			}
-		} else {
-			// Not an RTCM message, skip this byte
-			p.buffer = p.buffer[1:]
+// header reports whether a frame header starts at offset i: the 0xD3
+// preamble followed by 6 reserved zero bits
+func (p *RTCMParser) header(i int) bool {
+	return len(p.buffer) >= i+3 && p.buffer[i] == 0xD3 && p.buffer[i+1]&0xFC == 0
+}
+
+// frameLength returns the length of the frame at offset i including the
+// header and CRC
+func (p *RTCMParser) frameLength(i int) int {
+	return (int(p.buffer[i+1]&0x03)<<8 | int(p.buffer[i+2])) + 6
+}
+
+// checkCRC reports whether the frame at offset i with the given length
+// carries a valid CRC-24Q
+func (p *RTCMParser) checkCRC(i, totalLength int) bool {
+	frame := p.buffer[i : i+totalLength]
+	crc := uint32(frame[totalLength-3])<<16 | uint32(frame[totalLength-2])<<8 | uint32(frame[totalLength-1])
+	return CRC24Q(frame[:totalLength-3]) == crc
+}
+
+// nextFrame returns the offset of the first complete, valid frame after
+// the start of the buffer, or 0 if there is none yet
+func (p *RTCMParser) nextFrame() int {
+	for i := 1; i < len(p.buffer); i++ {
+		if !p.header(i) {
+			continue
+		}
+		if totalLength := p.frameLength(i); i+totalLength <= len(p.buffer) && p.checkCRC(i, totalLength) {
+			return i
 		}
 	}
+	return 0
+}
 
-	return messages
+// skip discards bytes from the front of the buffer
+func (p *RTCMParser) skip(n int) {
+	p.buffer = p.buffer[n:]
+	p.stats.DiscardedBytes += uint64(n)
 }
 
-// Reset clears the internal buffer
+// Stats returns the frame and error counters since the parser was created
+func (p *RTCMParser) Stats() RTCMStats {
+	return p.stats
+}
+
+// Reset clears the internal buffer. The counters are kept.
 func (p *RTCMParser) Reset() {
 	p.buffer = p.buffer[:0]
 }
 
+// crc24qTable holds the CRC-24Q remainder of every byte value
+var crc24qTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 16
+		for j := 0; j < 8; j++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864CFB
+			}
+		}
+		table[i] = crc & 0xFFFFFF
+	}
+	return table
+}()
+
+// CRC24Q computes the CRC-24Q checksum RTCM 3 appends to each frame over
+// the preamble, length and payload
+func CRC24Q(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = (crc<<8)&0xFFFFFF ^ crc24qTable[byte(crc>>16)^b]
+	}
+	return crc
+}
+
+// MaxPayload is the longest payload an RTCM 3 frame can carry
+const MaxPayload = 1023
+
+// EncodeFrame wraps a payload in an RTCM 3 frame: the 0xD3 preamble, the
+// 10-bit length and the CRC-24Q
+func EncodeFrame(payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, fmt.Errorf("payload of %d bytes exceeds %d", len(payload), MaxPayload)
+	}
+
+	frame := make([]byte, 0, len(payload)+6)
+	frame = append(frame, 0xD3, byte(len(payload)>>8), byte(len(payload)))
+	frame = append(frame, payload...)
+	crc := CRC24Q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc)), nil
+}
+
 // GetMessageDescription returns a description of the RTCM message type
 func (p *RTCMParser) GetMessageDescription(messageType int) string {
 	switch messageType {
@@ -108,8 +250,18 @@ func (p *RTCMParser) GetMessageDescription(messageType int) string {
 		return "GPS Ephemerides"
 	case 1020:
 		return "GLONASS Ephemerides"
+	case 1042:
+		return "BeiDou Satellite Ephemeris Data"
+	case 1044:
+		return "QZSS Ephemerides"
+	case 1045:
+		return "Galileo F/NAV Satellite Ephemeris Data"
+	case 1046:
+		return "Galileo I/NAV Satellite Ephemeris Data"
 	case 1033:
 		return "Receiver and Antenna Descriptors"
+	case 1230:
+		return "GLONASS L1 and L2 Code-Phase Biases"
 	case 1071, 1072, 1073, 1074, 1075, 1076, 1077:
 		return "GPS MSM" + string(rune(messageType-1070+'0'))
 	case 1081, 1082, 1083, 1084, 1085, 1086, 1087:
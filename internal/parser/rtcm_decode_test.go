@@ -0,0 +1,176 @@
+package parser_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// bitWriter builds RTCM payloads field by field
+type bitWriter struct {
+	data []byte
+	pos  int
+}
+
+// put appends an unsigned or two's complement field
+func (w *bitWriter) put(bits int, value int64) *bitWriter {
+	for i := bits - 1; i >= 0; i-- {
+		if w.pos%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		if uint64(value)>>uint(i)&1 == 1 {
+			w.data[w.pos/8] |= 1 << uint(7-w.pos%8)
+		}
+		w.pos++
+	}
+	return w
+}
+
+// text appends a counted character field
+func (w *bitWriter) text(s string) *bitWriter {
+	w.put(8, int64(len(s)))
+	for i := 0; i < len(s); i++ {
+		w.put(8, int64(s[i]))
+	}
+	return w
+}
+
+// decode parses a payload as a framed message and decodes it
+func decode(t *testing.T, payload []byte) interface{} {
+	t.Helper()
+
+	messages := parser.NewRTCMParser().Process(rtcmFrame(payload))
+	if len(messages) != 1 {
+		t.Fatalf("Expected one message, got %d", len(messages))
+	}
+	decoded, err := messages[0].Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return decoded
+}
+
+func TestBitReader(t *testing.T) {
+	w := &bitWriter{}
+	w.put(3, 5).put(12, -7).put(1, 1).put(38, -123456789012).put(2, 2)
+	r := parser.NewBitReader(w.data)
+
+	if v := r.Uint(3); v != 5 {
+		t.Errorf("Expected 5, got %d", v)
+	}
+	if v := r.Int(12); v != -7 {
+		t.Errorf("Expected -7, got %d", v)
+	}
+	if !r.Bool() {
+		t.Error("Expected a set flag")
+	}
+	if v := r.Int(38); v != -123456789012 {
+		t.Errorf("Expected -123456789012, got %d", v)
+	}
+	if r.Pos() != 54 || r.Err() != nil {
+		t.Errorf("Expected position 54 without error, got %d, %v", r.Pos(), r.Err())
+	}
+
+	// Reading past the end fails once and keeps failing
+	if v := r.Uint(16); v != 0 || !errors.Is(r.Err(), parser.ErrShortMessage) {
+		t.Errorf("Expected a short message error, got %d, %v", v, r.Err())
+	}
+	if v := r.Uint(2); v != 0 || r.Err() == nil {
+		t.Errorf("Expected reads after an error to fail, got %d", v)
+	}
+}
+
+func TestDecodeStationARP(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1006).put(12, 2003).put(6, 14).put(1, 1).put(1, 1).put(1, 0).put(1, 0)
+	w.put(38, 39786678176).put(1, 1).put(1, 0).put(38, -83329146).put(2, 1).put(38, 49683976747)
+	w.put(16, 15432)
+
+	arp, ok := decode(t, w.data).(*parser.StationARP)
+	if !ok {
+		t.Fatal("Expected a *StationARP")
+	}
+	if arp.StationID != 2003 || arp.ITRFYear != 14 || !arp.GPS || !arp.GLONASS || arp.Galileo || arp.ReferenceStation {
+		t.Errorf("Unexpected station fields: %+v", arp)
+	}
+	if math.Abs(arp.X-3978667.8176) > 1e-6 || math.Abs(arp.Y+8332.9146) > 1e-6 || math.Abs(arp.Z-4968397.6747) > 1e-6 {
+		t.Errorf("Unexpected coordinates: %f %f %f", arp.X, arp.Y, arp.Z)
+	}
+	if !arp.SingleOscillator || arp.QuarterCycle != 1 {
+		t.Errorf("Unexpected indicators: %+v", arp)
+	}
+	if !arp.HasHeight || math.Abs(arp.AntennaHeight-1.5432) > 1e-9 {
+		t.Errorf("Expected antenna height 1.5432, got %+v", arp)
+	}
+
+	// A 1005 has no height, and a truncated one is rejected
+	w = &bitWriter{}
+	w.put(12, 1005).put(12, 1).put(10, 0).put(38, 1).put(2, 0).put(38, 2).put(2, 0).put(38, 3)
+	if arp := decode(t, w.data).(*parser.StationARP); arp.HasHeight || math.Abs(arp.Z-0.0003) > 1e-9 {
+		t.Errorf("Unexpected 1005: %+v", arp)
+	}
+	if _, err := parser.DecodeStationARP(w.data[:10]); !errors.Is(err, parser.ErrShortMessage) {
+		t.Errorf("Expected a short message error, got %v", err)
+	}
+}
+
+func TestDecodeDescriptors(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1008).put(12, 7).text("TRM59800.00     NONE").put(8, 3).text("5000118441")
+	antenna, ok := decode(t, w.data).(*parser.AntennaDescriptor)
+	if !ok || antenna.StationID != 7 || antenna.Descriptor != "TRM59800.00     NONE" || antenna.SetupID != 3 || antenna.Serial != "5000118441" {
+		t.Errorf("Unexpected 1008: %+v", antenna)
+	}
+
+	w = &bitWriter{}
+	w.put(12, 1007).put(12, 7).text("ADVNULLANTENNA").put(8, 0)
+	antenna = decode(t, w.data).(*parser.AntennaDescriptor)
+	if antenna.Descriptor != "ADVNULLANTENNA" || antenna.Serial != "" {
+		t.Errorf("Unexpected 1007: %+v", antenna)
+	}
+
+	w = &bitWriter{}
+	w.put(12, 1033).put(12, 7).text("TRM59800.00     NONE").put(8, 0).text("")
+	w.text("SEPT POLARX5").text("5.4.0").text("3056789")
+	receiver, ok := decode(t, w.data).(*parser.ReceiverDescriptor)
+	if !ok || receiver.Antenna != "TRM59800.00     NONE" || receiver.Receiver != "SEPT POLARX5" ||
+		receiver.Firmware != "5.4.0" || receiver.ReceiverSerial != "3056789" || receiver.AntennaSerial != "" {
+		t.Errorf("Unexpected 1033: %+v", receiver)
+	}
+
+	// A counted string running past the end is rejected
+	if _, err := parser.DecodeReceiverDescriptor(w.data[:12]); !errors.Is(err, parser.ErrShortMessage) {
+		t.Errorf("Expected a short message error, got %v", err)
+	}
+}
+
+func TestDecodeGLONASSBiases(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1230).put(12, 7).put(1, 1).put(3, 0).put(4, 0x9).put(16, 3600).put(16, -100)
+	biases, ok := decode(t, w.data).(*parser.GLONASSBiases)
+	if !ok || !biases.Aligned || len(biases.Biases) != 2 {
+		t.Fatalf("Unexpected 1230: %+v", biases)
+	}
+	if biases.Biases[0].Signal != "L1 C/A" || math.Abs(biases.Biases[0].Bias-72) > 1e-9 {
+		t.Errorf("Unexpected L1 C/A bias: %+v", biases.Biases[0])
+	}
+	if biases.Biases[1].Signal != "L2 P" || math.Abs(biases.Biases[1].Bias+2) > 1e-9 {
+		t.Errorf("Unexpected L2 P bias: %+v", biases.Biases[1])
+	}
+}
+
+func TestDecodeUnsupported(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 4072).put(12, 0)
+	messages := parser.NewRTCMParser().Process(rtcmFrame(w.data))
+	if _, err := messages[0].Decode(); !errors.Is(err, parser.ErrUnsupportedMessage) {
+		t.Errorf("Expected ErrUnsupportedMessage, got %v", err)
+	}
+
+	// Decoders check the message type
+	if _, err := parser.DecodeStationARP(w.data); err == nil {
+		t.Error("Expected an error for a 4072 payload")
+	}
+}
@@ -0,0 +1,365 @@
+package parser_test
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// roundTrip frames an encoded payload and decodes it again
+func roundTrip(t *testing.T, payload []byte, err error) interface{} {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	frame, err := parser.EncodeFrame(payload)
+	if err != nil {
+		t.Fatalf("EncodeFrame failed: %v", err)
+	}
+	messages := parser.NewRTCMParser().Process(frame)
+	if len(messages) != 1 {
+		t.Fatalf("Expected one message, got %d", len(messages))
+	}
+	decoded, err := messages[0].Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return decoded
+}
+
+func TestEncodeFrame(t *testing.T) {
+	payload := []byte{0x3E, 0xD0, 0x00, 0x03}
+	frame, err := parser.EncodeFrame(payload)
+	if err != nil || !bytes.Equal(frame, rtcmFrame(payload)) {
+		t.Errorf("Expected %X, got %X, %v", rtcmFrame(payload), frame, err)
+	}
+
+	if _, err := parser.EncodeFrame(make([]byte, parser.MaxPayload+1)); err == nil {
+		t.Error("Expected an error for an oversized payload")
+	}
+}
+
+func TestEncodeStationARP(t *testing.T) {
+	for _, arp := range []parser.StationARP{
+		{StationID: 2003, ITRFYear: 20, GPS: true, Galileo: true, X: 3980581.1234, Y: -111.5, Z: 4966824.0001, QuarterCycle: 1},
+		{StationID: 7, GLONASS: true, ReferenceStation: true, SingleOscillator: true, X: -1, Y: 2, Z: -3, HasHeight: true, AntennaHeight: 1.5432},
+	} {
+		payload, err := parser.EncodeStationARP(&arp)
+		decoded, ok := roundTrip(t, payload, err).(*parser.StationARP)
+		if !ok {
+			t.Fatal("Expected a station ARP")
+		}
+		if !near(decoded.X, arp.X, 1e-6) || !near(decoded.Y, arp.Y, 1e-6) || !near(decoded.Z, arp.Z, 1e-6) || !near(decoded.AntennaHeight, arp.AntennaHeight, 1e-6) {
+			t.Errorf("Expected %+v, got %+v", arp, decoded)
+		}
+		decoded.X, decoded.Y, decoded.Z, decoded.AntennaHeight = arp.X, arp.Y, arp.Z, arp.AntennaHeight
+		if *decoded != arp {
+			t.Errorf("Expected %+v, got %+v", arp, *decoded)
+		}
+	}
+
+	if _, err := parser.EncodeStationARP(&parser.StationARP{StationID: 4096}); err == nil {
+		t.Error("Expected an error for a station ID out of range")
+	}
+	if _, err := parser.EncodeStationARP(&parser.StationARP{HasHeight: true, AntennaHeight: 7}); err == nil {
+		t.Error("Expected an error for an antenna height out of range")
+	}
+	for _, arp := range []parser.StationARP{
+		{ITRFYear: 64},
+		{QuarterCycle: 4},
+		{X: 13743895.35},
+		{Y: -13743895.36},
+		{Z: math.NaN()},
+	} {
+		if _, err := parser.EncodeStationARP(&arp); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("Expected an out of range error for %+v, got %v", arp, err)
+		}
+	}
+	// The extremes of the 38-bit fields still fit
+	arp := parser.StationARP{X: 13743895.3471, Y: -13743895.3472}
+	payload, err := parser.EncodeStationARP(&arp)
+	if decoded := roundTrip(t, payload, err).(*parser.StationARP); !near(decoded.X, arp.X, 1e-6) || !near(decoded.Y, arp.Y, 1e-6) {
+		t.Errorf("Expected %+v, got %+v", arp, decoded)
+	}
+}
+
+func TestEncodeDescriptors(t *testing.T) {
+	for _, antenna := range []parser.AntennaDescriptor{
+		{StationID: 12, Descriptor: "TRM59800.00     SCIS", SetupID: 1, Serial: "5000112233"},
+		{StationID: 12, Descriptor: "ADVNULLANTENNA"},
+	} {
+		payload, err := parser.EncodeAntennaDescriptor(&antenna)
+		if decoded := roundTrip(t, payload, err); !reflect.DeepEqual(decoded, &antenna) {
+			t.Errorf("Expected %+v, got %+v", antenna, decoded)
+		}
+	}
+
+	receiver := parser.ReceiverDescriptor{
+		StationID:      12,
+		Antenna:        "TRM59800.00     SCIS",
+		AntennaSerial:  "5000112233",
+		Receiver:       "TRIMBLE ALLOY",
+		Firmware:       "6.28",
+		ReceiverSerial: "6012R40001",
+	}
+	payload, err := parser.EncodeReceiverDescriptor(&receiver)
+	if decoded := roundTrip(t, payload, err); !reflect.DeepEqual(decoded, &receiver) {
+		t.Errorf("Expected %+v, got %+v", receiver, decoded)
+	}
+
+	if _, err := parser.EncodeAntennaDescriptor(&parser.AntennaDescriptor{Descriptor: strings.Repeat("A", 32)}); err == nil {
+		t.Error("Expected an error for an over-long descriptor")
+	}
+	if _, err := parser.EncodeAntennaDescriptor(&parser.AntennaDescriptor{SetupID: 256}); err == nil {
+		t.Error("Expected an error for an antenna setup ID out of range")
+	}
+	if _, err := parser.EncodeReceiverDescriptor(&parser.ReceiverDescriptor{SetupID: -1}); err == nil {
+		t.Error("Expected an error for an antenna setup ID out of range")
+	}
+}
+
+// observations returns MSM observations of two satellites on two signals
+func observations(system string) *parser.MSM {
+	m := &parser.MSM{System: system, StationID: 99, Epoch: 345600000, MultipleMessage: true, IODS: 3, Smoothing: true, SmoothingInterval: 2}
+	for i, id := range []int{3, 17} {
+		sat := parser.MSMSatellite{ID: id, PRN: id}
+		if system == "GLO" {
+			sat.Channel, sat.HasChannel = i-3, true
+		}
+		for j, sigID := range []int{2, 8} {
+			pr := 21123456.789 + float64(i)*1e6 + float64(j)*3.21
+			sig := parser.MSMSignal{
+				ID:                sigID,
+				Code:              parser.MSMSignalCode(system, sigID),
+				PseudoRange:       pr,
+				HasPseudoRange:    true,
+				PhaseRange:        pr + 1.234,
+				HasPhaseRange:     true,
+				PhaseRangeRate:    -523.4567 + float64(j)*0.01,
+				HasPhaseRangeRate: true,
+				LockTime:          5 * time.Second,
+				HalfCycle:         j == 1,
+				CNR:               45.25,
+			}
+			sat.Signals = append(sat.Signals, sig)
+		}
+		m.Satellites = append(m.Satellites, sat)
+	}
+	// The second satellite has lost its L2 phase
+	m.Satellites[1].Signals[1].HasPhaseRange = false
+	return m
+}
+
+func TestEncodeMSM(t *testing.T) {
+	tests := []struct {
+		system      string
+		level       int
+		messageType int
+		prTolerance float64
+		cpTolerance float64
+		lockTime    time.Duration
+		cnr         float64
+		rateAndInfo bool
+	}{
+		{"GPS", 7, 1077, 0.001, 0.0002, 4992 * time.Millisecond, 45.25, true},
+		{"GPS", 4, 1074, 0.02, 0.001, 4096 * time.Millisecond, 45, false},
+		{"GLO", 7, 1087, 0.001, 0.0002, 4992 * time.Millisecond, 45.25, true},
+		{"GAL", 5, 1095, 0.02, 0.001, 4096 * time.Millisecond, 45, true},
+		{"BDS", 6, 1126, 0.001, 0.0002, 4992 * time.Millisecond, 45.25, false},
+	}
+
+	for _, tt := range tests {
+		input := observations(tt.system)
+		payload, err := parser.EncodeMSM(input, tt.level)
+		decoded, ok := roundTrip(t, payload, err).(*parser.MSM)
+		if !ok {
+			t.Fatal("Expected an MSM")
+		}
+
+		if decoded.MessageType != tt.messageType || decoded.StationID != 99 || decoded.Epoch != 345600000 ||
+			!decoded.MultipleMessage || decoded.IODS != 3 || !decoded.Smoothing || decoded.SmoothingInterval != 2 {
+			t.Errorf("%s MSM%d: unexpected header %+v", tt.system, tt.level, decoded)
+		}
+		if len(decoded.Satellites) != 2 {
+			t.Fatalf("%s MSM%d: expected 2 satellites, got %d", tt.system, tt.level, len(decoded.Satellites))
+		}
+
+		for i, sat := range decoded.Satellites {
+			in := input.Satellites[i]
+			if sat.ID != in.ID || len(sat.Signals) != 2 {
+				t.Fatalf("%s MSM%d: unexpected satellite %+v", tt.system, tt.level, sat)
+			}
+			if tt.system == "GLO" && (!sat.HasChannel || sat.Channel != in.Channel) {
+				t.Errorf("%s MSM%d: expected channel %d, got %+v", tt.system, tt.level, in.Channel, sat)
+			}
+
+			for j, sig := range sat.Signals {
+				want := in.Signals[j]
+				if sig.ID != want.ID || sig.HalfCycle != want.HalfCycle || sig.LockTime != tt.lockTime || sig.CNR != tt.cnr {
+					t.Errorf("%s MSM%d: unexpected signal %+v", tt.system, tt.level, sig)
+				}
+				if !sig.HasPseudoRange || math.Abs(sig.PseudoRange-want.PseudoRange) > tt.prTolerance {
+					t.Errorf("%s MSM%d: expected pseudorange %.4f, got %.4f", tt.system, tt.level, want.PseudoRange, sig.PseudoRange)
+				}
+				if sig.HasPhaseRange != want.HasPhaseRange || want.HasPhaseRange && math.Abs(sig.PhaseRange-want.PhaseRange) > tt.cpTolerance {
+					t.Errorf("%s MSM%d: expected phase range %.4f, got %.4f", tt.system, tt.level, want.PhaseRange, sig.PhaseRange)
+				}
+				if sig.HasPhaseRangeRate != tt.rateAndInfo || tt.rateAndInfo && math.Abs(sig.PhaseRangeRate-want.PhaseRangeRate) > 0.0001 {
+					t.Errorf("%s MSM%d: expected rate %.4f, got %.4f", tt.system, tt.level, want.PhaseRangeRate, sig.PhaseRangeRate)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeMSMErrors(t *testing.T) {
+	if _, err := parser.EncodeMSM(observations("GPS"), 3); err == nil {
+		t.Error("Expected an error for MSM3")
+	}
+	if _, err := parser.EncodeMSM(observations("XYZ"), 7); err == nil {
+		t.Error("Expected an error for an unknown GNSS")
+	}
+
+	m := observations("GPS")
+	m.Satellites[0].Signals[0].ID = 0
+	if _, err := parser.EncodeMSM(m, 7); err == nil {
+		t.Error("Expected an error for a signal without an MSM ID")
+	}
+
+	m = observations("GPS")
+	m.StationID = 5000
+	if _, err := parser.EncodeMSM(m, 7); err == nil || !strings.Contains(err.Error(), "station ID 5000 out of range") {
+		t.Errorf("Expected an error for a station ID out of range, got %v", err)
+	}
+	m = observations("GPS")
+	m.IODS = 8
+	if _, err := parser.EncodeMSM(m, 7); err == nil || !strings.Contains(err.Error(), "IODS 8 out of range") {
+		t.Errorf("Expected an error for an IODS out of range, got %v", err)
+	}
+
+	// 9 satellites on 8 signals need 72 cells
+	m = &parser.MSM{System: "GPS"}
+	for id := 1; id <= 9; id++ {
+		sat := parser.MSMSatellite{ID: id}
+		for sig := 1; sig <= 8; sig++ {
+			sat.Signals = append(sat.Signals, parser.MSMSignal{ID: sig})
+		}
+		m.Satellites = append(m.Satellites, sat)
+	}
+	if _, err := parser.EncodeMSM(m, 4); err == nil {
+		t.Error("Expected an error for more than 64 cells")
+	}
+}
+
+func TestEncodeLegacyObservations(t *testing.T) {
+	for _, tt := range []struct {
+		system      string
+		messageType int
+		codes       [2]string
+	}{
+		{"GPS", 1004, [2]string{"1C", "2X"}},
+		{"GLO", 1012, [2]string{"1C", "2C"}},
+	} {
+		input := observations(tt.system)
+		input.Satellites[0].Signals[0].LockTime = 101 * time.Second
+		payload, err := parser.EncodeLegacyObservations(input, tt.messageType)
+		decoded, ok := roundTrip(t, payload, err).(*parser.MSM)
+		if !ok {
+			t.Fatal("Expected observations")
+		}
+
+		if decoded.MessageType != tt.messageType || decoded.StationID != 99 || decoded.Epoch&(1<<27-1) != input.Epoch&(1<<27-1) ||
+			!decoded.MultipleMessage || !decoded.Smoothing || decoded.SmoothingInterval != 2 {
+			t.Errorf("%d: unexpected header %+v", tt.messageType, decoded)
+		}
+		if len(decoded.Satellites) != 2 {
+			t.Fatalf("%d: expected 2 satellites, got %d", tt.messageType, len(decoded.Satellites))
+		}
+
+		for i, sat := range decoded.Satellites {
+			in := input.Satellites[i]
+			if sat.ID != in.ID || sat.HasChannel != in.HasChannel || sat.Channel != in.Channel || len(sat.Signals) != 2 {
+				t.Fatalf("%d: unexpected satellite %+v", tt.messageType, sat)
+			}
+			for j, sig := range sat.Signals {
+				want := in.Signals[j]
+				// Lock times are rounded down to the legacy indicator
+				lockTime := want.LockTime
+				if lockTime > 100*time.Second {
+					lockTime = 100 * time.Second
+				}
+				if sig.Code != tt.codes[j] || sig.LockTime != lockTime || sig.CNR != 45.25 {
+					t.Errorf("%d: unexpected signal %+v", tt.messageType, sig)
+				}
+				if !sig.HasPseudoRange || math.Abs(sig.PseudoRange-want.PseudoRange) > 0.02 {
+					t.Errorf("%d: expected pseudorange %.4f, got %.4f", tt.messageType, want.PseudoRange, sig.PseudoRange)
+				}
+				if sig.HasPhaseRange != want.HasPhaseRange || want.HasPhaseRange && math.Abs(sig.PhaseRange-want.PhaseRange) > 0.001 {
+					t.Errorf("%d: expected phase range %.4f, got %.4f", tt.messageType, want.PhaseRange, sig.PhaseRange)
+				}
+			}
+		}
+	}
+
+	// Phase ranges far from the pseudorange are rolled over by 1500 cycles
+	input := observations("GPS")
+	wavelength := parser.SpeedOfLight / 1575.42e6
+	input.Satellites[0].Signals[0].PhaseRange += 2000 * wavelength
+	payload, err := parser.EncodeLegacyObservations(input, 1002)
+	decoded := roundTrip(t, payload, err).(*parser.MSM)
+	sig, want := decoded.Satellites[0].Signals[0], input.Satellites[0].Signals[0]
+	if !sig.HasPhaseRange || math.Abs(sig.PhaseRange+1500*wavelength-want.PhaseRange) > 0.001 {
+		t.Errorf("Expected the phase range rolled over by 1500 cycles, got %.4f for %.4f", sig.PhaseRange, want.PhaseRange)
+	}
+	if len(decoded.Satellites[0].Signals) != 1 {
+		t.Errorf("Expected L1 only, got %+v", decoded.Satellites[0])
+	}
+}
+
+func TestEncodeLegacyObservationsErrors(t *testing.T) {
+	if _, err := parser.EncodeLegacyObservations(observations("GAL"), 1004); err == nil {
+		t.Error("Expected an error for Galileo observations")
+	}
+	if _, err := parser.EncodeLegacyObservations(observations("GPS"), 1012); err == nil {
+		t.Error("Expected an error for GPS observations as 1012")
+	}
+	if _, err := parser.EncodeLegacyObservations(observations("GPS"), 1077); err == nil {
+		t.Error("Expected an error for an MSM type")
+	}
+
+	m := observations("GLO")
+	m.Satellites[1].HasChannel = false
+	if _, err := parser.EncodeLegacyObservations(m, 1012); err == nil || !strings.Contains(err.Error(), "has no frequency channel") {
+		t.Errorf("Expected an error for a GLONASS satellite without a channel, got %v", err)
+	}
+	m = observations("GPS")
+	m.StationID = 5000
+	if _, err := parser.EncodeLegacyObservations(m, 1004); err == nil || !strings.Contains(err.Error(), "station ID 5000 out of range") {
+		t.Errorf("Expected an error for a station ID out of range, got %v", err)
+	}
+	m = observations("GLO")
+	m.Satellites[1].Channel = 13
+	if _, err := parser.EncodeLegacyObservations(m, 1012); err != nil {
+		t.Errorf("Unexpected error for channel 13: %v", err)
+	}
+	m.Satellites[1].Channel = 14
+	if _, err := parser.EncodeLegacyObservations(m, 1012); err == nil || !strings.Contains(err.Error(), "frequency channel 14") {
+		t.Errorf("Expected an error for a channel out of range, got %v", err)
+	}
+
+	m = &parser.MSM{System: "GPS"}
+	for id := 1; id <= 32; id++ {
+		m.Satellites = append(m.Satellites, parser.MSMSatellite{ID: id, Signals: []parser.MSMSignal{
+			{Code: "1C", PseudoRange: 21e6, HasPseudoRange: true},
+		}})
+	}
+	if _, err := parser.EncodeLegacyObservations(m, 1004); err == nil {
+		t.Error("Expected an error for more than 31 satellites")
+	}
+}
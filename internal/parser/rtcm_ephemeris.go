@@ -0,0 +1,280 @@
+package parser
+
+import "math"
+
+// semicircle is the value of pi the broadcast navigation messages are
+// defined with, used to turn semicircles into radians
+const semicircle = 3.1415926535898
+
+// Ephemeris is the broadcast orbit and clock of a GPS (1019), BeiDou
+// (1042), QZSS (1044) or Galileo (1045 F/NAV, 1046 I/NAV) satellite.
+// Angles are in radians and times of week in seconds of the satellite's
+// own system time.
+type Ephemeris struct {
+	MessageType int
+	System      string // "GPS", "BDS", "QZS" or "GAL"
+	PRN         int
+	Week        int  // As broadcast: modulo 1024 for GPS and QZSS, from 1999-08-22 for Galileo, from 2006-01-01 for BeiDou
+	IODE        int  // Galileo IODnav, BeiDou AODE
+	IODC        int  // BeiDou AODC, 0 for Galileo
+	Accuracy    int  // URA index, Galileo SISA or BeiDou URAI
+	Health      int  // 0 for a healthy satellite; Galileo signal health and data validity bits
+	FitInterval bool // GPS and QZSS curve fit interval is longer than nominal
+
+	Toc float64 // Clock reference time of week
+	Af0 float64 // Seconds
+	Af1 float64 // s/s
+	Af2 float64 // s/s²
+
+	Toe      float64 // Ephemeris reference time of week
+	SqrtA    float64 // m^½
+	E        float64 // Eccentricity
+	I0       float64
+	Omega0   float64
+	Omega    float64
+	M0       float64
+	DeltaN   float64 // rad/s
+	OmegaDot float64 // rad/s
+	IDot     float64 // rad/s
+	Crs      float64 // Metres
+	Crc      float64
+	Cus      float64 // Radians
+	Cuc      float64
+	Cis      float64
+	Cic      float64
+
+	// Group delays in seconds: GPS and QZSS TGD, Galileo BGD E5a/E1 and
+	// E5b/E1, BeiDou TGD1 and TGD2
+	TGD [2]float64
+}
+
+// GLONASSEphemeris is the broadcast ephemeris of a GLONASS satellite from
+// message 1020. The orbit is given as a PZ-90 state vector at tb, to be
+// integrated to other times. Times of day are GLONASS time, UTC(SU) + 3 h.
+type GLONASSEphemeris struct {
+	Slot     int
+	Channel  int  // Frequency channel, -7 to +13
+	Health   int  // Most significant bit of Bn, 0 for a healthy satellite
+	Tk       int  // Start of the frame, seconds of day
+	Tb       int  // Reference time of the state vector, seconds of day
+	Age      int  // Days since the ephemeris was uploaded (En)
+	Accuracy int  // FT
+	Day      int  // Day within the four-year interval (NT), 0 if unknown
+	FourYear int  // Four-year interval since 1996 (N4), 0 if unknown
+	Modern   bool // GLONASS-M data such as N4 and TauGPS is available
+
+	Position     [3]float64 // Metres
+	Velocity     [3]float64 // m/s
+	Acceleration [3]float64 // Lunisolar acceleration in m/s²
+
+	GammaN    float64 // Relative deviation of the carrier frequency
+	TauN      float64 // Satellite clock offset from GLONASS time in seconds
+	DeltaTauN float64 // L2 minus L1 delay in seconds
+	TauC      float64 // GLONASS time offset from UTC(SU) in seconds
+	TauGPS    float64 // GPS time offset from GLONASS time in seconds
+}
+
+// IsEphemeris reports whether a message type carries a broadcast ephemeris
+func IsEphemeris(messageType int) bool {
+	switch messageType {
+	case 1019, 1020, 1042, 1044, 1045, 1046:
+		return true
+	}
+	return false
+}
+
+// DecodeEphemeris decodes a 1019, 1042, 1044, 1045 or 1046 payload
+func DecodeEphemeris(payload []byte) (*Ephemeris, error) {
+	r := NewBitReader(payload)
+	messageType := int(r.Uint(12))
+	if err := expectType(r, messageType, 1019, 1042, 1044, 1045, 1046); err != nil {
+		return nil, err
+	}
+
+	eph := &Ephemeris{MessageType: messageType}
+	switch messageType {
+	case 1019:
+		decodeGPSEphemeris(r, eph)
+	case 1042:
+		decodeBeiDouEphemeris(r, eph)
+	case 1044:
+		decodeQZSSEphemeris(r, eph)
+	default:
+		decodeGalileoEphemeris(r, eph)
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return eph, nil
+}
+
+// decodeGPSEphemeris reads the fields of a 1019 after the message type
+func decodeGPSEphemeris(r *BitReader, eph *Ephemeris) {
+	eph.System = "GPS"
+	eph.PRN = int(r.Uint(6))
+	eph.Week = int(r.Uint(10))
+	eph.Accuracy = int(r.Uint(4))
+	r.Skip(2) // Code on L2
+	eph.IDot = scaled(r.Int(14), -43) * semicircle
+	eph.IODE = int(r.Uint(8))
+	eph.Toc = float64(r.Uint(16)) * 16
+	eph.Af2 = scaled(r.Int(8), -55)
+	eph.Af1 = scaled(r.Int(16), -43)
+	eph.Af0 = scaled(r.Int(22), -31)
+	eph.IODC = int(r.Uint(10))
+	readOrbit(r, eph, 16, -5, -29)
+	eph.OmegaDot = scaled(r.Int(24), -43) * semicircle
+	eph.TGD[0] = scaled(r.Int(8), -31)
+	eph.Health = int(r.Uint(6))
+	r.Skip(1) // L2 P data flag
+	eph.FitInterval = r.Bool()
+}
+
+// decodeQZSSEphemeris reads the fields of a 1044 after the message type
+func decodeQZSSEphemeris(r *BitReader, eph *Ephemeris) {
+	eph.System = "QZS"
+	eph.PRN = int(r.Uint(4)) + 192
+	eph.Toc = float64(r.Uint(16)) * 16
+	eph.Af2 = scaled(r.Int(8), -55)
+	eph.Af1 = scaled(r.Int(16), -43)
+	eph.Af0 = scaled(r.Int(22), -31)
+	eph.IODE = int(r.Uint(8))
+	readOrbit(r, eph, 16, -5, -29)
+	eph.OmegaDot = scaled(r.Int(24), -43) * semicircle
+	eph.IDot = scaled(r.Int(14), -43) * semicircle
+	r.Skip(2) // Code on L2
+	eph.Week = int(r.Uint(10))
+	eph.Accuracy = int(r.Uint(4))
+	eph.Health = int(r.Uint(6))
+	eph.TGD[0] = scaled(r.Int(8), -31)
+	eph.IODC = int(r.Uint(10))
+	eph.FitInterval = r.Bool()
+}
+
+// decodeGalileoEphemeris reads the fields of a 1045 or 1046 after the
+// message type
+func decodeGalileoEphemeris(r *BitReader, eph *Ephemeris) {
+	eph.System = "GAL"
+	eph.PRN = int(r.Uint(6))
+	eph.Week = int(r.Uint(12))
+	eph.IODE = int(r.Uint(10))
+	eph.Accuracy = int(r.Uint(8))
+	eph.IDot = scaled(r.Int(14), -43) * semicircle
+	eph.Toc = float64(r.Uint(14)) * 60
+	eph.Af2 = scaled(r.Int(6), -59)
+	eph.Af1 = scaled(r.Int(21), -46)
+	eph.Af0 = scaled(r.Int(31), -34)
+	readOrbit(r, eph, 16, -5, -29)
+	eph.OmegaDot = scaled(r.Int(24), -43) * semicircle
+	eph.TGD[0] = scaled(r.Int(10), -32)
+	if eph.MessageType == 1046 {
+		// E5b and E1-B signal health and data validity
+		eph.TGD[1] = scaled(r.Int(10), -32)
+		eph.Health = int(r.Uint(6))
+		r.Skip(2) // Reserved
+	} else {
+		// E5a signal health and data validity
+		eph.Health = int(r.Uint(3))
+		r.Skip(7) // Reserved
+	}
+}
+
+// decodeBeiDouEphemeris reads the fields of a 1042 after the message type
+func decodeBeiDouEphemeris(r *BitReader, eph *Ephemeris) {
+	eph.System = "BDS"
+	eph.PRN = int(r.Uint(6))
+	eph.Week = int(r.Uint(13))
+	eph.Accuracy = int(r.Uint(4))
+	eph.IDot = scaled(r.Int(14), -43) * semicircle
+	eph.IODE = int(r.Uint(5))
+	eph.Toc = float64(r.Uint(17)) * 8
+	eph.Af2 = scaled(r.Int(11), -66)
+	eph.Af1 = scaled(r.Int(22), -50)
+	eph.Af0 = scaled(r.Int(24), -33)
+	eph.IODC = int(r.Uint(5))
+	readOrbit(r, eph, 18, -6, -31)
+	eph.OmegaDot = scaled(r.Int(24), -43) * semicircle
+	// Group delays are in units of 0.1 ns
+	eph.TGD[0] = float64(r.Int(10)) * 1e-10
+	eph.TGD[1] = float64(r.Int(10)) * 1e-10
+	eph.Health = int(r.Uint(1))
+}
+
+// readOrbit reads the block of orbital elements from Crs to omega that all
+// the Keplerian ephemerides share. BeiDou widens the harmonic corrections,
+// so their size and scales are given.
+func readOrbit(r *BitReader, eph *Ephemeris, harmonicBits, radiusScale, angleScale int) {
+	eph.Crs = scaled(r.Int(harmonicBits), radiusScale)
+	eph.DeltaN = scaled(r.Int(16), -43) * semicircle
+	eph.M0 = scaled(r.Int(32), -31) * semicircle
+	eph.Cuc = scaled(r.Int(harmonicBits), angleScale)
+	eph.E = scaled(int64(r.Uint(32)), -33)
+	eph.Cus = scaled(r.Int(harmonicBits), angleScale)
+	eph.SqrtA = scaled(int64(r.Uint(32)), -19)
+	if eph.System == "GAL" {
+		eph.Toe = float64(r.Uint(14)) * 60
+	} else if eph.System == "BDS" {
+		eph.Toe = float64(r.Uint(17)) * 8
+	} else {
+		eph.Toe = float64(r.Uint(16)) * 16
+	}
+	eph.Cic = scaled(r.Int(harmonicBits), angleScale)
+	eph.Omega0 = scaled(r.Int(32), -31) * semicircle
+	eph.Cis = scaled(r.Int(harmonicBits), angleScale)
+	eph.I0 = scaled(r.Int(32), -31) * semicircle
+	eph.Crc = scaled(r.Int(harmonicBits), radiusScale)
+	eph.Omega = scaled(r.Int(32), -31) * semicircle
+}
+
+// DecodeGLONASSEphemeris decodes a 1020 payload
+func DecodeGLONASSEphemeris(payload []byte) (*GLONASSEphemeris, error) {
+	r := NewBitReader(payload)
+	if err := expectType(r, int(r.Uint(12)), 1020); err != nil {
+		return nil, err
+	}
+
+	eph := &GLONASSEphemeris{Slot: int(r.Uint(6))}
+	eph.Channel = int(r.Uint(5)) - 7
+	r.Skip(4) // Almanac health, its availability and P1
+
+	// tk is given as hours, minutes and a 30 s flag
+	eph.Tk = int(r.Uint(5))*3600 + int(r.Uint(6))*60 + int(r.Uint(1))*30
+	eph.Health = int(r.Uint(1))
+	r.Skip(1) // P2
+	eph.Tb = int(r.Uint(7)) * 900
+
+	// Each axis is velocity, position and acceleration in km
+	for i := 0; i < 3; i++ {
+		eph.Velocity[i] = scaled(r.SignMagnitude(24), -20) * 1000
+		eph.Position[i] = scaled(r.SignMagnitude(27), -11) * 1000
+		eph.Acceleration[i] = scaled(r.SignMagnitude(5), -30) * 1000
+	}
+
+	r.Skip(1) // P3
+	eph.GammaN = scaled(r.SignMagnitude(11), -40)
+	r.Skip(3) // P and ln of the third string
+	eph.TauN = scaled(r.SignMagnitude(22), -30)
+	eph.DeltaTauN = scaled(r.SignMagnitude(5), -30)
+	eph.Age = int(r.Uint(5))
+	r.Skip(1) // P4
+	eph.Accuracy = int(r.Uint(4))
+	eph.Day = int(r.Uint(11))
+	r.Skip(2) // Satellite type M
+	eph.Modern = r.Bool()
+	r.Skip(11) // NA, the day of the almanac
+	eph.TauC = scaled(r.SignMagnitude(32), -31)
+	eph.FourYear = int(r.Uint(5))
+	eph.TauGPS = scaled(r.SignMagnitude(22), -30)
+	r.Skip(8) // ln of the fifth string and reserved
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return eph, nil
+}
+
+// scaled applies a power of two scale factor to a raw field
+func scaled(value int64, exponent int) float64 {
+	return math.Ldexp(float64(value), exponent)
+}
@@ -0,0 +1,170 @@
+package parser_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// signMagnitude appends a field with a sign bit and a magnitude
+func (w *bitWriter) signMagnitude(bits int, value int64) *bitWriter {
+	if value < 0 {
+		return w.put(1, 1).put(bits-1, -value)
+	}
+	return w.put(1, 0).put(bits-1, value)
+}
+
+// orbit appends the orbital elements from Crs to Omega dot with the field
+// sizes of GPS, Galileo and QZSS, or BeiDou's wider harmonic corrections
+func (w *bitWriter) orbit(harmonic, toeBits int) *bitWriter {
+	w.put(harmonic, -100) // Crs
+	w.put(16, 1000)       // Delta n
+	w.put(32, -1<<29)     // M0, a quarter semicircle
+	w.put(harmonic, 200)  // Cuc
+	w.put(32, 1<<26)      // e, 2^-7
+	w.put(harmonic, -300) // Cus
+	w.put(32, 5153<<19)   // sqrt A
+	w.put(toeBits, 450)   // toe
+	w.put(harmonic, 400)  // Cic
+	w.put(32, 1<<30)      // Omega0, half a semicircle
+	w.put(harmonic, -500) // Cis
+	w.put(32, 3<<28)      // i0
+	w.put(harmonic, 600)  // Crc
+	w.put(32, -(1 << 28)) // omega
+	w.put(24, -2000)      // Omega dot
+	return w
+}
+
+func TestDecodeGPSEphemeris(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1019).put(6, 12).put(10, 321).put(4, 2).put(2, 1).
+		put(14, -50).put(8, 77).put(16, 450).put(8, 1).put(16, -2).put(22, 3000).put(10, 333).
+		orbit(16, 16).
+		put(8, -6).put(6, 0).put(1, 0).put(1, 1)
+	if w.pos != 488 {
+		t.Fatalf("Expected a 488 bit message, built %d", w.pos)
+	}
+
+	eph, ok := decode(t, w.data).(*parser.Ephemeris)
+	if !ok {
+		t.Fatal("Expected an ephemeris")
+	}
+	if eph.System != "GPS" || eph.PRN != 12 || eph.Week != 321 || eph.IODE != 77 || eph.IODC != 333 || eph.Accuracy != 2 {
+		t.Errorf("Unexpected header %+v", eph)
+	}
+	if eph.Toc != 7200 || eph.Toe != 7200 {
+		t.Errorf("Expected toc and toe 7200 s, got %v, %v", eph.Toc, eph.Toe)
+	}
+	if !near(eph.Af0, 3000*math.Pow(2, -31), 1e-18) || !near(eph.Af1, -2*math.Pow(2, -43), 1e-20) || !near(eph.Af2, math.Pow(2, -55), 1e-25) {
+		t.Errorf("Unexpected clock %g %g %g", eph.Af0, eph.Af1, eph.Af2)
+	}
+	if !near(eph.SqrtA, 5153, 1e-9) || !near(eph.E, 1.0/128, 1e-12) {
+		t.Errorf("Unexpected orbit size %v, %v", eph.SqrtA, eph.E)
+	}
+	if !near(eph.M0, -math.Pi/4, 1e-9) || !near(eph.Omega0, math.Pi/2, 1e-9) || !near(eph.I0, 0.375*math.Pi, 1e-9) || !near(eph.Omega, -math.Pi/8, 1e-9) {
+		t.Errorf("Unexpected angles %v %v %v %v", eph.M0, eph.Omega0, eph.I0, eph.Omega)
+	}
+	if !near(eph.Crs, -100.0/32, 1e-9) || !near(eph.Crc, 600.0/32, 1e-9) || !near(eph.Cis, -500*math.Pow(2, -29), 1e-15) {
+		t.Errorf("Unexpected corrections %v %v %v", eph.Crs, eph.Crc, eph.Cis)
+	}
+	if !near(eph.IDot, -50*math.Pow(2, -43)*3.1415926535898, 1e-20) || !near(eph.OmegaDot, -2000*math.Pow(2, -43)*3.1415926535898, 1e-20) {
+		t.Errorf("Unexpected rates %g %g", eph.IDot, eph.OmegaDot)
+	}
+	if !near(eph.TGD[0], -6*math.Pow(2, -31), 1e-18) || eph.Health != 0 || !eph.FitInterval {
+		t.Errorf("Unexpected trailer %+v", eph)
+	}
+}
+
+func TestDecodeOtherEphemerides(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload *bitWriter
+		bits    int
+		system  string
+		prn     int
+		toe     float64
+		health  int
+	}{
+		{
+			name: "QZSS",
+			payload: (&bitWriter{}).put(12, 1044).put(4, 2).put(16, 450).put(8, 0).put(16, 0).put(22, 0).put(8, 9).
+				orbit(16, 16).put(14, 0).put(2, 0).put(10, 321).put(4, 0).put(6, 0).put(8, 0).put(10, 9).put(1, 0),
+			bits: 485, system: "QZS", prn: 194, toe: 7200,
+		},
+		{
+			name: "Galileo F/NAV",
+			payload: (&bitWriter{}).put(12, 1045).put(6, 11).put(12, 1297).put(10, 9).put(8, 107).put(14, 0).
+				put(14, 450).put(6, 0).put(21, 0).put(31, 0).orbit(16, 14).put(10, 5).put(2, 1).put(1, 0).put(7, 0),
+			bits: 496, system: "GAL", prn: 11, toe: 27000, health: 2,
+		},
+		{
+			name: "Galileo I/NAV",
+			payload: (&bitWriter{}).put(12, 1046).put(6, 11).put(12, 1297).put(10, 9).put(8, 107).put(14, 0).
+				put(14, 450).put(6, 0).put(21, 0).put(31, 0).orbit(16, 14).put(10, 5).put(10, -5).put(6, 0).put(2, 0),
+			bits: 504, system: "GAL", prn: 11, toe: 27000,
+		},
+		{
+			name: "BeiDou",
+			payload: (&bitWriter{}).put(12, 1042).put(6, 3).put(13, 965).put(4, 0).put(14, 0).put(5, 9).
+				put(17, 450).put(11, 0).put(22, 0).put(24, 0).put(5, 9).orbit(18, 17).put(10, 20).put(10, -20).put(1, 1),
+			bits: 511, system: "BDS", prn: 3, toe: 3600, health: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.payload.pos != tt.bits {
+				t.Fatalf("Expected a %d bit message, built %d", tt.bits, tt.payload.pos)
+			}
+			eph, ok := decode(t, tt.payload.data).(*parser.Ephemeris)
+			if !ok {
+				t.Fatal("Expected an ephemeris")
+			}
+			if eph.System != tt.system || eph.PRN != tt.prn || eph.IODE != 9 || eph.Toe != tt.toe || eph.Health != tt.health {
+				t.Errorf("Unexpected ephemeris %+v", eph)
+			}
+			if !near(eph.SqrtA, 5153, 1e-9) || !near(eph.I0, 0.375*math.Pi, 1e-9) {
+				t.Errorf("Unexpected orbit %v %v", eph.SqrtA, eph.I0)
+			}
+		})
+	}
+}
+
+func TestDecodeGLONASSEphemeris(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1020).put(6, 5).put(5, 8).put(1, 1).put(1, 1).put(2, 0).
+		put(5, 13).put(6, 45).put(1, 1).put(1, 0).put(1, 0).put(7, 50)
+	w.signMagnitude(24, -1<<20).signMagnitude(27, 12000<<11).signMagnitude(5, 3)
+	w.signMagnitude(24, 2<<20).signMagnitude(27, -8000<<11).signMagnitude(5, -1)
+	w.signMagnitude(24, 0).signMagnitude(27, 20000<<11).signMagnitude(5, 0)
+	w.put(1, 0).signMagnitude(11, -4).put(2, 0).put(1, 0).signMagnitude(22, 1024).signMagnitude(5, 2).
+		put(5, 1).put(1, 1).put(4, 3).put(11, 700).put(2, 1).put(1, 1).put(11, 699).
+		signMagnitude(32, -8).put(5, 8).signMagnitude(22, 16).put(1, 0).put(7, 0)
+	if w.pos != 360 {
+		t.Fatalf("Expected a 360 bit message, built %d", w.pos)
+	}
+
+	eph, ok := decode(t, w.data).(*parser.GLONASSEphemeris)
+	if !ok {
+		t.Fatal("Expected a GLONASS ephemeris")
+	}
+	if eph.Slot != 5 || eph.Channel != 1 || eph.Health != 0 || eph.Tk != 13*3600+45*60+30 || eph.Tb != 50*900 {
+		t.Errorf("Unexpected header %+v", eph)
+	}
+	if eph.Position != [3]float64{12000e3, -8000e3, 20000e3} || eph.Velocity != [3]float64{-1000, 2000, 0} {
+		t.Errorf("Unexpected state %v %v", eph.Position, eph.Velocity)
+	}
+	if want := 3 * math.Pow(2, -30) * 1000; !near(eph.Acceleration[0], want, 1e-15) || !near(eph.Acceleration[1], -want/3, 1e-15) {
+		t.Errorf("Unexpected acceleration %v", eph.Acceleration)
+	}
+	if !near(eph.GammaN, -4*math.Pow(2, -40), 1e-20) || !near(eph.TauN, math.Pow(2, -20), 1e-15) || !near(eph.DeltaTauN, 2*math.Pow(2, -30), 1e-15) {
+		t.Errorf("Unexpected clock %g %g %g", eph.GammaN, eph.TauN, eph.DeltaTauN)
+	}
+	if eph.Age != 1 || eph.Accuracy != 3 || eph.Day != 700 || eph.FourYear != 8 || !eph.Modern {
+		t.Errorf("Unexpected trailer %+v", eph)
+	}
+	if !near(eph.TauC, -8*math.Pow(2, -31), 1e-15) || !near(eph.TauGPS, 16*math.Pow(2, -30), 1e-15) {
+		t.Errorf("Unexpected time offsets %g %g", eph.TauC, eph.TauGPS)
+	}
+}
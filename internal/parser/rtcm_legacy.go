@@ -0,0 +1,362 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Ranges of the legacy observation messages are sent modulo one light
+// millisecond for GPS and two for GLONASS, with the whole number of those
+// in an ambiguity field
+const (
+	gpsAmbiguity     = rangeMs
+	glonassAmbiguity = 2 * rangeMs
+)
+
+// legacyL2Codes are the RINEX codes of the L2 code indicator of 1003/1004
+// and 1011/1012
+var legacyL2Codes = map[string][4]string{
+	"GPS": {"2X", "2P", "2D", "2W"}, // C/A or L2C, P(Y), cross-correlated, Z-tracking
+	"GLO": {"2C", "2P", "2P", "2P"}, // C/A, P, reserved
+}
+
+// legacyL1Signals and legacyL2Signals list the signals a legacy message
+// can carry on L1 and L2, most preferred first, with the code indicator
+// each is sent with
+var (
+	legacyL1Signals = map[string][]legacyCode{
+		"GPS": {{"1C", 0}, {"1W", 1}, {"1P", 1}},
+		"GLO": {{"1C", 0}, {"1P", 1}},
+	}
+	legacyL2Signals = map[string][]legacyCode{
+		"GPS": {{"2W", 3}, {"2P", 1}, {"2D", 2}, {"2X", 0}, {"2L", 0}, {"2S", 0}, {"2C", 0}},
+		"GLO": {{"2P", 1}, {"2C", 0}},
+	}
+)
+
+// legacyCode is a signal and the code indicator it is sent with
+type legacyCode struct {
+	code      string
+	indicator uint64
+}
+
+// IsLegacyObservation reports whether a message type is one of the legacy
+// GPS (1001-1004) or GLONASS (1009-1012) observation messages
+func IsLegacyObservation(messageType int) bool {
+	return messageType >= 1001 && messageType <= 1004 || messageType >= 1009 && messageType <= 1012
+}
+
+// DecodeLegacyObservations decodes a 1001-1004 or 1009-1012 payload into
+// the same model as the MSMs, with Level 0. The L1-only messages carry one
+// signal per satellite and the L1/L2 ones two. The non-extended messages
+// (1001, 1003, 1009, 1011) carry no ambiguity, so their ranges are modulo
+// one (GPS) or two (GLONASS) light milliseconds. Phase ranges are as sent,
+// without correcting the 1500 cycle roll-overs some receivers apply.
+func DecodeLegacyObservations(payload []byte) (*MSM, error) {
+	r := NewBitReader(payload)
+	messageType := int(r.Uint(12))
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	if !IsLegacyObservation(messageType) {
+		return nil, fmt.Errorf("unexpected message type %d", messageType)
+	}
+
+	obs := &MSM{MessageType: messageType, System: "GPS", StationID: int(r.Uint(12))}
+	if messageType >= 1009 {
+		// GLONASS epochs are the time of day; the day of week is unknown
+		obs.System = "GLO"
+		obs.Epoch = 7<<27 | uint32(r.Uint(27))
+	} else {
+		obs.Epoch = uint32(r.Uint(30))
+	}
+	obs.MultipleMessage = r.Bool()
+	count := int(r.Uint(5))
+	obs.Smoothing = r.Bool()
+	obs.SmoothingInterval = int(r.Uint(3))
+
+	variant := (messageType - 1) % 4 // 0: L1, 1: extended L1, 2: L1/L2, 3: extended L1/L2
+	for i := 0; i < count; i++ {
+		obs.Satellites = append(obs.Satellites, obs.readLegacySatellite(r, variant))
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return obs, nil
+}
+
+// readLegacySatellite reads the observations of one satellite
+func (m *MSM) readLegacySatellite(r *BitReader, variant int) MSMSatellite {
+	sat := MSMSatellite{ID: int(r.Uint(6))}
+	sat.PRN = sat.ID
+	l1Code := "1C"
+	if r.Bool() {
+		l1Code = "1P"
+	}
+
+	prBits, ambiguity := 24, gpsAmbiguity
+	if m.System == "GLO" {
+		sat.Channel = int(r.Uint(5)) - 7
+		sat.HasChannel = true
+		prBits, ambiguity = 25, glonassAmbiguity
+	} else if sat.ID >= 40 {
+		// SBAS satellites may be sent as IDs 40-58
+		sat.PRN = sat.ID + 80
+	}
+
+	// Pseudoranges are in units of 0.02 m and phase ranges are given
+	// relative to the L1 pseudorange in units of 0.5 mm
+	pr := float64(r.Uint(prBits)) * 0.02
+	l1Phase := r.Int(20)
+	l1 := MSMSignal{Code: l1Code, LockTime: legacyLockTime(r.Uint(7))}
+	if variant == 1 || variant == 3 {
+		ambiguityBits := 8
+		if m.System == "GLO" {
+			ambiguityBits = 7
+		}
+		pr += float64(r.Uint(ambiguityBits)) * ambiguity
+		l1.CNR = float64(r.Uint(8)) * 0.25
+	}
+	l1.PseudoRange = pr
+	l1.HasPseudoRange = true
+	if l1Phase != -1<<19 {
+		l1.PhaseRange = pr + float64(l1Phase)*0.0005
+		l1.HasPhaseRange = true
+	}
+	sat.Signals = append(sat.Signals, m.legacySignal(sat, l1))
+
+	if variant < 2 {
+		return sat
+	}
+
+	l2 := MSMSignal{Code: legacyL2Codes[m.System][r.Uint(2)]}
+	l2Difference := r.Int(14)
+	l2Phase := r.Int(20)
+	l2.LockTime = legacyLockTime(r.Uint(7))
+	if variant == 3 {
+		l2.CNR = float64(r.Uint(8)) * 0.25
+	}
+	if l2Difference != -1<<13 {
+		l2.PseudoRange = pr + float64(l2Difference)*0.02
+		l2.HasPseudoRange = true
+	}
+	if l2Phase != -1<<19 {
+		l2.PhaseRange = pr + float64(l2Phase)*0.0005
+		l2.HasPhaseRange = true
+	}
+	sat.Signals = append(sat.Signals, m.legacySignal(sat, l2))
+	return sat
+}
+
+// legacySignal fills in the MSM signal ID and frequency of a signal. The
+// ID stays 0 for GPS cross-correlated L2, which has no MSM signal.
+func (m *MSM) legacySignal(sat MSMSatellite, sig MSMSignal) MSMSignal {
+	for i, code := range msmSignalCodes[m.System] {
+		if code == sig.Code {
+			sig.ID = i + 1
+			break
+		}
+	}
+	sig.Frequency = frequency(m.System, sig.Code, sat)
+	return sig
+}
+
+// legacyLockTime converts the 7-bit lock time indicator of the legacy
+// observation messages to the minimum lock time it stands for. Resolution
+// halves every 24 steps; 127 means at least 937 s.
+func legacyLockTime(indicator uint64) time.Duration {
+	i := int64(indicator)
+	var s int64
+	switch {
+	case i < 24:
+		s = i
+	case i < 48:
+		s = 2*i - 24
+	case i < 72:
+		s = 4*i - 120
+	case i < 96:
+		s = 8*i - 408
+	case i < 120:
+		s = 16*i - 1176
+	case i < 127:
+		s = 32*i - 3096
+	default:
+		s = 937
+	}
+	return time.Duration(s) * time.Second
+}
+
+// legacyLockIndicator returns the largest legacy lock time indicator whose
+// minimum lock time does not exceed lock
+func legacyLockIndicator(lock time.Duration) uint64 {
+	return uint64(sort.Search(128, func(i int) bool { return legacyLockTime(uint64(i)) > lock }) - 1)
+}
+
+// EncodeLegacyObservations encodes GPS observations as a 1001-1004 or
+// GLONASS observations as a 1009-1012. Each satellite is sent with its
+// preferred L1 signal and, for 1003/1004 and 1011/1012, its preferred L2
+// signal; satellites without an L1 pseudorange are left out. GLONASS
+// satellites need their frequency channel. Phase ranges are kept within
+// 750 cycles of the L1 pseudorange by 1500 cycle roll-overs, as RTCM
+// 10403 allows, and values that still do not fit are sent as invalid.
+func EncodeLegacyObservations(m *MSM, messageType int) ([]byte, error) {
+	if !IsLegacyObservation(messageType) {
+		return nil, fmt.Errorf("unexpected message type %d", messageType)
+	}
+	system := "GPS"
+	if messageType >= 1009 {
+		system = "GLO"
+	}
+	if m.System != system {
+		return nil, fmt.Errorf("cannot encode %s observations as %d", m.System, messageType)
+	}
+	if m.StationID < 0 || m.StationID > 4095 {
+		return nil, fmt.Errorf("station ID %d out of range", m.StationID)
+	}
+
+	variant := (messageType - 1) % 4 // 0: L1, 1: extended L1, 2: L1/L2, 3: extended L1/L2
+	type legacySatellite struct {
+		sat    MSMSatellite
+		l1, l2 *MSMSignal
+		l1Code uint64
+		l2Code uint64
+	}
+	var sats []legacySatellite
+	for _, sat := range m.Satellites {
+		if sat.ID < 1 || sat.ID > 63 {
+			return nil, fmt.Errorf("satellite ID %d out of range", sat.ID)
+		}
+		if system == "GLO" && !sat.HasChannel {
+			return nil, fmt.Errorf("GLONASS satellite %d has no frequency channel", sat.ID)
+		}
+		if system == "GLO" && (sat.Channel < -7 || sat.Channel > 13) {
+			return nil, fmt.Errorf("frequency channel %d of GLONASS satellite %d out of range", sat.Channel, sat.ID)
+		}
+
+		ls := legacySatellite{sat: sat}
+		ls.l1, ls.l1Code = legacySignalOf(sat, legacyL1Signals[system])
+		if ls.l1 == nil || !ls.l1.HasPseudoRange {
+			continue
+		}
+		if variant >= 2 {
+			ls.l2, ls.l2Code = legacySignalOf(sat, legacyL2Signals[system])
+		}
+		sats = append(sats, ls)
+	}
+	if len(sats) > 31 {
+		return nil, fmt.Errorf("%d satellites exceed the 31 of a legacy message", len(sats))
+	}
+
+	var w BitWriter
+	w.Uint(12, uint64(messageType))
+	w.Uint(12, uint64(m.StationID))
+	if system == "GLO" {
+		w.Uint(27, uint64(m.Epoch&(1<<27-1))) // Time of day without the day of week
+	} else {
+		w.Uint(30, uint64(m.Epoch))
+	}
+	w.Bool(m.MultipleMessage)
+	w.Uint(5, uint64(len(sats)))
+	w.Bool(m.Smoothing)
+	w.Uint(3, uint64(m.SmoothingInterval))
+
+	prBits, ambiguityBits, ambiguity := 24, 8, gpsAmbiguity
+	if system == "GLO" {
+		prBits, ambiguityBits, ambiguity = 25, 7, glonassAmbiguity
+	}
+	for _, ls := range sats {
+		w.Uint(6, uint64(ls.sat.ID))
+		w.Uint(1, ls.l1Code)
+		if system == "GLO" {
+			w.Uint(5, uint64(ls.sat.Channel+7))
+		}
+
+		// The L1 pseudorange is split into whole ambiguities and the
+		// remainder in units of 0.02 m; the other observables are sent
+		// relative to the range as transmitted
+		whole := math.Floor(ls.l1.PseudoRange / ambiguity)
+		remainder := math.Round((ls.l1.PseudoRange - whole*ambiguity) / 0.02)
+		if whole < 0 || whole >= math.Ldexp(1, ambiguityBits) || remainder >= math.Ldexp(1, prBits) {
+			return nil, fmt.Errorf("pseudorange of satellite %d out of range", ls.sat.ID)
+		}
+		pr := whole*ambiguity + remainder*0.02
+
+		w.Uint(prBits, uint64(remainder))
+		w.Int(20, legacyPhase(system, ls.sat, ls.l1, pr))
+		w.Uint(7, legacyLockIndicator(ls.l1.LockTime))
+		if variant == 1 || variant == 3 {
+			w.Uint(ambiguityBits, uint64(whole))
+			w.Uint(8, legacyCNR(ls.l1.CNR))
+		}
+		if variant < 2 {
+			continue
+		}
+
+		l2 := ls.l2
+		if l2 == nil {
+			l2 = &MSMSignal{}
+		}
+		difference := int64(-1 << 13)
+		if l2.HasPseudoRange {
+			if d := math.Round((l2.PseudoRange - pr) / 0.02); math.Abs(d) < 1<<13 {
+				difference = int64(d)
+			}
+		}
+		w.Uint(2, ls.l2Code)
+		w.Int(14, difference)
+		w.Int(20, legacyPhase(system, ls.sat, l2, pr))
+		w.Uint(7, legacyLockIndicator(l2.LockTime))
+		if variant == 3 {
+			w.Uint(8, legacyCNR(l2.CNR))
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+// legacySignalOf returns the most preferred of the given signals that the
+// satellite has, with its code indicator
+func legacySignalOf(sat MSMSatellite, codes []legacyCode) (*MSMSignal, uint64) {
+	for _, c := range codes {
+		for i := range sat.Signals {
+			if sat.Signals[i].Code == c.code {
+				return &sat.Signals[i], c.indicator
+			}
+		}
+	}
+	return nil, 0
+}
+
+// legacyPhase returns the phase range of a signal relative to the L1
+// pseudorange pr in units of 0.5 mm, rolled over by 1500 cycles to keep it
+// within 750 cycles of the pseudorange, or the invalid value
+func legacyPhase(system string, sat MSMSatellite, sig *MSMSignal, pr float64) int64 {
+	invalid := int64(-1 << 19)
+	if !sig.HasPhaseRange {
+		return invalid
+	}
+
+	difference := sig.PhaseRange - pr
+	f := sig.Frequency
+	if f == 0 {
+		f = frequency(system, sig.Code, sat)
+	}
+	if f != 0 {
+		wavelength := SpeedOfLight / f
+		difference -= math.Round(difference/wavelength/1500) * 1500 * wavelength
+	}
+
+	value := math.Round(difference / 0.0005)
+	if math.Abs(value) >= 1<<19 {
+		return invalid
+	}
+	return int64(value)
+}
+
+// legacyCNR returns a carrier-to-noise ratio in units of 0.25 dB-Hz
+func legacyCNR(cnr float64) uint64 {
+	return uint64(math.Max(0, math.Min(math.Round(cnr/0.25), 255)))
+}
@@ -0,0 +1,124 @@
+package parser_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+func TestDecodeLegacyGPS(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1004).put(12, 33).put(30, 123456789).put(1, 1).put(5, 2).put(1, 0).put(3, 0)
+	// G05: L1 C/A, 21000 km, phase 10 m above the pseudorange, L2 P(Y)
+	w.put(6, 5).put(1, 0).put(24, 100000).put(20, 20000).put(7, 30).put(8, 70).put(8, 180).
+		put(2, 1).put(14, -150).put(20, 24000).put(7, 127).put(8, 160)
+	// G12: invalid L2 observables
+	w.put(6, 12).put(1, 1).put(24, 0).put(20, -1<<19).put(7, 0).put(8, 67).put(8, 0).
+		put(2, 3).put(14, -1<<13).put(20, -1<<19).put(7, 0).put(8, 0)
+	if w.pos != 64+2*125 {
+		t.Fatalf("Expected %d bits, built %d", 64+2*125, w.pos)
+	}
+
+	obs, ok := decode(t, w.data).(*parser.MSM)
+	if !ok {
+		t.Fatal("Expected observations")
+	}
+	if obs.System != "GPS" || obs.Level != 0 || obs.StationID != 33 || obs.Epoch != 123456789 || !obs.MultipleMessage {
+		t.Errorf("Unexpected header %+v", obs)
+	}
+	if len(obs.Satellites) != 2 {
+		t.Fatalf("Expected 2 satellites, got %d", len(obs.Satellites))
+	}
+
+	sat := obs.Satellites[0]
+	if sat.PRN != 5 || sat.HasChannel || len(sat.Signals) != 2 {
+		t.Fatalf("Unexpected satellite %+v", sat)
+	}
+	pr := 100000*0.02 + 70*parser.SpeedOfLight/1000
+	l1, l2 := sat.Signals[0], sat.Signals[1]
+	if l1.Code != "1C" || l1.ID != 2 || l1.Frequency != 1575.42e6 {
+		t.Errorf("Unexpected L1 signal %+v", l1)
+	}
+	if !l1.HasPseudoRange || !near(l1.PseudoRange, pr, 1e-6) || !l1.HasPhaseRange || !near(l1.PhaseRange, pr+10, 1e-6) {
+		t.Errorf("Unexpected L1 ranges %+v", l1)
+	}
+	if l1.LockTime != 36*time.Second || l1.CNR != 45 {
+		t.Errorf("Unexpected L1 lock time %v and CNR %v", l1.LockTime, l1.CNR)
+	}
+	if l2.Code != "2P" || l2.ID != 9 || l2.Frequency != 1227.60e6 {
+		t.Errorf("Unexpected L2 signal %+v", l2)
+	}
+	if !near(l2.PseudoRange, pr-3, 1e-6) || !near(l2.PhaseRange, pr+12, 1e-6) || l2.LockTime != 937*time.Second || l2.CNR != 40 {
+		t.Errorf("Unexpected L2 observables %+v", l2)
+	}
+
+	sat = obs.Satellites[1]
+	if sat.PRN != 12 || sat.Signals[0].Code != "1P" || sat.Signals[0].HasPhaseRange {
+		t.Errorf("Unexpected satellite %+v", sat)
+	}
+	if l2 := sat.Signals[1]; l2.Code != "2W" || l2.HasPseudoRange || l2.HasPhaseRange {
+		t.Errorf("Expected invalid L2 observables, got %+v", l2)
+	}
+}
+
+func TestDecodeLegacyGLONASS(t *testing.T) {
+	w := &bitWriter{}
+	w.put(12, 1012).put(12, 33).put(27, 3600000).put(1, 0).put(5, 1).put(1, 0).put(3, 0)
+	w.put(6, 9).put(1, 0).put(5, 5).put(25, 200000).put(20, -2000).put(7, 60).put(7, 35).put(8, 176).
+		put(2, 0).put(14, 100).put(20, 4000).put(7, 50).put(8, 168)
+	if w.pos != 61+130 {
+		t.Fatalf("Expected %d bits, built %d", 61+130, w.pos)
+	}
+
+	obs, ok := decode(t, w.data).(*parser.MSM)
+	if !ok {
+		t.Fatal("Expected observations")
+	}
+	if obs.System != "GLO" || len(obs.Satellites) != 1 {
+		t.Fatalf("Unexpected observations %+v", obs)
+	}
+
+	sat := obs.Satellites[0]
+	if sat.PRN != 9 || !sat.HasChannel || sat.Channel != -2 {
+		t.Errorf("Unexpected satellite %+v", sat)
+	}
+	pr := 200000*0.02 + 35*2*parser.SpeedOfLight/1000
+	l1, l2 := sat.Signals[0], sat.Signals[1]
+	if l1.Code != "1C" || l1.Frequency != 1602e6-2*0.5625e6 || !near(l1.PseudoRange, pr, 1e-6) || !near(l1.PhaseRange, pr-1, 1e-6) {
+		t.Errorf("Unexpected L1 signal %+v", l1)
+	}
+	if l1.LockTime != 120*time.Second || l1.CNR != 44 {
+		t.Errorf("Unexpected L1 lock time %v and CNR %v", l1.LockTime, l1.CNR)
+	}
+	if l2.Code != "2C" || l2.Frequency != 1246e6-2*0.4375e6 || !near(l2.PseudoRange, pr+2, 1e-6) || !near(l2.PhaseRange, pr+2, 1e-6) {
+		t.Errorf("Unexpected L2 signal %+v", l2)
+	}
+
+	// The epoch is the GLONASS time of day, 01:00 Moscow time
+	ref := time.Date(2024, 12, 17, 21, 50, 0, 0, time.UTC)
+	if got, want := obs.Time(ref), time.Date(2024, 12, 17, 22, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestDecodeLegacyL1Only(t *testing.T) {
+	// 1001 and 1009 carry neither ambiguity nor CNR nor L2
+	w := &bitWriter{}
+	w.put(12, 1001).put(12, 1).put(30, 0).put(1, 0).put(5, 1).put(1, 0).put(3, 0)
+	w.put(6, 40).put(1, 0).put(24, 5000).put(20, 0).put(7, 5)
+	obs := decode(t, w.data).(*parser.MSM)
+	sat := obs.Satellites[0]
+	if sat.PRN != 120 || len(sat.Signals) != 1 || sat.Signals[0].PseudoRange != 100 || sat.Signals[0].LockTime != 5*time.Second {
+		t.Errorf("Unexpected 1001 satellite %+v", sat)
+	}
+
+	w = &bitWriter{}
+	w.put(12, 1009).put(12, 1).put(27, 0).put(1, 0).put(5, 1).put(1, 0).put(3, 0)
+	w.put(6, 3).put(1, 1).put(5, 20).put(25, 5000).put(20, 0).put(7, 0)
+	obs = decode(t, w.data).(*parser.MSM)
+	sat = obs.Satellites[0]
+	if sat.Channel != 13 || len(sat.Signals) != 1 || sat.Signals[0].Code != "1P" || sat.Signals[0].PseudoRange != 100 {
+		t.Errorf("Unexpected 1009 satellite %+v", sat)
+	}
+}
@@ -0,0 +1,662 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SpeedOfLight in metres per second, used to turn MSM ranges in light
+// milliseconds into metres
+const SpeedOfLight = 299792458.0
+
+// rangeMs converts a range in light milliseconds to metres
+const rangeMs = SpeedOfLight / 1000
+
+// LeapSeconds is the GPS-UTC offset applied when resolving epoch times.
+// It has been 18 s since 2017-01-01.
+const LeapSeconds = 18
+
+// msmSystems maps the tens digit of MSM message types 1071-1137 to a GNSS
+var msmSystems = []string{"GPS", "GLO", "GAL", "SBAS", "QZS", "BDS", "IRN"}
+
+// msmSignalCodes gives the RINEX observation code of each MSM signal ID
+// (1-32) per GNSS, following the RTCM 10403.3 signal tables
+var msmSignalCodes = map[string][32]string{
+	"GPS":  {1: "1C", 2: "1P", 3: "1W", 7: "2C", 8: "2P", 9: "2W", 14: "2S", 15: "2L", 16: "2X", 21: "5I", 22: "5Q", 23: "5X", 29: "1S", 30: "1L", 31: "1X"},
+	"GLO":  {1: "1C", 2: "1P", 7: "2C", 8: "2P"},
+	"GAL":  {1: "1C", 2: "1A", 3: "1B", 4: "1X", 5: "1Z", 7: "6C", 8: "6A", 9: "6B", 10: "6X", 11: "6Z", 13: "7I", 14: "7Q", 15: "7X", 17: "8I", 18: "8Q", 19: "8X", 21: "5I", 22: "5Q", 23: "5X"},
+	"SBAS": {1: "1C", 21: "5I", 22: "5Q", 23: "5X"},
+	"QZS":  {1: "1C", 8: "6S", 9: "6L", 10: "6X", 14: "2S", 15: "2L", 16: "2X", 21: "5I", 22: "5Q", 23: "5X", 29: "1S", 30: "1L", 31: "1X"},
+	"BDS":  {1: "2I", 2: "2Q", 3: "2X", 7: "6I", 8: "6Q", 9: "6X", 13: "7I", 14: "7Q", 15: "7X", 21: "5D", 22: "5P", 23: "5X", 24: "7D", 29: "1D", 30: "1P", 31: "1X"},
+	"IRN":  {7: "9A", 21: "5A"},
+}
+
+// bandFrequencies gives the carrier frequency in Hz of each RINEX band per
+// GNSS. GLONASS FDMA bands depend on the frequency channel.
+var bandFrequencies = map[string]map[byte]float64{
+	"GPS":  {'1': 1575.42e6, '2': 1227.60e6, '5': 1176.45e6},
+	"GAL":  {'1': 1575.42e6, '5': 1176.45e6, '6': 1278.75e6, '7': 1207.14e6, '8': 1191.795e6},
+	"SBAS": {'1': 1575.42e6, '5': 1176.45e6},
+	"QZS":  {'1': 1575.42e6, '2': 1227.60e6, '5': 1176.45e6, '6': 1278.75e6},
+	"BDS":  {'1': 1575.42e6, '2': 1561.098e6, '5': 1176.45e6, '6': 1268.52e6, '7': 1207.14e6},
+	"IRN":  {'5': 1176.45e6, '9': 2492.028e6},
+}
+
+// MSM is a decoded Multiple Signal Message (MSM1-MSM7) of any GNSS. The
+// legacy GPS and GLONASS observation messages decode to it too, so that
+// observations are handled the same whichever format a base sends.
+type MSM struct {
+	MessageType       int
+	System            string // "GPS", "GLO", "GAL", "SBAS", "QZS", "BDS" or "IRN"
+	Level             int    // 1-7, 0 for the legacy 1001-1004 and 1009-1012
+	StationID         int
+	Epoch             uint32 // Raw epoch time field, see Time
+	MultipleMessage   bool   // More MSMs follow for the same epoch
+	IODS              int    // Issue of data station
+	ClockSteering     int
+	ExternalClock     int
+	Smoothing         bool // Divergence-free smoothing applied
+	SmoothingInterval int
+	Satellites        []MSMSatellite
+}
+
+// MSMSatellite holds the observations of one satellite
+type MSMSatellite struct {
+	ID         int // Position in the satellite mask, 1-64, or the satellite ID of a legacy message
+	PRN        int // PRN, or slot number for GLONASS
+	Channel    int // GLONASS frequency channel, -7 to +13
+	HasChannel bool
+	Signals    []MSMSignal
+}
+
+// MSMSignal holds the observables of one signal of a satellite. Values
+// the message does not carry or marks as invalid have their Has flag unset.
+// MSM1-MSM3 carry no whole milliseconds, so their ranges are modulo one
+// light millisecond (about 300 km).
+type MSMSignal struct {
+	ID        int     // Signal ID, 1-32
+	Code      string  // RINEX observation code, e.g. "1C"
+	Frequency float64 // Carrier frequency in Hz, 0 if unknown
+
+	PseudoRange       float64 // Metres
+	HasPseudoRange    bool
+	PhaseRange        float64 // Carrier phase in metres
+	HasPhaseRange     bool
+	PhaseRangeRate    float64 // Metres per second
+	HasPhaseRangeRate bool
+	LockTime          time.Duration // Minimum time the phase has been tracked continuously
+	HalfCycle         bool          // Half-cycle ambiguity unresolved
+	CNR               float64       // Carrier-to-noise ratio in dB-Hz, 0 if not computed
+}
+
+// Wavelength returns the carrier wavelength in metres, or 0 if the
+// frequency is unknown
+func (s MSMSignal) Wavelength() float64 {
+	if s.Frequency == 0 {
+		return 0
+	}
+	return SpeedOfLight / s.Frequency
+}
+
+// IsMSM reports whether a message type is an MSM1-MSM7 message
+func IsMSM(messageType int) bool {
+	return messageType >= 1071 && messageType <= 1137 && messageType%10 >= 1 && messageType%10 <= 7
+}
+
+// MSMSystem returns the GNSS of an MSM message type, e.g. "GAL" for 1097
+func MSMSystem(messageType int) string {
+	if !IsMSM(messageType) {
+		return ""
+	}
+	return msmSystems[(messageType-1071)/10]
+}
+
+// MSMSignalCode returns the RINEX observation code of an MSM signal ID,
+// or "" if the ID is not defined for the GNSS
+func MSMSignalCode(system string, id int) string {
+	if id < 1 || id > 32 {
+		return ""
+	}
+	return msmSignalCodes[system][id-1]
+}
+
+// DecodeMSM decodes an MSM1-MSM7 payload of any GNSS
+func DecodeMSM(payload []byte) (*MSM, error) {
+	r := NewBitReader(payload)
+	messageType := int(r.Uint(12))
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	if !IsMSM(messageType) {
+		return nil, fmt.Errorf("unexpected message type %d", messageType)
+	}
+
+	msm := &MSM{
+		MessageType:     messageType,
+		System:          MSMSystem(messageType),
+		Level:           messageType % 10,
+		StationID:       int(r.Uint(12)),
+		Epoch:           uint32(r.Uint(30)),
+		MultipleMessage: r.Bool(),
+		IODS:            int(r.Uint(3)),
+	}
+	r.Skip(7) // Reserved
+	msm.ClockSteering = int(r.Uint(2))
+	msm.ExternalClock = int(r.Uint(2))
+	msm.Smoothing = r.Bool()
+	msm.SmoothingInterval = int(r.Uint(3))
+
+	// Expand the satellite and signal masks; the cell mask has one bit per
+	// satellite and signal pair
+	var satIDs, sigIDs []int
+	satMask := r.Uint(64)
+	for id := 1; id <= 64; id++ {
+		if satMask&(1<<uint(64-id)) != 0 {
+			satIDs = append(satIDs, id)
+		}
+	}
+	sigMask := r.Uint(32)
+	for id := 1; id <= 32; id++ {
+		if sigMask&(1<<uint(32-id)) != 0 {
+			sigIDs = append(sigIDs, id)
+		}
+	}
+	if len(satIDs)*len(sigIDs) > 64 {
+		return nil, fmt.Errorf("cell mask of %d satellites and %d signals exceeds 64 bits", len(satIDs), len(sigIDs))
+	}
+	cells := make([][]bool, len(satIDs))
+	cellCount := 0
+	for i := range cells {
+		cells[i] = make([]bool, len(sigIDs))
+		for j := range cells[i] {
+			cells[i][j] = r.Bool()
+			if cells[i][j] {
+				cellCount++
+			}
+		}
+	}
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	sats := msm.readSatellites(r, satIDs)
+	signals := msm.readSignals(r, cellCount)
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	// Combine the satellite and signal data of each cell
+	cell := 0
+	for i, id := range satIDs {
+		sat := MSMSatellite{ID: id, PRN: satellitePRN(msm.System, id)}
+		if msm.System == "GLO" && sats[i].info <= 13 && (msm.Level == 5 || msm.Level == 7) {
+			sat.Channel = sats[i].info - 7
+			sat.HasChannel = true
+		}
+		for j, sigID := range sigIDs {
+			if !cells[i][j] {
+				continue
+			}
+			sat.Signals = append(sat.Signals, msm.signal(sat, sigID, sats[i], signals[cell]))
+			cell++
+		}
+		msm.Satellites = append(msm.Satellites, sat)
+	}
+
+	return msm, nil
+}
+
+// msmSatData is the raw satellite data of an MSM
+type msmSatData struct {
+	wholeMs    uint64 // Rough range, whole milliseconds; 255 if invalid
+	hasWholeMs bool
+	fractionMs float64 // Rough range modulo 1 ms
+	info       int     // Extended satellite information
+	rate       int64   // Rough phase range rate in m/s; -8192 if invalid
+	hasRate    bool
+}
+
+// readSatellites reads the satellite data: each field for every satellite
+// in turn
+func (m *MSM) readSatellites(r *BitReader, ids []int) []msmSatData {
+	sats := make([]msmSatData, len(ids))
+	if m.Level >= 4 {
+		for i := range sats {
+			sats[i].wholeMs = r.Uint(8)
+			sats[i].hasWholeMs = sats[i].wholeMs != 255
+		}
+	}
+	if m.Level == 5 || m.Level == 7 {
+		for i := range sats {
+			sats[i].info = int(r.Uint(4))
+		}
+	}
+	for i := range sats {
+		sats[i].fractionMs = float64(r.Uint(10)) / 1024
+	}
+	if m.Level == 5 || m.Level == 7 {
+		for i := range sats {
+			sats[i].rate = r.Int(14)
+			sats[i].hasRate = sats[i].rate != -8192
+		}
+	}
+	return sats
+}
+
+// msmSigData is the raw signal data of one cell of an MSM. Invalid fine
+// values keep their reserved minimum.
+type msmSigData struct {
+	pseudoRange, phaseRange int64
+	lock                    uint64
+	halfCycle               bool
+	cnr                     uint64
+	rate                    int64
+}
+
+// readSignals reads the signal data of every cell: each field for every
+// cell in turn
+func (m *MSM) readSignals(r *BitReader, count int) []msmSigData {
+	sigs := make([]msmSigData, count)
+	extended := m.Level >= 6
+	prBits, cpBits, lockBits, cnrBits := 15, 22, 4, 6
+	if extended {
+		prBits, cpBits, lockBits, cnrBits = 20, 24, 10, 10
+	}
+
+	if m.Level != 2 {
+		for i := range sigs {
+			sigs[i].pseudoRange = r.Int(prBits)
+		}
+	}
+	if m.Level >= 2 {
+		for i := range sigs {
+			sigs[i].phaseRange = r.Int(cpBits)
+		}
+		for i := range sigs {
+			sigs[i].lock = r.Uint(lockBits)
+		}
+		for i := range sigs {
+			sigs[i].halfCycle = r.Bool()
+		}
+	}
+	if m.Level >= 4 {
+		for i := range sigs {
+			sigs[i].cnr = r.Uint(cnrBits)
+		}
+	}
+	if m.Level == 5 || m.Level == 7 {
+		for i := range sigs {
+			sigs[i].rate = r.Int(15)
+		}
+	}
+	return sigs
+}
+
+// signal converts the raw data of a cell to physical units
+func (m *MSM) signal(sat MSMSatellite, id int, sd msmSatData, raw msmSigData) MSMSignal {
+	sig := MSMSignal{ID: id, Code: MSMSignalCode(m.System, id)}
+	sig.Frequency = frequency(m.System, sig.Code, sat)
+
+	// Whole milliseconds are only sent from MSM4 on
+	roughMs := sd.fractionMs
+	roughValid := true
+	if m.Level >= 4 {
+		roughMs += float64(sd.wholeMs)
+		roughValid = sd.hasWholeMs
+	}
+
+	extended := m.Level >= 6
+	prScale, cpScale := 1.0/(1<<24), 1.0/(1<<29)
+	prInvalid, cpInvalid := int64(-1<<14), int64(-1<<21)
+	if extended {
+		prScale, cpScale = 1.0/(1<<29), 1.0/(1<<31)
+		prInvalid, cpInvalid = -1<<19, -1<<23
+	}
+
+	if m.Level != 2 && roughValid && raw.pseudoRange != prInvalid {
+		sig.PseudoRange = (roughMs + float64(raw.pseudoRange)*prScale) * rangeMs
+		sig.HasPseudoRange = true
+	}
+	if m.Level >= 2 {
+		if roughValid && raw.phaseRange != cpInvalid {
+			sig.PhaseRange = (roughMs + float64(raw.phaseRange)*cpScale) * rangeMs
+			sig.HasPhaseRange = true
+		}
+		if extended {
+			sig.LockTime = extendedLockTime(raw.lock)
+		} else {
+			sig.LockTime = lockTime(raw.lock)
+		}
+		sig.HalfCycle = raw.halfCycle
+	}
+	if m.Level >= 4 {
+		if extended {
+			sig.CNR = float64(raw.cnr) / 16
+		} else {
+			sig.CNR = float64(raw.cnr)
+		}
+	}
+	if (m.Level == 5 || m.Level == 7) && sd.hasRate && raw.rate != -1<<14 {
+		sig.PhaseRangeRate = float64(sd.rate) + float64(raw.rate)*0.0001
+		sig.HasPhaseRangeRate = true
+	}
+	return sig
+}
+
+// lockTime converts the 4-bit MSM lock time indicator to the minimum lock
+// time it stands for
+func lockTime(indicator uint64) time.Duration {
+	if indicator == 0 {
+		return 0
+	}
+	return time.Duration(1<<(indicator+4)) * time.Millisecond
+}
+
+// extendedLockTime converts the 10-bit MSM6/MSM7 lock time indicator to
+// the minimum lock time it stands for. Resolution halves every 32 steps
+// after the first 64; values above 704 are reserved and treated as 704.
+func extendedLockTime(indicator uint64) time.Duration {
+	i := int64(indicator)
+	if i < 64 {
+		return time.Duration(i) * time.Millisecond
+	}
+	if i > 704 {
+		i = 704
+	}
+	k := (i-64)/32 + 1
+	ms := int64(1)<<uint(k)*(i-64-32*(k-1)) + int64(1)<<uint(k+5)
+	return time.Duration(ms) * time.Millisecond
+}
+
+// satellitePRN converts a satellite mask position to a PRN. SBAS PRNs
+// start at 120 and QZSS PRNs at 193.
+func satellitePRN(system string, id int) int {
+	switch system {
+	case "SBAS":
+		return id + 119
+	case "QZS":
+		return id + 192
+	default:
+		return id
+	}
+}
+
+// frequency returns the carrier frequency of a signal, or 0 if unknown
+func frequency(system, code string, sat MSMSatellite) float64 {
+	if code == "" {
+		return 0
+	}
+	band := code[0]
+	if system == "GLO" {
+		if !sat.HasChannel {
+			return 0
+		}
+		switch band {
+		case '1':
+			return 1602e6 + float64(sat.Channel)*0.5625e6
+		case '2':
+			return 1246e6 + float64(sat.Channel)*0.4375e6
+		}
+		return 0
+	}
+	return bandFrequencies[system][band]
+}
+
+// Time resolves the epoch of the message to UTC. The epoch only gives the
+// time within the week (GLONASS: the day of week and time of day), so the
+// week is taken as the one that puts the epoch closest to ref, normally
+// the time of reception.
+func (m *MSM) Time(ref time.Time) time.Time {
+	ref = ref.UTC()
+
+	if m.System == "GLO" {
+		// GLONASS time is UTC(SU) + 3 h; a day of week of 7 means unknown
+		offset := 3 * time.Hour
+		dow := int(m.Epoch >> 27)
+		ms := time.Duration(m.Epoch&(1<<27-1)) * time.Millisecond
+		if dow == 7 {
+			return nearest(ref.Add(offset), ms, 24*time.Hour).Add(-offset)
+		}
+		return nearest(ref.Add(offset), time.Duration(dow)*24*time.Hour+ms, 7*24*time.Hour).Add(-offset)
+	}
+
+	// GPS, Galileo, QZSS, SBAS and NavIC time are GPS time; BeiDou time
+	// is 14 s behind it
+	offset := LeapSeconds * time.Second
+	if m.System == "BDS" {
+		offset -= 14 * time.Second
+	}
+	tow := time.Duration(m.Epoch) * time.Millisecond
+	return nearest(ref.Add(offset), tow, 7*24*time.Hour).Add(-offset)
+}
+
+// nearest returns the time at the given offset into the period (a day or
+// a week starting Sunday 00:00) closest to ref
+func nearest(ref time.Time, offset, period time.Duration) time.Time {
+	start := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, time.UTC)
+	if period > 24*time.Hour {
+		start = start.AddDate(0, 0, -int(start.Weekday()))
+	}
+
+	t := start.Add(offset)
+	if diff := t.Sub(ref); diff > period/2 {
+		t = t.Add(-period)
+	} else if diff < -period/2 {
+		t = t.Add(period)
+	}
+	return t
+}
+
+// EncodeMSM encodes observations as an MSM4, MSM5, MSM6 or MSM7 of their
+// GNSS. Satellites and signals are placed in the masks by their IDs, so
+// observations decoded from any level can be encoded at another. Values
+// that do not fit the fields of the level are sent as invalid.
+func EncodeMSM(m *MSM, level int) ([]byte, error) {
+	if level < 4 || level > 7 {
+		return nil, fmt.Errorf("cannot encode MSM%d", level)
+	}
+	system := -1
+	for i, s := range msmSystems {
+		if s == m.System {
+			system = i
+		}
+	}
+	if system < 0 {
+		return nil, fmt.Errorf("unknown GNSS %q", m.System)
+	}
+	if m.StationID < 0 || m.StationID > 4095 {
+		return nil, fmt.Errorf("station ID %d out of range", m.StationID)
+	}
+	if m.IODS < 0 || m.IODS > 7 {
+		return nil, fmt.Errorf("IODS %d out of range", m.IODS)
+	}
+
+	// Build the satellite and signal masks
+	var satMask, sigMask uint64
+	sats := make(map[int]MSMSatellite)
+	for _, sat := range m.Satellites {
+		if sat.ID < 1 || sat.ID > 64 {
+			return nil, fmt.Errorf("satellite ID %d out of range", sat.ID)
+		}
+		if _, ok := sats[sat.ID]; ok {
+			return nil, fmt.Errorf("satellite ID %d repeated", sat.ID)
+		}
+		sats[sat.ID] = sat
+		satMask |= 1 << uint(64-sat.ID)
+		for _, sig := range sat.Signals {
+			if sig.ID < 1 || sig.ID > 32 {
+				return nil, fmt.Errorf("signal %q of satellite %d has no MSM signal ID", sig.Code, sat.ID)
+			}
+			sigMask |= 1 << uint(32-sig.ID)
+		}
+	}
+	var satIDs, sigIDs []int
+	for id := 1; id <= 64; id++ {
+		if satMask&(1<<uint(64-id)) != 0 {
+			satIDs = append(satIDs, id)
+		}
+	}
+	for id := 1; id <= 32; id++ {
+		if sigMask&(1<<uint(32-id)) != 0 {
+			sigIDs = append(sigIDs, id)
+		}
+	}
+	if len(satIDs)*len(sigIDs) > 64 {
+		return nil, fmt.Errorf("cell mask of %d satellites and %d signals exceeds 64 bits", len(satIDs), len(sigIDs))
+	}
+
+	var w BitWriter
+	w.Uint(12, uint64(1070+10*system+level))
+	w.Uint(12, uint64(m.StationID))
+	w.Uint(30, uint64(m.Epoch))
+	w.Bool(m.MultipleMessage)
+	w.Uint(3, uint64(m.IODS))
+	w.Uint(7, 0) // Reserved
+	w.Uint(2, uint64(m.ClockSteering))
+	w.Uint(2, uint64(m.ExternalClock))
+	w.Bool(m.Smoothing)
+	w.Uint(3, uint64(m.SmoothingInterval))
+	w.Uint(64, satMask)
+	w.Uint(32, sigMask)
+
+	// The cell mask, collecting the signals of each cell with their
+	// satellite's rough values
+	type cell struct {
+		sat msmSatData
+		sig MSMSignal
+	}
+	var cells []cell
+	rough := make([]msmSatData, len(satIDs))
+	for i, id := range satIDs {
+		sat := sats[id]
+		rough[i] = roughValues(m.System, sat)
+		for _, sigID := range sigIDs {
+			found := false
+			for _, sig := range sat.Signals {
+				if sig.ID == sigID {
+					cells = append(cells, cell{sat: rough[i], sig: sig})
+					found = true
+					break
+				}
+			}
+			w.Bool(found)
+		}
+	}
+
+	// Satellite data: each field for every satellite in turn
+	info := level == 5 || level == 7
+	for _, sd := range rough {
+		w.Uint(8, sd.wholeMs)
+	}
+	if info {
+		for _, sd := range rough {
+			w.Uint(4, uint64(sd.info))
+		}
+	}
+	for _, sd := range rough {
+		w.Uint(10, uint64(math.Round(sd.fractionMs*1024)))
+	}
+	if info {
+		for _, sd := range rough {
+			w.Int(14, sd.rate)
+		}
+	}
+
+	// Signal data: each field for every cell in turn
+	extended := level >= 6
+	prBits, cpBits, cnrBits := 15, 22, 6
+	prScale, cpScale, cnrScale := 1.0/(1<<24), 1.0/(1<<29), 1.0
+	if extended {
+		prBits, cpBits, cnrBits = 20, 24, 10
+		prScale, cpScale, cnrScale = 1.0/(1<<29), 1.0/(1<<31), 16
+	}
+	for _, c := range cells {
+		w.Int(prBits, fineValue(c.sig.PseudoRange, c.sig.HasPseudoRange, c.sat, prScale, prBits))
+	}
+	for _, c := range cells {
+		w.Int(cpBits, fineValue(c.sig.PhaseRange, c.sig.HasPhaseRange, c.sat, cpScale, cpBits))
+	}
+	for _, c := range cells {
+		if extended {
+			w.Uint(10, uint64(sort.Search(705, func(i int) bool { return extendedLockTime(uint64(i)) > c.sig.LockTime })-1))
+		} else {
+			w.Uint(4, uint64(sort.Search(16, func(i int) bool { return lockTime(uint64(i)) > c.sig.LockTime })-1))
+		}
+	}
+	for _, c := range cells {
+		w.Bool(c.sig.HalfCycle)
+	}
+	for _, c := range cells {
+		cnr := math.Round(c.sig.CNR * cnrScale)
+		w.Uint(cnrBits, uint64(math.Max(0, math.Min(cnr, float64(int(1)<<uint(cnrBits)-1)))))
+	}
+	if info {
+		for _, c := range cells {
+			rate := int64(-1 << 14)
+			if c.sig.HasPhaseRangeRate && c.sat.hasRate {
+				if fine := math.Round((c.sig.PhaseRangeRate - float64(c.sat.rate)) / 0.0001); math.Abs(fine) < 1<<14 {
+					rate = int64(fine)
+				}
+			}
+			w.Int(15, rate)
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+// roughValues derives the rough range and rate a satellite's signals are
+// sent relative to, from its first signal with a range and a rate, and the
+// extended satellite information
+func roughValues(system string, sat MSMSatellite) msmSatData {
+	sd := msmSatData{wholeMs: 255, rate: -8192}
+	if system == "GLO" {
+		// The extended information holds channels -7 to +6; 15 is unknown
+		sd.info = 15
+		if sat.HasChannel && sat.Channel >= -7 && sat.Channel <= 6 {
+			sd.info = sat.Channel + 7
+		}
+	}
+
+	for _, sig := range sat.Signals {
+		r, ok := sig.PseudoRange, sig.HasPseudoRange
+		if !ok {
+			r, ok = sig.PhaseRange, sig.HasPhaseRange
+		}
+		if !ok {
+			continue
+		}
+		// Rough ranges have a resolution of 1/1024 ms
+		units := int64(math.Round(r / rangeMs * 1024))
+		if units >= 0 && units < 255*1024 {
+			sd.wholeMs, sd.fractionMs, sd.hasWholeMs = uint64(units/1024), float64(units%1024)/1024, true
+		}
+		break
+	}
+
+	for _, sig := range sat.Signals {
+		if sig.HasPhaseRangeRate {
+			if rate := int64(math.Round(sig.PhaseRangeRate)); rate > -8192 && rate < 8192 {
+				sd.rate, sd.hasRate = rate, true
+			}
+			break
+		}
+	}
+	return sd
+}
+
+// fineValue returns the fine part of a range relative to the rough range
+// of its satellite, or the invalid value if it is missing or does not fit
+func fineValue(r float64, ok bool, sd msmSatData, scale float64, bits int) int64 {
+	invalid := int64(-1) << uint(bits-1)
+	if !ok || !sd.hasWholeMs {
+		return invalid
+	}
+	fine := math.Round((r/rangeMs - float64(sd.wholeMs) - sd.fractionMs) / scale)
+	if math.Abs(fine) >= float64(-invalid) {
+		return invalid
+	}
+	return int64(fine)
+}
@@ -0,0 +1,210 @@
+package parser_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// msmHeader writes an MSM header with the given satellite and signal IDs
+// and cell mask
+func msmHeader(messageType int, epoch int64, sats, sigs []int, cells []bool) *bitWriter {
+	w := &bitWriter{}
+	w.put(12, int64(messageType)).put(12, 42).put(30, epoch).put(1, 0).put(3, 0).put(7, 0)
+	w.put(2, 0).put(2, 0).put(1, 0).put(3, 0)
+
+	var satMask, sigMask uint64
+	for _, id := range sats {
+		satMask |= 1 << uint(64-id)
+	}
+	for _, id := range sigs {
+		sigMask |= 1 << uint(32-id)
+	}
+	w.put(64, int64(satMask)).put(32, int64(sigMask))
+	for _, cell := range cells {
+		if cell {
+			w.put(1, 1)
+		} else {
+			w.put(1, 0)
+		}
+	}
+	return w
+}
+
+// near reports whether two values agree to within tolerance
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestDecodeMSM7(t *testing.T) {
+	// Two GPS satellites with L1 C/A and L2C (L), the second without L2
+	w := msmHeader(1077, 432018000, []int{5, 12}, []int{2, 16}, []bool{true, true, true, false})
+	w.put(8, 72).put(8, 80)      // Whole milliseconds
+	w.put(4, 0).put(4, 0)        // Extended info
+	w.put(10, 512).put(10, 256)  // Fractional milliseconds
+	w.put(14, -300).put(14, 150) // Rough phase range rates
+	w.put(20, 1000).put(20, -2000).put(20, 0)
+	w.put(24, 5000).put(24, -8388608).put(24, 100) // The second phase is invalid
+	w.put(10, 50).put(10, 100).put(10, 704)
+	w.put(1, 0).put(1, 1).put(1, 0)
+	w.put(10, 720).put(10, 616).put(10, 800)
+	w.put(15, 1234).put(15, -16384).put(15, -5) // The second rate is invalid
+
+	msm, ok := decode(t, w.data).(*parser.MSM)
+	if !ok {
+		t.Fatal("Expected an *MSM")
+	}
+	if msm.System != "GPS" || msm.Level != 7 || msm.StationID != 42 || len(msm.Satellites) != 2 {
+		t.Fatalf("Unexpected header: %+v", msm)
+	}
+
+	const lightMs = parser.SpeedOfLight / 1000
+	sat := msm.Satellites[0]
+	if sat.PRN != 5 || len(sat.Signals) != 2 {
+		t.Fatalf("Unexpected first satellite: %+v", sat)
+	}
+	l1 := sat.Signals[0]
+	if l1.Code != "1C" || l1.Frequency != 1575.42e6 || !near(l1.Wavelength(), 0.1903, 1e-4) {
+		t.Errorf("Unexpected L1 signal: %+v", l1)
+	}
+	if !l1.HasPseudoRange || !near(l1.PseudoRange, (72.5+1000/math.Pow(2, 29))*lightMs, 1e-6) {
+		t.Errorf("Unexpected L1 pseudorange %f", l1.PseudoRange)
+	}
+	if !l1.HasPhaseRange || !near(l1.PhaseRange, (72.5+5000/math.Pow(2, 31))*lightMs, 1e-6) {
+		t.Errorf("Unexpected L1 phase range %f", l1.PhaseRange)
+	}
+	if !l1.HasPhaseRangeRate || !near(l1.PhaseRangeRate, -299.8766, 1e-9) {
+		t.Errorf("Unexpected L1 phase range rate %f", l1.PhaseRangeRate)
+	}
+	if l1.LockTime != 50*time.Millisecond || l1.HalfCycle || l1.CNR != 45 {
+		t.Errorf("Unexpected L1 lock, half-cycle or CNR: %+v", l1)
+	}
+
+	l2 := sat.Signals[1]
+	if l2.Code != "2L" || l2.HasPhaseRange || l2.HasPhaseRangeRate || !l2.HasPseudoRange {
+		t.Errorf("Expected L2 with only a pseudorange, got %+v", l2)
+	}
+	if l2.LockTime != 144*time.Millisecond || !l2.HalfCycle || l2.CNR != 38.5 {
+		t.Errorf("Unexpected L2 lock, half-cycle or CNR: %+v", l2)
+	}
+
+	sat = msm.Satellites[1]
+	if sat.PRN != 12 || len(sat.Signals) != 1 {
+		t.Fatalf("Unexpected second satellite: %+v", sat)
+	}
+	l1 = sat.Signals[0]
+	if !near(l1.PseudoRange, 80.25*lightMs, 1e-6) || !near(l1.PhaseRangeRate, 149.9995, 1e-9) || l1.CNR != 50 {
+		t.Errorf("Unexpected second satellite signal: %+v", l1)
+	}
+	if l1.LockTime != 67108864*time.Millisecond {
+		t.Errorf("Expected the maximum lock time, got %v", l1.LockTime)
+	}
+}
+
+func TestDecodeMSMGLONASS(t *testing.T) {
+	// MSM4 carries no frequency channel, so the frequency is unknown
+	w := msmHeader(1084, 0, []int{3}, []int{2}, []bool{true})
+	w.put(8, 70).put(10, 0)
+	w.put(15, -16384).put(22, 1000).put(4, 4).put(1, 0).put(6, 40)
+
+	msm := decode(t, w.data).(*parser.MSM)
+	sig := msm.Satellites[0].Signals[0]
+	if msm.System != "GLO" || msm.Satellites[0].HasChannel || sig.Frequency != 0 {
+		t.Errorf("Unexpected MSM4: %+v", msm)
+	}
+	if sig.HasPseudoRange || !sig.HasPhaseRange || sig.LockTime != 256*time.Millisecond || sig.CNR != 40 {
+		t.Errorf("Unexpected MSM4 signal: %+v", sig)
+	}
+
+	// MSM5 gives the channel in the extended satellite information
+	w = msmHeader(1085, 0, []int{3}, []int{2, 8}, []bool{true, true})
+	w.put(8, 70).put(4, 10).put(10, 0).put(14, 0)
+	w.put(15, 0).put(15, 0).put(22, 0).put(22, 0).put(4, 0).put(4, 0)
+	w.put(1, 0).put(1, 0).put(6, 0).put(6, 0).put(15, 0).put(15, 0)
+
+	sat := decode(t, w.data).(*parser.MSM).Satellites[0]
+	if !sat.HasChannel || sat.Channel != 3 {
+		t.Fatalf("Expected channel 3, got %+v", sat)
+	}
+	if sat.Signals[0].Frequency != 1603.6875e6 || sat.Signals[1].Code != "2C" || sat.Signals[1].Frequency != 1247.3125e6 {
+		t.Errorf("Unexpected FDMA frequencies: %+v", sat.Signals)
+	}
+}
+
+func TestDecodeMSMLevels(t *testing.T) {
+	// MSM1 has only pseudoranges modulo 1 ms; MSM2 only phase
+	w := msmHeader(1121, 0, []int{7}, []int{2}, []bool{true})
+	w.put(10, 256).put(15, 0)
+	msm := decode(t, w.data).(*parser.MSM)
+	sig := msm.Satellites[0].Signals[0]
+	if msm.System != "BDS" || sig.Code != "2I" || !near(sig.PseudoRange, 0.25*parser.SpeedOfLight/1000, 1e-6) || sig.HasPhaseRange {
+		t.Errorf("Unexpected MSM1 signal: %+v", sig)
+	}
+
+	w = msmHeader(1112, 0, []int{1}, []int{2}, []bool{true})
+	w.put(10, 0).put(22, 0).put(4, 0).put(1, 1)
+	msm = decode(t, w.data).(*parser.MSM)
+	sig = msm.Satellites[0].Signals[0]
+	if msm.System != "QZS" || msm.Satellites[0].PRN != 193 || sig.HasPseudoRange || !sig.HasPhaseRange || !sig.HalfCycle {
+		t.Errorf("Unexpected MSM2: %+v", msm)
+	}
+
+	// Truncated signal data is rejected
+	if _, err := parser.DecodeMSM(w.data[:len(w.data)-4]); err == nil {
+		t.Error("Expected an error for a truncated MSM")
+	}
+
+	// More than 64 cells cannot be encoded
+	w = msmHeader(1074, 0, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, []int{2, 3, 4, 8, 9, 10, 15, 16}, nil)
+	if _, err := parser.DecodeMSM(w.data); err == nil {
+		t.Error("Expected an error for an oversized cell mask")
+	}
+}
+
+func TestMSMTime(t *testing.T) {
+	ref := time.Date(2026, 10, 16, 12, 0, 5, 0, time.UTC) // A Friday
+	want := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	// GPS time of week is 18 s ahead of UTC
+	gpsTOW := int64((5*86400 + 12*3600 + 18) * 1000)
+	tests := []struct {
+		name string
+		msm  parser.MSM
+		ref  time.Time
+		want time.Time
+	}{
+		{"GPS", parser.MSM{System: "GPS", Epoch: uint32(gpsTOW)}, ref, want},
+		{"Galileo", parser.MSM{System: "GAL", Epoch: uint32(gpsTOW)}, ref, want},
+		{"BeiDou", parser.MSM{System: "BDS", Epoch: uint32(gpsTOW - 14000)}, ref, want},
+		{
+			// Received just after the GPS week rolled over
+			"GPS previous week",
+			parser.MSM{System: "GPS", Epoch: 604790000},
+			time.Date(2026, 10, 18, 0, 0, 10, 0, time.UTC),
+			time.Date(2026, 10, 17, 23, 59, 32, 0, time.UTC),
+		},
+		{
+			// 22:30 UTC is 01:30 on Saturday in GLONASS time
+			"GLONASS",
+			parser.MSM{System: "GLO", Epoch: 6<<27 | 5400000},
+			time.Date(2026, 10, 16, 22, 30, 1, 0, time.UTC),
+			time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC),
+		},
+		{
+			"GLONASS unknown day",
+			parser.MSM{System: "GLO", Epoch: 7<<27 | 86399000},
+			time.Date(2026, 10, 16, 21, 0, 1, 0, time.UTC),
+			time.Date(2026, 10, 16, 20, 59, 59, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.msm.Time(tt.ref); !got.Equal(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+)
+
+// StationARP is the antenna reference point of a reference station from
+// message 1005, or 1006 which adds the antenna height
+type StationARP struct {
+	StationID        int     `json:"station_id"`
+	ITRFYear         int     `json:"itrf_year"` // ITRF realisation year, 0 if unspecified
+	GPS              bool    `json:"gps"`       // Observations of each constellation are provided
+	GLONASS          bool    `json:"glonass"`
+	Galileo          bool    `json:"galileo"`
+	ReferenceStation bool    `json:"reference_station"` // False for a physical station, true for a virtual or non-physical one
+	X                float64 `json:"x"`                 // ECEF coordinates of the ARP in metres
+	Y                float64 `json:"y"`
+	Z                float64 `json:"z"`
+	SingleOscillator bool    `json:"single_oscillator"` // All raw data is from one receiver oscillator
+	QuarterCycle     int     `json:"quarter_cycle"`     // Quarter cycle indicator, 0 if unknown
+
+	HasHeight     bool    `json:"has_height"`     // Antenna height present (1006)
+	AntennaHeight float64 `json:"antenna_height"` // Height of the ARP above the marker in metres
+}
+
+// AntennaDescriptor describes the antenna of a reference station from
+// message 1007, or 1008 which adds the serial number
+type AntennaDescriptor struct {
+	StationID  int    `json:"station_id"`
+	Descriptor string `json:"descriptor"` // IGS antenna name, e.g. "TRM59800.00     NONE"
+	SetupID    int    `json:"setup_id"`   // Changes whenever the antenna setup changes
+	Serial     string `json:"serial"`
+}
+
+// ReceiverDescriptor describes the antenna and receiver of a reference
+// station from message 1033
+type ReceiverDescriptor struct {
+	StationID      int    `json:"station_id"`
+	Antenna        string `json:"antenna"`
+	SetupID        int    `json:"setup_id"`
+	AntennaSerial  string `json:"antenna_serial"`
+	Receiver       string `json:"receiver"`
+	Firmware       string `json:"firmware"`
+	ReceiverSerial string `json:"receiver_serial"`
+}
+
+// GLONASSBiases holds the GLONASS code-phase biases of message 1230
+type GLONASSBiases struct {
+	StationID int           `json:"station_id"`
+	Aligned   bool          `json:"aligned"` // L1 and L2 code and phase are aligned in the observations
+	Biases    []GLONASSBias `json:"biases"`
+}
+
+// GLONASSBias is the code-phase bias of one GLONASS signal
+type GLONASSBias struct {
+	Signal string  `json:"signal"` // "L1 C/A", "L1 P", "L2 C/A" or "L2 P"
+	Bias   float64 `json:"bias"`   // Metres
+}
+
+// glonassBiasSignals lists the signals of the 1230 mask, most significant bit first
+var glonassBiasSignals = []string{"L1 C/A", "L1 P", "L2 C/A", "L2 P"}
+
+// DecodeStationARP decodes a 1005 or 1006 payload
+func DecodeStationARP(payload []byte) (*StationARP, error) {
+	r := NewBitReader(payload)
+	messageType := int(r.Uint(12))
+	if err := expectType(r, messageType, 1005, 1006); err != nil {
+		return nil, err
+	}
+
+	arp := &StationARP{
+		StationID:        int(r.Uint(12)),
+		ITRFYear:         int(r.Uint(6)),
+		GPS:              r.Bool(),
+		GLONASS:          r.Bool(),
+		Galileo:          r.Bool(),
+		ReferenceStation: r.Bool(),
+	}
+	// Coordinates are 38-bit signed values in units of 0.1 mm
+	arp.X = float64(r.Int(38)) * 0.0001
+	arp.SingleOscillator = r.Bool()
+	r.Skip(1) // Reserved
+	arp.Y = float64(r.Int(38)) * 0.0001
+	arp.QuarterCycle = int(r.Uint(2))
+	arp.Z = float64(r.Int(38)) * 0.0001
+	if messageType == 1006 {
+		arp.HasHeight = true
+		arp.AntennaHeight = float64(r.Uint(16)) * 0.0001
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return arp, nil
+}
+
+// DecodeAntennaDescriptor decodes a 1007 or 1008 payload
+func DecodeAntennaDescriptor(payload []byte) (*AntennaDescriptor, error) {
+	r := NewBitReader(payload)
+	messageType := int(r.Uint(12))
+	if err := expectType(r, messageType, 1007, 1008); err != nil {
+		return nil, err
+	}
+
+	antenna := &AntennaDescriptor{StationID: int(r.Uint(12))}
+	antenna.Descriptor = r.String(int(r.Uint(8)))
+	antenna.SetupID = int(r.Uint(8))
+	if messageType == 1008 {
+		antenna.Serial = r.String(int(r.Uint(8)))
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return antenna, nil
+}
+
+// DecodeReceiverDescriptor decodes a 1033 payload
+func DecodeReceiverDescriptor(payload []byte) (*ReceiverDescriptor, error) {
+	r := NewBitReader(payload)
+	if err := expectType(r, int(r.Uint(12)), 1033); err != nil {
+		return nil, err
+	}
+
+	receiver := &ReceiverDescriptor{StationID: int(r.Uint(12))}
+	receiver.Antenna = r.String(int(r.Uint(8)))
+	receiver.SetupID = int(r.Uint(8))
+	receiver.AntennaSerial = r.String(int(r.Uint(8)))
+	receiver.Receiver = r.String(int(r.Uint(8)))
+	receiver.Firmware = r.String(int(r.Uint(8)))
+	receiver.ReceiverSerial = r.String(int(r.Uint(8)))
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return receiver, nil
+}
+
+// DecodeGLONASSBiases decodes a 1230 payload
+func DecodeGLONASSBiases(payload []byte) (*GLONASSBiases, error) {
+	r := NewBitReader(payload)
+	if err := expectType(r, int(r.Uint(12)), 1230); err != nil {
+		return nil, err
+	}
+
+	biases := &GLONASSBiases{StationID: int(r.Uint(12))}
+	biases.Aligned = r.Bool()
+	r.Skip(3) // Reserved
+	mask := r.Uint(4)
+	for i, signal := range glonassBiasSignals {
+		if mask&(1<<uint(3-i)) != 0 {
+			// Biases are 16-bit signed values in units of 0.02 m
+			biases.Biases = append(biases.Biases, GLONASSBias{Signal: signal, Bias: float64(r.Int(16)) * 0.02})
+		}
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return biases, nil
+}
+
+// maxText is the longest descriptor string RTCM 3 allows
+const maxText = 31
+
+// maxCoordinate is the largest ARP coordinate, in units of 0.1 mm, that
+// fits the signed 38-bit fields of 1005/1006
+const maxCoordinate = 1<<37 - 1
+
+// EncodeStationARP encodes a 1005, or a 1006 when the antenna height is set
+func EncodeStationARP(arp *StationARP) ([]byte, error) {
+	if arp.StationID < 0 || arp.StationID > 4095 {
+		return nil, fmt.Errorf("station ID %d out of range", arp.StationID)
+	}
+	if arp.ITRFYear < 0 || arp.ITRFYear > 63 {
+		return nil, fmt.Errorf("ITRF realisation year %d out of range", arp.ITRFYear)
+	}
+	if arp.QuarterCycle < 0 || arp.QuarterCycle > 3 {
+		return nil, fmt.Errorf("quarter cycle indicator %d out of range", arp.QuarterCycle)
+	}
+	var coordinates [3]int64
+	for i, c := range []struct {
+		axis  string
+		value float64
+	}{{"X", arp.X}, {"Y", arp.Y}, {"Z", arp.Z}} {
+		v := math.Round(c.value / 0.0001)
+		if !(v >= -maxCoordinate-1 && v <= maxCoordinate) {
+			return nil, fmt.Errorf("ARP %s coordinate %.4f m out of range", c.axis, c.value)
+		}
+		coordinates[i] = int64(v)
+	}
+	height := math.Round(arp.AntennaHeight / 0.0001)
+	if arp.HasHeight && !(height >= 0 && height <= 0xFFFF) {
+		return nil, fmt.Errorf("antenna height %.4f m out of range", arp.AntennaHeight)
+	}
+
+	var w BitWriter
+	if arp.HasHeight {
+		w.Uint(12, 1006)
+	} else {
+		w.Uint(12, 1005)
+	}
+	w.Uint(12, uint64(arp.StationID))
+	w.Uint(6, uint64(arp.ITRFYear))
+	w.Bool(arp.GPS)
+	w.Bool(arp.GLONASS)
+	w.Bool(arp.Galileo)
+	w.Bool(arp.ReferenceStation)
+	w.Int(38, coordinates[0])
+	w.Bool(arp.SingleOscillator)
+	w.Uint(1, 0) // Reserved
+	w.Int(38, coordinates[1])
+	w.Uint(2, uint64(arp.QuarterCycle))
+	w.Int(38, coordinates[2])
+	if arp.HasHeight {
+		w.Uint(16, uint64(height))
+	}
+	return w.Bytes(), nil
+}
+
+// EncodeAntennaDescriptor encodes a 1008, or a 1007 when there is no
+// serial number
+func EncodeAntennaDescriptor(antenna *AntennaDescriptor) ([]byte, error) {
+	if antenna.StationID < 0 || antenna.StationID > 4095 {
+		return nil, fmt.Errorf("station ID %d out of range", antenna.StationID)
+	}
+	if antenna.SetupID < 0 || antenna.SetupID > 255 {
+		return nil, fmt.Errorf("antenna setup ID %d out of range", antenna.SetupID)
+	}
+
+	var w BitWriter
+	if antenna.Serial == "" {
+		w.Uint(12, 1007)
+	} else {
+		w.Uint(12, 1008)
+	}
+	w.Uint(12, uint64(antenna.StationID))
+	if err := writeText(&w, antenna.Descriptor); err != nil {
+		return nil, err
+	}
+	w.Uint(8, uint64(antenna.SetupID))
+	if antenna.Serial != "" {
+		if err := writeText(&w, antenna.Serial); err != nil {
+			return nil, err
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// EncodeReceiverDescriptor encodes a 1033
+func EncodeReceiverDescriptor(receiver *ReceiverDescriptor) ([]byte, error) {
+	if receiver.StationID < 0 || receiver.StationID > 4095 {
+		return nil, fmt.Errorf("station ID %d out of range", receiver.StationID)
+	}
+	if receiver.SetupID < 0 || receiver.SetupID > 255 {
+		return nil, fmt.Errorf("antenna setup ID %d out of range", receiver.SetupID)
+	}
+
+	var w BitWriter
+	w.Uint(12, 1033)
+	w.Uint(12, uint64(receiver.StationID))
+	if err := writeText(&w, receiver.Antenna); err != nil {
+		return nil, err
+	}
+	w.Uint(8, uint64(receiver.SetupID))
+	for _, text := range []string{receiver.AntennaSerial, receiver.Receiver, receiver.Firmware, receiver.ReceiverSerial} {
+		if err := writeText(&w, text); err != nil {
+			return nil, err
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// writeText appends a counted character field
+func writeText(w *BitWriter, text string) error {
+	if len(text) > maxText {
+		return fmt.Errorf("%q is longer than %d characters", text, maxText)
+	}
+	w.Uint(8, uint64(len(text)))
+	w.String(text)
+	return nil
+}
+
+// expectType checks the message type read from the start of a payload
+func expectType(r *BitReader, messageType int, types ...int) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	for _, t := range types {
+		if messageType == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected message type %d", messageType)
+}
@@ -0,0 +1,254 @@
+package pipeline
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Observation formats a Converter can produce
+const (
+	FormatMSM4   = "msm4"   // MSM4 of every GNSS
+	FormatLegacy = "legacy" // 1004 for GPS and 1012 for GLONASS
+)
+
+// Converter is a Stage that re-encodes observations for receivers that
+// only understand, or only need, one format. Converting to MSM4 turns
+// MSM5-MSM7 and the extended legacy messages 1002/1004/1010/1012 into
+// MSM4, which is about half the size of MSM7. Converting to legacy turns
+// GPS and GLONASS MSM4-MSM7 into 1004 and 1012 and drops the observations
+// of other constellations. Other messages pass through unchanged.
+//
+// Ranges are rounded to the resolution of the target format. Lock times
+// are rounded down to the target's lock time indicator, and a loss of
+// lock in the source is always sent as a lock time of 0, so that a rover
+// detects the cycle slip however coarse the target's indicator is.
+type Converter struct {
+	format   string
+	channels map[int]int               // GLONASS frequency channel by slot, from MSM5/MSM7 and 1020
+	locks    map[lockKey]time.Duration // Last source lock time of each signal
+
+	// Legacy messages carry no flag for the GNSS they are followed by, so
+	// an epoch's messages are held until its last message shows which of
+	// them is last
+	pending      []*parser.MSM
+	pendingEpoch time.Time
+}
+
+// lockKey identifies a signal of a satellite
+type lockKey struct {
+	system string
+	sat    int
+	code   string
+}
+
+// maxLegacySatellites is the number of satellites a legacy message can hold
+const maxLegacySatellites = 31
+
+// NewConverter creates a converter to FormatMSM4 or FormatLegacy
+func NewConverter(format string) (*Converter, error) {
+	if format != FormatMSM4 && format != FormatLegacy {
+		return nil, fmt.Errorf("unknown observation format %q", format)
+	}
+	return &Converter{
+		format:   format,
+		channels: make(map[int]int),
+		locks:    make(map[lockKey]time.Duration),
+	}, nil
+}
+
+// Process converts an observation message, passing other messages on
+func (c *Converter) Process(message parser.RTCMMessage) []parser.RTCMMessage {
+	if message.MessageType == 1020 {
+		if eph, err := parser.DecodeGLONASSEphemeris(message.Payload); err == nil {
+			c.channels[eph.Slot] = eph.Channel
+		}
+		return []parser.RTCMMessage{message}
+	}
+	if !isObservation(message.MessageType) {
+		return []parser.RTCMMessage{message}
+	}
+
+	// Undecodable observations are passed on rather than dropped
+	decoded, err := message.Decode()
+	obs, ok := decoded.(*parser.MSM)
+	if err != nil || !ok {
+		return []parser.RTCMMessage{message}
+	}
+	if obs.System == "GLO" {
+		for _, sat := range obs.Satellites {
+			if sat.HasChannel {
+				c.channels[sat.ID] = sat.Channel
+			}
+		}
+	}
+
+	if c.format == FormatLegacy {
+		return c.toLegacy(message, obs)
+	}
+	return c.toMSM4(message, obs)
+}
+
+// toMSM4 converts MSM5-MSM7 and extended legacy observations to MSM4.
+// MSM1-MSM3 and the non-extended legacy messages have no whole
+// milliseconds of range to convert and pass through unchanged, as does
+// MSM4 itself.
+func (c *Converter) toMSM4(message parser.RTCMMessage, obs *parser.MSM) []parser.RTCMMessage {
+	switch {
+	case obs.Level == 0 && (message.MessageType-1)%2 == 0, obs.Level >= 1 && obs.Level <= 4:
+		return []parser.RTCMMessage{message}
+	}
+
+	var sats []parser.MSMSatellite
+	for _, sat := range obs.Satellites {
+		// Legacy GPS messages may carry SBAS satellites, which have
+		// their own MSM
+		if obs.Level == 0 && obs.System == "GPS" && sat.ID > 32 {
+			continue
+		}
+		sat = c.convertSatellite(obs.System, sat)
+		if len(sat.Signals) > 0 {
+			sats = append(sats, sat)
+		}
+	}
+
+	// Split satellites over several messages when their cells do not fit
+	// one cell mask
+	var out []parser.RTCMMessage
+	groups := msmGroups(sats)
+	for i, group := range groups {
+		m := *obs
+		m.Satellites = group
+		m.MultipleMessage = obs.MultipleMessage || i < len(groups)-1
+		payload, err := parser.EncodeMSM(&m, 4)
+		if err != nil {
+			return []parser.RTCMMessage{message}
+		}
+		converted, err := newMessage(payload)
+		if err != nil {
+			return []parser.RTCMMessage{message}
+		}
+		out = append(out, converted)
+	}
+	return out
+}
+
+// toLegacy converts GPS and GLONASS MSM4-MSM7 to 1004 and 1012. The
+// messages of an epoch are held until its last message arrives.
+func (c *Converter) toLegacy(message parser.RTCMMessage, obs *parser.MSM) []parser.RTCMMessage {
+	if obs.Level == 0 {
+		return []parser.RTCMMessage{message}
+	}
+
+	var out []parser.RTCMMessage
+	epoch := obs.Time(time.Now())
+	if len(c.pending) > 0 && !epoch.Equal(c.pendingEpoch) {
+		// The last message of the previous epoch was lost
+		out = c.flush()
+	}
+	c.pendingEpoch = epoch
+
+	if (obs.System == "GPS" || obs.System == "GLO") && obs.Level >= 4 {
+		var sats []parser.MSMSatellite
+		for _, sat := range obs.Satellites {
+			if obs.System == "GLO" {
+				// 1012 needs the frequency channel, which MSM4 and MSM6 lack
+				channel, ok := c.channels[sat.ID]
+				if !ok {
+					continue
+				}
+				sat.Channel, sat.HasChannel = channel, true
+			}
+			sats = append(sats, c.convertSatellite(obs.System, sat))
+		}
+
+		for start := 0; start < len(sats); start += maxLegacySatellites {
+			end := start + maxLegacySatellites
+			if end > len(sats) {
+				end = len(sats)
+			}
+			m := *obs
+			m.Satellites = sats[start:end]
+			c.pending = append(c.pending, &m)
+		}
+	}
+
+	if !obs.MultipleMessage {
+		out = append(out, c.flush()...)
+	}
+	return out
+}
+
+// flush encodes the held legacy messages of an epoch, flagging all but
+// the last as followed by more
+func (c *Converter) flush() []parser.RTCMMessage {
+	var out []parser.RTCMMessage
+	for i, m := range c.pending {
+		m.MultipleMessage = i < len(c.pending)-1
+		messageType := 1004
+		if m.System == "GLO" {
+			messageType = 1012
+		}
+		payload, err := parser.EncodeLegacyObservations(m, messageType)
+		if err != nil {
+			continue
+		}
+		if converted, err := newMessage(payload); err == nil {
+			out = append(out, converted)
+		}
+	}
+	c.pending = nil
+	return out
+}
+
+// convertSatellite drops the signals without an MSM signal ID, such as
+// the cross-correlated GPS L2 of legacy messages, and sends a loss of lock
+// as a lock time of 0
+func (c *Converter) convertSatellite(system string, sat parser.MSMSatellite) parser.MSMSatellite {
+	signals := make([]parser.MSMSignal, 0, len(sat.Signals))
+	for _, sig := range sat.Signals {
+		if sig.ID == 0 {
+			continue
+		}
+		key := lockKey{system: system, sat: sat.ID, code: sig.Code}
+		previous, seen := c.locks[key]
+		c.locks[key] = sig.LockTime
+		if seen && sig.LockTime < previous {
+			sig.LockTime = 0
+		}
+		signals = append(signals, sig)
+	}
+	sat.Signals = signals
+	return sat
+}
+
+// msmGroups splits satellites into groups whose cell masks fit 64 bits
+func msmGroups(sats []parser.MSMSatellite) [][]parser.MSMSatellite {
+	var groups [][]parser.MSMSatellite
+	var group []parser.MSMSatellite
+	signals := make(map[int]bool)
+	for _, sat := range sats {
+		union := make(map[int]bool, len(signals))
+		for id := range signals {
+			union[id] = true
+		}
+		for _, sig := range sat.Signals {
+			union[sig.ID] = true
+		}
+
+		if len(group) > 0 && (len(group)+1)*len(union) > 64 {
+			groups = append(groups, group)
+			group, union = nil, make(map[int]bool)
+			for _, sig := range sat.Signals {
+				union[sig.ID] = true
+			}
+		}
+		group = append(group, sat)
+		signals = union
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
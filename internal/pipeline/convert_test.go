@@ -0,0 +1,249 @@
+package pipeline
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Epochs of Thursday 00:00 GPS time in GPS and GLONASS time
+const (
+	gpsEpoch = 4 * 86400000
+	gloEpoch = 4<<27 | (3*3600000 - 18000)
+)
+
+// msmMessage is an MSM of station 7 with sats satellites on L1 and L2
+func msmMessage(t *testing.T, system string, level int, epoch uint32, multiple bool, sats int, lock time.Duration) parser.RTCMMessage {
+	t.Helper()
+
+	m := &parser.MSM{System: system, StationID: 7, Epoch: epoch, MultipleMessage: multiple}
+	for id := 1; id <= sats; id++ {
+		sat := parser.MSMSatellite{ID: id, Channel: id - 7, HasChannel: system == "GLO"}
+		for _, sigID := range []int{2, 9} {
+			pr := 21000000 + float64(id)*1000 + float64(sigID)
+			sat.Signals = append(sat.Signals, parser.MSMSignal{
+				ID: sigID, Code: parser.MSMSignalCode(system, sigID),
+				PseudoRange: pr, HasPseudoRange: true, PhaseRange: pr + 1.5, HasPhaseRange: true,
+				LockTime: lock, CNR: 42,
+			})
+		}
+		m.Satellites = append(m.Satellites, sat)
+	}
+	payload, err := parser.EncodeMSM(m, level)
+	if err != nil {
+		t.Fatalf("EncodeMSM failed: %v", err)
+	}
+	message, err := newMessage(payload)
+	if err != nil {
+		t.Fatalf("newMessage failed: %v", err)
+	}
+	return message
+}
+
+// decodeAll decodes converted observation messages
+func decodeAll(t *testing.T, messages []parser.RTCMMessage) []*parser.MSM {
+	t.Helper()
+
+	var result []*parser.MSM
+	for _, m := range messages {
+		decoded, err := m.Decode()
+		if err != nil {
+			t.Fatalf("Decode of %d failed: %v", m.MessageType, err)
+		}
+		result = append(result, decoded.(*parser.MSM))
+	}
+	return result
+}
+
+func newConverter(t *testing.T, format string) *Converter {
+	t.Helper()
+
+	c, err := NewConverter(format)
+	if err != nil {
+		t.Fatalf("NewConverter failed: %v", err)
+	}
+	return c
+}
+
+func TestConvertToMSM4(t *testing.T) {
+	c := newConverter(t, FormatMSM4)
+
+	// Other messages and MSM4 pass unchanged
+	station, msm4 := stationMessage(t), msmMessage(t, "GAL", 4, gpsEpoch, false, 2, time.Minute)
+	for _, m := range []parser.RTCMMessage{station, msm4} {
+		if out := c.Process(m); len(out) != 1 || !bytes.Equal(out[0].Frame, m.Frame) {
+			t.Errorf("Expected %d passed unchanged, got %v", m.MessageType, types(out))
+		}
+	}
+
+	msm7 := msmMessage(t, "GLO", 7, gloEpoch, true, 3, time.Minute)
+	out := c.Process(msm7)
+	if !reflect.DeepEqual(types(out), []int{1084}) {
+		t.Fatalf("Expected a 1084, got %v", types(out))
+	}
+	converted := decodeAll(t, out)[0]
+	original, _ := msm7.Decode()
+	if converted.StationID != 7 || converted.Epoch != gloEpoch || !converted.MultipleMessage || len(converted.Satellites) != 3 {
+		t.Errorf("Unexpected header %+v", converted)
+	}
+	for i, sat := range converted.Satellites {
+		for j, sig := range sat.Signals {
+			want := original.(*parser.MSM).Satellites[i].Signals[j]
+			if sig.ID != want.ID || math.Abs(sig.PseudoRange-want.PseudoRange) > 0.02 || math.Abs(sig.PhaseRange-want.PhaseRange) > 0.001 {
+				t.Errorf("Expected %+v, got %+v", want, sig)
+			}
+			if sig.LockTime != 32768*time.Millisecond {
+				t.Errorf("Expected the lock time rounded down to 32.768 s, got %v", sig.LockTime)
+			}
+		}
+	}
+}
+
+func TestConvertLegacyToMSM4(t *testing.T) {
+	m := &parser.MSM{System: "GPS", StationID: 7, Epoch: gpsEpoch}
+	for _, id := range []int{5, 12, 40} {
+		m.Satellites = append(m.Satellites, parser.MSMSatellite{ID: id, Signals: []parser.MSMSignal{
+			{Code: "1C", PseudoRange: 22e6, HasPseudoRange: true, LockTime: time.Minute},
+			{Code: map[int]string{5: "2P", 12: "2D", 40: "2X"}[id], PseudoRange: 22e6 + 2, HasPseudoRange: true},
+		}})
+	}
+	payload, err := parser.EncodeLegacyObservations(m, 1004)
+	if err != nil {
+		t.Fatalf("EncodeLegacyObservations failed: %v", err)
+	}
+	legacy, err := newMessage(payload)
+	if err != nil {
+		t.Fatalf("newMessage failed: %v", err)
+	}
+
+	out := newConverter(t, FormatMSM4).Process(legacy)
+	if !reflect.DeepEqual(types(out), []int{1074}) {
+		t.Fatalf("Expected a 1074, got %v", types(out))
+	}
+	converted := decodeAll(t, out)[0]
+	if converted.Epoch != gpsEpoch || converted.MultipleMessage || len(converted.Satellites) != 2 {
+		t.Fatalf("Expected the SBAS satellite dropped, got %+v", converted)
+	}
+	// Cross-correlated L2 has no MSM signal
+	if sat := converted.Satellites[1]; sat.ID != 12 || len(sat.Signals) != 1 || sat.Signals[0].Code != "1C" {
+		t.Errorf("Expected G12 on L1 only, got %+v", sat)
+	}
+	if sat := converted.Satellites[0]; len(sat.Signals) != 2 || sat.Signals[1].Code != "2P" || math.Abs(sat.Signals[1].PseudoRange-22e6-2) > 0.04 {
+		t.Errorf("Unexpected G05 %+v", sat)
+	}
+
+	// Non-extended legacy messages have no whole milliseconds to convert
+	payload, err = parser.EncodeLegacyObservations(m, 1003)
+	if err != nil {
+		t.Fatalf("EncodeLegacyObservations failed: %v", err)
+	}
+	legacy, _ = newMessage(payload)
+	if out := newConverter(t, FormatMSM4).Process(legacy); !reflect.DeepEqual(types(out), []int{1003}) {
+		t.Errorf("Expected the 1003 passed on, got %v", types(out))
+	}
+}
+
+func TestConvertSplitsCells(t *testing.T) {
+	// 20 satellites with mixed L1 and L2 codes need 20 x 4 cells
+	m := &parser.MSM{System: "GPS", StationID: 7, Epoch: gpsEpoch}
+	for id := 1; id <= 20; id++ {
+		codes := [][2]string{{"1C", "2X"}, {"1P", "2P"}}[id%2]
+		m.Satellites = append(m.Satellites, parser.MSMSatellite{ID: id, Signals: []parser.MSMSignal{
+			{Code: codes[0], PseudoRange: 22e6, HasPseudoRange: true},
+			{Code: codes[1], PseudoRange: 22e6, HasPseudoRange: true},
+		}})
+	}
+	payload, err := parser.EncodeLegacyObservations(m, 1004)
+	if err != nil {
+		t.Fatalf("EncodeLegacyObservations failed: %v", err)
+	}
+	legacy, err := newMessage(payload)
+	if err != nil {
+		t.Fatalf("newMessage failed: %v", err)
+	}
+
+	out := newConverter(t, FormatMSM4).Process(legacy)
+	converted := decodeAll(t, out)
+	if len(converted) != 2 {
+		t.Fatalf("Expected 2 messages, got %v", types(out))
+	}
+	if !converted[0].MultipleMessage || converted[1].MultipleMessage {
+		t.Errorf("Expected only the last message to end the epoch")
+	}
+	if n := len(converted[0].Satellites) + len(converted[1].Satellites); n != 20 {
+		t.Errorf("Expected 20 satellites, got %d", n)
+	}
+}
+
+func TestConvertLockLoss(t *testing.T) {
+	c := newConverter(t, FormatMSM4)
+
+	// MSM4 cannot tell 10 s from 5 s of lock, so the drop must be sent as 0
+	var locks []time.Duration
+	for i, lock := range []time.Duration{10 * time.Second, 5 * time.Second, 6 * time.Second} {
+		out := c.Process(msmMessage(t, "GPS", 7, gpsEpoch+uint32(i*1000), false, 1, lock))
+		locks = append(locks, decodeAll(t, out)[0].Satellites[0].Signals[0].LockTime)
+	}
+	want := []time.Duration{8192 * time.Millisecond, 0, 4096 * time.Millisecond}
+	if !reflect.DeepEqual(locks, want) {
+		t.Errorf("Expected lock times %v, got %v", want, locks)
+	}
+}
+
+func TestConvertToLegacy(t *testing.T) {
+	c := newConverter(t, FormatLegacy)
+
+	// GLONASS MSM4 has no channels until an MSM5/MSM7 or 1020 gives them
+	if out := c.Process(msmMessage(t, "GPS", 7, gpsEpoch, true, 3, time.Minute)); len(out) != 0 {
+		t.Errorf("Expected the epoch held, got %v", types(out))
+	}
+	if out := c.Process(msmMessage(t, "GLO", 4, gloEpoch, true, 3, time.Minute)); len(out) != 0 {
+		t.Errorf("Expected the epoch held, got %v", types(out))
+	}
+	out := c.Process(msmMessage(t, "GAL", 7, gpsEpoch, false, 3, time.Minute))
+	if !reflect.DeepEqual(types(out), []int{1004}) {
+		t.Fatalf("Expected a 1004, got %v", types(out))
+	}
+	converted := decodeAll(t, out)[0]
+	if converted.StationID != 7 || converted.Epoch != gpsEpoch || converted.MultipleMessage || len(converted.Satellites) != 3 {
+		t.Errorf("Unexpected 1004 %+v", converted)
+	}
+	if sig := converted.Satellites[0].Signals[1]; sig.Code != "2P" || math.Abs(sig.PseudoRange-21001009) > 0.04 {
+		t.Errorf("Unexpected L2 signal %+v", sig)
+	}
+
+	// Channels learnt from MSM7 serve later MSM4
+	const next = 1000
+	c.Process(msmMessage(t, "GLO", 7, gloEpoch+next, true, 3, time.Minute))
+	c.Process(msmMessage(t, "GPS", 7, gpsEpoch+next, true, 3, time.Minute))
+	out = c.Process(msmMessage(t, "GLO", 4, gloEpoch+2*next, true, 2, time.Minute))
+	if !reflect.DeepEqual(types(out), []int{1012, 1004}) {
+		t.Fatalf("Expected the epoch flushed when the next begins, got %v", types(out))
+	}
+	if converted := decodeAll(t, out); !converted[0].MultipleMessage || converted[1].MultipleMessage {
+		t.Errorf("Expected only the last message to end the epoch")
+	}
+	out = c.Process(msmMessage(t, "GPS", 7, gpsEpoch+2*next, false, 1, time.Minute))
+	if !reflect.DeepEqual(types(out), []int{1012, 1004}) {
+		t.Fatalf("Expected a 1012 and a 1004, got %v", types(out))
+	}
+	glonass := decodeAll(t, out)[0]
+	if len(glonass.Satellites) != 2 || glonass.Satellites[1].Channel != -5 {
+		t.Errorf("Expected R02 on channel -5, got %+v", glonass.Satellites)
+	}
+
+	// Legacy observations pass unchanged
+	if out := c.Process(out[1]); len(out) != 1 || out[0].MessageType != 1004 {
+		t.Errorf("Expected the 1004 passed on, got %v", types(out))
+	}
+}
+
+func TestNewConverter(t *testing.T) {
+	if _, err := NewConverter("msm7"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,97 @@
+// Package pipeline processes RTCM 3 streams frame by frame. A Stage sits
+// between any RTCM source and sink, such as a caster mountpoint, an NTRIP
+// client session or a file, and can drop, rewrite or add frames.
+package pipeline
+
+import (
+	"io"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Stage processes the frames of one stream in order. Process returns the
+// messages to pass on in place of the one given: none to drop it, the
+// message itself, or rewritten ones. Stages keep per-stream state and are
+// not safe for concurrent use.
+type Stage interface {
+	Process(message parser.RTCMMessage) []parser.RTCMMessage
+}
+
+// Chain runs stages one after another, each on the output of the last
+type Chain []Stage
+
+// Process passes the message through every stage of the chain
+func (c Chain) Process(message parser.RTCMMessage) []parser.RTCMMessage {
+	messages := []parser.RTCMMessage{message}
+	for _, stage := range c {
+		var next []parser.RTCMMessage
+		for _, m := range messages {
+			next = append(next, stage.Process(m)...)
+		}
+		messages = next
+	}
+	return messages
+}
+
+// Reader applies a stage to the RTCM frames read from a stream. Bytes that
+// are not part of a frame with a valid CRC are dropped.
+type Reader struct {
+	source  io.Reader
+	stage   Stage
+	parser  *parser.RTCMParser
+	buffer  []byte
+	pending []byte // Frames processed but not read yet
+	err     error  // Error from the source, returned once pending is read
+}
+
+// NewReader creates a reader that passes the frames of source through stage
+func NewReader(source io.Reader, stage Stage) *Reader {
+	return &Reader{
+		source: source,
+		stage:  stage,
+		parser: parser.NewRTCMParser(),
+		buffer: make([]byte, 4096),
+	}
+}
+
+// Read reads processed frames, blocking until the stage passes one on
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 && r.err == nil {
+		n, err := r.source.Read(r.buffer)
+		for _, message := range r.parser.Process(r.buffer[:n]) {
+			for _, out := range r.stage.Process(message) {
+				r.pending = append(r.pending, out.Frame...)
+			}
+		}
+		r.err = err
+	}
+
+	if len(r.pending) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// Close closes the source if it is an io.Closer
+func (r *Reader) Close() error {
+	if closer, ok := r.source.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// newMessage frames a payload as a message
+func newMessage(payload []byte) (parser.RTCMMessage, error) {
+	frame, err := parser.EncodeFrame(payload)
+	if err != nil {
+		return parser.RTCMMessage{}, err
+	}
+
+	message := parser.RTCMMessage{Length: len(payload), Payload: payload, Frame: frame, Valid: true}
+	if len(payload) >= 2 {
+		message.MessageType = int(payload[0])<<4 | int(payload[1])>>4
+	}
+	return message, nil
+}
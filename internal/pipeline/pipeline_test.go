@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// stageFunc adapts a function to a Stage
+type stageFunc func(parser.RTCMMessage) []parser.RTCMMessage
+
+func (f stageFunc) Process(message parser.RTCMMessage) []parser.RTCMMessage {
+	return f(message)
+}
+
+// duplicate passes every message on twice
+var duplicate = stageFunc(func(m parser.RTCMMessage) []parser.RTCMMessage {
+	return []parser.RTCMMessage{m, m}
+})
+
+func TestChain(t *testing.T) {
+	deny, err := NewRewriter(RewriteConfig{Deny: []int{1006}})
+	if err != nil {
+		t.Fatalf("NewRewriter failed: %v", err)
+	}
+	chain := Chain{duplicate, deny, duplicate}
+
+	if out := chain.Process(observationMessage(t, "GPS", 0)); len(out) != 4 {
+		t.Errorf("Expected 4 messages, got %d", len(out))
+	}
+	if out := chain.Process(stationMessage(t)); len(out) != 0 {
+		t.Errorf("Expected the station message dropped, got %d", len(out))
+	}
+	if stats := deny.Stats(); stats.In != 4 || stats.Dropped != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestReader(t *testing.T) {
+	station, obs := stationMessage(t), observationMessage(t, "GPS", 0)
+
+	var input []byte
+	input = append(input, station.Frame...)
+	input = append(input, "garbage"...)
+	input = append(input, obs.Frame...)
+	input = append(input, station.Frame...)
+
+	deny, err := NewRewriter(RewriteConfig{Deny: []int{1006}})
+	if err != nil {
+		t.Fatalf("NewRewriter failed: %v", err)
+	}
+
+	// One byte at a time, so frames arrive split across reads
+	data, err := io.ReadAll(NewReader(iotest.OneByteReader(bytes.NewReader(input)), deny))
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+	if !bytes.Equal(data, obs.Frame) {
+		t.Errorf("Expected only the observation frame, got %X", data)
+	}
+
+	// Errors from the source are returned once the frames are read
+	r := NewReader(iotest.DataErrReader(bytes.NewReader(obs.Frame)), duplicate)
+	buffer := make([]byte, 2*len(obs.Frame))
+	if n, err := io.ReadFull(r, buffer); n != len(buffer) || err != nil {
+		t.Errorf("Expected both frames, got %d bytes, %v", n, err)
+	}
+	if _, err := r.Read(buffer); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
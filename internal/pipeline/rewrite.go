@@ -0,0 +1,246 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+// RewriteConfig declares how a Rewriter changes a stream, normally loaded
+// from JSON. The zero value passes every frame through unchanged.
+type RewriteConfig struct {
+	// Allow lists the message types passed on, all types if empty. Deny
+	// lists the types dropped even if allowed.
+	Allow []int `json:"allow,omitempty"`
+	Deny  []int `json:"deny,omitempty"`
+
+	// ARP replaces the coordinates sent in 1005/1006 with a surveyed position
+	ARP *ARPConfig `json:"arp,omitempty"`
+
+	// StationID renumbers the reference station in every message that
+	// carries its ID
+	StationID *int `json:"station_id,omitempty"`
+
+	// ObservationInterval passes only the observation epochs that fall on
+	// a whole multiple of this many seconds of GPS time, e.g. 5 to reduce
+	// a 1 Hz base to 0.2 Hz. It must divide a day; 0 keeps every epoch.
+	ObservationInterval int `json:"observation_interval,omitempty"`
+}
+
+// ARPConfig is a surveyed antenna reference point, given either as WGS84
+// ECEF coordinates or as latitude, longitude and ellipsoidal height
+type ARPConfig struct {
+	X float64 `json:"x,omitempty"` // Metres
+	Y float64 `json:"y,omitempty"`
+	Z float64 `json:"z,omitempty"`
+
+	Latitude  float64 `json:"latitude,omitempty"` // Decimal degrees
+	Longitude float64 `json:"longitude,omitempty"`
+	Height    float64 `json:"height,omitempty"` // Metres above the ellipsoid
+}
+
+// LoadRewriteConfig reads and validates a JSON rewrite configuration file
+func LoadRewriteConfig(path string) (*RewriteConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rewrite config: %v", err)
+	}
+
+	config := &RewriteConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing rewrite config %s: %v", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rewrite config %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// Validate checks the configuration for values a stream cannot carry
+func (c *RewriteConfig) Validate() error {
+	for _, types := range [][]int{c.Allow, c.Deny} {
+		for _, t := range types {
+			if t < 0 || t > 4095 {
+				return fmt.Errorf("invalid message type %d", t)
+			}
+		}
+	}
+
+	if a := c.ARP; a != nil {
+		ecef := a.X != 0 || a.Y != 0 || a.Z != 0
+		geodetic := a.Latitude != 0 || a.Longitude != 0 || a.Height != 0
+		switch {
+		case ecef && geodetic:
+			return fmt.Errorf("arp: give either x, y, z or latitude, longitude, height")
+		case !ecef && !geodetic:
+			return fmt.Errorf("arp: no position given")
+		case a.Latitude < -90 || a.Latitude > 90 || a.Longitude < -180 || a.Longitude > 180:
+			return fmt.Errorf("arp: invalid latitude or longitude")
+		}
+	}
+
+	if c.StationID != nil && (*c.StationID < 0 || *c.StationID > 4095) {
+		return fmt.Errorf("station_id %d out of range 0-4095", *c.StationID)
+	}
+
+	if c.ObservationInterval < 0 || c.ObservationInterval > 0 && 86400%c.ObservationInterval != 0 {
+		return fmt.Errorf("observation_interval %d does not divide a day", c.ObservationInterval)
+	}
+
+	return nil
+}
+
+// ecef returns the ARP as ECEF coordinates
+func (a *ARPConfig) ecef() (x, y, z float64) {
+	if a.X != 0 || a.Y != 0 || a.Z != 0 {
+		return a.X, a.Y, a.Z
+	}
+	return position.ToECEF(a.Latitude, a.Longitude, a.Height)
+}
+
+// RewriteStats counts what a Rewriter has done
+type RewriteStats struct {
+	In        uint64 // Frames processed
+	Out       uint64 // Frames passed on
+	Dropped   uint64 // Frames filtered out or decimated
+	Rewritten uint64 // Frames passed on with a changed payload
+}
+
+// Rewriter is a Stage that filters a stream by message type, overrides the
+// station position and ID and decimates observations
+type Rewriter struct {
+	config RewriteConfig
+	allow  map[int]bool
+	deny   map[int]bool
+	stats  RewriteStats
+}
+
+// NewRewriter creates a rewriter from a configuration
+func NewRewriter(config RewriteConfig) (*Rewriter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := &Rewriter{config: config, deny: make(map[int]bool)}
+	if len(config.Allow) > 0 {
+		r.allow = make(map[int]bool)
+		for _, t := range config.Allow {
+			r.allow[t] = true
+		}
+	}
+	for _, t := range config.Deny {
+		r.deny[t] = true
+	}
+	return r, nil
+}
+
+// Process filters and rewrites one message
+func (r *Rewriter) Process(message parser.RTCMMessage) []parser.RTCMMessage {
+	r.stats.In++
+	if !r.passes(message) {
+		r.stats.Dropped++
+		return nil
+	}
+
+	payload := message.Payload
+	if r.config.ARP != nil && (message.MessageType == 1005 || message.MessageType == 1006) {
+		payload = r.overrideARP(payload)
+	}
+	if r.config.StationID != nil && hasStationID(message.MessageType) {
+		payload = withStationID(payload, *r.config.StationID)
+	}
+
+	if !bytes.Equal(payload, message.Payload) {
+		if rewritten, err := newMessage(payload); err == nil {
+			message = rewritten
+			r.stats.Rewritten++
+		}
+	}
+	r.stats.Out++
+	return []parser.RTCMMessage{message}
+}
+
+// Stats returns the rewriter's counters
+func (r *Rewriter) Stats() RewriteStats {
+	return r.stats
+}
+
+// passes reports whether a message survives the type filter and decimation
+func (r *Rewriter) passes(message parser.RTCMMessage) bool {
+	if r.allow != nil && !r.allow[message.MessageType] || r.deny[message.MessageType] {
+		return false
+	}
+	if r.config.ObservationInterval == 0 || !isObservation(message.MessageType) {
+		return true
+	}
+
+	// Undecodable observations are passed on rather than guessed at
+	decoded, err := message.Decode()
+	obs, ok := decoded.(*parser.MSM)
+	if err != nil || !ok {
+		return true
+	}
+	return onInterval(obs, time.Duration(r.config.ObservationInterval)*time.Second)
+}
+
+// onInterval reports whether the epoch of an observation message falls on
+// a whole multiple of the interval of GPS time. Epochs of every GNSS are
+// compared in GPS time so that the epochs kept line up across them.
+func onInterval(obs *parser.MSM, interval time.Duration) bool {
+	// Week and day boundaries are whole days of Unix time, so the time of
+	// reception only needs to resolve the epoch to some week
+	gps := obs.Time(time.Now()).Add(parser.LeapSeconds * time.Second)
+	return time.Duration(gps.UnixNano())%interval == 0
+}
+
+// overrideARP returns the payload of a 1005/1006 with the configured
+// coordinates, or the payload unchanged if it cannot be decoded
+func (r *Rewriter) overrideARP(payload []byte) []byte {
+	arp, err := parser.DecodeStationARP(payload)
+	if err != nil {
+		return payload
+	}
+
+	arp.X, arp.Y, arp.Z = r.config.ARP.ecef()
+	rewritten, err := parser.EncodeStationARP(arp)
+	if err != nil {
+		return payload
+	}
+	return rewritten
+}
+
+// isObservation reports whether a message type carries observations
+func isObservation(messageType int) bool {
+	return parser.IsMSM(messageType) || parser.IsLegacyObservation(messageType)
+}
+
+// hasStationID reports whether a message type carries the reference
+// station ID in bits 12-23: observations, station and antenna
+// descriptions, text, and GLONASS biases
+func hasStationID(messageType int) bool {
+	switch {
+	case messageType >= 1001 && messageType <= 1013, messageType == 1029, messageType == 1033, messageType == 1230:
+		return true
+	default:
+		return parser.IsMSM(messageType)
+	}
+}
+
+// withStationID returns a copy of the payload with the station ID replaced
+func withStationID(payload []byte, id int) []byte {
+	if len(payload) < 3 {
+		return payload
+	}
+
+	rewritten := append([]byte(nil), payload...)
+	rewritten[1] = rewritten[1]&0xF0 | byte(id>>8)
+	rewritten[2] = byte(id)
+	return rewritten
+}
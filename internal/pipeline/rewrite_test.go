@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// stationMessage is a 1006 of station 7
+func stationMessage(t *testing.T) parser.RTCMMessage {
+	t.Helper()
+
+	payload, err := parser.EncodeStationARP(&parser.StationARP{
+		StationID: 7, GPS: true, GLONASS: true, X: 3978667.8176, Y: -8332.9146, Z: 4968397.6747,
+		HasHeight: true, AntennaHeight: 1.5,
+	})
+	if err != nil {
+		t.Fatalf("EncodeStationARP failed: %v", err)
+	}
+	message, err := newMessage(payload)
+	if err != nil {
+		t.Fatalf("newMessage failed: %v", err)
+	}
+	return message
+}
+
+// observationMessage is an MSM4 of station 7 with one satellite
+func observationMessage(t *testing.T, system string, epoch uint32) parser.RTCMMessage {
+	t.Helper()
+
+	payload, err := parser.EncodeMSM(&parser.MSM{
+		System:    system,
+		StationID: 7,
+		Epoch:     epoch,
+		Satellites: []parser.MSMSatellite{{ID: 5, Signals: []parser.MSMSignal{{
+			ID: 2, PseudoRange: 21000000, HasPseudoRange: true, CNR: 40,
+		}}}},
+	}, 4)
+	if err != nil {
+		t.Fatalf("EncodeMSM failed: %v", err)
+	}
+	message, err := newMessage(payload)
+	if err != nil {
+		t.Fatalf("newMessage failed: %v", err)
+	}
+	return message
+}
+
+// types returns the message types of messages
+func types(messages []parser.RTCMMessage) []int {
+	var result []int
+	for _, m := range messages {
+		result = append(result, m.MessageType)
+	}
+	return result
+}
+
+func TestRewriterFilter(t *testing.T) {
+	station := stationMessage(t)
+	obs := observationMessage(t, "GPS", 0)
+	other := parser.RTCMMessage{MessageType: 4094, Payload: []byte{0xFF, 0xE0}, Frame: []byte{0xD3}}
+
+	tests := []struct {
+		name   string
+		config RewriteConfig
+		want   int
+	}{
+		{"pass all", RewriteConfig{}, 3},
+		{"allow", RewriteConfig{Allow: []int{1006, 1074}}, 2},
+		{"deny", RewriteConfig{Deny: []int{4094}}, 2},
+		{"allow and deny", RewriteConfig{Allow: []int{1006, 1074}, Deny: []int{1074}}, 1},
+	}
+
+	for _, tt := range tests {
+		r, err := NewRewriter(tt.config)
+		if err != nil {
+			t.Fatalf("%s: NewRewriter failed: %v", tt.name, err)
+		}
+		var out []parser.RTCMMessage
+		for _, m := range []parser.RTCMMessage{station, obs, other} {
+			out = append(out, r.Process(m)...)
+		}
+		if len(out) != tt.want {
+			t.Errorf("%s: expected %d messages, got %v", tt.name, tt.want, types(out))
+		}
+		if stats := r.Stats(); stats.In != 3 || stats.Out != uint64(tt.want) || stats.Dropped != uint64(3-tt.want) || stats.Rewritten != 0 {
+			t.Errorf("%s: unexpected stats %+v", tt.name, stats)
+		}
+	}
+}
+
+func TestRewriterStation(t *testing.T) {
+	id := 1234
+	r, err := NewRewriter(RewriteConfig{
+		ARP:       &ARPConfig{Latitude: -33.86, Longitude: 151.21, Height: 40},
+		StationID: &id,
+	})
+	if err != nil {
+		t.Fatalf("NewRewriter failed: %v", err)
+	}
+
+	out := r.Process(stationMessage(t))
+	if len(out) != 1 {
+		t.Fatalf("Expected one message, got %d", len(out))
+	}
+	decoded, err := out[0].Decode()
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	arp := decoded.(*parser.StationARP)
+	x, y, z := 3978667.8176, -8332.9146, 4968397.6747
+	if arp.StationID != id || math.Abs(arp.X-x) < 1 || math.Abs(arp.Y-y) < 1 || math.Abs(arp.Z-z) < 1 {
+		t.Errorf("Expected station %d at a new position, got %+v", id, arp)
+	}
+	if !arp.GPS || !arp.GLONASS || !arp.HasHeight || arp.AntennaHeight != 1.5 {
+		t.Errorf("Expected the other fields kept, got %+v", arp)
+	}
+
+	// The rewritten frame is valid
+	frames := parser.NewRTCMParser().Process(out[0].Frame)
+	if len(frames) != 1 || frames[0].MessageType != 1006 {
+		t.Errorf("Expected a valid 1006 frame, got %+v", frames)
+	}
+
+	// Observations are renumbered too
+	out = r.Process(observationMessage(t, "GAL", 0))
+	decoded, err = out[0].Decode()
+	if err != nil || decoded.(*parser.MSM).StationID != id {
+		t.Errorf("Expected observations of station %d, got %+v, %v", id, decoded, err)
+	}
+	if stats := r.Stats(); stats.Rewritten != 2 {
+		t.Errorf("Expected 2 rewritten messages, got %+v", stats)
+	}
+}
+
+func TestRewriterDecimation(t *testing.T) {
+	r, err := NewRewriter(RewriteConfig{ObservationInterval: 5})
+	if err != nil {
+		t.Fatalf("NewRewriter failed: %v", err)
+	}
+
+	// Ten seconds from Thursday 00:00 GPS time. GLONASS time of day is
+	// UTC + 3 h, 18 s behind GPS time, and BeiDou time is 14 s behind.
+	const tow, tod = 4 * 86400000, 3*3600000 - 18000
+	kept := map[string][]int{}
+	for i := 0; i < 10; i++ {
+		ms := uint32(i * 1000)
+		for _, m := range []parser.RTCMMessage{
+			observationMessage(t, "GPS", tow+ms),
+			observationMessage(t, "GLO", 4<<27|(tod+ms)),
+			observationMessage(t, "BDS", tow-14000+ms),
+			stationMessage(t),
+		} {
+			if out := r.Process(m); len(out) > 0 {
+				kept[parser.MSMSystem(m.MessageType)] = append(kept[parser.MSMSystem(m.MessageType)], i)
+			}
+		}
+	}
+
+	for _, system := range []string{"GPS", "GLO", "BDS"} {
+		if got := kept[system]; len(got) != 2 || got[0] != 0 || got[1] != 5 {
+			t.Errorf("%s: expected epochs 0 and 5 kept, got %v", system, got)
+		}
+	}
+	if got := kept[""]; len(got) != 10 {
+		t.Errorf("Expected every station message kept, got %v", got)
+	}
+}
+
+func TestRewriteConfigValidate(t *testing.T) {
+	id := 4096
+	for _, config := range []RewriteConfig{
+		{Allow: []int{5000}},
+		{ARP: &ARPConfig{}},
+		{ARP: &ARPConfig{X: 1, Latitude: 1}},
+		{ARP: &ARPConfig{Latitude: 91}},
+		{StationID: &id},
+		{ObservationInterval: 7},
+		{ObservationInterval: -1},
+	} {
+		if err := config.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+
+	if err := (&RewriteConfig{ObservationInterval: 30, ARP: &ARPConfig{X: 1, Y: 2, Z: 3}}).Validate(); err != nil {
+		t.Errorf("Expected a valid config, got %v", err)
+	}
+}
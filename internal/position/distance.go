@@ -0,0 +1,24 @@
+package position
+
+import "math"
+
+// EarthRadiusKm is the mean Earth radius used for great-circle distances
+const EarthRadiusKm = 6371.0088
+
+// DistanceKm returns the great-circle distance in kilometres between two
+// points given in decimal degrees, using the haversine formula.
+func DistanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRad := math.Pi / 180.0
+	dLat := (lat2 - lat1) * toRad
+	dLon := (lon2 - lon1) * toRad
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// DistanceTo returns the great-circle distance in kilometres to another position
+func (p *Position) DistanceTo(other *Position) float64 {
+	return DistanceKm(p.Latitude, p.Longitude, other.Latitude, other.Longitude)
+}
@@ -0,0 +1,46 @@
+package position
+
+import "math"
+
+// WGS84 ellipsoid parameters
+const (
+	wgs84A = 6378137.0         // Semi-major axis in metres
+	wgs84F = 1 / 298.257223563 // Flattening
+)
+
+// FromECEF converts WGS84 earth-centred, earth-fixed coordinates in metres
+// to latitude and longitude in decimal degrees and ellipsoidal height in
+// metres
+func FromECEF(x, y, z float64) (lat, lon, alt float64) {
+	e2 := wgs84F * (2 - wgs84F) // Eccentricity squared
+
+	lon = math.Atan2(y, x) * 180 / math.Pi
+
+	// Iterate on latitude, starting from the spherical approximation
+	p := math.Sqrt(x*x + y*y)
+	lat = math.Atan2(z, p*(1-e2))
+	for i := 0; i < 5; i++ {
+		sinLat := math.Sin(lat)
+		n := wgs84A / math.Sqrt(1-e2*sinLat*sinLat)
+		alt = p/math.Cos(lat) - n
+		lat = math.Atan2(z, p*(1-e2*n/(n+alt)))
+	}
+
+	return lat * 180 / math.Pi, lon, alt
+}
+
+// ToECEF converts latitude and longitude in decimal degrees and ellipsoidal
+// height in metres to WGS84 earth-centred, earth-fixed coordinates in
+// metres
+func ToECEF(lat, lon, alt float64) (x, y, z float64) {
+	e2 := wgs84F * (2 - wgs84F)
+
+	sinLat, cosLat := math.Sincos(lat * math.Pi / 180)
+	sinLon, cosLon := math.Sincos(lon * math.Pi / 180)
+	n := wgs84A / math.Sqrt(1-e2*sinLat*sinLat) // Prime vertical radius of curvature
+
+	x = (n + alt) * cosLat * cosLon
+	y = (n + alt) * cosLat * sinLon
+	z = (n*(1-e2) + alt) * sinLat
+	return x, y, z
+}
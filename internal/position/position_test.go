@@ -2,6 +2,7 @@ package position
 
 import (
 	"encoding/json"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
@@ -415,3 +416,52 @@ func TestGetFixQualityDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestDistanceKm(t *testing.T) {
+	// London to Paris is roughly 344 km
+	d := DistanceKm(51.5074, -0.1278, 48.8566, 2.3522)
+	if d < 340 || d > 348 {
+		t.Errorf("Expected distance around 344 km, got %f", d)
+	}
+
+	// Same point
+	if d := DistanceKm(10, 10, 10, 10); d != 0 {
+		t.Errorf("Expected zero distance, got %f", d)
+	}
+
+	// DistanceTo matches DistanceKm
+	a := &Position{Latitude: -36.85, Longitude: 174.76}
+	b := &Position{Latitude: -41.29, Longitude: 174.78}
+	if a.DistanceTo(b) != DistanceKm(a.Latitude, a.Longitude, b.Latitude, b.Longitude) {
+		t.Error("Expected DistanceTo to match DistanceKm")
+	}
+}
+
+func TestFromECEF(t *testing.T) {
+	// ECEF coordinates of a point at 51.5N 0.12W, 45 m above the ellipsoid
+	lat, lon, alt := FromECEF(3978667.8176, -8332.9146, 4968397.6747)
+	if math.Abs(lat-51.5) > 1e-6 || math.Abs(lon+0.12) > 1e-6 || math.Abs(alt-45) > 0.01 {
+		t.Errorf("Expected 51.5, -0.12, 45, got %f, %f, %f", lat, lon, alt)
+	}
+
+	// Points on the axes
+	if lat, lon, _ := FromECEF(6378137, 0, 0); math.Abs(lat) > 1e-9 || lon != 0 {
+		t.Errorf("Expected the equator at the prime meridian, got %f, %f", lat, lon)
+	}
+	if lat, _, alt := FromECEF(0, 0, 6356752.3142); math.Abs(lat-90) > 1e-6 || math.Abs(alt) > 0.01 {
+		t.Errorf("Expected the north pole, got %f with height %f", lat, alt)
+	}
+}
+
+func TestToECEF(t *testing.T) {
+	x, y, z := ToECEF(51.5, -0.12, 45)
+	if math.Abs(x-3978667.8176) > 0.01 || math.Abs(y+8332.9146) > 0.01 || math.Abs(z-4968397.6747) > 0.01 {
+		t.Errorf("Expected 3978667.8176, -8332.9146, 4968397.6747, got %.4f, %.4f, %.4f", x, y, z)
+	}
+
+	// Converting back gives the original position
+	lat, lon, alt := FromECEF(ToECEF(-33.86, 151.21, 1234.5))
+	if math.Abs(lat+33.86) > 1e-9 || math.Abs(lon-151.21) > 1e-9 || math.Abs(alt-1234.5) > 1e-4 {
+		t.Errorf("Expected -33.86, 151.21, 1234.5, got %f, %f, %f", lat, lon, alt)
+	}
+}
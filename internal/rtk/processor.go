@@ -2,13 +2,12 @@ package rtk
 
 import (
 	"fmt"
-	"math"
 	"sync"
 	"time"
 
+	"github.com/bramburn/go_ntrip/internal/ephemeris"
+	"github.com/bramburn/go_ntrip/internal/parser"
 	"github.com/bramburn/go_ntrip/internal/position"
-	"github.com/go-gnss/rtcm/rtcm3"
-	"github.com/adrianmo/go-nmea"
 )
 
 // Solution status constants
@@ -41,10 +40,11 @@ type Processor struct {
 	processingRun bool
 	mode          string // "static" or "kinematic"
 	// RTK state data
-	basePosition  *position.Position // Base station position (for static mode)
-	rtcmMessages  map[uint16]rtcm3.Message // Store latest RTCM messages by type
-	observations  []rtcm3.Message1004 // Store GPS observations
-	ephemeris     map[int]rtcm3.Message1019 // Store GPS ephemeris by satellite ID
+	basePosition *position.Position         // Base station position (for static mode)
+	rtcmParser   *parser.RTCMParser         // Frames RTCM messages across calls
+	rtcmMessages map[int]parser.RTCMMessage // Store latest RTCM messages by type
+	observations []*parser.MSM              // Store MSM or legacy observations of every GNSS
+	ephemerides  *ephemeris.Store           // Broadcast ephemerides of every GNSS
 }
 
 // NewProcessor creates a new RTK processor with default kinematic mode
@@ -64,8 +64,9 @@ func NewProcessorWithMode(mode string) *Processor {
 		solutions:    make([]RTKSolution, 0),
 		solutionChan: make(chan RTKSolution, 10),
 		mode:         mode,
-		rtcmMessages: make(map[uint16]rtcm3.Message),
-		ephemeris:    make(map[int]rtcm3.Message1019),
+		rtcmParser:   parser.NewRTCMParser(),
+		rtcmMessages: make(map[int]parser.RTCMMessage),
+		ephemerides:  ephemeris.NewStore(),
 	}
 }
 
@@ -77,11 +78,11 @@ func (p *Processor) ProcessRTCM(data []byte) {
 	// Append new RTCM data
 	p.rtcmData = append(p.rtcmData, data...)
 
-	// Process RTCM data using the rtcm library
+	// Process RTCM data
 	if len(p.rtcmData) > 0 {
-		// Try to parse RTCM messages
-		messages, err := p.parseRTCMData(p.rtcmData)
-		if err == nil && len(messages) > 0 {
+		// Try to parse RTCM messages; partial frames are kept by the parser
+		messages := p.rtcmParser.Process(p.rtcmData)
+		if len(messages) > 0 {
 			// Process the parsed messages
 			p.processRTCMMessages(messages)
 
@@ -107,63 +108,38 @@ func (p *Processor) ProcessRTCM(data []byte) {
 	}
 }
 
-// parseRTCMData parses RTCM data into messages
-func (p *Processor) parseRTCMData(data []byte) ([]rtcm3.Message, error) {
-	var messages []rtcm3.Message
-
-	// Create a frame parser
-	parser := rtcm3.NewParser()
-
-	// Add data to the parser
-	parser.Write(data)
-
-	// Parse frames
-	for {
-		frame, err := parser.NextFrame()
-		if err != nil {
-			break // No more complete frames
-		}
-
-		// Parse the message from the frame
-		msg, err := rtcm3.DeserializeMessage(frame.Data)
-		if err != nil {
-			continue // Skip invalid messages
-		}
-
-		messages = append(messages, msg)
-	}
-
-	return messages, nil
-}
-
 // processRTCMMessages processes RTCM messages and updates internal state
-func (p *Processor) processRTCMMessages(messages []rtcm3.Message) {
+func (p *Processor) processRTCMMessages(messages []parser.RTCMMessage) {
+	now := time.Now()
+	p.ephemerides.Prune(now)
+
 	for _, msg := range messages {
 		// Store the message by type
-		p.rtcmMessages[msg.Number()] = msg
+		p.rtcmMessages[msg.MessageType] = msg
 
 		// Process specific message types
-		switch msg.Number() {
-		case 1004: // GPS L1/L2 observations
-			if obsMsg, ok := msg.(rtcm3.Message1004); ok {
-				p.observations = append(p.observations, obsMsg)
-				// Keep only the last 10 observation messages
-				if len(p.observations) > 10 {
-					p.observations = p.observations[len(p.observations)-10:]
-				}
+		switch {
+		case parser.IsMSM(msg.MessageType) || parser.IsLegacyObservation(msg.MessageType):
+			// Observations, decoded alike from MSM and 1001-1004/1009-1012
+			decoded, err := msg.Decode()
+			if err != nil {
+				continue
 			}
-
-		case 1019: // GPS ephemeris
-			if ephMsg, ok := msg.(rtcm3.Message1019); ok {
-				p.ephemeris[int(ephMsg.SatelliteID)] = ephMsg
+			p.observations = append(p.observations, decoded.(*parser.MSM))
+			// Keep only the last 10 observation messages
+			if len(p.observations) > 10 {
+				p.observations = p.observations[len(p.observations)-10:]
 			}
 
-		case 1005, 1006: // Station coordinates
+		case parser.IsEphemeris(msg.MessageType):
+			p.ephemerides.AddMessage(msg, now)
+
+		case msg.MessageType == 1005 || msg.MessageType == 1006: // Station coordinates
 			// If in static mode, use this as the base position
 			if p.mode == "static" {
-				if stationMsg, ok := msg.(rtcm3.Message1005); ok {
+				if station, err := parser.DecodeStationARP(msg.Payload); err == nil {
 					// Convert ECEF to lat/lon/alt
-					lat, lon, alt := ecefToLatLonAlt(stationMsg.X, stationMsg.Y, stationMsg.Z)
+					lat, lon, alt := position.FromECEF(station.X, station.Y, station.Z)
 
 					// Update base position
 					p.basePosition = &position.Position{
@@ -193,19 +169,16 @@ func (p *Processor) computeRTKSolution() (RTKSolution, error) {
 			Longitude: p.basePosition.Longitude,
 			Altitude:  p.basePosition.Altitude,
 			Time:      time.Now().UTC(),
-			NumSats:   len(p.ephemeris), // Use number of satellites with ephemeris
-			HDOP:      0.8, // Placeholder
+			NumSats:   len(p.ephemerides.Satellites(time.Now())), // Use number of satellites with ephemeris
+			HDOP:      0.8,                                       // Placeholder
 		}, nil
 	}
 
 	// For kinematic mode or if no base position is available
 	// Use the observations and ephemeris to compute a solution
 	if len(p.observations) > 0 {
-		// Get the latest observation
-		latestObs := p.observations[len(p.observations)-1]
-
 		// Count satellites with valid observations
-		numSats := len(latestObs.Satellites)
+		numSats := p.latestSatellites()
 
 		// In a real implementation, we would compute a solution using
 		// the observations and ephemeris data
@@ -226,6 +199,18 @@ func (p *Processor) computeRTKSolution() (RTKSolution, error) {
 	return RTKSolution{}, fmt.Errorf("not enough data for RTK solution")
 }
 
+// latestSatellites counts the satellites observed at the latest epoch. The
+// messages of an epoch, one per GNSS, all but the last have the multiple
+// message flag set.
+func (p *Processor) latestSatellites() int {
+	last := len(p.observations) - 1
+	count := len(p.observations[last].Satellites)
+	for i := last - 1; i >= 0 && p.observations[i].MultipleMessage; i-- {
+		count += len(p.observations[i].Satellites)
+	}
+	return count
+}
+
 // computeFixStatus determines the fix status based on available data
 func computeFixStatus(numSats int) int {
 	if numSats >= 5 {
@@ -249,35 +234,6 @@ func computeHDOP(numSats int) float64 {
 	return 5.0 / float64(numSats)
 }
 
-// ecefToLatLonAlt converts ECEF coordinates to latitude, longitude, altitude
-func ecefToLatLonAlt(x, y, z float64) (lat, lon, alt float64) {
-	// WGS84 ellipsoid parameters
-	a := 6378137.0 // semi-major axis
-	f := 1.0 / 298.257223563 // flattening
-	b := a * (1.0 - f) // semi-minor axis
-	e2 := f * (2.0 - f) // eccentricity squared
-
-	// Calculate longitude
-	lon = math.Atan2(y, x) * 180.0 / math.Pi
-
-	// Calculate latitude and altitude iteratively
-	p := math.Sqrt(x*x + y*y)
-	lat = math.Atan2(z, p * (1.0 - e2))
-
-	// Iterative calculation for better accuracy
-	for i := 0; i < 5; i++ {
-		sinLat := math.Sin(lat)
-		N := a / math.Sqrt(1.0 - e2*sinLat*sinLat)
-		alt = p/math.Cos(lat) - N
-		lat = math.Atan2(z, p*(1.0-e2*N/(N+alt)))
-	}
-
-	// Convert latitude to degrees
-	lat = lat * 180.0 / math.Pi
-
-	return lat, lon, alt
-}
-
 // GetSolutionChannel returns the channel for receiving solutions
 func (p *Processor) GetSolutionChannel() <-chan RTKSolution {
 	return p.solutionChan
@@ -3,6 +3,8 @@ package rtk
 import (
 	"testing"
 	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
 )
 
 func TestNewProcessor(t *testing.T) {
@@ -24,31 +26,58 @@ func TestNewProcessor(t *testing.T) {
 	}
 }
 
+// observationFrame returns a framed 1004 with two GPS satellites and no
+// observables set
+func observationFrame() []byte {
+	payload := make([]byte, (64+2*125+7)/8)
+	put := func(pos, bits int, value uint64) {
+		for i := 0; i < bits; i++ {
+			if value>>uint(bits-1-i)&1 == 1 {
+				payload[(pos+i)/8] |= 1 << uint(7-(pos+i)%8)
+			}
+		}
+	}
+	put(0, 12, 1004)
+	put(55, 5, 2)      // Satellites
+	put(64, 6, 5)      // First satellite ID
+	put(64+125, 6, 12) // Second satellite ID
+
+	frame := append([]byte{0xD3, byte(len(payload) >> 8), byte(len(payload))}, payload...)
+	crc := parser.CRC24Q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
 func TestProcessRTCM(t *testing.T) {
 	processor := NewProcessor()
+	frame := observationFrame()
+
+	// Half a frame is kept by the parser until the rest arrives
+	processor.ProcessRTCM(frame[:20])
+
+	if len(processor.rtcmData) != 0 {
+		t.Errorf("Expected rtcmData to be cleared, got length %d", len(processor.rtcmData))
+	}
+	if len(processor.solutions) != 0 {
+		t.Errorf("Expected no solution, got %d", len(processor.solutions))
+	}
 
-	// Test with small data (less than threshold)
-	smallData := []byte("test data")
-	processor.ProcessRTCM(smallData)
+	processor.ProcessRTCM(frame[20:])
 
-	if len(processor.rtcmData) != len(smallData) {
-		t.Errorf("Expected rtcmData length %d, got %d", len(smallData), len(processor.rtcmData))
+	// Should have generated a solution
+	if len(processor.solutions) != 1 {
+		t.Fatalf("Expected 1 solution, got %d", len(processor.solutions))
+	}
+	if processor.solutions[0].NumSats != 2 {
+		t.Errorf("Expected 2 satellites, got %d", processor.solutions[0].NumSats)
 	}
 
-	// Test with large data (more than threshold)
+	// Data that is not RTCM produces nothing
 	largeData := make([]byte, 2000)
 	for i := range largeData {
 		largeData[i] = byte(i % 256)
 	}
-
 	processor.ProcessRTCM(largeData)
 
-	// After processing large data, the buffer should be cleared
-	if len(processor.rtcmData) != 0 {
-		t.Errorf("Expected rtcmData to be cleared, got length %d", len(processor.rtcmData))
-	}
-
-	// Should have generated a solution
 	if len(processor.solutions) != 1 {
 		t.Errorf("Expected 1 solution, got %d", len(processor.solutions))
 	}
@@ -73,8 +102,7 @@ func TestGetLastSolution(t *testing.T) {
 	}
 
 	// Process some data to generate a solution
-	largeData := make([]byte, 2000)
-	processor.ProcessRTCM(largeData)
+	processor.ProcessRTCM(observationFrame())
 
 	// Now there should be a solution
 	solution = processor.GetLastSolution()
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -11,10 +12,10 @@ import (
 	"time"
 
 	"github.com/bramburn/go_ntrip/internal/device"
-	"github.com/bramburn/go_ntrip/internal/ntrip"
 	"github.com/bramburn/go_ntrip/internal/parser"
 	"github.com/bramburn/go_ntrip/internal/position"
 	"github.com/bramburn/go_ntrip/internal/rtk"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 )
 
 // CLI represents the command-line interface
@@ -337,21 +338,17 @@ func (c *CLI) getNtripPosition() {
 
 	// Create NTRIP client
 	client := ntrip.NewClient(url, username, password, mountpoint)
+	defer c.uploadRoverGGA(client)()
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	// Connect to NTRIP server
+	// Open a session that reconnects when the link drops
 	fmt.Printf("Connecting to NTRIP server at %s...\n", url)
-	stream, err := client.Connect(ctx)
-	if err != nil {
-		fmt.Printf("Error connecting to NTRIP server: %v\n", err)
-		return
-	}
+	stream := ntrip.NewSession(ctx, client, ntrip.DefaultSessionConfig())
 	defer stream.Close()
-
-	fmt.Println("Connected to NTRIP server. Receiving RTCM data...")
+	go ntrip.LogEvents(stream, log.New(os.Stdout, "\n", 0))
 
 	// Create a channel to signal stopping
 	stopChan := make(chan bool)
@@ -450,14 +447,31 @@ func (c *CLI) getNtripPosition() {
 		}
 
 	case <-stopChan:
-		// Stop monitoring
-		if d, ok := c.device.(*device.TOPGNSSDevice); ok {
-			d.StopMonitoring()
-		}
 		fmt.Println("\nStopped NTRIP connection.")
 	}
 }
 
+// uploadRoverGGA uploads the GGA sentences of the connected device to the
+// caster, as VRS mountpoints require, and returns a function that stops
+// monitoring the device
+func (c *CLI) uploadRoverGGA(client *ntrip.Client) func() {
+	d, ok := c.device.(*device.TOPGNSSDevice)
+	if !ok || !d.IsConnected() {
+		return func() {}
+	}
+
+	rover := ntrip.NewRoverGGA(30 * time.Second)
+	config := device.DefaultMonitorConfig(device.ProtocolNMEA, device.SentenceHandler(rover.Update))
+	if err := d.MonitorNMEA(config); err != nil {
+		fmt.Printf("Error starting NMEA monitoring: %v\n", err)
+		return func() {}
+	}
+
+	client.GGASource = rover
+	fmt.Println("Uploading the device position to the NTRIP server.")
+	return d.StopMonitoring
+}
+
 // NtripPositionHandler implements device.DataHandler for NMEA data with position extraction
 type NtripPositionHandler struct {
 	parser       *parser.NMEAParser
@@ -552,21 +566,17 @@ func (c *CLI) getAveragedPosition() {
 
 	// Create NTRIP client
 	client := ntrip.NewClient(url, username, password, mountpoint)
+	defer c.uploadRoverGGA(client)()
 
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	// Connect to NTRIP server
+	// Open a session that reconnects when the link drops
 	fmt.Printf("Connecting to NTRIP server at %s...\n", url)
-	stream, err := client.Connect(ctx)
-	if err != nil {
-		fmt.Printf("Error connecting to NTRIP server: %v\n", err)
-		return
-	}
+	stream := ntrip.NewSession(ctx, client, ntrip.DefaultSessionConfig())
 	defer stream.Close()
-
-	fmt.Println("Connected to NTRIP server. Receiving RTCM data...")
+	go ntrip.LogEvents(stream, log.New(os.Stdout, "\n", 0))
 
 	// Create a channel to signal stopping
 	stopChan := make(chan bool)
@@ -15,7 +15,7 @@ import (
 
 	"github.com/adrianmo/go-nmea"
 	"github.com/bramburn/go_ntrip/pkg/ntrip"
-	"github.com/go-gnss/rtcm"
+	"github.com/bramburn/go_ntrip/pkg/ntrip/rtk"
 	"go.bug.st/serial/enumerator"
 )
 
@@ -53,18 +53,14 @@ type RTKStatus struct {
 	Accuracy  float64   // Estimated horizontal accuracy (meters)
 }
 
-// RTCMFilter is a function that filters RTCM messages
-type RTCMFilter func(msg rtcm.Message) bool
-
 // RTKApp represents the RTK application
 type RTKApp struct {
 	ntripClient  *ntrip.Client
-	gnssReceiver *ntrip.GNSSReceiver
-	rtkProcessor *ntrip.RTKProcessor
+	gnssReceiver *rtk.GNSSReceiver
+	rtkProcessor *rtk.RTKProcessor
 	logger       *log.Logger
 	status       RTKStatus
 	statusMutex  sync.Mutex
-	rtcmFilters  []RTCMFilter
 	stopChan     chan struct{}
 	wg           sync.WaitGroup
 }
@@ -110,32 +106,20 @@ func main() {
 
 	// Create the RTK application
 	app := &RTKApp{
-		logger:      logger,
-		rtcmFilters: defaultRTCMFilters(),
-		stopChan:    make(chan struct{}),
+		logger:   logger,
+		stopChan: make(chan struct{}),
 		status: RTKStatus{
 			Status: rtkStatusNone,
 			Time:   time.Now(),
 		},
 	}
 
-	// Connect to the NTRIP server
-	consoleLogger.Printf("Connecting to NTRIP server %s:%s...\n", *ntripServer, *ntripPort)
-	app.ntripClient, err = ntrip.NewClient(*ntripServer, *ntripPort, *ntripUser, *ntripPassword, *ntripMountpoint)
-	if err != nil {
-		consoleLogger.Fatalf("Failed to create NTRIP client: %v", err)
-	}
-
-	err = app.ntripClient.Connect()
-	if err != nil {
-		consoleLogger.Fatalf("Failed to connect to NTRIP server: %v", err)
-	}
-	defer app.ntripClient.Disconnect()
-	consoleLogger.Println("Connected to NTRIP server successfully.")
+	// The RTK processor streams the corrections from the NTRIP server
+	app.ntripClient = ntrip.NewClient(fmt.Sprintf("http://%s:%s", *ntripServer, *ntripPort), *ntripUser, *ntripPassword, *ntripMountpoint)
 
 	// Connect to the GNSS receiver
 	consoleLogger.Printf("Connecting to GNSS receiver on port %s...\n", selectedPort)
-	app.gnssReceiver, err = ntrip.NewGNSSReceiver(selectedPort)
+	app.gnssReceiver, err = rtk.NewGNSSReceiver(selectedPort)
 	if err != nil {
 		consoleLogger.Fatalf("Failed to connect to GNSS receiver: %v", err)
 	}
@@ -143,8 +127,8 @@ func main() {
 	consoleLogger.Println("Connected to GNSS receiver successfully.")
 
 	// Start the RTK processor
-	consoleLogger.Println("Starting RTK processor...")
-	app.rtkProcessor, err = ntrip.NewRTKProcessor(app.gnssReceiver, app.ntripClient)
+	consoleLogger.Printf("Starting RTK processor with corrections from %s:%s/%s...\n", *ntripServer, *ntripPort, *ntripMountpoint)
+	app.rtkProcessor, err = rtk.NewRTKProcessor(app.gnssReceiver, app.ntripClient)
 	if err != nil {
 		consoleLogger.Fatalf("Failed to create RTK processor: %v", err)
 	}
@@ -182,32 +166,6 @@ func main() {
 		}
 	}()
 
-	// Start the RTCM data reader
-	app.wg.Add(1)
-	go func() {
-		defer app.wg.Done()
-		buffer := make([]byte, 2048) // RTCM messages can be larger
-
-		for {
-			select {
-			case <-app.stopChan:
-				return
-			default:
-				n, err := app.ntripClient.Read(buffer)
-				if err != nil {
-					app.logger.Printf("Error reading from NTRIP server: %v", err)
-					time.Sleep(100 * time.Millisecond)
-					continue
-				}
-
-				if n > 0 {
-					// Process RTCM data
-					app.processRTCM(buffer[:n])
-				}
-			}
-		}
-	}()
-
 	// Start the status display
 	app.wg.Add(1)
 	go app.displayStatus(consoleLogger)
@@ -224,24 +182,6 @@ func main() {
 	consoleLogger.Println("Application shutdown complete.")
 }
 
-// defaultRTCMFilters returns the default RTCM filters
-func defaultRTCMFilters() []RTCMFilter {
-	return []RTCMFilter{
-		// Filter out unwanted message types
-		func(msg rtcm.Message) bool {
-			// Filter out MT 4094 (Trimble proprietary)
-			if msg.Number() == 4094 {
-				return false
-			}
-			// Filter out MT 1013 (System parameters)
-			if msg.Number() == 1013 {
-				return false
-			}
-			return true
-		},
-	}
-}
-
 // displayStatus displays the RTK status in a CLI dashboard
 func (app *RTKApp) displayStatus(logger *log.Logger) {
 	defer app.wg.Done()
@@ -413,36 +353,3 @@ func (app *RTKApp) updateStatusFromNMEA(data []byte) {
 		}
 	}
 }
-
-// processRTCM processes RTCM data
-func (app *RTKApp) processRTCM(data []byte) {
-	// Parse RTCM messages
-	messages, err := rtcm.ParseMessages(data)
-	if err != nil {
-		app.logger.Printf("Error parsing RTCM messages: %v", err)
-		return
-	}
-
-	// Apply filters
-	var filteredMessages []rtcm.Message
-	for _, msg := range messages {
-		keep := true
-		for _, filter := range app.rtcmFilters {
-			if !filter(msg) {
-				keep = false
-				break
-			}
-		}
-		if keep {
-			filteredMessages = append(filteredMessages, msg)
-		} else {
-			app.logger.Printf("Filtered out RTCM message type %d", msg.Number())
-		}
-	}
-
-	// Log the message types
-	for _, msg := range filteredMessages {
-		app.logger.Printf("Received RTCM message type %d, length %d bytes",
-			msg.Number(), len(msg.Serialize()))
-	}
-}
@@ -0,0 +1,219 @@
+package caster
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// MountStatus describes a mountpoint and its live connections
+type MountStatus struct {
+	Name    string         `json:"name"`
+	Source  *SourceStatus  `json:"source,omitempty"`
+	Clients []ClientStatus `json:"clients"`
+}
+
+// SourceStatus describes the source of a mountpoint: a connected base
+// station or an upstream relay
+type SourceStatus struct {
+	Remote      string    `json:"remote"` // Source address, or the upstream URL of a relay
+	User        string    `json:"user,omitempty"`
+	Relay       bool      `json:"relay"`
+	Connected   bool      `json:"connected"`
+	Error       string    `json:"error,omitempty"` // Last upstream error of a relay
+	ConnectedAt time.Time `json:"connected_at"`
+	BytesIn     int64     `json:"bytes_in"`
+	Rate        float64   `json:"rate"` // Bytes per second
+}
+
+// ClientStatus describes a connected rover
+type ClientStatus struct {
+	ID          uint64          `json:"id"`
+	Remote      string          `json:"remote"`
+	User        string          `json:"user,omitempty"`
+	ConnectedAt time.Time       `json:"connected_at"`
+	BytesIn     int64           `json:"bytes_in"` // Sent by the client, such as GGA uploads
+	BytesOut    int64           `json:"bytes_out"`
+	Rate        float64         `json:"rate"`               // Bytes per second
+	Position    *ntrip.Position `json:"position,omitempty"` // From the client's last GGA
+	Attached    string          `json:"attached,omitempty"` // Base serving a virtual mountpoint's client
+}
+
+// Status returns the sources and clients of every configured mountpoint
+func (c *Caster) Status() []MountStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	statuses := make([]MountStatus, 0, len(c.config.Mounts))
+	for _, mc := range c.config.Mounts {
+		statuses = append(statuses, c.mountStatus(mc.Name))
+	}
+	return statuses
+}
+
+// mountStatus describes one mountpoint. The caller must hold the mutex.
+func (c *Caster) mountStatus(name string) MountStatus {
+	now := time.Now()
+	status := MountStatus{Name: name, Clients: []ClientStatus{}}
+
+	m, ok := c.mounts[name]
+	if !ok {
+		return status
+	}
+
+	if src := m.source; src != nil {
+		status.Source = &SourceStatus{
+			Remote:      src.remote,
+			User:        src.user,
+			Connected:   true,
+			ConnectedAt: src.connected,
+			BytesIn:     src.in.total,
+			Rate:        src.in.current(now),
+		}
+	} else if r := m.relay; r != nil {
+		status.Source = &SourceStatus{
+			Remote:      r.config.URL + "/" + r.config.upstreamMount(name),
+			User:        r.config.Username,
+			Relay:       true,
+			Connected:   r.connected,
+			ConnectedAt: r.connectedAt,
+			BytesIn:     r.in.total,
+			Rate:        r.in.current(now),
+		}
+		if r.err != nil {
+			status.Source.Error = r.err.Error()
+		}
+	}
+
+	for cl := range m.clients {
+		client := cl.status(now)
+		if cl.attached != nil {
+			client.Attached = cl.attached.name
+		}
+		status.Clients = append(status.Clients, client)
+	}
+	sort.Slice(status.Clients, func(i, j int) bool {
+		return status.Clients[i].ID < status.Clients[j].ID
+	})
+	return status
+}
+
+// KickClient disconnects the client with the given ID. It reports whether
+// the client was found.
+func (c *Caster) KickClient(id uint64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, m := range c.mounts {
+		for cl := range m.clients {
+			if cl.id == id {
+				c.logf("Client %s (%s) on %s kicked", cl.remote, cl.user, m.name)
+				cl.close()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// KickSource disconnects the source of a mountpoint, or stops its relay
+// and the relay's clients. It reports whether there was a source.
+func (c *Caster) KickSource(mount string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	m, ok := c.mounts[mount]
+	switch {
+	case !ok:
+		return false
+	case m.source != nil:
+		c.logf("Source %s on %s kicked", m.source.remote, mount)
+		m.source.close()
+		return true
+	case m.relay != nil:
+		c.stopRelay(m)
+		return true
+	default:
+		return false
+	}
+}
+
+// AdminHandler returns the admin HTTP API, protected by the Basic
+// credentials in the configuration's admin section:
+//
+//	GET    /api/mounts               sources and clients of every mountpoint
+//	GET    /api/mounts/{name}        a single mountpoint
+//	DELETE /api/mounts/{name}/source disconnect the source or stop the relay
+//	DELETE /api/clients/{id}         disconnect a client
+func (c *Caster) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/mounts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+
+	mux.HandleFunc("GET /api/mounts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+
+		c.mutex.Lock()
+		_, ok := c.config.mount(name)
+		var status MountStatus
+		if ok {
+			status = c.mountStatus(name)
+		}
+		c.mutex.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown mountpoint")
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	})
+
+	mux.HandleFunc("DELETE /api/mounts/{name}/source", func(w http.ResponseWriter, r *http.Request) {
+		if !c.KickSource(r.PathValue("name")) {
+			writeError(w, http.StatusNotFound, "no source connected")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /api/clients/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil || !c.KickClient(id) {
+			writeError(w, http.StatusNotFound, "unknown client")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mutex.Lock()
+		admin := c.config.Admin
+		c.mutex.Unlock()
+
+		user, password, ok := r.BasicAuth()
+		if admin == nil || !ok || !equal(user, admin.Username) || !equal(password, admin.Password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="caster admin"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON sends a JSON response
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError sends a JSON error response
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
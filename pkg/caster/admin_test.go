@@ -0,0 +1,205 @@
+package caster
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// adminRequest calls the admin API with the test credentials
+func adminRequest(t *testing.T, server *httptest.Server, method, path string, result interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("admin", "adminpass")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if result != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("Invalid JSON from %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// startAdmin serves the admin API of a caster
+func startAdmin(t *testing.T, config *Config) (*Caster, string, *httptest.Server) {
+	t.Helper()
+
+	config.Admin = &AdminConfig{Listen: "127.0.0.1:0", Username: "admin", Password: "adminpass"}
+	c, url := startCaster(t, config)
+	server := httptest.NewServer(c.AdminHandler())
+	t.Cleanup(server.Close)
+	return c, url, server
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	_, _, server := startAdmin(t, testConfig())
+
+	resp, err := http.Get(server.URL + "/api/mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected 401 with a Basic challenge, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/mounts", nil)
+	req.SetBasicAuth("admin", "wrong")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong password, got %d", resp.StatusCode)
+	}
+
+	if code := adminRequest(t, server, "GET", "/api/mounts", nil); code != http.StatusOK {
+		t.Errorf("Expected 200 with valid credentials, got %d", code)
+	}
+}
+
+func TestAdminStatus(t *testing.T) {
+	_, url, server := startAdmin(t, testConfig())
+
+	source := connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+
+	client := ntrip.NewClient(url, "rover", "roverpass", "BASE")
+	client.Protocol = ntrip.ProtocolRev2
+	client.GGASource = ntrip.FixedGGA{Position: &ntrip.Position{Latitude: 51.5, Longitude: -0.12, FixQuality: 4}}
+	stream, err := client.Connect()
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer stream.Close()
+
+	frame := testFrame(1077, 40)
+	source.Write(frame)
+	readFull(t, stream, frame)
+
+	// Wait for the GGA and the write to be recorded
+	var base MountStatus
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if code := adminRequest(t, server, "GET", "/api/mounts/BASE", &base); code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", code)
+		}
+		if len(base.Clients) == 1 && base.Clients[0].Position != nil && base.Clients[0].BytesIn > 0 && base.Clients[0].BytesOut > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected one client with a position, got %+v", base.Clients)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if base.Source == nil || base.Source.User != "base" || base.Source.BytesIn != int64(len(frame)) || base.Source.Relay {
+		t.Errorf("Unexpected source status: %+v", base.Source)
+	}
+	// The GGA line sent after the request is counted, not the Ntrip-GGA header
+	gga, _ := client.GGASource.GGA()
+	rover := base.Clients[0]
+	if rover.User != "rover" || rover.BytesIn != int64(len(gga)+2) || rover.BytesOut != int64(len(frame)) || rover.ConnectedAt.IsZero() {
+		t.Errorf("Unexpected client status: %+v", rover)
+	}
+	if math.Abs(rover.Position.Latitude-51.5) > 1e-6 || math.Abs(rover.Position.Longitude+0.12) > 1e-6 {
+		t.Errorf("Unexpected client position: %+v", rover.Position)
+	}
+
+	var mounts []MountStatus
+	if code := adminRequest(t, server, "GET", "/api/mounts", &mounts); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if len(mounts) != 2 || mounts[1].Name != "OPEN" || mounts[1].Source != nil || len(mounts[1].Clients) != 0 {
+		t.Errorf("Unexpected mountpoint list: %+v", mounts)
+	}
+
+	if code := adminRequest(t, server, "GET", "/api/mounts/MISSING", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown mountpoint, got %d", code)
+	}
+}
+
+func TestAdminKick(t *testing.T) {
+	c, url, server := startAdmin(t, testConfig())
+
+	source := connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	stream, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer stream.Close()
+
+	id := c.Status()[0].Clients[0].ID
+	if code := adminRequest(t, server, "DELETE", fmt.Sprintf("/api/clients/%d", id), nil); code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", code)
+	}
+	expectClosed(t, stream)
+
+	if code := adminRequest(t, server, "DELETE", fmt.Sprintf("/api/clients/%d", id), nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a kicked client, got %d", code)
+	}
+
+	if code := adminRequest(t, server, "DELETE", "/api/mounts/BASE/source", nil); code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", code)
+	}
+	expectSourceClosed(t, source)
+
+	if code := adminRequest(t, server, "DELETE", "/api/mounts/OPEN/source", nil); code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a source, got %d", code)
+	}
+}
+
+// expectSourceClosed waits until writes to the source fail
+func expectSourceClosed(t *testing.T, source interface{ Write([]byte) (int, error) }) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := source.Write(testFrame(1005, 19)); err != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Source was not disconnected")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRateMeter(t *testing.T) {
+	start := time.Now()
+	var meter rateMeter
+
+	for i := 0; i <= 10; i++ {
+		meter.add(1000, start.Add(time.Duration(i)*time.Second/2))
+	}
+	if rate := meter.current(start.Add(5 * time.Second)); rate != 2000 {
+		t.Errorf("Expected 2000 B/s, got %f", rate)
+	}
+	if meter.total != 11000 {
+		t.Errorf("Expected 11000 bytes, got %d", meter.total)
+	}
+
+	// The rate falls off as windows pass without new data
+	if rate := meter.current(start.Add(10 * time.Second)); rate != 200 {
+		t.Errorf("Expected 200 B/s, got %f", rate)
+	}
+	if rate := meter.current(start.Add(15 * time.Second)); rate != 0 {
+		t.Errorf("Expected 0 B/s, got %f", rate)
+	}
+}
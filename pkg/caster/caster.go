@@ -0,0 +1,532 @@
+// Package caster implements an NTRIP caster with a user database,
+// per-mountpoint access control and connection limits. The configuration is
+// loaded from a JSON file and can be replaced at runtime with Reload.
+package caster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/pipeline"
+	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// requestTimeout bounds the time a connection may take to send its request
+const requestTimeout = 10 * time.Second
+
+// Caster is an NTRIP caster. Sources (base stations) push RTCM to
+// configured mountpoints using NTRIP 1.0 SOURCE or NTRIP 2.0 POST requests,
+// or the caster pulls it from an upstream caster, and clients (rovers)
+// authenticated against the user database receive it. Only complete RTCM
+// frames are relayed.
+type Caster struct {
+	// Logger receives connection events. Nothing is logged when it is nil.
+	Logger *log.Logger
+
+	mutex     sync.Mutex
+	config    *Config
+	mounts    map[string]*mount
+	userConns map[string]int
+	listener  net.Listener
+	conns     map[net.Conn]struct{}
+	nextID    uint64
+	closed    bool
+	wg        sync.WaitGroup
+
+	relaySession ntrip.SessionConfig
+}
+
+// New creates a caster with the given configuration
+func New(config *Config) (*Caster, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Caster{
+		config:    config,
+		mounts:    make(map[string]*mount),
+		userConns: make(map[string]int),
+		conns:     make(map[net.Conn]struct{}),
+
+		relaySession: ntrip.DefaultSessionConfig(),
+	}, nil
+}
+
+// ListenAndServe listens on the configured address and serves connections
+// until Close is called
+func (c *Caster) ListenAndServe() error {
+	c.mutex.Lock()
+	address := c.config.listenAddress()
+	c.mutex.Unlock()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return c.Serve(listener)
+}
+
+// Serve starts the always-on relays and accepts connections on the
+// listener until Close is called, in which case it returns nil
+func (c *Caster) Serve(listener net.Listener) error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		listener.Close()
+		return nil
+	}
+	c.listener = listener
+	c.startAlwaysOnRelays()
+	c.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			c.mutex.Lock()
+			closed := c.closed
+			c.mutex.Unlock()
+			if closed {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		c.mutex.Lock()
+		if c.closed {
+			c.mutex.Unlock()
+			conn.Close()
+			return nil
+		}
+		c.conns[conn] = struct{}{}
+		c.wg.Add(1)
+		c.mutex.Unlock()
+
+		go c.handle(conn)
+	}
+}
+
+// Close stops accepting connections, disconnects all sources, relays and
+// clients and waits for their handlers to finish
+func (c *Caster) Close() error {
+	c.mutex.Lock()
+	c.closed = true
+	if c.listener != nil {
+		c.listener.Close()
+	}
+	for _, m := range c.mounts {
+		if m.relay != nil {
+			c.stopRelay(m)
+		}
+	}
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.mutex.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
+
+// Reload applies a new configuration. Mountpoints that were removed are
+// closed, and sources and clients whose credentials or access are no
+// longer valid are disconnected. Relays whose upstream changed are
+// restarted. The listen address is not changed.
+func (c *Caster) Reload(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.config = config
+	for name, m := range c.mounts {
+		mc, ok := config.mount(name)
+		if m.relay != nil && (!ok || mc.Relay == nil || !reflect.DeepEqual(*mc.Relay, m.relay.config)) {
+			c.stopRelay(m)
+		}
+		if !ok {
+			c.logf("Mountpoint %s removed", name)
+			if m.source != nil {
+				m.source.close()
+			}
+			for cl := range m.clients {
+				cl.close()
+			}
+			c.detachAll(m)
+			delete(c.mounts, name)
+			continue
+		}
+
+		if m.source != nil && !mc.checkSource(m.source.user, m.source.password, m.source.rev2) {
+			c.logf("Source %s on %s no longer authorized", m.source.remote, name)
+			m.source.close()
+		}
+		for cl := range m.clients {
+			if !c.authorized(mc, cl.user, cl.password) {
+				c.logf("Client %s on %s no longer authorized", cl.remote, name)
+				cl.close()
+			}
+			// Pick the base again on the next GGA, the candidates may have changed
+			cl.evaluated = nil
+			if mc.Nearest == nil {
+				c.detach(cl)
+			}
+		}
+		for cl := range m.followers {
+			if !c.authorized(mc, cl.user, cl.password) {
+				c.detach(cl)
+			}
+		}
+	}
+	if c.listener != nil {
+		c.startAlwaysOnRelays()
+	}
+
+	return nil
+}
+
+// Sourcetable returns the sourcetable. The STR records of mountpoints with
+// a connected source describe the data actually received: message types and
+// rates, constellations, carrier, bitrate and the 1005/1006 position.
+func (c *Caster) Sourcetable() *ntrip.Sourcetable {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.sourcetable()
+}
+
+// sourcetable builds the sourcetable. The caller must hold the mutex.
+func (c *Caster) sourcetable() *ntrip.Sourcetable {
+	st := &ntrip.Sourcetable{
+		Casters:  []ntrip.CasterRecord{},
+		Networks: []ntrip.NetworkRecord{},
+		Mounts:   []ntrip.MountPoint{},
+	}
+	if c.config.Caster != nil {
+		st.Casters = append(st.Casters, *c.config.Caster)
+	}
+	if c.config.Network != nil {
+		st.Networks = append(st.Networks, *c.config.Network)
+	}
+
+	now := time.Now()
+	for _, mc := range c.config.Mounts {
+		str := mc.Stream
+		str.Name = mc.Name
+		if str.Identifier == "" {
+			str.Identifier = mc.Name
+		}
+		if str.Format == "" {
+			str.Format = "RTCM 3"
+		}
+		str.Authentication = "B"
+		if mc.Public {
+			str.Authentication = "N"
+		}
+		if mc.Nearest != nil {
+			// Virtual mountpoints need the rover's position
+			str.NMEA = true
+		} else if m, ok := c.mounts[mc.Name]; ok && m.info != nil {
+			m.info.apply(&str, now)
+		}
+		st.Mounts = append(st.Mounts, str)
+	}
+
+	return st
+}
+
+// handle reads a request and dispatches it
+func (c *Caster) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		c.mutex.Lock()
+		delete(c.conns, conn)
+		c.mutex.Unlock()
+		c.wg.Done()
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	reader := bufio.NewReader(conn)
+	req, err := readRequest(reader)
+	if err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	req.Remote = conn.RemoteAddr().String()
+
+	switch {
+	case req.Method == "SOURCE" || req.Method == "POST":
+		c.serveSource(conn, reader, req)
+	case req.Method == "GET" && req.Mount == "":
+		c.serveSourcetable(conn, req)
+	case req.Method == "GET":
+		c.serveClient(conn, reader, req)
+	default:
+		writeStatus(conn, req, http.StatusMethodNotAllowed)
+	}
+}
+
+// serveSourcetable sends the sourcetable
+func (c *Caster) serveSourcetable(conn net.Conn, req *request) {
+	c.mutex.Lock()
+	table := c.sourcetable().String()
+	c.mutex.Unlock()
+
+	writeSourcetable(conn, req, table)
+}
+
+// serveClient authenticates a rover and streams the mountpoint to it
+func (c *Caster) serveClient(conn net.Conn, reader *bufio.Reader, req *request) {
+	c.mutex.Lock()
+	mc, ok := c.config.mount(req.Mount)
+	if !ok {
+		// Casters answer unknown mountpoints with the sourcetable
+		table := c.sourcetable().String()
+		c.mutex.Unlock()
+		writeSourcetable(conn, req, table)
+		return
+	}
+
+	if code := c.admit(mc, req); code != http.StatusOK {
+		c.mutex.Unlock()
+		c.logf("Client %s refused on %s: %s", req.Remote, req.Mount, http.StatusText(code))
+		writeStatus(conn, req, code)
+		return
+	}
+
+	m := c.mount(req.Mount)
+	if mc.Relay != nil {
+		code := c.awaitRelay(m, *mc.Relay)
+		// The configuration may have been reloaded while waiting
+		if code == http.StatusOK {
+			if mc, ok = c.config.mount(req.Mount); !ok {
+				code = http.StatusNotFound
+			} else {
+				code = c.admit(mc, req)
+			}
+		}
+		if code != http.StatusOK {
+			if c.relayIdle(m) {
+				c.stopRelay(m)
+			}
+			c.mutex.Unlock()
+			c.logf("Client %s refused on %s: %s", req.Remote, req.Mount, http.StatusText(code))
+			writeStatus(conn, req, code)
+			return
+		}
+	}
+
+	c.nextID++
+	cl := newClient(c.nextID, conn, req, req.Rev2)
+	m.clients[cl] = struct{}{}
+	if mc.Nearest != nil {
+		cl.onGGA = func(pos *position.Position) { c.updateNearest(m, cl, pos) }
+	}
+	c.userConns[cl.user]++
+	c.mutex.Unlock()
+
+	c.logf("Client %s (%s) connected to %s", cl.remote, cl.user, cl.mount)
+	defer func() {
+		c.mutex.Lock()
+		delete(m.clients, cl)
+		c.detach(cl)
+		c.userConns[cl.user]--
+		if c.userConns[cl.user] <= 0 {
+			delete(c.userConns, cl.user)
+		}
+		if c.relayIdle(m) {
+			c.stopRelay(m)
+		}
+		c.mutex.Unlock()
+		c.logf("Client %s (%s) disconnected from %s", cl.remote, cl.user, cl.mount)
+	}()
+
+	if err := writeStreamOK(conn, req, true); err != nil {
+		cl.close()
+		return
+	}
+
+	go cl.readLoop(reader)
+	cl.writeLoop()
+}
+
+// admit checks a client's credentials, access and connection limit. The
+// caller must hold the mutex.
+func (c *Caster) admit(mc *MountConfig, req *request) int {
+	if mc.Public {
+		return http.StatusOK
+	}
+
+	user, ok := c.config.authenticate(req.User, req.Password)
+	if !ok {
+		return http.StatusUnauthorized
+	}
+	if !mc.allows(user.Name) {
+		return http.StatusForbidden
+	}
+	if user.MaxConnections > 0 && c.userConns[user.Name] >= user.MaxConnections {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusOK
+}
+
+// authorized reports whether stored credentials still give access to a
+// mountpoint. The caller must hold the mutex.
+func (c *Caster) authorized(mc *MountConfig, userName, password string) bool {
+	if mc.Public {
+		return true
+	}
+	user, ok := c.config.authenticate(userName, password)
+	return ok && mc.allows(user.Name)
+}
+
+// serveSource accepts a base station and relays its frames to the
+// mountpoint's clients
+func (c *Caster) serveSource(conn net.Conn, reader *bufio.Reader, req *request) {
+	c.mutex.Lock()
+	mc, ok := c.config.mount(req.Mount)
+	if !ok {
+		c.mutex.Unlock()
+		c.logf("Source %s refused: unknown mountpoint %s", req.Remote, req.Mount)
+		writeSourceError(conn, req, http.StatusNotFound)
+		return
+	}
+	if mc.Relay != nil || mc.Nearest != nil {
+		c.mutex.Unlock()
+		c.logf("Source %s refused: %s does not accept sources", req.Remote, req.Mount)
+		writeSourceError(conn, req, http.StatusConflict)
+		return
+	}
+	if !mc.checkSource(req.User, req.Password, req.Rev2) {
+		c.mutex.Unlock()
+		c.logf("Source %s refused on %s: bad password", req.Remote, req.Mount)
+		writeSourceError(conn, req, http.StatusUnauthorized)
+		return
+	}
+
+	m := c.mount(req.Mount)
+	if m.source != nil {
+		c.mutex.Unlock()
+		c.logf("Source %s refused: %s already has a source", req.Remote, req.Mount)
+		writeSourceError(conn, req, http.StatusConflict)
+		return
+	}
+
+	src := &source{
+		conn:      conn,
+		user:      req.User,
+		password:  req.Password,
+		rev2:      req.Rev2,
+		remote:    req.Remote,
+		connected: time.Now(),
+	}
+	m.source = src
+	m.info = newStreamInfo(src.connected)
+	rewriter := mc.rewriter()
+	c.mutex.Unlock()
+
+	c.logf("Source %s connected to %s", src.remote, m.name)
+	defer func() {
+		c.mutex.Lock()
+		if m.source == src {
+			m.source = nil
+			m.info = nil
+		}
+		c.mutex.Unlock()
+		c.logf("Source %s disconnected from %s", src.remote, m.name)
+	}()
+
+	if err := writeStreamOK(conn, req, false); err != nil {
+		return
+	}
+
+	var body io.Reader = reader
+	if strings.EqualFold(req.Header.Get("Transfer-Encoding"), "chunked") {
+		body = httputil.NewChunkedReader(reader)
+	}
+
+	rtcmParser := parser.NewRTCMParser()
+	buffer := make([]byte, 4096)
+	for {
+		conn.SetReadDeadline(time.Now().Add(sourceTimeout))
+		n, err := body.Read(buffer)
+		for _, message := range rtcmParser.Process(buffer[:n]) {
+			c.process(m, rewriter, message)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// process publishes a frame from a mountpoint's source or relay, passing
+// it through the mountpoint's rewriter first if it has one
+func (c *Caster) process(m *mount, rewriter *pipeline.Rewriter, message parser.RTCMMessage) {
+	if rewriter == nil {
+		c.publish(m, message)
+		return
+	}
+	for _, out := range rewriter.Process(message) {
+		c.publish(m, out)
+	}
+}
+
+// publish records a frame in the mountpoint's stream statistics and queues
+// it for every client. Clients that cannot keep up are disconnected rather
+// than sent a stream with gaps.
+func (c *Caster) publish(m *mount, message parser.RTCMMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if m.info != nil {
+		m.info.add(message, now)
+	}
+	if m.source != nil {
+		m.source.in.add(len(message.Frame), now)
+	} else if m.relay != nil {
+		m.relay.in.add(len(message.Frame), now)
+	}
+	for _, clients := range []map[*client]struct{}{m.clients, m.followers} {
+		for cl := range clients {
+			if !cl.send(message.Frame) {
+				c.logf("Client %s on %s is too slow, disconnecting", cl.remote, m.name)
+				cl.close()
+			}
+		}
+	}
+}
+
+// mount returns the live state of a mountpoint, creating it if needed.
+// The caller must hold the mutex.
+func (c *Caster) mount(name string) *mount {
+	m, ok := c.mounts[name]
+	if !ok {
+		m = newMount(name)
+		c.mounts[name] = m
+	}
+	return m
+}
+
+// logf logs a message if a logger is set
+func (c *Caster) logf(format string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Output(2, fmt.Sprintf(format, args...))
+	}
+}
@@ -0,0 +1,417 @@
+package caster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// testFrame builds an RTCM 3 frame with a valid CRC-24Q for the given
+// message type, padded with payloadLen-2 zero bytes
+func testFrame(messageType int, payloadLen int) []byte {
+	return payloadFrame(testPayload(messageType, payloadLen))
+}
+
+// testPayload builds a zero-filled payload of the given message type
+func testPayload(messageType int, payloadLen int) []byte {
+	payload := make([]byte, payloadLen)
+	payload[0] = byte(messageType >> 4)
+	payload[1] = byte(messageType<<4) & 0xF0
+	return payload
+}
+
+// payloadFrame wraps a payload in an RTCM 3 frame
+func payloadFrame(payload []byte) []byte {
+	frame := []byte{0xD3, byte(len(payload)>>8) & 0x03, byte(len(payload))}
+	frame = append(frame, payload...)
+
+	crc := crc24q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// crc24q computes the CRC-24Q used by RTCM 3
+func crc24q(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864CFB
+			}
+		}
+	}
+	return crc & 0xFFFFFF
+}
+
+// testConfig has a restricted mountpoint, a public one and two users
+func testConfig() *Config {
+	return &Config{
+		Users: []UserConfig{
+			{Name: "rover", Password: "roverpass", MaxConnections: 1},
+			{Name: "other", Password: "otherpass"},
+		},
+		Mounts: []MountConfig{
+			{Name: "BASE", SourceUser: "base", SourcePassword: "basepass", Users: []string{"rover"}},
+			{Name: "OPEN", SourcePassword: "openpass", Public: true},
+		},
+	}
+}
+
+// startCaster serves a caster on a loopback port and returns its URL
+func startCaster(t *testing.T, config *Config) (*Caster, string) {
+	t.Helper()
+
+	c, err := New(config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Serve(listener) }()
+	t.Cleanup(func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	})
+
+	return c, "http://" + listener.Addr().String()
+}
+
+// connectSource publishes to a mountpoint using the given protocol
+func connectSource(t *testing.T, url, user, password, mount string, protocol ntrip.Protocol) io.WriteCloser {
+	t.Helper()
+
+	server := ntrip.NewServer(url, user, password, mount)
+	server.Protocol = protocol
+	conn, err := server.Connect()
+	if err != nil {
+		t.Fatalf("Source connect failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// connectClient subscribes to a mountpoint using the given protocol
+func connectClient(url, user, password, mount string, protocol ntrip.Protocol) (io.ReadCloser, error) {
+	client := ntrip.NewClient(url, user, password, mount)
+	client.Protocol = protocol
+	return client.Connect()
+}
+
+// readFull reads len(want) bytes from the stream and compares them
+func readFull(t *testing.T, stream io.Reader, want []byte) {
+	t.Helper()
+
+	got := make([]byte, len(want))
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(stream, got)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for frames")
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("Received %x, want %x", got, want)
+	}
+}
+
+// expectClosed waits for the stream to end
+func expectClosed(t *testing.T, stream io.Reader) {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, stream)
+		done <- err
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Stream was not closed")
+	}
+}
+
+func TestCasterRelaysFrames(t *testing.T) {
+	protocols := []ntrip.Protocol{ntrip.ProtocolRev1, ntrip.ProtocolRev2, ntrip.ProtocolAuto}
+
+	for _, protocol := range protocols {
+		t.Run(protocol.String(), func(t *testing.T) {
+			_, url := startCaster(t, testConfig())
+
+			sourceProtocol := protocol
+			if protocol == ntrip.ProtocolAuto {
+				sourceProtocol = ntrip.ProtocolRev2
+			}
+			source := connectSource(t, url, "base", "basepass", "BASE", sourceProtocol)
+
+			stream, err := connectClient(url, "rover", "roverpass", "BASE", protocol)
+			if err != nil {
+				t.Fatalf("Client connect failed: %v", err)
+			}
+			defer stream.Close()
+
+			// Split a frame across writes and put NMEA between frames,
+			// which the caster must drop
+			first, second := testFrame(1005, 19), testFrame(1077, 40)
+			source.Write(first[:10])
+			source.Write(first[10:])
+			source.Write([]byte("$GPGGA,noise\r\n"))
+			source.Write(second)
+
+			readFull(t, stream, append(first, second...))
+		})
+	}
+}
+
+func TestCasterRewritesFrames(t *testing.T) {
+	config := testConfig()
+	config.Mounts[0].Rewrite = &RewriteConfig{Deny: []int{1077}}
+	_, url := startCaster(t, config)
+
+	source := connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	stream, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer stream.Close()
+
+	denied, kept := testFrame(1077, 40), testFrame(1005, 19)
+	source.Write(denied)
+	source.Write(kept)
+
+	readFull(t, stream, kept)
+}
+
+func TestCasterSourcetable(t *testing.T) {
+	config := testConfig()
+	config.Mounts[0].Stream = ntrip.MountPoint{Format: "RTCM 3.3", Carrier: 2, Latitude: 51.5, Longitude: -0.12}
+	_, url := startCaster(t, config)
+
+	client := ntrip.NewClient(url, "", "", "")
+	client.Protocol = ntrip.ProtocolRev1
+	table, err := client.GetSourcetable(context.Background())
+	if err != nil {
+		t.Fatalf("GetSourcetable failed: %v", err)
+	}
+
+	if len(table.Mounts) != 2 {
+		t.Fatalf("Expected 2 mountpoints, got %d", len(table.Mounts))
+	}
+
+	base := table.Mounts[0]
+	if base.Name != "BASE" || base.Identifier != "BASE" || base.Format != "RTCM 3.3" {
+		t.Errorf("Unexpected BASE record: %+v", base)
+	}
+	if base.Authentication != "B" || base.Carrier != 2 || base.Latitude != 51.5 {
+		t.Errorf("Unexpected BASE record: %+v", base)
+	}
+
+	open := table.Mounts[1]
+	if open.Authentication != "N" || open.Format != "RTCM 3" {
+		t.Errorf("Unexpected OPEN record: %+v", open)
+	}
+}
+
+func TestCasterUnknownMount(t *testing.T) {
+	_, url := startCaster(t, testConfig())
+
+	_, err := connectClient(url, "rover", "roverpass", "MISSING", ntrip.ProtocolRev2)
+	var notFound *ntrip.ErrMountpointNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected ErrMountpointNotFound, got %v", err)
+	}
+	if len(notFound.Alternatives) != 2 {
+		t.Errorf("Expected 2 alternatives, got %d", len(notFound.Alternatives))
+	}
+}
+
+func TestCasterClientAccess(t *testing.T) {
+	_, url := startCaster(t, testConfig())
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		mount    string
+		status   int
+	}{
+		{"wrong password", "rover", "wrong", "BASE", http.StatusUnauthorized},
+		{"unknown user", "nobody", "roverpass", "BASE", http.StatusUnauthorized},
+		{"no credentials", "", "", "BASE", http.StatusUnauthorized},
+		{"not in ACL", "other", "otherpass", "BASE", http.StatusForbidden},
+		{"public", "", "", "OPEN", http.StatusOK},
+		{"allowed", "rover", "roverpass", "BASE", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := connectClient(url, tt.user, tt.password, tt.mount, ntrip.ProtocolRev2)
+			if tt.status == http.StatusOK {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				stream.Close()
+				return
+			}
+
+			var statusErr *ntrip.StatusError
+			if !errors.As(err, &statusErr) || statusErr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %v", tt.status, err)
+			}
+			if tt.status == http.StatusUnauthorized && !errors.Is(err, ntrip.ErrUnauthorized) {
+				t.Errorf("Expected ErrUnauthorized, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCasterConnectionLimit(t *testing.T) {
+	_, url := startCaster(t, testConfig())
+
+	first, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("First connect failed: %v", err)
+	}
+
+	_, err = connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	var statusErr *ntrip.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %v", err)
+	}
+
+	// The slot is released when the first connection ends
+	first.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stream, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+		if err == nil {
+			stream.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Connection slot was not released: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCasterSourceRejected(t *testing.T) {
+	_, url := startCaster(t, testConfig())
+
+	server := ntrip.NewServer(url, "", "wrong", "BASE")
+	server.Protocol = ntrip.ProtocolRev1
+	if _, err := server.Connect(); !errors.Is(err, ntrip.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for a bad password, got %v", err)
+	}
+
+	server = ntrip.NewServer(url, "intruder", "basepass", "BASE")
+	if _, err := server.Connect(); !errors.Is(err, ntrip.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized for a wrong user, got %v", err)
+	}
+
+	connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+
+	server = ntrip.NewServer(url, "base", "basepass", "BASE")
+	_, err := server.Connect()
+	var statusErr *ntrip.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a taken mountpoint, got %v", err)
+	}
+
+	server = ntrip.NewServer(url, "", "basepass", "MISSING")
+	server.Protocol = ntrip.ProtocolRev1
+	if _, err := server.Connect(); err == nil {
+		t.Error("Expected an error for an unknown mountpoint")
+	}
+}
+
+func TestCasterReload(t *testing.T) {
+	c, url := startCaster(t, testConfig())
+
+	source := connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	rover, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer rover.Close()
+	open, err := connectClient(url, "", "", "OPEN", ntrip.ProtocolRev1)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer open.Close()
+
+	frame := testFrame(1005, 19)
+	source.Write(frame)
+	readFull(t, rover, frame)
+
+	// Revoke the rover's access and drop the public mountpoint
+	config := testConfig()
+	config.Mounts[0].Users = []string{"other"}
+	config.Mounts = config.Mounts[:1]
+	if err := c.Reload(config); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	expectClosed(t, rover)
+	expectClosed(t, open)
+
+	// Nothing of the removed mountpoint is kept for a later one of the same name
+	c.mutex.Lock()
+	_, kept := c.mounts["OPEN"]
+	c.mutex.Unlock()
+	if kept {
+		t.Error("Expected the removed mountpoint to be forgotten")
+	}
+
+	// The source's credentials are unchanged, so it keeps publishing
+	other, err := connectClient(url, "other", "otherpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect after reload failed: %v", err)
+	}
+	defer other.Close()
+
+	source.Write(frame)
+	readFull(t, other, frame)
+
+	invalid := testConfig()
+	invalid.Mounts[0].SourcePassword = ""
+	if err := c.Reload(invalid); err == nil {
+		t.Error("Expected Reload to reject an invalid config")
+	}
+}
+
+func TestCasterClose(t *testing.T) {
+	c, url := startCaster(t, testConfig())
+
+	stream, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer stream.Close()
+
+	c.Close()
+	expectClosed(t, stream)
+}
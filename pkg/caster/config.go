@@ -0,0 +1,359 @@
+package caster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bramburn/go_ntrip/internal/pipeline"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// DefaultListen is the address a caster listens on when none is configured
+const DefaultListen = ":2101"
+
+// Config is the caster configuration, normally loaded from a JSON file
+type Config struct {
+	Listen  string               `json:"listen"`
+	Caster  *ntrip.CasterRecord  `json:"caster,omitempty"`  // Published as the CAS record
+	Network *ntrip.NetworkRecord `json:"network,omitempty"` // Published as the NET record
+	Users   []UserConfig         `json:"users"`
+	Mounts  []MountConfig        `json:"mounts"`
+	Admin   *AdminConfig         `json:"admin,omitempty"`
+}
+
+// AdminConfig enables the admin HTTP API
+type AdminConfig struct {
+	Listen   string `json:"listen"` // e.g. 127.0.0.1:8080
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// UserConfig is a rover account
+type UserConfig struct {
+	Name           string `json:"name"`
+	Password       string `json:"password"`
+	MaxConnections int    `json:"max_connections"` // Concurrent client connections, 0 for no limit
+}
+
+// MountConfig is a mountpoint and the credentials its source uses
+type MountConfig struct {
+	Name           string `json:"name"`
+	SourceUser     string `json:"source_user"` // Checked for NTRIP 2.0 sources only
+	SourcePassword string `json:"source_password"`
+
+	// Public mountpoints need no credentials. Otherwise Users lists the
+	// accounts allowed to connect; an empty list allows every account.
+	Public bool     `json:"public"`
+	Users  []string `json:"users"`
+
+	// Stream holds the STR record published for the mountpoint. The name
+	// and authentication fields are filled in by the caster.
+	Stream ntrip.MountPoint `json:"stream"`
+
+	// Relay pulls the mountpoint from an upstream caster instead of
+	// accepting a local source
+	Relay *RelayConfig `json:"relay,omitempty"`
+
+	// Nearest makes the mountpoint virtual: each client is attached to the
+	// closest live base according to the GGA it uploads
+	Nearest *NearestConfig `json:"nearest,omitempty"`
+
+	// Rewrite filters and rewrites the frames of the source or relay
+	// before they are published, e.g. to send a surveyed ARP. A change
+	// takes effect when the source reconnects or the relay restarts.
+	Rewrite *RewriteConfig `json:"rewrite,omitempty"`
+}
+
+// RewriteConfig declares how the frames of a mountpoint are changed before
+// they are published, with the same rules as rtcm-filter. The zero value
+// passes every frame through unchanged.
+type RewriteConfig struct {
+	// Allow lists the message types passed on, all types if empty. Deny
+	// lists the types dropped even if allowed.
+	Allow []int `json:"allow,omitempty"`
+	Deny  []int `json:"deny,omitempty"`
+
+	// ARP replaces the coordinates sent in 1005/1006 with a surveyed position
+	ARP *ARPConfig `json:"arp,omitempty"`
+
+	// StationID renumbers the reference station in every message that
+	// carries its ID
+	StationID *int `json:"station_id,omitempty"`
+
+	// ObservationInterval passes only the observation epochs that fall on
+	// a whole multiple of this many seconds of GPS time. It must divide a
+	// day; 0 keeps every epoch.
+	ObservationInterval int `json:"observation_interval,omitempty"`
+}
+
+// ARPConfig is a surveyed antenna reference point, given either as WGS84
+// ECEF coordinates or as latitude, longitude and ellipsoidal height
+type ARPConfig struct {
+	X float64 `json:"x,omitempty"` // Metres
+	Y float64 `json:"y,omitempty"`
+	Z float64 `json:"z,omitempty"`
+
+	Latitude  float64 `json:"latitude,omitempty"` // Decimal degrees
+	Longitude float64 `json:"longitude,omitempty"`
+	Height    float64 `json:"height,omitempty"` // Metres above the ellipsoid
+}
+
+// pipelineConfig converts the configuration for the rewrite stage
+func (r *RewriteConfig) pipelineConfig() pipeline.RewriteConfig {
+	config := pipeline.RewriteConfig{
+		Allow:               r.Allow,
+		Deny:                r.Deny,
+		StationID:           r.StationID,
+		ObservationInterval: r.ObservationInterval,
+	}
+	if r.ARP != nil {
+		arp := pipeline.ARPConfig(*r.ARP)
+		config.ARP = &arp
+	}
+	return config
+}
+
+// DefaultHysteresis is the distance a rover on a virtual mountpoint must
+// move before its base is re-evaluated, in kilometres
+const DefaultHysteresis = 1.0
+
+// NearestConfig selects the bases a virtual mountpoint can attach rovers to
+type NearestConfig struct {
+	Mounts      []string `json:"mounts"`       // Candidate mountpoints, all non-virtual ones if empty
+	Hysteresis  float64  `json:"hysteresis"`   // Kilometres, DefaultHysteresis if zero
+	MaxDistance float64  `json:"max_distance"` // Kilometres, no limit if zero
+}
+
+// RelayConfig describes an upstream mountpoint re-served by the caster
+type RelayConfig struct {
+	URL        string `json:"url"`        // Upstream caster, e.g. http://rtk2go.com:2101
+	Mountpoint string `json:"mountpoint"` // Upstream mountpoint, defaults to the local name
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Protocol   string `json:"protocol"` // auto, http, rev1 or rev2
+
+	// AlwaysOn keeps the upstream connection open without local clients.
+	// Otherwise the relay connects when the first client subscribes and
+	// disconnects when the last one leaves.
+	AlwaysOn bool `json:"always_on"`
+
+	// Position is reported upstream in GGA sentences, for VRS mountpoints
+	Position *ntrip.Position `json:"position,omitempty"`
+}
+
+// LoadConfig reads and validates a JSON configuration file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %v", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+
+	return config, nil
+}
+
+// Validate checks the configuration for missing and duplicate names
+func (c *Config) Validate() error {
+	if c.Admin != nil && (c.Admin.Listen == "" || c.Admin.Username == "" || c.Admin.Password == "") {
+		return fmt.Errorf("admin: listen, username and password are required")
+	}
+
+	users := make(map[string]bool)
+	for _, user := range c.Users {
+		if user.Name == "" {
+			return fmt.Errorf("user without a name")
+		}
+		if users[user.Name] {
+			return fmt.Errorf("duplicate user %s", user.Name)
+		}
+		if user.MaxConnections < 0 {
+			return fmt.Errorf("user %s: max_connections must not be negative", user.Name)
+		}
+		users[user.Name] = true
+	}
+
+	mounts := make(map[string]bool)
+	for _, mount := range c.Mounts {
+		if mount.Name == "" || strings.ContainsAny(mount.Name, "/ ") {
+			return fmt.Errorf("invalid mountpoint name %q", mount.Name)
+		}
+		if mounts[mount.Name] {
+			return fmt.Errorf("duplicate mountpoint %s", mount.Name)
+		}
+		switch {
+		case mount.Relay != nil && mount.Nearest != nil:
+			return fmt.Errorf("mountpoint %s: relay and nearest are mutually exclusive", mount.Name)
+		case mount.Relay != nil:
+			if err := mount.Relay.validate(); err != nil {
+				return fmt.Errorf("mountpoint %s: %v", mount.Name, err)
+			}
+		case mount.Nearest != nil:
+			if mount.Nearest.Hysteresis < 0 || mount.Nearest.MaxDistance < 0 {
+				return fmt.Errorf("mountpoint %s: distances must not be negative", mount.Name)
+			}
+		case mount.SourcePassword == "":
+			return fmt.Errorf("mountpoint %s: source_password is required", mount.Name)
+		}
+		if mount.Rewrite != nil {
+			if mount.Nearest != nil {
+				return fmt.Errorf("mountpoint %s: virtual mountpoints cannot be rewritten", mount.Name)
+			}
+			rewrite := mount.Rewrite.pipelineConfig()
+			if err := rewrite.Validate(); err != nil {
+				return fmt.Errorf("mountpoint %s: rewrite: %v", mount.Name, err)
+			}
+		}
+		for _, name := range mount.Users {
+			if !users[name] {
+				return fmt.Errorf("mountpoint %s: unknown user %s", mount.Name, name)
+			}
+		}
+		mounts[mount.Name] = true
+	}
+
+	// Virtual mountpoints may only attach rovers to real ones
+	for _, mount := range c.Mounts {
+		if mount.Nearest == nil {
+			continue
+		}
+		for _, name := range mount.Nearest.Mounts {
+			base, ok := c.mount(name)
+			if !ok {
+				return fmt.Errorf("mountpoint %s: unknown mountpoint %s", mount.Name, name)
+			}
+			if base.Nearest != nil {
+				return fmt.Errorf("mountpoint %s: %s is virtual", mount.Name, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validate checks the upstream URL and protocol
+func (r *RelayConfig) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid relay url %q", r.URL)
+	}
+	if _, err := ntrip.ParseProtocol(r.Protocol); err != nil {
+		return fmt.Errorf("relay: %v", err)
+	}
+	return nil
+}
+
+// upstreamMount returns the upstream mountpoint for a local one
+func (r *RelayConfig) upstreamMount(local string) string {
+	if r.Mountpoint == "" {
+		return local
+	}
+	return r.Mountpoint
+}
+
+// candidates returns the mountpoints a virtual mountpoint can attach to
+func (n *NearestConfig) candidates(c *Config) []string {
+	if len(n.Mounts) > 0 {
+		return n.Mounts
+	}
+
+	var names []string
+	for _, mount := range c.Mounts {
+		if mount.Nearest == nil {
+			names = append(names, mount.Name)
+		}
+	}
+	return names
+}
+
+// hysteresis returns the re-evaluation distance in kilometres
+func (n *NearestConfig) hysteresis() float64 {
+	if n.Hysteresis == 0 {
+		return DefaultHysteresis
+	}
+	return n.Hysteresis
+}
+
+// listenAddress returns the configured listen address or the default
+func (c *Config) listenAddress() string {
+	if c.Listen == "" {
+		return DefaultListen
+	}
+	return c.Listen
+}
+
+// mount returns the configuration of a mountpoint
+func (c *Config) mount(name string) (*MountConfig, bool) {
+	for i := range c.Mounts {
+		if c.Mounts[i].Name == name {
+			return &c.Mounts[i], true
+		}
+	}
+	return nil, false
+}
+
+// user returns the account with the given name
+func (c *Config) user(name string) (*UserConfig, bool) {
+	for i := range c.Users {
+		if c.Users[i].Name == name {
+			return &c.Users[i], true
+		}
+	}
+	return nil, false
+}
+
+// authenticate checks a user's credentials
+func (c *Config) authenticate(name, password string) (*UserConfig, bool) {
+	user, ok := c.user(name)
+	if !ok || !equal(user.Password, password) {
+		return nil, false
+	}
+	return user, true
+}
+
+// allows reports whether an authenticated user may use the mountpoint
+func (m *MountConfig) allows(user string) bool {
+	if m.Public || len(m.Users) == 0 {
+		return true
+	}
+	for _, name := range m.Users {
+		if name == user {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriter returns the stage applied to the mountpoint's frames, or nil
+func (m *MountConfig) rewriter() *pipeline.Rewriter {
+	if m.Rewrite == nil {
+		return nil
+	}
+	r, _ := pipeline.NewRewriter(m.Rewrite.pipelineConfig()) // Validated with the configuration
+	return r
+}
+
+// checkSource verifies source credentials. NTRIP 1.0 sources send only a
+// password, so the user is checked for NTRIP 2.0 sources only.
+func (m *MountConfig) checkSource(user, password string, rev2 bool) bool {
+	if rev2 && m.SourceUser != "" && !equal(user, m.SourceUser) {
+		return false
+	}
+	return equal(password, m.SourcePassword)
+}
+
+// equal compares credentials in constant time
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
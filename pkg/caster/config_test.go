@@ -0,0 +1,166 @@
+package caster
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "caster.json")
+	data := `{
+  "listen": ":2102",
+  "users": [{"name": "rover", "password": "secret", "max_connections": 2}],
+  "mounts": [{"name": "BASE", "source_password": "pass", "users": ["rover"],
+              "stream": {"format": "RTCM 3.3", "carrier": 2}}]
+}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if config.listenAddress() != ":2102" {
+		t.Errorf("Expected listen address :2102, got %s", config.listenAddress())
+	}
+	user, ok := config.authenticate("rover", "secret")
+	if !ok || user.MaxConnections != 2 {
+		t.Errorf("Expected rover to authenticate, got %+v, %v", user, ok)
+	}
+	if _, ok := config.authenticate("rover", "wrong"); ok {
+		t.Error("Expected a wrong password to be rejected")
+	}
+
+	mount, ok := config.mount("BASE")
+	if !ok {
+		t.Fatal("Expected mountpoint BASE")
+	}
+	if mount.Stream.Format != "RTCM 3.3" || mount.Stream.Carrier != 2 {
+		t.Errorf("Unexpected stream record: %+v", mount.Stream)
+	}
+	if !mount.allows("rover") || mount.allows("other") {
+		t.Error("Unexpected ACL result")
+	}
+	if !mount.checkSource("", "pass", false) || mount.checkSource("", "wrong", false) {
+		t.Error("Unexpected source password check")
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestCheckSource(t *testing.T) {
+	mount := &MountConfig{Name: "BASE", SourceUser: "base", SourcePassword: "pass"}
+
+	tests := []struct {
+		user, password string
+		rev2, want     bool
+	}{
+		{"base", "pass", true, true},
+		{"", "pass", true, false}, // An empty user must not bypass source_user
+		{"other", "pass", true, false},
+		{"base", "wrong", true, false},
+		{"", "pass", false, true}, // NTRIP 1.0 sends no user
+		{"", "wrong", false, false},
+	}
+	for _, tt := range tests {
+		if got := mount.checkSource(tt.user, tt.password, tt.rev2); got != tt.want {
+			t.Errorf("checkSource(%q, %q, %v) = %v, want %v", tt.user, tt.password, tt.rev2, got, tt.want)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		errMsg string
+	}{
+		{
+			name:   "duplicate user",
+			config: Config{Users: []UserConfig{{Name: "a"}, {Name: "a"}}},
+			errMsg: "duplicate user",
+		},
+		{
+			name:   "negative limit",
+			config: Config{Users: []UserConfig{{Name: "a", MaxConnections: -1}}},
+			errMsg: "max_connections",
+		},
+		{
+			name:   "invalid mountpoint",
+			config: Config{Mounts: []MountConfig{{Name: "A/B", SourcePassword: "x"}}},
+			errMsg: "invalid mountpoint",
+		},
+		{
+			name:   "duplicate mountpoint",
+			config: Config{Mounts: []MountConfig{{Name: "A", SourcePassword: "x"}, {Name: "A", SourcePassword: "x"}}},
+			errMsg: "duplicate mountpoint",
+		},
+		{
+			name:   "missing source password",
+			config: Config{Mounts: []MountConfig{{Name: "A"}}},
+			errMsg: "source_password",
+		},
+		{
+			name:   "unknown user in ACL",
+			config: Config{Mounts: []MountConfig{{Name: "A", SourcePassword: "x", Users: []string{"b"}}}},
+			errMsg: "unknown user",
+		},
+		{
+			name:   "nearest with relay",
+			config: Config{Mounts: []MountConfig{{Name: "A", Nearest: &NearestConfig{}, Relay: &RelayConfig{URL: "http://x"}}}},
+			errMsg: "mutually exclusive",
+		},
+		{
+			name:   "negative hysteresis",
+			config: Config{Mounts: []MountConfig{{Name: "A", Nearest: &NearestConfig{Hysteresis: -1}}}},
+			errMsg: "negative",
+		},
+		{
+			name:   "unknown nearest candidate",
+			config: Config{Mounts: []MountConfig{{Name: "A", Nearest: &NearestConfig{Mounts: []string{"B"}}}}},
+			errMsg: "unknown mountpoint",
+		},
+		{
+			name: "virtual nearest candidate",
+			config: Config{Mounts: []MountConfig{
+				{Name: "A", Nearest: &NearestConfig{Mounts: []string{"B"}}},
+				{Name: "B", Nearest: &NearestConfig{}},
+			}},
+			errMsg: "is virtual",
+		},
+		{
+			name:   "invalid rewrite",
+			config: Config{Mounts: []MountConfig{{Name: "A", SourcePassword: "x", Rewrite: &RewriteConfig{ObservationInterval: 7}}}},
+			errMsg: "rewrite: observation_interval",
+		},
+		{
+			name:   "invalid rewrite ARP",
+			config: Config{Mounts: []MountConfig{{Name: "A", SourcePassword: "x", Rewrite: &RewriteConfig{ARP: &ARPConfig{Latitude: 91, Longitude: 0.1}}}}},
+			errMsg: "rewrite: arp: invalid latitude",
+		},
+		{
+			name:   "rewritten nearest",
+			config: Config{Mounts: []MountConfig{{Name: "A", Nearest: &NearestConfig{}, Rewrite: &RewriteConfig{}}}},
+			errMsg: "cannot be rewritten",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+
+	if err := testConfig().Validate(); err != nil {
+		t.Errorf("Unexpected error for a valid config: %v", err)
+	}
+}
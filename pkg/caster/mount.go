@@ -0,0 +1,216 @@
+package caster
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+// Connection defaults
+const (
+	clientQueueSize = 256              // Frames buffered per client before it is dropped as too slow
+	writeTimeout    = 30 * time.Second // Bound on a single write to a client
+	sourceTimeout   = 60 * time.Second // Drop a source that sends nothing for this long
+)
+
+// mount is the live state of a mountpoint: its source or upstream relay,
+// what the source is sending, the clients subscribed to it and the
+// clients of virtual mountpoints currently attached to it
+type mount struct {
+	name      string
+	source    *source
+	relay     *relay
+	info      *streamInfo
+	clients   map[*client]struct{}
+	followers map[*client]struct{}
+}
+
+// newMount creates the state for a mountpoint
+func newMount(name string) *mount {
+	return &mount{
+		name:      name,
+		clients:   make(map[*client]struct{}),
+		followers: make(map[*client]struct{}),
+	}
+}
+
+// source is a connected base station feeding a mountpoint. Its counters
+// are protected by the caster's mutex.
+type source struct {
+	conn      net.Conn
+	user      string
+	password  string
+	rev2      bool
+	remote    string
+	connected time.Time
+	in        rateMeter
+}
+
+// close disconnects the source
+func (s *source) close() {
+	s.conn.Close()
+}
+
+// client is a connected rover. Frames are queued by the mountpoint and
+// written by the client's own goroutine, so a slow rover cannot hold up
+// the others.
+type client struct {
+	id        uint64
+	conn      net.Conn
+	writer    io.Writer
+	user      string
+	password  string
+	mount     string
+	remote    string
+	connected time.Time
+
+	frames    chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mutex    sync.Mutex
+	in       rateMeter
+	out      rateMeter
+	position *position.Position // From the last GGA the client sent
+
+	// Clients of virtual mountpoints are attached to a base, chosen from
+	// their position when it was last evaluated. Protected by the caster's
+	// mutex; onGGA is set before readLoop starts.
+	attached  *mount
+	evaluated *position.Position
+	onGGA     func(pos *position.Position)
+}
+
+// newClient creates a client for a connection. NTRIP 2.0 clients are sent
+// chunked data.
+func newClient(id uint64, conn net.Conn, req *request, chunked bool) *client {
+	cl := &client{
+		id:        id,
+		conn:      conn,
+		writer:    conn,
+		user:      req.User,
+		password:  req.Password,
+		mount:     req.Mount,
+		remote:    req.Remote,
+		connected: time.Now(),
+		frames:    make(chan []byte, clientQueueSize),
+		done:      make(chan struct{}),
+	}
+	if chunked {
+		cl.writer = httputil.NewChunkedWriter(conn)
+	}
+	return cl
+}
+
+// send queues a frame for the client. It reports false when the queue is
+// full.
+func (cl *client) send(frame []byte) bool {
+	select {
+	case cl.frames <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+// close disconnects the client
+func (cl *client) close() {
+	cl.closeOnce.Do(func() {
+		close(cl.done)
+		cl.conn.Close()
+	})
+}
+
+// writeLoop writes queued frames until the client disconnects or is closed
+func (cl *client) writeLoop() {
+	for {
+		select {
+		case <-cl.done:
+			return
+		case frame := <-cl.frames:
+			cl.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if _, err := cl.writer.Write(frame); err != nil {
+				cl.close()
+				return
+			}
+
+			cl.mutex.Lock()
+			cl.out.add(len(frame), time.Now())
+			cl.mutex.Unlock()
+		}
+	}
+}
+
+// readLoop records the position from the GGA sentences the client sends
+// and closes the client when the connection ends
+func (cl *client) readLoop(reader io.Reader) {
+	defer cl.close()
+
+	reader = &clientReader{client: cl, reader: reader}
+	nmeaParser := parser.NewNMEAParser()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		start := strings.IndexByte(line, '$')
+		if start < 0 {
+			continue
+		}
+
+		pos, err := position.ExtractFromGGA(nmeaParser.Parse(strings.TrimSpace(line[start:])))
+		if err != nil || pos.FixQuality == 0 {
+			continue
+		}
+
+		cl.mutex.Lock()
+		cl.position = pos
+		cl.mutex.Unlock()
+
+		if cl.onGGA != nil {
+			cl.onGGA(pos)
+		}
+	}
+
+	// Overlong lines stop the scanner; keep reading until the client hangs up
+	io.Copy(io.Discard, reader)
+}
+
+// clientReader counts the bytes a client sends
+type clientReader struct {
+	client *client
+	reader io.Reader
+}
+
+// Read reads from the client and adds the bytes to its counter
+func (r *clientReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.client.mutex.Lock()
+		r.client.in.add(n, time.Now())
+		r.client.mutex.Unlock()
+	}
+	return n, err
+}
+
+// status returns the client's counters and last position
+func (cl *client) status(now time.Time) ClientStatus {
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	return ClientStatus{
+		ID:          cl.id,
+		Remote:      cl.remote,
+		User:        cl.user,
+		ConnectedAt: cl.connected,
+		BytesIn:     cl.in.total,
+		BytesOut:    cl.out.total,
+		Rate:        cl.out.current(now),
+		Position:    cl.position,
+	}
+}
@@ -0,0 +1,103 @@
+package caster
+
+import (
+	"math"
+
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+// updateNearest re-evaluates the base of a virtual mountpoint's client
+// after it reported a position. The base only changes once the rover has
+// moved more than the hysteresis distance since the last evaluation, or
+// when its base has gone offline. Frames are queued whole, so the switch
+// happens on a frame boundary.
+func (c *Caster) updateNearest(vm *mount, cl *client, pos *position.Position) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := vm.clients[cl]; !ok {
+		return
+	}
+	mc, ok := c.config.mount(vm.name)
+	if !ok || mc.Nearest == nil {
+		return
+	}
+
+	current := cl.attached
+	if current != nil && c.live(current) && cl.evaluated != nil &&
+		position.DistanceKm(cl.evaluated.Latitude, cl.evaluated.Longitude, pos.Latitude, pos.Longitude) < mc.Nearest.hysteresis() {
+		return
+	}
+	cl.evaluated = pos
+
+	best := c.nearestBase(mc.Nearest, cl, pos)
+	if best == nil || best == current {
+		return
+	}
+
+	c.detach(cl)
+	best.followers[cl] = struct{}{}
+	cl.attached = best
+	c.logf("Client %s (%s) on %s attached to %s", cl.remote, cl.user, vm.name, best.name)
+}
+
+// nearestBase returns the closest live base the client may use. The caller
+// must hold the mutex.
+func (c *Caster) nearestBase(config *NearestConfig, cl *client, pos *position.Position) *mount {
+	var best *mount
+	bestDistance := math.Inf(1)
+
+	for _, name := range config.candidates(c.config) {
+		m, ok := c.mounts[name]
+		if !ok || !c.live(m) {
+			continue
+		}
+		mc, ok := c.config.mount(name)
+		if !ok || !c.authorized(mc, cl.user, cl.password) {
+			continue
+		}
+
+		distance := position.DistanceKm(pos.Latitude, pos.Longitude, m.info.latitude, m.info.longitude)
+		if config.MaxDistance > 0 && distance > config.MaxDistance {
+			continue
+		}
+		if distance < bestDistance {
+			best, bestDistance = m, distance
+		}
+	}
+
+	return best
+}
+
+// live reports whether a mountpoint is receiving data and knows its base
+// position from 1005/1006. The caller must hold the mutex.
+func (c *Caster) live(m *mount) bool {
+	if m.source == nil && (m.relay == nil || !m.relay.connected) {
+		return false
+	}
+	return m.info != nil && m.info.hasPosition
+}
+
+// detach removes a virtual mountpoint's client from its base. The caller
+// must hold the mutex.
+func (c *Caster) detach(cl *client) {
+	m := cl.attached
+	if m == nil {
+		return
+	}
+
+	delete(m.followers, cl)
+	cl.attached = nil
+	if c.relayIdle(m) {
+		c.stopRelay(m)
+	}
+}
+
+// detachAll removes every follower from a base. The caller must hold the
+// mutex.
+func (c *Caster) detachAll(m *mount) {
+	for cl := range m.followers {
+		delete(m.followers, cl)
+		cl.attached = nil
+	}
+}
@@ -0,0 +1,193 @@
+package caster
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// Base positions used by the tests: London and Paris, about 343 km apart
+var (
+	london = &position.Position{Latitude: 51.5, Longitude: -0.12}
+	paris  = &position.Position{Latitude: 48.85, Longitude: 2.35}
+)
+
+// nearestConfig adds a public NEAREST mountpoint over BASE and OPEN
+func nearestConfig() *Config {
+	config := testConfig()
+	config.Mounts = append(config.Mounts, MountConfig{Name: "NEAREST", Public: true, Nearest: &NearestConfig{}})
+	return config
+}
+
+// connectNearest subscribes to NEAREST over NTRIP 1.0 and returns the raw
+// connection, so GGA sentences can be sent at will
+func connectNearest(t *testing.T, url, user, password string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	fmt.Fprintf(conn, "GET /NEAREST HTTP/1.0\r\nUser-Agent: NTRIP test\r\nAuthorization: Basic %s\r\n\r\n", auth)
+
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil || status != "ICY 200 OK\r\n" {
+		t.Fatalf("Expected ICY 200 OK, got %q (%v)", status, err)
+	}
+	return conn, reader
+}
+
+// sendGGA uploads a GGA for the position
+func sendGGA(t *testing.T, conn net.Conn, pos *position.Position) {
+	t.Helper()
+	if _, err := fmt.Fprintf(conn, "%s\r\n", ntrip.FormatGGA(pos, time.Now())); err != nil {
+		t.Fatalf("GGA upload failed: %v", err)
+	}
+}
+
+// waitForAttached waits until the only NEAREST client is attached to a base
+func waitForAttached(t *testing.T, c *Caster, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		clients := c.Status()[2].Clients
+		if len(clients) == 1 && clients[0].Attached == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the client to be attached to %q, got %+v", want, clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForPosition waits until the base position of a mountpoint is known
+func waitForPosition(t *testing.T, c *Caster, name string) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		c.mutex.Lock()
+		m, ok := c.mounts[name]
+		known := ok && m.info != nil && m.info.hasPosition
+		c.mutex.Unlock()
+		if known {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Base position of %s was not received", name)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNearestAttachesClosestBase(t *testing.T) {
+	c, url := startCaster(t, nearestConfig())
+
+	londonSource := connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	parisSource := connectSource(t, url, "", "openpass", "OPEN", ntrip.ProtocolRev2)
+	londonSource.Write(payloadFrame(stationPayload(3978667.8176, -8332.9146, 4968397.6747)))
+	parisSource.Write(payloadFrame(stationPayload(4201473.6496, 172421.1352, 4779598.4006)))
+	waitForPosition(t, c, "BASE")
+	waitForPosition(t, c, "OPEN")
+
+	conn, stream := connectNearest(t, url, "rover", "roverpass")
+
+	// Nothing is sent until the rover reports its position
+	sendGGA(t, conn, &position.Position{Latitude: 51.4, Longitude: -0.2})
+	waitForAttached(t, c, "BASE")
+
+	londonFrame, parisFrame := testFrame(1077, 30), testFrame(1087, 40)
+	londonSource.Write(londonFrame)
+	parisSource.Write(parisFrame)
+	readFull(t, stream, londonFrame)
+
+	// Moving south switches to the Paris base
+	sendGGA(t, conn, &position.Position{Latitude: 48.9, Longitude: 2.3})
+	waitForAttached(t, c, "OPEN")
+	parisSource.Write(parisFrame)
+	readFull(t, stream, parisFrame)
+
+	// The virtual mountpoint asks for NMEA and carries no stream details
+	str := c.Sourcetable().Mounts[2]
+	if str.Name != "NEAREST" || !str.NMEA || str.FormatDetails != "" {
+		t.Errorf("Unexpected NEAREST record: %+v", str)
+	}
+}
+
+func TestNearestHysteresis(t *testing.T) {
+	config := nearestConfig()
+	config.Mounts[2].Nearest.Hysteresis = 200
+	c, err := New(config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// Fake two live bases and a client on the virtual mountpoint
+	for name, pos := range map[string]*position.Position{"BASE": london, "OPEN": paris} {
+		m := c.mount(name)
+		m.source = &source{}
+		m.info = &streamInfo{hasPosition: true, latitude: pos.Latitude, longitude: pos.Longitude}
+	}
+	vm := c.mount("NEAREST")
+	cl := &client{user: "rover", password: "roverpass"}
+	vm.clients[cl] = struct{}{}
+
+	attached := func() string {
+		if cl.attached == nil {
+			return ""
+		}
+		return cl.attached.name
+	}
+
+	c.updateNearest(vm, cl, london)
+	if attached() != "BASE" {
+		t.Fatalf("Expected BASE, got %q", attached())
+	}
+
+	// 194 km from London and 149 km from Paris: within the hysteresis
+	c.updateNearest(vm, cl, &position.Position{Latitude: 50.0, Longitude: 1.3})
+	if attached() != "BASE" {
+		t.Errorf("Expected to stay on BASE within the hysteresis, got %q", attached())
+	}
+
+	c.updateNearest(vm, cl, paris)
+	if attached() != "OPEN" || len(c.mounts["BASE"].followers) != 0 || len(c.mounts["OPEN"].followers) != 1 {
+		t.Errorf("Expected to switch to OPEN, got %q", attached())
+	}
+
+	// A base that goes offline is replaced without waiting for movement
+	c.mounts["OPEN"].source = nil
+	c.updateNearest(vm, cl, paris)
+	if attached() != "BASE" {
+		t.Errorf("Expected to fall back to BASE, got %q", attached())
+	}
+
+	// Bases the user may not access are skipped
+	other := &client{user: "other", password: "otherpass"}
+	vm.clients[other] = struct{}{}
+	c.updateNearest(vm, other, london)
+	if other.attached != nil {
+		t.Errorf("Expected no base for a user outside the ACL, got %s", other.attached.name)
+	}
+
+	// Bases beyond the maximum distance are skipped
+	config.Mounts[2].Nearest.MaxDistance = 100
+	cl.evaluated = nil
+	c.updateNearest(vm, cl, &position.Position{Latitude: 50.0, Longitude: 1.3})
+	if attached() != "BASE" {
+		t.Errorf("Expected to keep BASE when no base is within range, got %q", attached())
+	}
+}
@@ -0,0 +1,239 @@
+package caster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/pipeline"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// relayTimeout bounds how long a client waits for a relay to connect upstream
+const relayTimeout = 15 * time.Second
+
+// errRelayStopped is reported to clients waiting on a relay that was stopped
+var errRelayStopped = errors.New("relay stopped")
+
+// relay pulls a mountpoint from an upstream caster through an ntrip.Session,
+// which reconnects with backoff, and publishes its frames locally. Its
+// fields are protected by the caster's mutex.
+type relay struct {
+	config RelayConfig
+	cancel context.CancelFunc
+
+	connected   bool
+	connectedAt time.Time
+	err         error // Last upstream error, reported to new clients while disconnected
+	pending     int   // Clients waiting for the first connection attempt
+	in          rateMeter
+
+	ready     chan struct{} // Closed once the first attempt succeeds or fails
+	readyOnce sync.Once
+}
+
+// signal wakes the clients waiting for the first connection attempt
+func (r *relay) signal() {
+	r.readyOnce.Do(func() { close(r.ready) })
+}
+
+// startRelay connects a mountpoint to its upstream. The caller must hold the
+// mutex. It returns nil once the caster is closed.
+func (c *Caster) startRelay(m *mount, config RelayConfig) *relay {
+	if c.closed {
+		return nil
+	}
+
+	client := ntrip.NewClient(config.URL, config.Username, config.Password, config.upstreamMount(m.name))
+	client.Protocol, _ = ntrip.ParseProtocol(config.Protocol)
+	if config.Position != nil {
+		client.GGASource = ntrip.FixedGGA{Position: config.Position}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &relay{
+		config: config,
+		cancel: cancel,
+		ready:  make(chan struct{}),
+	}
+	m.relay = r
+
+	var rewriter *pipeline.Rewriter
+	if mc, ok := c.config.mount(m.name); ok {
+		rewriter = mc.rewriter()
+	}
+
+	session := ntrip.NewSession(ctx, client, c.relaySession)
+	c.wg.Add(2)
+	go c.relayEvents(m, r, session)
+	go c.relayData(m, session, rewriter)
+
+	c.logf("Relay %s started from %s/%s", m.name, config.URL, config.upstreamMount(m.name))
+	return r
+}
+
+// stopRelay disconnects a mountpoint from its upstream and drops its
+// clients. The caller must hold the mutex.
+func (c *Caster) stopRelay(m *mount) {
+	r := m.relay
+	r.cancel()
+	if r.err == nil && !r.connected {
+		r.err = errRelayStopped
+	}
+	r.signal()
+
+	m.relay = nil
+	m.info = nil
+	for cl := range m.clients {
+		cl.close()
+	}
+	c.detachAll(m)
+	c.logf("Relay %s stopped", m.name)
+}
+
+// startAlwaysOnRelays starts the relays that run without clients. The
+// caller must hold the mutex.
+func (c *Caster) startAlwaysOnRelays() {
+	for _, mc := range c.config.Mounts {
+		if mc.Relay == nil || !mc.Relay.AlwaysOn {
+			continue
+		}
+		if m := c.mount(mc.Name); m.relay == nil {
+			c.startRelay(m, *mc.Relay)
+		}
+	}
+}
+
+// awaitRelay makes sure the mountpoint's relay is running and connected
+// and returns the status to send to the client: 200 when connected,
+// otherwise the upstream error translated by relayStatus. The caller must
+// hold the mutex, which is released while waiting.
+func (c *Caster) awaitRelay(m *mount, config RelayConfig) int {
+	r := m.relay
+	if r == nil {
+		if r = c.startRelay(m, config); r == nil {
+			return http.StatusServiceUnavailable
+		}
+	}
+
+	r.pending++
+	c.mutex.Unlock()
+	timer := time.NewTimer(relayTimeout)
+	select {
+	case <-r.ready:
+	case <-timer.C:
+	}
+	timer.Stop()
+	c.mutex.Lock()
+	r.pending--
+
+	switch {
+	case r.connected && m.relay == r:
+		return http.StatusOK
+	case r.err != nil:
+		return relayStatus(r.err)
+	case m.relay != r:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusGatewayTimeout
+	}
+}
+
+// relayIdle reports whether an on-demand relay has no clients left,
+// including those attached through a virtual mountpoint. The caller must
+// hold the mutex.
+func (c *Caster) relayIdle(m *mount) bool {
+	return m.relay != nil && !m.relay.config.AlwaysOn && len(m.clients) == 0 && len(m.followers) == 0 && m.relay.pending == 0
+}
+
+// relayStatus translates an upstream error for local clients. Mountpoint
+// and status errors are passed through, except that rejected relay
+// credentials are the caster's problem rather than the client's.
+func relayStatus(err error) int {
+	var notFound *ntrip.ErrMountpointNotFound
+	var statusErr *ntrip.StatusError
+	switch {
+	case errors.Is(err, errRelayStopped):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &notFound):
+		return http.StatusNotFound
+	case errors.As(err, &statusErr) && statusErr.Code != http.StatusUnauthorized && statusErr.Code != http.StatusForbidden:
+		return statusErr.Code
+	case errors.Is(err, ntrip.ErrStalled) || errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// relayEvents tracks the upstream connection state
+func (c *Caster) relayEvents(m *mount, r *relay, session *ntrip.Session) {
+	defer c.wg.Done()
+
+	for event := range session.Events() {
+		c.mutex.Lock()
+		switch event.Type {
+		case ntrip.EventConnected:
+			r.connected, r.err = true, nil
+			r.connectedAt = event.Time
+			if m.relay == r {
+				m.info = newStreamInfo(event.Time)
+			}
+			r.signal()
+			c.logf("Relay %s connected upstream", m.name)
+		case ntrip.EventDisconnected:
+			r.connected = false
+			if event.Err != nil {
+				r.err = event.Err
+			}
+			if m.relay == r {
+				m.info = nil
+			}
+			c.logf("Relay %s disconnected: %v", m.name, event.Err)
+		case ntrip.EventReconnecting:
+			if event.Err != nil {
+				r.err = event.Err
+			}
+			r.signal()
+			if m.relay == r && c.relayIdle(m) {
+				c.stopRelay(m)
+			}
+		case ntrip.EventFailed:
+			r.connected, r.err = false, event.Err
+			r.signal()
+			c.logf("Relay %s failed: %v", m.name, event.Err)
+			if m.relay == r {
+				c.stopRelay(m)
+			}
+		}
+		c.mutex.Unlock()
+	}
+
+	c.mutex.Lock()
+	if r.err == nil && !r.connected {
+		r.err = errRelayStopped
+	}
+	r.signal()
+	c.mutex.Unlock()
+}
+
+// relayData publishes the upstream frames until the session ends
+func (c *Caster) relayData(m *mount, session *ntrip.Session, rewriter *pipeline.Rewriter) {
+	defer c.wg.Done()
+	defer session.Close()
+
+	rtcmParser := parser.NewRTCMParser()
+	buffer := make([]byte, 4096)
+	for {
+		n, err := session.Read(buffer)
+		for _, message := range rtcmParser.Process(buffer[:n]) {
+			c.process(m, rewriter, message)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package caster
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// relayConfig serves LOCAL from the upstream caster's BASE mountpoint
+func relayConfig(upstreamURL string, alwaysOn bool) *Config {
+	return &Config{
+		Users: []UserConfig{{Name: "local", Password: "localpass"}},
+		Mounts: []MountConfig{{
+			Name: "LOCAL",
+			Relay: &RelayConfig{
+				URL:        upstreamURL,
+				Mountpoint: "BASE",
+				Username:   "rover",
+				Password:   "roverpass",
+				Protocol:   "rev2",
+				AlwaysOn:   alwaysOn,
+			},
+		}},
+	}
+}
+
+// startRelayCaster serves a caster whose relays reconnect quickly
+func startRelayCaster(t *testing.T, config *Config) (*Caster, string) {
+	t.Helper()
+
+	c, err := New(config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	c.relaySession = ntrip.SessionConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		StallTimeout:   -1,
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Serve(listener) }()
+	t.Cleanup(func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve returned %v", err)
+		}
+	})
+
+	return c, "http://" + listener.Addr().String()
+}
+
+// waitForClients waits until a mountpoint has the given number of clients
+func waitForClients(t *testing.T, c *Caster, name string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		c.mutex.Lock()
+		got := 0
+		if m, ok := c.mounts[name]; ok {
+			got = len(m.clients)
+		}
+		c.mutex.Unlock()
+
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d clients on %s, got %d", want, name, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRelayOnDemand(t *testing.T) {
+	upstream, upstreamURL := startCaster(t, testConfig())
+	source := connectSource(t, upstreamURL, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	_, url := startRelayCaster(t, relayConfig(upstreamURL, false))
+
+	// Nothing is pulled until a local client subscribes
+	time.Sleep(50 * time.Millisecond)
+	waitForClients(t, upstream, "BASE", 0)
+
+	first, err := connectClient(url, "local", "localpass", "LOCAL", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer first.Close()
+	second, err := connectClient(url, "local", "localpass", "LOCAL", ntrip.ProtocolRev1)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer second.Close()
+
+	// Both local clients share one upstream connection
+	waitForClients(t, upstream, "BASE", 1)
+
+	frames := append(testFrame(1005, 19), testFrame(1077, 40)...)
+	source.Write(frames)
+	readFull(t, first, frames)
+	readFull(t, second, frames)
+
+	// The upstream connection is dropped after the last client leaves
+	first.Close()
+	second.Close()
+	waitForClients(t, upstream, "BASE", 0)
+
+	// and reopened for the next one
+	third, err := connectClient(url, "local", "localpass", "LOCAL", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer third.Close()
+	waitForClients(t, upstream, "BASE", 1)
+	source.Write(frames)
+	readFull(t, third, frames)
+}
+
+func TestRelayAlwaysOn(t *testing.T) {
+	upstream, upstreamURL := startCaster(t, testConfig())
+	source := connectSource(t, upstreamURL, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	c, url := startRelayCaster(t, relayConfig(upstreamURL, true))
+
+	waitForClients(t, upstream, "BASE", 1)
+
+	// Live details are published before any local client connects
+	frame := testFrame(1077, 40)
+	source.Write(frame)
+	deadline := time.Now().Add(3 * time.Second)
+	for c.Sourcetable().Mounts[0].FormatDetails != "1077" {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected live format details, got %+v", c.Sourcetable().Mounts[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stream, err := connectClient(url, "local", "localpass", "LOCAL", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	source.Write(frame)
+	readFull(t, stream, frame)
+
+	// The relay stays up after the client leaves
+	stream.Close()
+	waitForClients(t, c, "LOCAL", 0)
+	time.Sleep(50 * time.Millisecond)
+	waitForClients(t, upstream, "BASE", 1)
+
+	// Local sources cannot take over a relayed mountpoint
+	server := ntrip.NewServer(url, "", "anything", "LOCAL")
+	_, err = server.Connect()
+	var statusErr *ntrip.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a source on a relayed mountpoint, got %v", err)
+	}
+}
+
+func TestRelayUpstreamErrors(t *testing.T) {
+	_, upstreamURL := startCaster(t, testConfig())
+
+	unreachable, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	unreachableURL := "http://" + unreachable.Addr().String()
+	unreachable.Close()
+
+	tests := []struct {
+		name   string
+		modify func(r *RelayConfig)
+		status int
+	}{
+		{"unknown mountpoint", func(r *RelayConfig) { r.Mountpoint = "MISSING" }, http.StatusNotFound},
+		{"rejected credentials", func(r *RelayConfig) { r.Password = "wrong" }, http.StatusBadGateway},
+		{"upstream limit", func(r *RelayConfig) { r.Mountpoint = "BASE" }, http.StatusTooManyRequests},
+		{"unreachable", func(r *RelayConfig) { r.URL = unreachableURL }, http.StatusBadGateway},
+	}
+
+	// The upstream rover account allows one connection, so holding it makes
+	// the relay hit the limit
+	held, err := connectClient(upstreamURL, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer held.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := relayConfig(upstreamURL, false)
+			tt.modify(config.Mounts[0].Relay)
+			c, url := startRelayCaster(t, config)
+
+			_, err := connectClient(url, "local", "localpass", "LOCAL", ntrip.ProtocolRev2)
+			var statusErr *ntrip.StatusError
+			if !errors.As(err, &statusErr) || statusErr.Code != tt.status {
+				t.Fatalf("Expected status %d, got %v", tt.status, err)
+			}
+
+			// The failed on-demand relay is not left running
+			c.mutex.Lock()
+			running := c.mounts["LOCAL"].relay != nil
+			c.mutex.Unlock()
+			if running {
+				t.Error("Expected the relay to be stopped")
+			}
+		})
+	}
+}
+
+func TestRelayUpstreamFailureDisconnectsClients(t *testing.T) {
+	upstream, upstreamURL := startCaster(t, testConfig())
+	connectSource(t, upstreamURL, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	_, url := startRelayCaster(t, relayConfig(upstreamURL, false))
+
+	stream, err := connectClient(url, "local", "localpass", "LOCAL", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer stream.Close()
+	waitForClients(t, upstream, "BASE", 1)
+
+	// Revoking the relay's upstream account is a permanent error
+	config := testConfig()
+	config.Mounts[0].Users = []string{"other"}
+	config.Users[0].Password = "changed"
+	if err := upstream.Reload(config); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	expectClosed(t, stream)
+}
+
+func TestRelayReload(t *testing.T) {
+	upstream, upstreamURL := startCaster(t, testConfig())
+	connectSource(t, upstreamURL, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	c, _ := startRelayCaster(t, relayConfig(upstreamURL, false))
+
+	// Switching the relay to always-on starts it without clients
+	if err := c.Reload(relayConfig(upstreamURL, true)); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	waitForClients(t, upstream, "BASE", 1)
+
+	// Removing the mountpoint stops it
+	config := relayConfig(upstreamURL, true)
+	config.Mounts = nil
+	if err := c.Reload(config); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	waitForClients(t, upstream, "BASE", 0)
+}
@@ -0,0 +1,169 @@
+package caster
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// serverAgent identifies the caster in responses
+const serverAgent = "NTRIP go_ntrip/caster"
+
+// request is a parsed NTRIP request. NTRIP 1.0 sources send
+// "SOURCE password /mount" instead of an HTTP request line.
+type request struct {
+	Method   string
+	Mount    string
+	Rev2     bool
+	Header   textproto.MIMEHeader
+	User     string
+	Password string
+	Remote   string
+}
+
+// readRequest reads the request line and headers
+func readRequest(reader *bufio.Reader) (*request, error) {
+	tp := textproto.NewReader(reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("malformed request line: %q", line)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	req := &request{Method: strings.ToUpper(fields[0]), Header: header}
+
+	switch req.Method {
+	case "SOURCE":
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("malformed SOURCE request: %q", line)
+		}
+		req.Password = fields[1]
+		req.Mount = mountName(fields[2])
+	default:
+		req.Mount = mountName(fields[1])
+		req.Rev2 = req.Method == "POST" || strings.Contains(header.Get("Ntrip-Version"), "2.0")
+		req.User, req.Password = basicAuth(header.Get("Authorization"))
+	}
+
+	return req, nil
+}
+
+// mountName extracts the mountpoint from a request path
+func mountName(path string) string {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return strings.Trim(path, "/")
+}
+
+// basicAuth decodes a Basic Authorization header
+func basicAuth(header string) (string, string) {
+	scheme, encoded, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", ""
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", ""
+	}
+
+	user, password, _ := strings.Cut(string(decoded), ":")
+	return user, password
+}
+
+// writeStatus writes an error status in the form the request's protocol
+// expects. A 401 asks the client for Basic credentials for the mountpoint.
+func writeStatus(w io.Writer, req *request, code int) error {
+	version := "HTTP/1.0"
+	if req.Rev2 {
+		version = "HTTP/1.1"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d %s\r\n", version, code, http.StatusText(code))
+	if req.Rev2 {
+		sb.WriteString("Ntrip-Version: Ntrip/2.0\r\n")
+	}
+	fmt.Fprintf(&sb, "Server: %s\r\n", serverAgent)
+	if code == http.StatusUnauthorized {
+		fmt.Fprintf(&sb, "WWW-Authenticate: Basic realm=\"/%s\"\r\n", req.Mount)
+	}
+	sb.WriteString("Connection: close\r\n\r\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeSourceError rejects a source. NTRIP 1.0 sources expect an
+// "ERROR - ..." line rather than a status code.
+func writeSourceError(w io.Writer, req *request, code int) error {
+	if req.Method != "SOURCE" {
+		return writeStatus(w, req, code)
+	}
+
+	message := "ERROR - Mount Point Taken or Invalid"
+	if code == http.StatusUnauthorized {
+		message = "ERROR - Bad Password"
+	}
+	_, err := io.WriteString(w, message+"\r\n")
+	return err
+}
+
+// writeStreamOK accepts a client or source. NTRIP 2.0 client streams are
+// sent with chunked transfer encoding.
+func writeStreamOK(w io.Writer, req *request, client bool) error {
+	if !req.Rev2 {
+		_, err := io.WriteString(w, "ICY 200 OK\r\n")
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("HTTP/1.1 200 OK\r\n")
+	sb.WriteString("Ntrip-Version: Ntrip/2.0\r\n")
+	fmt.Fprintf(&sb, "Server: %s\r\n", serverAgent)
+	if client {
+		sb.WriteString("Content-Type: gnss/data\r\n")
+		sb.WriteString("Transfer-Encoding: chunked\r\n")
+	}
+	sb.WriteString("Cache-Control: no-store, no-cache, max-age=0\r\n")
+	sb.WriteString("Connection: close\r\n\r\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeSourcetable sends the sourcetable. NTRIP 1.0 clients get a
+// "SOURCETABLE 200 OK" status line.
+func writeSourcetable(w io.Writer, req *request, table string) error {
+	var sb strings.Builder
+	if req.Rev2 {
+		sb.WriteString("HTTP/1.1 200 OK\r\n")
+		sb.WriteString("Ntrip-Version: Ntrip/2.0\r\n")
+		fmt.Fprintf(&sb, "Server: %s\r\n", serverAgent)
+		sb.WriteString("Content-Type: gnss/sourcetable\r\n")
+	} else {
+		sb.WriteString("SOURCETABLE 200 OK\r\n")
+		fmt.Fprintf(&sb, "Server: %s\r\n", serverAgent)
+		sb.WriteString("Content-Type: text/plain\r\n")
+	}
+	fmt.Fprintf(&sb, "Content-Length: %d\r\n", len(table))
+	sb.WriteString("Connection: close\r\n\r\n")
+	sb.WriteString(table)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
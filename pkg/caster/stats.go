@@ -0,0 +1,45 @@
+package caster
+
+import "time"
+
+// rateWindow is the period over which data rates are measured
+const rateWindow = 5 * time.Second
+
+// rateMeter counts bytes and measures their rate over the last complete
+// window. It is not safe for concurrent use.
+type rateMeter struct {
+	total       int64
+	windowStart time.Time
+	windowBytes int64
+	rate        float64
+}
+
+// add counts bytes transferred at the given time
+func (r *rateMeter) add(n int, now time.Time) {
+	r.roll(now)
+	r.total += int64(n)
+	r.windowBytes += int64(n)
+}
+
+// current returns the rate in bytes per second
+func (r *rateMeter) current(now time.Time) float64 {
+	r.roll(now)
+	return r.rate
+}
+
+// roll closes the window once it has run its length. A window that ran
+// much longer because no data arrived yields a correspondingly low rate.
+func (r *rateMeter) roll(now time.Time) {
+	if r.windowStart.IsZero() {
+		r.windowStart = now
+		return
+	}
+
+	elapsed := now.Sub(r.windowStart)
+	if elapsed < rateWindow {
+		return
+	}
+	r.rate = float64(r.windowBytes) / elapsed.Seconds()
+	r.windowStart = now
+	r.windowBytes = 0
+}
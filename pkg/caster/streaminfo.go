@@ -0,0 +1,219 @@
+package caster
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// GNSS names in the order they are listed in the STR nav-system field
+var systemOrder = []string{"GPS", "GLO", "GAL", "BDS", "QZS", "IRN", "SBAS"}
+
+// streamInfo describes what a source is actually sending: the message
+// types and their rates, the constellations and frequency bands, the
+// bitrate and the station position from 1005/1006
+type streamInfo struct {
+	started  time.Time
+	bytes    int64
+	messages map[int]*messageRate
+	systems  map[string]bool
+	bands    map[string]map[byte]bool
+
+	hasPosition bool
+	latitude    float64
+	longitude   float64
+}
+
+// messageRate counts the frames of one message type
+type messageRate struct {
+	count int
+	first time.Time
+	last  time.Time
+}
+
+// newStreamInfo creates empty stream statistics
+func newStreamInfo(now time.Time) *streamInfo {
+	return &streamInfo{
+		started:  now,
+		messages: make(map[int]*messageRate),
+		systems:  make(map[string]bool),
+		bands:    make(map[string]map[byte]bool),
+	}
+}
+
+// add records a frame received at the given time
+func (s *streamInfo) add(message parser.RTCMMessage, now time.Time) {
+	s.bytes += int64(len(message.Frame))
+
+	rate, ok := s.messages[message.MessageType]
+	if !ok {
+		rate = &messageRate{first: now}
+		s.messages[message.MessageType] = rate
+	}
+	rate.count++
+	rate.last = now
+
+	payload := message.Payload
+	switch t := message.MessageType; {
+	case t == 1005 || t == 1006:
+		s.addStation(payload)
+	case t >= 1001 && t <= 1004:
+		s.addSystem("GPS", legacyBands(t-1000)...)
+	case t >= 1009 && t <= 1012:
+		s.addSystem("GLO", legacyBands(t-1008)...)
+	case parser.IsMSM(t):
+		system := parser.MSMSystem(t)
+		s.addSystem(system, msmSignalBands(system, payload)...)
+	case t == 1019:
+		s.addSystem("GPS")
+	case t == 1020:
+		s.addSystem("GLO")
+	case t == 1041:
+		s.addSystem("IRN")
+	case t == 1042:
+		s.addSystem("BDS")
+	case t == 1044:
+		s.addSystem("QZS")
+	case t == 1045 || t == 1046:
+		s.addSystem("GAL")
+	}
+}
+
+// addSystem records a constellation and the bands observed for it
+func (s *streamInfo) addSystem(system string, bands ...byte) {
+	s.systems[system] = true
+	if len(bands) == 0 {
+		return
+	}
+	if s.bands[system] == nil {
+		s.bands[system] = make(map[byte]bool)
+	}
+	for _, band := range bands {
+		s.bands[system][band] = true
+	}
+}
+
+// addStation decodes the antenna reference point of a 1005/1006 message
+func (s *streamInfo) addStation(payload []byte) {
+	arp, err := parser.DecodeStationARP(payload)
+	if err != nil || (arp.X == 0 && arp.Y == 0 && arp.Z == 0) {
+		return
+	}
+
+	s.latitude, s.longitude, _ = position.FromECEF(arp.X, arp.Y, arp.Z)
+	s.hasPosition = true
+}
+
+// legacyBands returns the bands of the legacy observation messages. The
+// first two of each group are L1-only, the last two L1/L2.
+func legacyBands(index int) []byte {
+	if index <= 2 {
+		return []byte{'1'}
+	}
+	return []byte{'1', '2'}
+}
+
+// msmSignalBands returns the bands present in the signal mask of an MSM
+// message
+func msmSignalBands(system string, payload []byte) []byte {
+	// The 32-bit signal mask follows the 73-bit header and 64-bit satellite mask
+	r := parser.NewBitReader(payload)
+	r.Skip(137)
+	mask := r.Uint(32)
+	if r.Err() != nil {
+		return nil
+	}
+
+	// The band is the first character of the signal's RINEX code
+	var bands []byte
+	for id := 1; id <= 32; id++ {
+		if code := parser.MSMSignalCode(system, id); mask&(1<<uint(32-id)) != 0 && code != "" {
+			bands = append(bands, code[0])
+		}
+	}
+	return bands
+}
+
+// formatDetails lists the message types with their update interval in
+// seconds, e.g. "1005(10),1077(1)". Types seen only once have no interval.
+func (s *streamInfo) formatDetails() string {
+	types := make([]int, 0, len(s.messages))
+	for t := range s.messages {
+		types = append(types, t)
+	}
+	sort.Ints(types)
+
+	details := make([]string, 0, len(types))
+	for _, t := range types {
+		rate := s.messages[t]
+		if rate.count < 2 {
+			details = append(details, fmt.Sprint(t))
+			continue
+		}
+		interval := rate.last.Sub(rate.first).Seconds() / float64(rate.count-1)
+		details = append(details, fmt.Sprintf("%d(%d)", t, int(math.Max(1, math.Round(interval)))))
+	}
+	return strings.Join(details, ",")
+}
+
+// navSystem lists the constellations seen, e.g. "GPS+GLO+GAL"
+func (s *streamInfo) navSystem() string {
+	var systems []string
+	for _, system := range systemOrder {
+		if s.systems[system] {
+			systems = append(systems, system)
+		}
+	}
+	return strings.Join(systems, "+")
+}
+
+// carrier returns the STR carrier field: 0 without phase observations,
+// 1 for single-frequency and 2 for multi-frequency data
+func (s *streamInfo) carrier() int {
+	carrier := 0
+	for _, bands := range s.bands {
+		if len(bands) >= 2 {
+			return 2
+		}
+		if len(bands) == 1 {
+			carrier = 1
+		}
+	}
+	return carrier
+}
+
+// bitrate returns the average data rate in bits per second
+func (s *streamInfo) bitrate(now time.Time) int {
+	elapsed := now.Sub(s.started).Seconds()
+	if elapsed < 1 {
+		return 0
+	}
+	return int(math.Round(float64(s.bytes) * 8 / elapsed))
+}
+
+// apply overwrites the STR fields that can be derived from the stream.
+// Fields the stream has not revealed yet keep their configured values.
+func (s *streamInfo) apply(str *ntrip.MountPoint, now time.Time) {
+	if len(s.messages) > 0 {
+		str.FormatDetails = s.formatDetails()
+	}
+	if len(s.systems) > 0 {
+		str.NavSystem = s.navSystem()
+	}
+	if len(s.bands) > 0 {
+		str.Carrier = s.carrier()
+	}
+	if bitrate := s.bitrate(now); bitrate > 0 {
+		str.Bitrate = bitrate
+	}
+	if s.hasPosition {
+		str.Latitude = s.latitude
+		str.Longitude = s.longitude
+	}
+}
@@ -0,0 +1,169 @@
+package caster
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
+)
+
+// setBits stores an unsigned big-endian bit field
+func setBits(data []byte, pos, length int, value uint64) {
+	for i := 0; i < length; i++ {
+		bit := byte(value>>uint(length-1-i)) & 1
+		data[(pos+i)/8] |= bit << (7 - uint((pos+i)%8))
+	}
+}
+
+// stationPayload builds a 1005 message for the given ECEF coordinates in metres
+func stationPayload(x, y, z float64) []byte {
+	payload := make([]byte, 19)
+	setBits(payload, 0, 12, 1005)
+	for i, v := range []float64{x, y, z} {
+		setBits(payload, 34+40*i, 38, uint64(int64(math.Round(v*10000)))&(1<<38-1))
+	}
+	return payload
+}
+
+// msmPayload builds an MSM header with the given signal IDs set in the mask
+func msmPayload(messageType int, signals ...int) []byte {
+	payload := make([]byte, 22)
+	setBits(payload, 0, 12, uint64(messageType))
+	for _, id := range signals {
+		setBits(payload, 137+id-1, 1, 1)
+	}
+	return payload
+}
+
+// message parses a single frame
+func message(t *testing.T, payload []byte) parser.RTCMMessage {
+	t.Helper()
+	messages := parser.NewRTCMParser().Process(payloadFrame(payload))
+	if len(messages) != 1 {
+		t.Fatalf("Expected one message, got %d", len(messages))
+	}
+	return messages[0]
+}
+
+func TestStreamInfo(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	info := newStreamInfo(start)
+
+	// 51.5N 0.12W, 45 m
+	station := message(t, stationPayload(3978667.8176, -8332.9146, 4968397.6747))
+	gps := message(t, msmPayload(1077, 2, 16))     // L1C, L2L
+	glonass := message(t, msmPayload(1087, 2))     // L1C only
+	galileo := message(t, msmPayload(1097, 2, 22)) // E1C, E5aI
+	ephemeris := message(t, testPayload(1042, 64))
+
+	for second := 0; second <= 20; second++ {
+		now := start.Add(time.Duration(second) * time.Second)
+		info.add(gps, now)
+		info.add(glonass, now)
+		info.add(galileo, now)
+		if second%10 == 0 {
+			info.add(station, now)
+		}
+	}
+	info.add(ephemeris, start.Add(5*time.Second))
+
+	if got, want := info.formatDetails(), "1005(10),1042,1077(1),1087(1),1097(1)"; got != want {
+		t.Errorf("Expected format details %q, got %q", want, got)
+	}
+	if got, want := info.navSystem(), "GPS+GLO+GAL+BDS"; got != want {
+		t.Errorf("Expected nav systems %q, got %q", want, got)
+	}
+	if info.carrier() != 2 {
+		t.Errorf("Expected carrier 2, got %d", info.carrier())
+	}
+
+	var str ntrip.MountPoint
+	info.apply(&str, start.Add(20*time.Second))
+	if math.Abs(str.Latitude-51.5) > 1e-6 || math.Abs(str.Longitude+0.12) > 1e-6 {
+		t.Errorf("Expected position 51.5, -0.12, got %f, %f", str.Latitude, str.Longitude)
+	}
+	bytes := 21*3*len(gps.Frame) + 3*len(station.Frame) + len(ephemeris.Frame)
+	wantBitrate := int(math.Round(float64(bytes) * 8 / 20))
+	if str.Bitrate != wantBitrate {
+		t.Errorf("Expected bitrate %d, got %d", wantBitrate, str.Bitrate)
+	}
+}
+
+func TestStreamInfoCarrier(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		payloads [][]byte
+		carrier  int
+	}{
+		{"no observations", [][]byte{stationPayload(1, 2, 3)}, 0},
+		{"legacy L1", [][]byte{testPayload(1002, 8)}, 1},
+		{"legacy L1/L2", [][]byte{testPayload(1004, 8)}, 2},
+		{"single band per system", [][]byte{msmPayload(1074, 2, 3), msmPayload(1124, 2)}, 1},
+		{"dual band", [][]byte{msmPayload(1124, 2, 30)}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := newStreamInfo(now)
+			for _, payload := range tt.payloads {
+				info.add(message(t, payload), now)
+			}
+			if info.carrier() != tt.carrier {
+				t.Errorf("Expected carrier %d, got %d", tt.carrier, info.carrier())
+			}
+		})
+	}
+}
+
+func TestCasterLiveSourcetable(t *testing.T) {
+	config := testConfig()
+	config.Mounts[0].Stream = ntrip.MountPoint{NavSystem: "GPS", Country: "GBR", Latitude: 1, Longitude: 2}
+	c, url := startCaster(t, config)
+
+	// Before a source connects the configured values are published
+	if str := c.Sourcetable().Mounts[0]; str.NavSystem != "GPS" || str.Latitude != 1 {
+		t.Errorf("Expected the configured record, got %+v", str)
+	}
+
+	source := connectSource(t, url, "base", "basepass", "BASE", ntrip.ProtocolRev2)
+	stream, err := connectClient(url, "rover", "roverpass", "BASE", ntrip.ProtocolRev2)
+	if err != nil {
+		t.Fatalf("Client connect failed: %v", err)
+	}
+	defer stream.Close()
+
+	station := payloadFrame(stationPayload(3978667.8176, -8332.9146, 4968397.6747))
+	observations := payloadFrame(msmPayload(1097, 2, 22))
+	source.Write(append(station, observations...))
+	readFull(t, stream, append(station, observations...))
+
+	client := ntrip.NewClient(url, "", "", "")
+	client.Protocol = ntrip.ProtocolRev2
+	table, err := client.GetSourcetable(context.Background())
+	if err != nil {
+		t.Fatalf("GetSourcetable failed: %v", err)
+	}
+
+	str := table.Mounts[0]
+	if str.FormatDetails != "1005,1097" || str.NavSystem != "GAL" || str.Carrier != 2 {
+		t.Errorf("Expected live stream details, got %+v", str)
+	}
+	if math.Abs(str.Latitude-51.5) > 0.01 || math.Abs(str.Longitude+0.12) > 0.01 || str.Country != "GBR" {
+		t.Errorf("Expected the 1005 position and configured country, got %+v", str)
+	}
+
+	// The configured record is restored when the source disconnects
+	source.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for c.Sourcetable().Mounts[0].NavSystem != "GPS" {
+		if time.Now().After(deadline) {
+			t.Fatal("Live details were not cleared after the source disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
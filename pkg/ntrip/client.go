@@ -1,103 +1,275 @@
 package ntrip
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+)
+
+// Protocol selects how the client talks to the caster
+type Protocol int
 
-	"github.com/bramburn/gnssgo"
+// Supported protocols
+const (
+	// ProtocolAuto sends an NTRIP 2.0 request over a raw TCP connection
+	// and reads the reply according to its status line, so NTRIP 1.0
+	// casters answering "ICY 200 OK" or "SOURCETABLE 200 OK" work too.
+	// Casters that reject the request or close the connection without a
+	// status line are asked again with an NTRIP 1.0 request.
+	ProtocolAuto Protocol = iota
+	// ProtocolHTTP uses net/http with an NTRIP 2.0 request
+	ProtocolHTTP
+	// ProtocolRev1 uses a raw TCP connection with an NTRIP 1.0 request
+	ProtocolRev1
+	// ProtocolRev2 uses a raw TCP connection with an NTRIP 2.0 request
+	ProtocolRev2
 )
 
+// String returns the name of the protocol
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolAuto:
+		return "auto"
+	case ProtocolHTTP:
+		return "http"
+	case ProtocolRev1:
+		return "rev1"
+	case ProtocolRev2:
+		return "rev2"
+	default:
+		return fmt.Sprintf("Protocol(%d)", int(p))
+	}
+}
+
+// ParseProtocol parses a protocol name as accepted on the command line
+func ParseProtocol(name string) (Protocol, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return ProtocolAuto, nil
+	case "http":
+		return ProtocolHTTP, nil
+	case "rev1", "1", "1.0", "v1":
+		return ProtocolRev1, nil
+	case "rev2", "2", "2.0", "v2":
+		return ProtocolRev2, nil
+	default:
+		return ProtocolAuto, fmt.Errorf("unknown NTRIP protocol: %s", name)
+	}
+}
+
+// userAgent is sent with every request. NTRIP 1.0 casters require the
+// agent to start with "NTRIP".
+const userAgent = "NTRIP go_ntrip/client"
+
 // Client represents an NTRIP client
 type Client struct {
-	server     string
-	port       string
-	username   string
-	password   string
-	mountpoint string
-	stream     gnssgo.Stream
-	mutex      sync.Mutex
-	connected  bool
+	URL        string
+	Username   string
+	Password   string
+	Mountpoint string
+	Protocol   Protocol
+
+	// GGASource, when set, provides the position uploaded to the caster
+	// every GGAInterval. Uploading requires the raw TCP transport, so
+	// ProtocolHTTP only sends the position once with the request.
+	GGASource   GGASource
+	GGAInterval time.Duration
+
+	// TLSConfig is used for ntrips:// and https:// URLs, for example to
+	// trust a private CA or present a client certificate (see LoadTLSConfig)
+	TLSConfig *tls.Config
+
+	// Proxy routes connections through an HTTP CONNECT (http://host:port)
+	// or SOCKS5 (socks5://host:port) proxy. Credentials may be given in the
+	// URL. When empty, the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables are honoured.
+	Proxy string
+
+	// httpClient is built for the TLSConfig and Proxy it was created with
+	// and rebuilt when either changes
+	httpMutex  sync.Mutex
+	httpClient *http.Client
+	httpTLS    *tls.Config
+	httpProxy  string
 }
 
 // NewClient creates a new NTRIP client
-func NewClient(server, port, username, password, mountpoint string) (*Client, error) {
-	return &Client{
-		server:     server,
-		port:       port,
-		username:   username,
-		password:   password,
-		mountpoint: mountpoint,
-	}, nil
+func NewClient(url, username, password, mountpoint string) *Client {
+	c := &Client{
+		URL:        url,
+		Username:   username,
+		Password:   password,
+		Mountpoint: mountpoint,
+	}
+	c.httpClientFor()
+	return c
 }
 
-// Connect connects to the NTRIP server
-func (c *Client) Connect() error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+// Connect connects to the NTRIP server and returns a reader for the RTCM
+// data. It is equivalent to ConnectContext with a background context.
+func (c *Client) Connect() (io.ReadCloser, error) {
+	return c.ConnectContext(context.Background())
+}
 
-	if c.connected {
-		return fmt.Errorf("already connected")
+// ConnectContext connects to the NTRIP server and returns a reader for the
+// RTCM data. The context bounds the connection attempt and, once connected,
+// cancelling it ends the stream.
+func (c *Client) ConnectContext(ctx context.Context) (io.ReadCloser, error) {
+	switch c.Protocol {
+	case ProtocolHTTP:
+		return c.connectHTTP(ctx)
+	case ProtocolRev1:
+		return c.connectRaw(ctx, ProtocolRev1)
+	}
+	stream, err := c.connectRaw(ctx, ProtocolRev2)
+	if err != nil && c.Protocol == ProtocolAuto && rev1Fallback(ctx, err) {
+		return c.connectRaw(ctx, ProtocolRev1)
 	}
+	return stream, err
+}
 
-	// Initialize the stream
-	c.stream.InitStream()
+// rev1Fallback reports whether an NTRIP 2.0 request failed the way NTRIP
+// 1.0 only casters reject it: with a 400, 404, 405, 501 or 505 status, or
+// by closing the connection before sending a status line
+func rev1Fallback(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.Code {
+		case http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed,
+			http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
 
-	// Construct the NTRIP path
-	ntripPath := fmt.Sprintf("%s:%s@%s:%s/%s",
-		c.username, c.password, c.server, c.port, c.mountpoint)
+// streamURL returns the caster URL with the mountpoint appended if it is
+// not already included
+func (c *Client) streamURL() string {
+	fullURL := c.URL
+	if c.Mountpoint != "" && !strings.Contains(fullURL, c.Mountpoint) {
+		if !strings.HasSuffix(fullURL, "/") {
+			fullURL += "/"
+		}
+		fullURL += c.Mountpoint
+	}
+	return fullURL
+}
+
+// connectHTTP requests the stream using net/http
+func (c *Client) connectHTTP(ctx context.Context) (io.ReadCloser, error) {
+	// Create a new request with context
+	req, err := http.NewRequestWithContext(ctx, "GET", httpURL(c.streamURL()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
 
-	// Open the NTRIP client stream
-	result := c.stream.OpenStream(gnssgo.STR_NTRIPCLI, gnssgo.STR_MODE_R, ntripPath)
+	// Set NTRIP specific headers
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Ntrip-Version", "Ntrip/2.0")
 
-	// Check if the stream was opened successfully
-	if result <= 0 || c.stream.State <= 0 {
-		return fmt.Errorf("failed to connect to NTRIP server: %s", c.stream.Msg)
+	// net/http cannot upload after the request, so only the initial
+	// position is sent
+	if gga := c.currentGGA(); gga != "" {
+		req.Header.Set("Ntrip-GGA", gga)
 	}
 
-	c.connected = true
-	return nil
-}
+	// Set authentication if provided
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
 
-// Disconnect disconnects from the NTRIP server
-func (c *Client) Disconnect() error {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	// Make the request
+	resp, err := c.httpClientFor().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NTRIP caster: %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, statusError(resp.StatusCode)
+	}
 
-	if !c.connected {
-		return nil
+	// A sourcetable in place of the stream means the mountpoint is missing
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "gnss/sourcetable") {
+		defer resp.Body.Close()
+		data, _ := readSourcetableBody(resp.Body)
+		return nil, newMountpointNotFound(c.Mountpoint, data)
 	}
 
-	c.stream.StreamClose()
-	c.connected = false
-	return nil
+	return resp.Body, nil
+}
+
+// GetSourcetable retrieves the sourcetable from the NTRIP server
+func (c *Client) GetSourcetable(ctx context.Context) (*Sourcetable, error) {
+	switch c.Protocol {
+	case ProtocolHTTP:
+		return c.getSourcetableHTTP(ctx)
+	case ProtocolRev1:
+		return c.getSourcetableRaw(ctx, ProtocolRev1)
+	}
+	sourcetable, err := c.getSourcetableRaw(ctx, ProtocolRev2)
+	if err != nil && c.Protocol == ProtocolAuto && rev1Fallback(ctx, err) {
+		return c.getSourcetableRaw(ctx, ProtocolRev1)
+	}
+	return sourcetable, err
 }
 
-// Read reads data from the NTRIP server
-func (c *Client) Read(p []byte) (int, error) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+// getSourcetableHTTP retrieves the sourcetable using net/http
+func (c *Client) getSourcetableHTTP(ctx context.Context) (*Sourcetable, error) {
+	// Create a new request with context
+	req, err := http.NewRequestWithContext(ctx, "GET", httpURL(c.URL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
 
-	if !c.connected {
-		return 0, fmt.Errorf("not connected")
+	// Set NTRIP specific headers
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Ntrip-Version", "Ntrip/2.0")
+
+	// Set authentication if provided
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
 	}
 
-	n := c.stream.StreamRead(p, len(p))
-	if n <= 0 {
-		return 0, io.EOF
+	// Make the request
+	resp, err := c.httpClientFor().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NTRIP caster: %v", err)
 	}
+	defer resp.Body.Close()
 
-	return n, nil
-}
+	if resp.StatusCode != 200 {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	// Read the response body
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	// Parse the sourcetable
+	sourcetable, err := parseSourcetable(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sourcetable: %v", err)
+	}
 
-// IsConnected returns true if the client is connected
-func (c *Client) IsConnected() bool {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	return c.connected
+	return sourcetable, nil
 }
 
-// GetStream returns the underlying stream
-func (c *Client) GetStream() *gnssgo.Stream {
-	return &c.stream
+// statusError converts a non-200 status code into an error
+func statusError(code int) error {
+	return &StatusError{Code: code}
 }
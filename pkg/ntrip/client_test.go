@@ -1,182 +1,299 @@
 package ntrip
 
 import (
+	"context"
 	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
-
-	"github.com/bramburn/gnssgo/pkg/gnssgo"
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
+	"time"
 )
 
-// MockStream is already defined in gnss_receiver_test.go
-
-// TestNewClient tests the NewClient function
 func TestNewClient(t *testing.T) {
-	// Test with valid parameters
-	client, err := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	assert.NoError(t, err)
-	assert.NotNil(t, client)
-	assert.Equal(t, "example.com", client.server)
-	assert.Equal(t, "2101", client.port)
-	assert.Equal(t, "user", client.username)
-	assert.Equal(t, "pass", client.password)
-	assert.Equal(t, "MOUNT", client.mountpoint)
-	assert.False(t, client.connected)
+	url := "http://example.com"
+	username := "user"
+	password := "pass"
+	mountpoint := "MOUNT"
+
+	client := NewClient(url, username, password, mountpoint)
+
+	if client == nil {
+		t.Fatal("NewClient returned nil")
+	}
+
+	if client.URL != url {
+		t.Errorf("Expected URL %s, got %s", url, client.URL)
+	}
+
+	if client.Username != username {
+		t.Errorf("Expected username %s, got %s", username, client.Username)
+	}
+
+	if client.Password != password {
+		t.Errorf("Expected password %s, got %s", password, client.Password)
+	}
+
+	if client.Mountpoint != mountpoint {
+		t.Errorf("Expected mountpoint %s, got %s", mountpoint, client.Mountpoint)
+	}
+
+	if client.httpClient == nil {
+		t.Error("httpClient should be initialized")
+	}
 }
 
-// TestClientConnect tests the Connect method
-func TestClientConnect(t *testing.T) {
-	// Create a client with a mock stream
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Create a mock stream
-	originalStream := gnssgo.Stream{}
-	
-	// Save the original functions to restore later
-	originalInitStream := originalStream.InitStream
-	originalOpenStream := originalStream.OpenStream
-	
-	// Mock the InitStream and OpenStream functions
-	gnssgo.Stream.InitStream = func(s *gnssgo.Stream) {
-		// Do nothing
-	}
-	
-	gnssgo.Stream.OpenStream = func(s *gnssgo.Stream, strtype, strmode int, path string) int {
-		s.State = 1 // Set state to connected
-		return 1    // Return success
-	}
-	
-	// Test connect
-	err := client.Connect()
-	
-	// Restore original functions
-	gnssgo.Stream.InitStream = originalInitStream
-	gnssgo.Stream.OpenStream = originalOpenStream
-	
-	// Verify results
-	assert.NoError(t, err)
-	assert.True(t, client.connected)
+func TestConnect(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check request method
+		if r.Method != "GET" {
+			t.Errorf("Expected GET request, got %s", r.Method)
+		}
+
+		// Check path
+		if r.URL.Path != "/MOUNT" {
+			t.Errorf("Expected path /MOUNT, got %s", r.URL.Path)
+		}
+
+		// Check authentication
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			t.Error("Expected basic authentication")
+		}
+		if username != "user" {
+			t.Errorf("Expected username 'user', got '%s'", username)
+		}
+		if password != "pass" {
+			t.Errorf("Expected password 'pass', got '%s'", password)
+		}
+
+		// Send response
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("RTCM data"))
+	}))
+	defer server.Close()
+
+	// Create client
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	// Connect
+	ctx := context.Background()
+	stream, err := client.ConnectContext(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	// Read data
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Error reading from stream: %v", err)
+	}
+
+	// Check data
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got '%s'", string(data))
+	}
 }
 
-// TestClientConnectFailure tests the Connect method with a failure
-func TestClientConnectFailure(t *testing.T) {
-	// Create a client with a mock stream
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Create a mock stream
-	originalStream := gnssgo.Stream{}
-	
-	// Save the original functions to restore later
-	originalInitStream := originalStream.InitStream
-	originalOpenStream := originalStream.OpenStream
-	
-	// Mock the InitStream and OpenStream functions
-	gnssgo.Stream.InitStream = func(s *gnssgo.Stream) {
-		// Do nothing
-	}
-	
-	gnssgo.Stream.OpenStream = func(s *gnssgo.Stream, strtype, strmode int, path string) int {
-		s.State = 0 // Set state to not connected
-		s.Msg = "connection failed"
-		return 0    // Return failure
-	}
-	
-	// Test connect
-	err := client.Connect()
-	
-	// Restore original functions
-	gnssgo.Stream.InitStream = originalInitStream
-	gnssgo.Stream.OpenStream = originalOpenStream
-	
-	// Verify results
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "failed to connect")
-	assert.False(t, client.connected)
+func TestConnectError(t *testing.T) {
+	// Create a test server that returns an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// Create client
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	// Connect
+	ctx := context.Background()
+	_, err := client.ConnectContext(ctx)
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
 }
 
-// TestClientDisconnect tests the Disconnect method
-func TestClientDisconnect(t *testing.T) {
-	// Create a client with a mock stream
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Replace the stream with our mock
-	mockStream := new(MockStream)
-	client.stream = mockStream
-	
-	// Setup mock expectations
-	mockStream.On("StreamClose").Return()
-	
-	// Set connected state
-	client.connected = true
-	
-	// Test disconnect
-	err := client.Disconnect()
-	assert.NoError(t, err)
-	assert.False(t, client.connected)
-	mockStream.AssertCalled(t, "StreamClose")
+func TestConnectStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	_, err := client.Connect()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected StatusError, got %v", err)
+	}
+	if statusErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected code 503, got %d", statusErr.Code)
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		t.Error("503 should not be reported as ErrUnauthorized")
+	}
+
+	unauthorized := &StatusError{Code: http.StatusUnauthorized}
+	if !errors.Is(unauthorized, ErrUnauthorized) {
+		t.Error("Expected 401 StatusError to match ErrUnauthorized")
+	}
 }
 
-// TestClientRead tests the Read method
-func TestClientRead(t *testing.T) {
-	// Create a client with a mock stream
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Replace the stream with our mock
-	mockStream := new(MockStream)
-	client.stream = mockStream
-	
-	// Setup mock expectations
-	testData := []byte("test data")
-	mockStream.On("StreamRead", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
-		buffer := args.Get(0).([]byte)
-		copy(buffer, testData)
-	}).Return(len(testData))
-	
-	// Set connected state
-	client.connected = true
-	
-	// Test read
-	buffer := make([]byte, 1024)
-	n, err := client.Read(buffer)
-	assert.NoError(t, err)
-	assert.Equal(t, len(testData), n)
-	assert.Equal(t, testData, buffer[:n])
+func TestGetSourcetable(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check request method
+		if r.Method != "GET" {
+			t.Errorf("Expected GET request, got %s", r.Method)
+		}
+
+		// Send response
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("SOURCETABLE 200 OK\r\n" +
+			"STR;MOUNT1;Server 1;RTCM 3;1005,1077,1087,1097,1127;2;GPS+GLO+GAL+BDS;SNIP;CHN;31.22;121.46;1;1;SNIP;none;B;N;0;\r\n" +
+			"STR;MOUNT2;Server 2;RTCM 3;1005,1077,1087,1097,1127;2;GPS+GLO+GAL+BDS;SNIP;CHN;31.22;121.46;1;1;SNIP;none;B;N;0;\r\n" +
+			"ENDSOURCETABLE\r\n"))
+	}))
+	defer server.Close()
+
+	// Create client
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	// Get sourcetable
+	ctx := context.Background()
+	sourcetable, err := client.GetSourcetable(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Check sourcetable
+	if sourcetable == nil {
+		t.Fatal("Expected non-nil sourcetable")
+	}
+
+	if len(sourcetable.Mounts) != 2 {
+		t.Errorf("Expected 2 mounts, got %d", len(sourcetable.Mounts))
+	}
+
+	if sourcetable.Mounts[0].Name != "MOUNT1" {
+		t.Errorf("Expected mount name 'MOUNT1', got '%s'", sourcetable.Mounts[0].Name)
+	}
+
+	if sourcetable.Mounts[1].Name != "MOUNT2" {
+		t.Errorf("Expected mount name 'MOUNT2', got '%s'", sourcetable.Mounts[1].Name)
+	}
 }
 
-// TestClientReadNotConnected tests the Read method when not connected
-func TestClientReadNotConnected(t *testing.T) {
-	// Create a client
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Test read when not connected
-	buffer := make([]byte, 1024)
-	_, err := client.Read(buffer)
-	assert.Error(t, err)
-	assert.Equal(t, "not connected", err.Error())
+func TestGetSourcetableError(t *testing.T) {
+	// Create a test server that returns an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	// Create client
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	// Get sourcetable
+	ctx := context.Background()
+	_, err := client.GetSourcetable(ctx)
+	if err == nil {
+		t.Error("Expected error, got nil")
+	}
+}
+
+func TestConnectMountpointNotFound(t *testing.T) {
+	// NTRIP 2.0 casters answer a request for an unknown mountpoint with
+	// the sourcetable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "gnss/sourcetable")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("STR;MOUNT1;Server 1;RTCM 3;1005,1077;2;GPS;SNIP;CHN;31.22;121.46;1;1;SNIP;none;B;N;0;\r\n" +
+			"ENDSOURCETABLE\r\n"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "user", "pass", "MISSING")
+
+	_, err := client.ConnectContext(context.Background())
+	var notFound *ErrMountpointNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected ErrMountpointNotFound, got %v", err)
+	}
+
+	if len(notFound.Alternatives) != 1 || notFound.Alternatives[0].Name != "MOUNT1" {
+		t.Errorf("Expected alternative MOUNT1, got %+v", notFound.Alternatives)
+	}
 }
 
-// TestClientIsConnected tests the IsConnected method
-func TestClientIsConnected(t *testing.T) {
-	// Create a client
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Test when not connected
-	assert.False(t, client.IsConnected())
-	
-	// Test when connected
-	client.connected = true
-	assert.True(t, client.IsConnected())
+func TestConnectWithMountpoint(t *testing.T) {
+	// Create a test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check path
+		if r.URL.Path != "/MOUNT" {
+			t.Errorf("Expected path /MOUNT, got %s", r.URL.Path)
+		}
+
+		// Send response
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("RTCM data"))
+	}))
+	defer server.Close()
+
+	// Test with URL that doesn't include mountpoint
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	ctx := context.Background()
+	_, err := client.ConnectContext(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Test with URL that already includes mountpoint
+	client = NewClient(server.URL+"/MOUNT", "user", "pass", "")
+
+	_, err = client.ConnectContext(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Test with URL that has trailing slash
+	client = NewClient(server.URL+"/", "user", "pass", "MOUNT")
+
+	_, err = client.ConnectContext(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 }
 
-// TestClientGetStream tests the GetStream method
-func TestClientGetStream(t *testing.T) {
-	// Create a client
-	client, _ := NewClient("example.com", "2101", "user", "pass", "MOUNT")
-	
-	// Test GetStream
-	stream := client.GetStream()
-	assert.NotNil(t, stream)
-	assert.Equal(t, &client.stream, stream)
+func TestConnectTimeout(t *testing.T) {
+	// Create a test server that delays response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Create client
+	client := NewClient(server.URL, "user", "pass", "MOUNT")
+
+	// Create context with short timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Connect should timeout
+	_, err := client.ConnectContext(ctx)
+	if err == nil {
+		t.Error("Expected timeout error, got nil")
+	}
+
+	if !strings.Contains(err.Error(), "context deadline exceeded") &&
+		!strings.Contains(err.Error(), "context canceled") {
+		t.Errorf("Expected deadline exceeded error, got: %v", err)
+	}
 }
@@ -0,0 +1,394 @@
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTLSPort is used for ntrips:// URLs without a port
+const defaultTLSPort = "443"
+
+// LoadTLSConfig builds a TLS configuration for NTRIPS casters. caFile adds
+// a PEM bundle of trusted roots on top of the system pool; certFile and
+// keyFile provide an optional client certificate. Empty paths are skipped.
+func LoadTLSConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// isTLSScheme reports whether a URL scheme requires TLS
+func isTLSScheme(scheme string) bool {
+	scheme = strings.ToLower(scheme)
+	return scheme == "ntrips" || scheme == "https"
+}
+
+// httpURL maps ntrip:// and ntrips:// URLs onto the schemes net/http knows
+func httpURL(rawURL string) string {
+	lower := strings.ToLower(rawURL)
+	switch {
+	case strings.HasPrefix(lower, "ntrips://"):
+		return "https://" + rawURL[len("ntrips://"):]
+	case strings.HasPrefix(lower, "ntrip://"):
+		return "http://" + rawURL[len("ntrip://"):]
+	}
+	return rawURL
+}
+
+// hostPort returns the dial address for a caster URL, applying the default
+// port for the scheme
+func hostPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if isTLSScheme(u.Scheme) {
+		return net.JoinHostPort(u.Hostname(), defaultTLSPort)
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// httpClientFor returns the net/http client for the current TLS and proxy
+// settings. The client is cached so that connections are reused, and only
+// rebuilt when TLSConfig or Proxy has changed since it was built.
+func (c *Client) httpClientFor() *http.Client {
+	c.httpMutex.Lock()
+	defer c.httpMutex.Unlock()
+
+	if c.httpClient != nil && c.httpTLS == c.TLSConfig && c.httpProxy == c.Proxy {
+		return c.httpClient
+	}
+
+	// Only the response headers are bounded: a correction stream is
+	// unbounded, so an overall client timeout would cut it off
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       c.TLSConfig,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+	if c.Proxy != "" {
+		transport.Proxy = nil
+		transport.DialContext = c.dialContext
+	}
+
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
+	c.httpClient = &http.Client{Transport: transport}
+	c.httpTLS, c.httpProxy = c.TLSConfig, c.Proxy
+	return c.httpClient
+}
+
+// dialCaster opens a connection to the caster in u, through the configured
+// or environment proxy, and performs the TLS handshake for ntrips:// URLs
+func (c *Client) dialCaster(ctx context.Context, u *url.URL) (net.Conn, error) {
+	proxyURL, err := c.proxyFor(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+
+	conn, err := dialProxy(ctx, hostPort(u), proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isTLSScheme(u.Scheme) {
+		return conn, nil
+	}
+
+	config := &tls.Config{}
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %v", err)
+	}
+
+	return tlsConn, nil
+}
+
+// proxyFor returns the proxy to reach the caster in u through: the
+// configured Proxy, or the one the environment selects for u. It returns
+// nil for a direct connection.
+func (c *Client) proxyFor(u *url.URL) (*url.URL, error) {
+	if c.Proxy != "" {
+		return url.Parse(c.Proxy)
+	}
+
+	target := *u
+	target.Scheme = "http"
+	if isTLSScheme(u.Scheme) {
+		target.Scheme = "https"
+	}
+	return http.ProxyFromEnvironment(&http.Request{URL: &target})
+}
+
+// dialContext dials addr directly or through the configured proxy
+func (c *Client) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c.Proxy == "" {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	proxyURL, err := url.Parse(c.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	return dialProxy(ctx, addr, proxyURL)
+}
+
+// dialProxy dials addr over TCP, tunnelling through proxyURL unless it is
+// nil
+func dialProxy(ctx context.Context, addr string, proxyURL *url.URL) (net.Conn, error) {
+	var dialer net.Dialer
+	if proxyURL == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "8080"
+		if strings.HasPrefix(proxyURL.Scheme, "socks5") {
+			port = "1080"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to proxy: %v", err)
+	}
+
+	// Bound the proxy handshake by the context
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tunnel := conn
+	switch proxyURL.Scheme {
+	case "http":
+		tunnel, err = httpConnect(conn, proxyURL, addr)
+	case "socks5", "socks5h":
+		err = socks5Connect(conn, proxyURL, addr)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy error: %v", contextError(ctx, err))
+	}
+
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// bufferedConn is a net.Conn whose first reads drain a bufio.Reader, used
+// when the proxy sent data beyond its CONNECT response
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads buffered data first and then from the connection
+func (b *bufferedConn) Read(p []byte) (int, error) {
+	return b.reader.Read(p)
+}
+
+// httpConnect opens a tunnel to addr with an HTTP CONNECT request
+func httpConnect(conn net.Conn, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if user := proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		fmt.Fprintf(&sb, "Proxy-Authorization: Basic %s\r\n", credentials)
+	}
+	sb.WriteString("\r\n")
+
+	if _, err := io.WriteString(conn, sb.String()); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT to %s failed: %s", addr, resp.Status)
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// SOCKS5 protocol constants (RFC 1928 and RFC 1929)
+const (
+	socks5Version      = 0x05
+	socks5NoAuth       = 0x00
+	socks5UserPass     = 0x02
+	socks5NoAcceptable = 0xFF
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+// socks5Connect opens a tunnel to addr through a SOCKS5 proxy. The host
+// name is passed to the proxy for resolution.
+func socks5Connect(conn net.Conn, proxyURL *url.URL, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", portStr)
+	}
+
+	// Method negotiation
+	methods := []byte{socks5NoAuth}
+	if proxyURL.User != nil {
+		methods = []byte{socks5NoAuth, socks5UserPass}
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5UserPass:
+		if proxyURL.User == nil {
+			return fmt.Errorf("SOCKS5 proxy requires authentication")
+		}
+		password, _ := proxyURL.User.Password()
+		username := proxyURL.User.Username()
+		if len(username) > 255 || len(password) > 255 {
+			return fmt.Errorf("SOCKS5 user name or password too long")
+		}
+		auth := []byte{0x01, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("SOCKS5 authentication failed")
+		}
+	case socks5NoAcceptable:
+		return fmt.Errorf("SOCKS5 proxy accepted none of the offered authentication methods")
+	default:
+		return fmt.Errorf("unsupported SOCKS5 authentication method %d", reply[1])
+	}
+
+	// Connect request
+	request := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		request = append(request, socks5AddrIPv4)
+		request = append(request, ip.To4()...)
+	} else if ip != nil {
+		request = append(request, socks5AddrIPv6)
+		request = append(request, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long")
+		}
+		request = append(request, socks5AddrDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	// Reply: version, status, reserved, address type, address, port
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("SOCKS5 connect to %s failed with status %d", addr, header[1])
+	}
+
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("unexpected SOCKS5 address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
@@ -0,0 +1,497 @@
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a self-signed certificate for 127.0.0.1 and
+// returns it with its PEM encoded certificate and key
+func testCertificate(t *testing.T, name string) (tls.Certificate, []byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load key pair: %v", err)
+	}
+
+	return cert, certPEM, keyPEM
+}
+
+// newTLSFakeCaster starts a fake caster behind TLS
+func newTLSFakeCaster(t *testing.T, config *tls.Config, reply func(req fakeRequest, conn net.Conn)) *fakeCaster {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	return newFakeCasterOn(t, listener, reply)
+}
+
+// writeTempFile writes data to a file in a test directory and returns its path
+func writeTempFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// startTestProxy starts a proxy stand-in that runs handshake on each
+// connection and then relays to the target it returns. Targets are
+// reported on the returned channel.
+func startTestProxy(t *testing.T, handshake func(conn net.Conn, reader *bufio.Reader) (string, error)) (string, chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	targets := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				target, err := handshake(conn, reader)
+				if err != nil {
+					return
+				}
+				targets <- target
+
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+
+				go io.Copy(upstream, reader)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), targets
+}
+
+// httpConnectHandshake accepts a CONNECT request with the given credentials
+func httpConnectHandshake(credentials string) func(conn net.Conn, reader *bufio.Reader) (string, error) {
+	return func(conn net.Conn, reader *bufio.Reader) (string, error) {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return "", err
+		}
+		if req.Method != http.MethodConnect {
+			io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+			return "", fmt.Errorf("unexpected method %s", req.Method)
+		}
+		if req.Header.Get("Proxy-Authorization") != credentials {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return "", fmt.Errorf("bad credentials")
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		return req.Host, nil
+	}
+}
+
+// socks5Handshake accepts a SOCKS5 CONNECT with username/password auth
+func socks5Handshake(username, password string) func(conn net.Conn, reader *bufio.Reader) (string, error) {
+	return func(conn net.Conn, reader *bufio.Reader) (string, error) {
+		greeting := make([]byte, 2)
+		if _, err := io.ReadFull(reader, greeting); err != nil {
+			return "", err
+		}
+		methods := make([]byte, greeting[1])
+		if _, err := io.ReadFull(reader, methods); err != nil {
+			return "", err
+		}
+		if !strings.Contains(string(methods), "\x02") {
+			conn.Write([]byte{0x05, 0xFF})
+			return "", fmt.Errorf("no acceptable method")
+		}
+		conn.Write([]byte{0x05, 0x02})
+
+		// Username/password sub-negotiation
+		version, _ := reader.ReadByte()
+		ulen, _ := reader.ReadByte()
+		user := make([]byte, ulen)
+		io.ReadFull(reader, user)
+		plen, _ := reader.ReadByte()
+		pass := make([]byte, plen)
+		io.ReadFull(reader, pass)
+		if version != 0x01 || string(user) != username || string(pass) != password {
+			conn.Write([]byte{0x01, 0x01})
+			return "", fmt.Errorf("bad credentials")
+		}
+		conn.Write([]byte{0x01, 0x00})
+
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return "", err
+		}
+		var host string
+		switch header[3] {
+		case 0x01:
+			ip := make([]byte, 4)
+			io.ReadFull(reader, ip)
+			host = net.IP(ip).String()
+		case 0x03:
+			length, _ := reader.ReadByte()
+			name := make([]byte, length)
+			io.ReadFull(reader, name)
+			host = string(name)
+		default:
+			return "", fmt.Errorf("unsupported address type")
+		}
+		port := make([]byte, 2)
+		io.ReadFull(reader, port)
+
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+		return net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port))), nil
+	}
+}
+
+func TestConnectNTRIPS(t *testing.T) {
+	cert, certPEM, _ := testCertificate(t, "caster")
+	fc := newTLSFakeCaster(t, &tls.Config{Certificates: []tls.Certificate{cert}}, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\nRTCM data")
+	})
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+
+	client := NewClient("ntrips://"+fc.listener.Addr().String(), "user", "pass", "MOUNT")
+	client.Protocol = ProtocolRev1
+	client.TLSConfig = &tls.Config{RootCAs: pool}
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, _ := io.ReadAll(stream)
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got %q", data)
+	}
+
+	req := fc.lastRequest(t)
+	if req.RequestLine != "GET /MOUNT HTTP/1.0" {
+		t.Errorf("Unexpected request line %q", req.RequestLine)
+	}
+}
+
+func TestConnectNTRIPSUntrustedCertificate(t *testing.T) {
+	cert, _, _ := testCertificate(t, "caster")
+	fc := newTLSFakeCaster(t, &tls.Config{Certificates: []tls.Certificate{cert}}, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+	})
+
+	client := NewClient("ntrips://"+fc.listener.Addr().String(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+
+	_, err := client.ConnectContext(context.Background())
+	if err == nil {
+		t.Fatal("Expected error for untrusted certificate")
+	}
+	if !strings.Contains(err.Error(), "TLS handshake failed") {
+		t.Errorf("Expected TLS handshake error, got %v", err)
+	}
+}
+
+func TestConnectNTRIPSClientCertificate(t *testing.T) {
+	serverCert, serverPEM, _ := testCertificate(t, "caster")
+	_, clientPEM, clientKey := testCertificate(t, "rover")
+
+	clientPool := x509.NewCertPool()
+	clientPool.AppendCertsFromPEM(clientPEM)
+
+	fc := newTLSFakeCaster(t, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientPool,
+	}, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\nRTCM data")
+	})
+
+	config, err := LoadTLSConfig(
+		writeTempFile(t, "ca.pem", serverPEM),
+		writeTempFile(t, "client.pem", clientPEM),
+		writeTempFile(t, "client.key", clientKey),
+		false)
+	if err != nil {
+		t.Fatalf("LoadTLSConfig failed: %v", err)
+	}
+
+	client := NewClient("ntrips://"+fc.listener.Addr().String(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+	client.TLSConfig = config
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, _ := io.ReadAll(stream)
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got %q", data)
+	}
+}
+
+func TestLoadTLSConfigErrors(t *testing.T) {
+	if _, err := LoadTLSConfig(writeTempFile(t, "ca.pem", []byte("not a certificate")), "", "", false); err == nil {
+		t.Error("Expected error for CA file without certificates")
+	}
+	if _, err := LoadTLSConfig("", filepath.Join(t.TempDir(), "missing.pem"), "", false); err == nil {
+		t.Error("Expected error for missing client certificate")
+	}
+}
+
+func TestGetSourcetableHTTPS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "gnss/sourcetable")
+		io.WriteString(w, fakeSourcetable)
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	client := NewClient(strings.Replace(server.URL, "https://", "ntrips://", 1), "", "", "")
+	client.TLSConfig = &tls.Config{RootCAs: pool}
+
+	sourcetable, err := client.GetSourcetable(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(sourcetable.Mounts) != 1 || sourcetable.Mounts[0].Name != "MOUNT" {
+		t.Errorf("Expected mountpoint MOUNT, got %+v", sourcetable.Mounts)
+	}
+}
+
+func TestConnectThroughHTTPProxy(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\n\r\nRTCM data")
+	})
+	proxyAddr, targets := startTestProxy(t, httpConnectHandshake("Basic dTpw"))
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+	client.Proxy = "http://u:p@" + proxyAddr
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, _ := io.ReadAll(stream)
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got %q", data)
+	}
+
+	target := <-targets
+	if target != fc.listener.Addr().String() {
+		t.Errorf("Expected CONNECT to %s, got %s", fc.listener.Addr(), target)
+	}
+}
+
+func TestConnectThroughHTTPProxyRejected(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {})
+	proxyAddr, _ := startTestProxy(t, httpConnectHandshake("Basic dTpw"))
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+	client.Proxy = "http://" + proxyAddr
+
+	_, err := client.ConnectContext(context.Background())
+	if err == nil {
+		t.Fatal("Expected error when the proxy rejects the tunnel")
+	}
+	if !strings.Contains(err.Error(), "407") {
+		t.Errorf("Expected 407 in error, got %v", err)
+	}
+}
+
+func TestConnectNTRIPSThroughSOCKS5Proxy(t *testing.T) {
+	cert, certPEM, _ := testCertificate(t, "caster")
+	fc := newTLSFakeCaster(t, &tls.Config{Certificates: []tls.Certificate{cert}}, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\nRTCM data")
+	})
+	proxyAddr, targets := startTestProxy(t, socks5Handshake("user", "secret"))
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+
+	_, port, _ := net.SplitHostPort(fc.listener.Addr().String())
+	client := NewClient("ntrips://localhost:"+port, "", "", "MOUNT")
+	client.Protocol = ProtocolRev1
+	client.TLSConfig = &tls.Config{RootCAs: pool}
+	client.Proxy = "socks5://user:secret@" + proxyAddr
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, _ := io.ReadAll(stream)
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got %q", data)
+	}
+
+	// The host name is resolved by the proxy, not the client
+	if target := <-targets; target != "localhost:"+port {
+		t.Errorf("Expected SOCKS5 target localhost:%s, got %s", port, target)
+	}
+}
+
+func TestGetSourcetableHTTPThroughSOCKS5Proxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "gnss/sourcetable")
+		io.WriteString(w, fakeSourcetable)
+	}))
+	defer server.Close()
+
+	proxyAddr, targets := startTestProxy(t, socks5Handshake("user", "secret"))
+
+	client := NewClient(server.URL, "", "", "")
+	client.Protocol = ProtocolHTTP
+	client.Proxy = "socks5://user:secret@" + proxyAddr
+
+	sourcetable, err := client.GetSourcetable(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(sourcetable.Mounts) != 1 {
+		t.Errorf("Expected 1 mountpoint, got %d", len(sourcetable.Mounts))
+	}
+	if target := <-targets; target != strings.TrimPrefix(server.URL, "http://") {
+		t.Errorf("Unexpected SOCKS5 target %s", target)
+	}
+}
+
+func TestSOCKS5CredentialsTooLong(t *testing.T) {
+	conn, proxy := net.Pipe()
+	defer conn.Close()
+	defer proxy.Close()
+
+	// The proxy asks for a user name and password, which must not be sent
+	sent := make(chan int, 1)
+	go func() {
+		greeting := make([]byte, 4)
+		if _, err := io.ReadFull(proxy, greeting); err != nil {
+			return
+		}
+		proxy.Write([]byte{0x05, 0x02})
+		n, _ := proxy.Read(make([]byte, 512))
+		sent <- n
+	}()
+
+	proxyURL, _ := url.Parse("socks5://user:" + strings.Repeat("x", 256) + "@proxy:1080")
+	err := socks5Connect(conn, proxyURL, "caster.example:2101")
+	if err == nil || !strings.Contains(err.Error(), "too long") {
+		t.Errorf("Expected an error for a long password, got %v", err)
+	}
+	conn.Close()
+	if n := <-sent; n != 0 {
+		t.Errorf("Expected no authentication request, got %d bytes", n)
+	}
+}
+
+func TestHTTPClientCached(t *testing.T) {
+	client := NewClient("https://caster.example", "", "", "MOUNT")
+	client.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	first := client.httpClientFor()
+	if client.httpClientFor() != first {
+		t.Error("Expected the client to be reused while the settings are unchanged")
+	}
+
+	client.Proxy = "socks5://127.0.0.1:1080"
+	second := client.httpClientFor()
+	if second == first {
+		t.Error("Expected a new client after the proxy changed")
+	}
+
+	client.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+	if third := client.httpClientFor(); third == second {
+		t.Error("Expected a new client after the TLS configuration changed")
+	}
+}
+
+func TestHTTPURL(t *testing.T) {
+	tests := map[string]string{
+		"ntrips://caster.example:443/MOUNT": "https://caster.example:443/MOUNT",
+		"NTRIP://caster.example:2101":       "http://caster.example:2101",
+		"http://caster.example:2101":        "http://caster.example:2101",
+		"https://caster.example":            "https://caster.example",
+	}
+
+	for input, expected := range tests {
+		if got := httpURL(input); got != expected {
+			t.Errorf("httpURL(%q): expected %q, got %q", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package ntrip
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChangeType identifies how a mountpoint changed between two sourcetables
+type ChangeType int
+
+// Mountpoint change types
+const (
+	MountAdded ChangeType = iota
+	MountRemoved
+	MountChanged
+)
+
+// String returns the name of the change type
+func (t ChangeType) String() string {
+	switch t {
+	case MountAdded:
+		return "added"
+	case MountRemoved:
+		return "removed"
+	case MountChanged:
+		return "changed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the change type by name
+func (t ChangeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// FieldChange is a single field that differs between two versions of a
+// mountpoint
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// MountChange describes a mountpoint that was added, removed or changed
+type MountChange struct {
+	Type   ChangeType    `json:"change"`
+	Name   string        `json:"name"`
+	Old    *MountPoint   `json:"old,omitempty"`
+	New    *MountPoint   `json:"new,omitempty"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// String returns a one-line summary of the change
+func (c MountChange) String() string {
+	switch c.Type {
+	case MountAdded:
+		return fmt.Sprintf("+ %s (%s, %s, %s)", c.Name, c.New.Format, c.New.Country, formatCoordinates(c.New))
+	case MountRemoved:
+		return fmt.Sprintf("- %s (%s, %s, %s)", c.Name, c.Old.Format, c.Old.Country, formatCoordinates(c.Old))
+	}
+
+	parts := make([]string, len(c.Fields))
+	for i, f := range c.Fields {
+		parts[i] = fmt.Sprintf("%s %q -> %q", f.Field, f.Old, f.New)
+	}
+	return fmt.Sprintf("~ %s: %s", c.Name, strings.Join(parts, ", "))
+}
+
+// formatCoordinates formats a mountpoint position as "lat,lon"
+func formatCoordinates(m *MountPoint) string {
+	return strconv.FormatFloat(m.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(m.Longitude, 'f', -1, 64)
+}
+
+// DiffSourcetables compares two sourcetables and reports added and removed
+// mountpoints and changes to their format, format details, navigation
+// systems, bitrate and coordinates. Changes are sorted by mountpoint name.
+func DiffSourcetables(previous, current *Sourcetable) []MountChange {
+	oldMounts := mountsByName(previous)
+	newMounts := mountsByName(current)
+
+	var changes []MountChange
+	for name, o := range oldMounts {
+		n, ok := newMounts[name]
+		if !ok {
+			changes = append(changes, MountChange{Type: MountRemoved, Name: name, Old: o})
+			continue
+		}
+		if fields := diffMount(o, n); len(fields) > 0 {
+			changes = append(changes, MountChange{Type: MountChanged, Name: name, Old: o, New: n, Fields: fields})
+		}
+	}
+	for name, n := range newMounts {
+		if _, ok := oldMounts[name]; !ok {
+			changes = append(changes, MountChange{Type: MountAdded, Name: name, New: n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// mountsByName indexes the mountpoints of a sourcetable. Casters sometimes
+// list a name twice; the last record wins.
+func mountsByName(st *Sourcetable) map[string]*MountPoint {
+	mounts := make(map[string]*MountPoint)
+	if st == nil {
+		return mounts
+	}
+	for i := range st.Mounts {
+		mounts[st.Mounts[i].Name] = &st.Mounts[i]
+	}
+	return mounts
+}
+
+// diffMount lists the tracked fields that differ between two versions
+func diffMount(o, n *MountPoint) []FieldChange {
+	var fields []FieldChange
+	add := func(field, oldValue, newValue string) {
+		if oldValue != newValue {
+			fields = append(fields, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+
+	add("format", o.Format, n.Format)
+	add("format_details", o.FormatDetails, n.FormatDetails)
+	add("nav_system", o.NavSystem, n.NavSystem)
+	add("bitrate", strconv.Itoa(o.Bitrate), strconv.Itoa(n.Bitrate))
+	add("coordinates", formatCoordinates(o), formatCoordinates(n))
+
+	return fields
+}
@@ -0,0 +1,74 @@
+package ntrip
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSourcetables(t *testing.T) {
+	previous := &Sourcetable{Mounts: []MountPoint{
+		{Name: "KEEP", Format: "RTCM 3.2", FormatDetails: "1005(10),1077(1)", Bitrate: 2400, Latitude: 51.5, Longitude: -0.1},
+		{Name: "GONE", Format: "RTCM 3.2", Country: "BEL", Latitude: 50.8, Longitude: 4.36},
+		{Name: "MOVED", Format: "RTCM 3.2", Bitrate: 2400, Latitude: 52.1, Longitude: 5.1},
+	}}
+	current := &Sourcetable{Mounts: []MountPoint{
+		{Name: "NEW", Format: "RTCM 3.3", Country: "NLD", Latitude: 51.6, Longitude: 4.9},
+		{Name: "MOVED", Format: "RTCM 3.2", Bitrate: 4800, Latitude: 52.2, Longitude: 5.1},
+		{Name: "KEEP", Format: "RTCM 3.2", FormatDetails: "1005(10),1077(1)", Bitrate: 2400, Latitude: 51.5, Longitude: -0.1, Misc: "ignored"},
+	}}
+
+	changes := DiffSourcetables(previous, current)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %d: %v", len(changes), changes)
+	}
+
+	if changes[0].Type != MountRemoved || changes[0].Name != "GONE" {
+		t.Errorf("Expected GONE removed, got %s %s", changes[0].Type, changes[0].Name)
+	}
+
+	moved := changes[1]
+	if moved.Type != MountChanged || moved.Name != "MOVED" {
+		t.Fatalf("Expected MOVED changed, got %s %s", moved.Type, moved.Name)
+	}
+	if len(moved.Fields) != 2 {
+		t.Fatalf("Expected 2 changed fields, got %v", moved.Fields)
+	}
+	if moved.Fields[0] != (FieldChange{Field: "bitrate", Old: "2400", New: "4800"}) {
+		t.Errorf("Unexpected bitrate change %+v", moved.Fields[0])
+	}
+	if moved.Fields[1] != (FieldChange{Field: "coordinates", Old: "52.1,5.1", New: "52.2,5.1"}) {
+		t.Errorf("Unexpected coordinates change %+v", moved.Fields[1])
+	}
+
+	if changes[2].Type != MountAdded || changes[2].Name != "NEW" {
+		t.Errorf("Expected NEW added, got %s %s", changes[2].Type, changes[2].Name)
+	}
+}
+
+func TestDiffSourcetablesNoChanges(t *testing.T) {
+	st := loadSourcetable(t, "snip.txt")
+	if changes := DiffSourcetables(st, loadSourcetable(t, "snip.txt")); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+
+	// Everything is new compared to nothing
+	if changes := DiffSourcetables(nil, st); len(changes) != len(st.Mounts) {
+		t.Errorf("Expected %d added mounts, got %d", len(st.Mounts), len(changes))
+	}
+}
+
+func TestMountChangeString(t *testing.T) {
+	change := MountChange{
+		Type:   MountChanged,
+		Name:   "MOUNT",
+		Fields: []FieldChange{{Field: "format_details", Old: "1005(10)", New: "1005(10),1077(1)"}},
+	}
+	if got := change.String(); got != `~ MOUNT: format_details "1005(10)" -> "1005(10),1077(1)"` {
+		t.Errorf("Unexpected string %q", got)
+	}
+
+	added := MountChange{Type: MountAdded, Name: "NEW", New: &MountPoint{Format: "RTCM 3.3", Country: "NLD", Latitude: 51.6, Longitude: 4.9}}
+	if got := added.String(); !strings.HasPrefix(got, "+ NEW (RTCM 3.3, NLD, 51.6,4.9)") {
+		t.Errorf("Unexpected string %q", got)
+	}
+}
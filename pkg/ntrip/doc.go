@@ -2,96 +2,57 @@
 Package ntrip provides functionality for working with NTRIP (Networked Transport of RTCM via Internet Protocol)
 and GNSS (Global Navigation Satellite System) data processing.
 
-This package serves as a high-level wrapper around the core functionality provided by the gnssgo package,
-making it easier to work with NTRIP clients, GNSS receivers, and RTK (Real-Time Kinematic) processing.
+The NTRIP client, server and sourcetable tools are implemented directly on net/http and raw TCP
+connections.
 
 # Main Components
 
 ## NTRIP Client
 
-The Client type provides a simple interface for connecting to NTRIP servers and receiving RTCM correction data.
-It handles the details of establishing and maintaining the connection, authentication, and data streaming.
+The Client type connects to NTRIP casters over NTRIP 1.0, NTRIP 2.0 or plain HTTP, optionally through TLS
+(ntrips:// URLs) and HTTP or SOCKS5 proxies. Every network operation takes a context. By default it sends an
+NTRIP 2.0 request and reads the reply by its status line, so NTRIP 1.0 casters answering "ICY 200 OK"
+need no configuration. Casters that reject an NTRIP 2.0 request are asked again with an NTRIP 1.0 request.
 
 Example usage:
-    
+
     // Create a new NTRIP client
-    client, err := ntrip.NewClient("example.com", "2101", "username", "password", "MOUNTPOINT")
-    if err != nil {
-        log.Fatalf("Failed to create NTRIP client: %v", err)
-    }
-    
+    client := ntrip.NewClient("http://example.com:2101", "username", "password", "MOUNTPOINT")
+
     // Connect to the NTRIP server
-    err = client.Connect()
+    stream, err := client.ConnectContext(ctx)
     if err != nil {
+        var notFound *ntrip.ErrMountpointNotFound
+        if errors.As(err, &notFound) {
+            log.Fatalf("Unknown mountpoint, caster offers %d others", len(notFound.Alternatives))
+        }
         log.Fatalf("Failed to connect to NTRIP server: %v", err)
     }
-    defer client.Disconnect()
-    
+    defer stream.Close()
+
     // Read RTCM data
     buffer := make([]byte, 1024)
-    n, err := client.Read(buffer)
-    if err != nil {
-        log.Fatalf("Failed to read RTCM data: %v", err)
-    }
-    
-    // Process the RTCM data
-    processRTCM(buffer[:n])
-
-## GNSS Receiver
+    n, err := stream.Read(buffer)
 
-The GNSSReceiver type provides an interface for connecting to physical GNSS receivers via serial ports
-and reading raw GNSS data. It handles the details of establishing and maintaining the connection and data streaming.
-
-Example usage:
-    
-    // Create a new GNSS receiver
-    receiver, err := ntrip.NewGNSSReceiver("COM1:9600:8:N:1")
-    if err != nil {
-        log.Fatalf("Failed to connect to GNSS receiver: %v", err)
-    }
-    defer receiver.Close()
-    
-    // Read GNSS data
-    buffer := make([]byte, 1024)
-    n, err := receiver.Read(buffer)
-    if err != nil {
-        log.Fatalf("Failed to read GNSS data: %v", err)
-    }
-    
-    // Process the GNSS data
-    processGNSS(buffer[:n])
+Errors are typed: ErrUnauthorized for rejected credentials, *StatusError for other non-200 replies and
+*ErrMountpointNotFound when the caster answers with its sourcetable.
 
-## RTK Processor
+GetSourcetable fetches and parses the caster's sourcetable, which can be filtered with MountFilter and
+ranked by distance with Nearest. VRS and network RTK mountpoints need the rover position: set GGASource
+to a FixedGGA or RoverGGA and the client uploads a GGA sentence every GGAInterval. A RoverGGA is fed
+the rover's raw NMEA sentences with Update.
 
-The RTKProcessor type provides functionality for processing GNSS data using RTK techniques.
-It combines data from a GNSS receiver (rover) and NTRIP client (base station) to calculate precise positions.
+For long-running streams, NewSession wraps a client in an io.Reader that reconnects with exponential
+backoff, detects stalled streams and reports SessionStats. NewFailover merges several sources in
+priority order, switching when the active one goes silent or its observation epochs grow too old.
 
-Example usage:
-    
-    // Create a new RTK processor
-    processor, err := ntrip.NewRTKProcessor(receiver, client)
-    if err != nil {
-        log.Fatalf("Failed to create RTK processor: %v", err)
-    }
-    
-    // Start RTK processing
-    err = processor.Start()
-    if err != nil {
-        log.Fatalf("Failed to start RTK processing: %v", err)
-    }
-    defer processor.Stop()
-    
-    // Get RTK statistics
-    stats := processor.GetStats()
-    fmt.Printf("Rover observations: %d\n", stats.RoverObs)
-    fmt.Printf("Base observations: %d\n", stats.BaseObs)
-    fmt.Printf("Solutions: %d\n", stats.Solutions)
-    fmt.Printf("Fix ratio: %.2f%%\n", stats.FixRatio*100)
+To publish corrections from a local base, NewServer describes the caster mountpoint and NewUpload sends the
+RTCM frames read from a source, such as a DeviceReader, using an NTRIP 1.0 SOURCE or NTRIP 2.0 POST request.
+UploadStats reports the upload rate and the frames dropped while the caster was unreachable.
 
-# Relationship with gnssgo
+## GNSS Receiver and RTK Processor
 
-This package is built on top of the gnssgo package, which provides the core GNSS processing functionality.
-The ntrip package provides a higher-level, more user-friendly interface to the gnssgo functionality,
-making it easier to work with NTRIP and RTK in Go applications.
+The GNSS receiver and RTK processor are in the rtk subpackage, which is built on the gnssgo package.
+This package does not depend on gnssgo.
 */
 package ntrip
@@ -0,0 +1,60 @@
+package ntrip
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnauthorized is returned when the caster rejects the credentials
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrStalled is reported by a Session when no RTCM frame arrived within
+// the stall timeout and the connection was dropped
+var ErrStalled = errors.New("no RTCM frame received within stall timeout")
+
+// StatusError is returned when the caster answers with a status other than
+// 200. A 401 status unwraps to ErrUnauthorized.
+type StatusError struct {
+	Code int
+}
+
+// Error implements the error interface
+func (e *StatusError) Error() string {
+	if e.Code == http.StatusUnauthorized {
+		return fmt.Sprintf("received non-200 response code: %d: %v", e.Code, ErrUnauthorized)
+	}
+	return fmt.Sprintf("received non-200 response code: %d", e.Code)
+}
+
+// Unwrap returns ErrUnauthorized for a 401 status
+func (e *StatusError) Unwrap() error {
+	if e.Code == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// ErrMountpointNotFound is returned when a caster answers a stream request
+// with its sourcetable, which is how NTRIP casters signal that the
+// requested mountpoint does not exist. Alternatives holds the mountpoints
+// the caster offers instead.
+type ErrMountpointNotFound struct {
+	Mountpoint   string
+	Alternatives []MountPoint
+}
+
+// Error implements the error interface
+func (e *ErrMountpointNotFound) Error() string {
+	return fmt.Sprintf("mountpoint %s not found (caster offers %d alternatives)", e.Mountpoint, len(e.Alternatives))
+}
+
+// newMountpointNotFound builds an ErrMountpointNotFound from the sourcetable
+// text the caster sent in place of the stream
+func newMountpointNotFound(mountpoint, data string) error {
+	err := &ErrMountpointNotFound{Mountpoint: mountpoint}
+	if sourcetable, parseErr := parseSourcetable(data); parseErr == nil {
+		err.Alternatives = sourcetable.Mounts
+	}
+	return err
+}
@@ -0,0 +1,411 @@
+package ntrip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Failover defaults
+const (
+	DefaultMaxSilence       = 5 * time.Second
+	DefaultMaxCorrectionAge = 10 * time.Second
+	DefaultRecoveryPeriod   = 30 * time.Second
+)
+
+// FailoverSource is one caster/mountpoint endpoint in priority order
+type FailoverSource struct {
+	Name   string // Label used in events; defaults to mountpoint@host
+	Client *Client
+}
+
+// FailoverConfig holds configuration for a failover stream
+type FailoverConfig struct {
+	Session          SessionConfig // Reconnect settings for each source
+	MaxSilence       time.Duration // Switch away when the active source has sent no frame for this long
+	MaxCorrectionAge time.Duration // Switch away when the latest observation epoch of the active source is this old
+	RecoveryPeriod   time.Duration // A preferred source must be healthy this long before switching back
+}
+
+// DefaultFailoverConfig returns a default failover configuration
+func DefaultFailoverConfig() FailoverConfig {
+	return FailoverConfig{
+		Session:          DefaultSessionConfig(),
+		MaxSilence:       DefaultMaxSilence,
+		MaxCorrectionAge: DefaultMaxCorrectionAge,
+		RecoveryPeriod:   DefaultRecoveryPeriod,
+	}
+}
+
+// FailoverEvent reports a change of the active source
+type FailoverEvent struct {
+	Time   time.Time
+	From   int    // Index of the previous source, -1 if none
+	To     int    // Index of the new source, -1 if none is healthy
+	Source string // Name of the new source
+	Reason string
+}
+
+// FailoverStatus describes one source of a failover stream
+type FailoverStatus struct {
+	Name      string
+	Active    bool
+	Healthy   bool
+	LastFrame time.Time
+	LastEpoch time.Time // Latest observation epoch received
+	Stats     SessionStats
+}
+
+// failoverSource tracks one source's session and health
+type failoverSource struct {
+	name    string
+	session *Session
+
+	lastFrame    time.Time
+	lastEpoch    time.Time
+	healthySince time.Time
+	err          error
+	ended        bool
+}
+
+// sourceFrame is a complete RTCM frame received from a source
+type sourceFrame struct {
+	index int
+	frame []byte
+}
+
+// Failover merges an ordered list of correction sources into one RTCM
+// stream. Every source is kept connected so that a standby can take over
+// immediately when the active source goes silent or its observations grow
+// older than MaxCorrectionAge, and the stream returns
+// to a preferred source once it has been healthy for RecoveryPeriod.
+// Only complete RTCM frames are forwarded, so a switch never splices part
+// of a frame from one source onto another.
+type Failover struct {
+	config FailoverConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sources []*failoverSource
+	frames  chan sourceFrame
+
+	pipeReader *io.PipeReader
+	pipeWriter *io.PipeWriter
+	events     chan FailoverEvent
+
+	mutex  sync.Mutex
+	active int
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+// NewFailover connects to all sources and starts forwarding corrections
+// from the first healthy one. The stream runs until ctx is done or Close
+// is called.
+func NewFailover(ctx context.Context, sources []FailoverSource, config FailoverConfig) *Failover {
+	if config.MaxSilence <= 0 {
+		config.MaxSilence = DefaultMaxSilence
+	}
+	if config.MaxCorrectionAge <= 0 {
+		config.MaxCorrectionAge = DefaultMaxCorrectionAge
+	}
+	if config.RecoveryPeriod < 0 {
+		config.RecoveryPeriod = 0
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+
+	f := &Failover{
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		frames:     make(chan sourceFrame),
+		pipeReader: pr,
+		pipeWriter: pw,
+		events:     make(chan FailoverEvent, 32),
+		active:     -1,
+		done:       make(chan struct{}),
+	}
+
+	for i, source := range sources {
+		name := source.Name
+		if name == "" {
+			name = sourceName(source.Client)
+		}
+		s := &failoverSource{
+			name:    name,
+			session: NewSession(ctx, source.Client, config.Session),
+		}
+		f.sources = append(f.sources, s)
+
+		f.wg.Add(1)
+		go f.readSource(i, s)
+	}
+
+	go f.run()
+
+	return f
+}
+
+// sourceName returns mountpoint@host for a client
+func sourceName(client *Client) string {
+	host := client.URL
+	if u, err := url.Parse(client.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return client.Mountpoint + "@" + host
+}
+
+// Read reads RTCM frames from the active source
+func (f *Failover) Read(p []byte) (int, error) {
+	return f.pipeReader.Read(p)
+}
+
+// Close stops the stream and all source sessions
+func (f *Failover) Close() error {
+	f.cancel()
+	f.pipeReader.Close()
+	<-f.done
+	return nil
+}
+
+// Events returns the channel on which source switches are reported.
+// Events are dropped if the channel is not drained.
+func (f *Failover) Events() <-chan FailoverEvent {
+	return f.events
+}
+
+// Active returns the index and name of the active source, or -1 and ""
+// if no source is healthy
+func (f *Failover) Active() (int, string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.active < 0 {
+		return -1, ""
+	}
+	return f.active, f.sources[f.active].name
+}
+
+// Status returns the state of every source in priority order
+func (f *Failover) Status() []FailoverStatus {
+	now := time.Now()
+
+	f.mutex.Lock()
+	status := make([]FailoverStatus, len(f.sources))
+	for i, s := range f.sources {
+		status[i] = FailoverStatus{
+			Name:      s.name,
+			Active:    i == f.active,
+			Healthy:   f.healthy(s, now),
+			LastFrame: s.lastFrame,
+			LastEpoch: s.lastEpoch,
+		}
+	}
+	f.mutex.Unlock()
+
+	for i, s := range f.sources {
+		status[i].Stats = s.session.Stats()
+	}
+	return status
+}
+
+// readSource splits one source's stream into frames and hands them to run.
+// The epochs of observation messages are kept as the source's correction
+// time; station and other messages only show that the source is alive.
+func (f *Failover) readSource(index int, s *failoverSource) {
+	defer f.wg.Done()
+
+	rtcmParser := parser.NewRTCMParser()
+	buffer := make([]byte, 4096)
+
+	for {
+		n, err := s.session.Read(buffer)
+		for _, message := range rtcmParser.Process(buffer[:n]) {
+			now := time.Now()
+			var epoch time.Time
+			if parser.IsMSM(message.MessageType) || parser.IsLegacyObservation(message.MessageType) {
+				if decoded, err := message.Decode(); err == nil {
+					epoch = decoded.(*parser.MSM).Time(now)
+				}
+			}
+
+			f.mutex.Lock()
+			wasHealthy := f.healthy(s, now)
+			s.lastFrame = now
+			if epoch.After(s.lastEpoch) {
+				s.lastEpoch = epoch
+			}
+			if !wasHealthy && f.healthy(s, now) {
+				s.healthySince = now
+			}
+			f.mutex.Unlock()
+
+			select {
+			case f.frames <- sourceFrame{index: index, frame: message.Frame}:
+			case <-f.ctx.Done():
+				return
+			}
+		}
+
+		if err != nil {
+			f.mutex.Lock()
+			s.ended = true
+			s.err = err
+			f.mutex.Unlock()
+			s.session.Close()
+			return
+		}
+	}
+}
+
+// run forwards frames from the active source and re-evaluates the choice
+// of source between frames
+func (f *Failover) run() {
+	defer close(f.done)
+	defer close(f.events)
+
+	// All sources ending closes the frames channel
+	sourcesDone := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(sourcesDone)
+	}()
+
+	interval := f.config.MaxSilence
+	if f.config.MaxCorrectionAge < interval {
+		interval = f.config.MaxCorrectionAge
+	}
+	ticker := time.NewTicker(interval / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.ctx.Done():
+			f.pipeWriter.CloseWithError(f.ctx.Err())
+			<-sourcesDone
+			return
+
+		case <-sourcesDone:
+			f.pipeWriter.CloseWithError(f.lastError())
+			return
+
+		case <-ticker.C:
+			f.selectSource()
+
+		case sf := <-f.frames:
+			if f.selectSource() != sf.index {
+				continue
+			}
+			if _, err := f.pipeWriter.Write(sf.frame); err != nil {
+				// The reader closed the stream
+				f.cancel()
+			}
+		}
+	}
+}
+
+// selectSource picks the source to forward and returns its index. The
+// active source is kept while it is healthy unless a preferred source has
+// been healthy for RecoveryPeriod; otherwise the first healthy source in
+// priority order takes over.
+func (f *Failover) selectSource() int {
+	now := time.Now()
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	next := -1
+	reason := ""
+	activeHealthy := f.active >= 0 && f.healthy(f.sources[f.active], now)
+
+	for i, s := range f.sources {
+		if !f.healthy(s, now) {
+			continue
+		}
+		if i == f.active {
+			next = i
+			break
+		}
+		if activeHealthy && i < f.active {
+			if now.Sub(s.healthySince) >= f.config.RecoveryPeriod {
+				next = i
+				reason = "preferred source recovered"
+				break
+			}
+			continue
+		}
+		if !activeHealthy {
+			next = i
+			if f.active < 0 {
+				reason = "source available"
+			} else {
+				reason = f.unhealthyReason(f.sources[f.active], now)
+			}
+			break
+		}
+	}
+
+	if next == -1 && f.active >= 0 {
+		reason = f.unhealthyReason(f.sources[f.active], now)
+	}
+
+	if next != f.active {
+		event := FailoverEvent{Time: now, From: f.active, To: next, Reason: reason}
+		if next >= 0 {
+			event.Source = f.sources[next].name
+		}
+		f.active = next
+		select {
+		case f.events <- event:
+		default:
+			// Channel is full, discard the event
+		}
+	}
+
+	return f.active
+}
+
+// healthy reports whether a source has sent a frame within MaxSilence and
+// observations no older than MaxCorrectionAge. The caller must hold the
+// mutex.
+func (f *Failover) healthy(s *failoverSource, now time.Time) bool {
+	return !s.ended &&
+		!s.lastFrame.IsZero() && now.Sub(s.lastFrame) <= f.config.MaxSilence &&
+		!s.lastEpoch.IsZero() && now.Sub(s.lastEpoch) <= f.config.MaxCorrectionAge
+}
+
+// unhealthyReason describes why a source is no longer healthy. The caller
+// must hold the mutex.
+func (f *Failover) unhealthyReason(s *failoverSource, now time.Time) string {
+	if s.ended {
+		return fmt.Sprintf("%s failed: %v", s.name, s.err)
+	}
+	if now.Sub(s.lastFrame) <= f.config.MaxSilence {
+		if s.lastEpoch.IsZero() {
+			return fmt.Sprintf("no observations from %s", s.name)
+		}
+		return fmt.Sprintf("observations from %s are %v old", s.name, now.Sub(s.lastEpoch).Round(time.Millisecond))
+	}
+	return fmt.Sprintf("no corrections from %s for %v", s.name, now.Sub(s.lastFrame).Round(time.Millisecond))
+}
+
+// lastError returns the error that ended the last source
+func (f *Failover) lastError() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for i := len(f.sources) - 1; i >= 0; i-- {
+		if err := f.sources[i].err; err != nil {
+			return fmt.Errorf("all correction sources failed: %w", err)
+		}
+	}
+	return errors.New("no correction sources")
+}
@@ -0,0 +1,274 @@
+package ntrip
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// observationFrame encodes an MSM4 frame of the GNSS with the given epoch
+func observationFrame(t *testing.T, system string, epoch time.Time) []byte {
+	gps := epoch.Add(parser.LeapSeconds * time.Second)
+	week := time.Date(gps.Year(), gps.Month(), gps.Day()-int(gps.Weekday()), 0, 0, 0, 0, time.UTC)
+	m := &parser.MSM{System: system, StationID: 7, Epoch: uint32(gps.Sub(week).Milliseconds()), Satellites: []parser.MSMSatellite{
+		{ID: 5, Signals: []parser.MSMSignal{{ID: 2, PseudoRange: 21e6, HasPseudoRange: true, CNR: 45}}},
+	}}
+	payload, err := parser.EncodeMSM(m, 4)
+	if err != nil {
+		t.Errorf("EncodeMSM failed: %v", err)
+		return nil
+	}
+	frame, err := parser.EncodeFrame(payload)
+	if err != nil {
+		t.Errorf("EncodeFrame failed: %v", err)
+	}
+	return frame
+}
+
+// currentObservations returns a frame source of MSM4 observations of the
+// GNSS at the current time
+func currentObservations(t *testing.T, system string) func() []byte {
+	return func() []byte { return observationFrame(t, system, time.Now()) }
+}
+
+// newSwitchableCaster starts a caster that streams the frames returned by
+// next every 10ms while enabled is true and stays connected but silent
+// otherwise. Each frame is written in two halves to exercise frame
+// reassembly.
+func newSwitchableCaster(t *testing.T, next func() []byte, enabled *atomic.Bool) *fakeCaster {
+	t.Helper()
+
+	return newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		if _, err := io.WriteString(conn, "ICY 200 OK\r\n"); err != nil {
+			return
+		}
+		for {
+			if enabled.Load() {
+				frame := next()
+				half := len(frame) / 2
+				if _, err := conn.Write(frame[:half]); err != nil {
+					return
+				}
+				time.Sleep(2 * time.Millisecond)
+				if _, err := conn.Write(frame[half:]); err != nil {
+					return
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func fastFailoverConfig() FailoverConfig {
+	return FailoverConfig{
+		Session:          fastSessionConfig(),
+		MaxSilence:       150 * time.Millisecond,
+		MaxCorrectionAge: 500 * time.Millisecond,
+		RecoveryPeriod:   200 * time.Millisecond,
+	}
+}
+
+func waitForSwitch(t *testing.T, f *Failover, to int) FailoverEvent {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case event, ok := <-f.Events():
+			if !ok {
+				t.Fatalf("Events closed while waiting for switch to %d", to)
+			}
+			if event.To == to {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for switch to %d", to)
+		}
+	}
+}
+
+func TestFailoverSwitchesAndRecovers(t *testing.T) {
+	var primaryOn, backupOn atomic.Bool
+	primaryOn.Store(true)
+	backupOn.Store(true)
+	primary := newSwitchableCaster(t, currentObservations(t, "GPS"), &primaryOn)
+	backup := newSwitchableCaster(t, currentObservations(t, "GAL"), &backupOn)
+
+	primaryClient := NewClient(primary.URL(), "", "", "PRIMARY")
+	primaryClient.Protocol = ProtocolRev1
+	backupClient := NewClient(backup.URL(), "", "", "BACKUP")
+	backupClient.Protocol = ProtocolRev1
+
+	f := NewFailover(context.Background(), []FailoverSource{
+		{Name: "primary", Client: primaryClient},
+		{Client: backupClient},
+	}, fastFailoverConfig())
+	defer f.Close()
+
+	// Collect the message types of everything forwarded
+	types := make(chan int, 1000)
+	readErr := make(chan error, 1)
+	go func() {
+		rtcmParser := parser.NewRTCMParser()
+		buffer := make([]byte, 1024)
+		pending := 0
+		for {
+			n, err := f.Read(buffer)
+			pending += n
+			for _, message := range rtcmParser.Process(buffer[:n]) {
+				pending -= len(message.Frame)
+				types <- message.MessageType
+			}
+			if err != nil {
+				if pending != 0 {
+					err = errors.New("stream ended inside a frame")
+				}
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	// Either source may deliver first; the primary must end up active
+	deadline := time.After(3 * time.Second)
+	for {
+		if index, name := f.Active(); index == 0 {
+			if name != "primary" {
+				t.Errorf("Expected active source name 'primary', got %q", name)
+			}
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("Primary never became active")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// Silence the primary: the backup takes over
+	drainEvents(f)
+	primaryOn.Store(false)
+	event := waitForSwitch(t, f, 1)
+	if event.From != 0 || event.Source != "BACKUP@"+backup.listener.Addr().String() {
+		t.Errorf("Unexpected switch event %+v", event)
+	}
+
+	// Once the switch is reported only backup frames may follow
+	drain(types)
+	time.Sleep(50 * time.Millisecond)
+	for len(types) > 0 {
+		if messageType := <-types; messageType != 1094 {
+			t.Errorf("Expected only backup frames after failover, got %d", messageType)
+		}
+	}
+
+	// The primary recovers and is preferred again after the recovery period
+	drainEvents(f)
+	primaryOn.Store(true)
+	start := time.Now()
+	event = waitForSwitch(t, f, 0)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Switched back after %v, before the recovery period", elapsed)
+	}
+	if event.From != 1 {
+		t.Errorf("Expected switch from backup, got %+v", event)
+	}
+
+	status := f.Status()
+	if len(status) != 2 || !status[0].Active || status[1].Active {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	f.Close()
+	if err := <-readErr; err != nil && !errors.Is(err, io.ErrClosedPipe) && !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected read error: %v", err)
+	}
+}
+
+func TestFailoverStaleCorrections(t *testing.T) {
+	tests := map[string]func() []byte{
+		"station only": func() []byte { return testFrame(1005, 19) },
+		"old epochs":   func() []byte { return observationFrame(t, "GPS", time.Now().Add(-time.Minute)) },
+	}
+
+	for name, stale := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The primary sends current observations until isStale is set
+			var isStale, on atomic.Bool
+			on.Store(true)
+			current := currentObservations(t, "GPS")
+			primary := newSwitchableCaster(t, func() []byte {
+				if isStale.Load() {
+					return stale()
+				}
+				return current()
+			}, &on)
+			backup := newSwitchableCaster(t, currentObservations(t, "GAL"), &on)
+
+			primaryClient := NewClient(primary.URL(), "", "", "PRIMARY")
+			primaryClient.Protocol = ProtocolRev1
+			backupClient := NewClient(backup.URL(), "", "", "BACKUP")
+			backupClient.Protocol = ProtocolRev1
+
+			f := NewFailover(context.Background(), []FailoverSource{
+				{Name: "primary", Client: primaryClient},
+				{Name: "backup", Client: backupClient},
+			}, fastFailoverConfig())
+			defer f.Close()
+			go io.Copy(io.Discard, f)
+
+			waitForSwitch(t, f, 0)
+			isStale.Store(true)
+			event := waitForSwitch(t, f, 1)
+			if event.From != 0 || !strings.HasPrefix(event.Reason, "observations from primary are") {
+				t.Errorf("Unexpected switch event %+v", event)
+			}
+
+			// The primary is still sending frames, but is not healthy
+			status := f.Status()
+			if status[0].Healthy || time.Since(status[0].LastFrame) > time.Second {
+				t.Errorf("Unexpected primary status %+v", status[0])
+			}
+		})
+	}
+}
+
+func TestFailoverAllSourcesFail(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 401 Unauthorized\r\n\r\n")
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+
+	f := NewFailover(context.Background(), []FailoverSource{{Client: client}}, fastFailoverConfig())
+	defer f.Close()
+
+	_, err := io.ReadAll(f)
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if index, _ := f.Active(); index != -1 {
+		t.Errorf("Expected no active source, got %d", index)
+	}
+}
+
+// drainEvents discards switch events reported so far
+func drainEvents(f *Failover) {
+	for len(f.events) > 0 {
+		<-f.events
+	}
+}
+
+// drain discards everything buffered in ch
+func drain(ch chan int) {
+	for len(ch) > 0 {
+		<-ch
+	}
+}
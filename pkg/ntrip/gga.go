@@ -0,0 +1,160 @@
+package ntrip
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+// DefaultGGAInterval is how often a GGA is uploaded when no interval is set
+const DefaultGGAInterval = 10 * time.Second
+
+// GGASource provides the NMEA GGA sentence uploaded to the caster. VRS and
+// network RTK mountpoints stay silent until they receive one.
+type GGASource interface {
+	// GGA returns a complete GGA sentence including checksum
+	GGA() (string, error)
+}
+
+// FormatGGA builds a GGA sentence with checksum for the position at time t.
+// Casters reject sentences reporting no fix, so a zero fix quality is sent
+// as a GPS fix and missing satellite count and HDOP get plausible values.
+func FormatGGA(pos *position.Position, t time.Time) string {
+	quality := pos.FixQuality
+	if quality == 0 {
+		quality = 1
+	}
+	satellites := pos.Satellites
+	if satellites == 0 {
+		satellites = 12
+	}
+	hdop := pos.HDOP
+	if hdop == 0 {
+		hdop = 1.0
+	}
+
+	t = t.UTC()
+	body := fmt.Sprintf("GPGGA,%02d%02d%02d.%02d,%s,%s,%d,%02d,%.1f,%.3f,M,0.0,M,,",
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/1e7,
+		formatNMEACoordinate(pos.Latitude, 2, "N", "S"),
+		formatNMEACoordinate(pos.Longitude, 3, "E", "W"),
+		quality, satellites, hdop, pos.Altitude)
+
+	return "$" + body + "*" + parser.NMEAChecksum(body)
+}
+
+// formatNMEACoordinate converts decimal degrees to the NMEA (D)DDMM.MMMMM
+// form followed by the hemisphere letter
+func formatNMEACoordinate(value float64, degreeDigits int, positive, negative string) string {
+	hemisphere := positive
+	if value < 0 {
+		hemisphere = negative
+		value = -value
+	}
+
+	degrees := math.Floor(value)
+	minutes := (value - degrees) * 60
+	// Avoid printing 60.00000 minutes after rounding
+	if math.Round(minutes*1e5) >= 60*1e5 {
+		degrees++
+		minutes = 0
+	}
+
+	return fmt.Sprintf("%0*d%08.5f,%s", degreeDigits, int(degrees), minutes, hemisphere)
+}
+
+// currentGGA returns the sentence to upload now, or "" if the client has
+// no GGA source or the source has nothing to report yet
+func (c *Client) currentGGA() string {
+	if c.GGASource == nil {
+		return ""
+	}
+	sentence, err := c.GGASource.GGA()
+	if err != nil {
+		return ""
+	}
+	return sentence
+}
+
+// ggaInterval returns the configured upload interval or the default
+func (c *Client) ggaInterval() time.Duration {
+	if c.GGAInterval > 0 {
+		return c.GGAInterval
+	}
+	return DefaultGGAInterval
+}
+
+// FixedGGA reports a fixed position, for example a surveyed site or the
+// approximate location of a rover without NMEA output
+type FixedGGA struct {
+	Position *position.Position
+}
+
+// GGA returns a GGA sentence for the fixed position at the current time
+func (f FixedGGA) GGA() (string, error) {
+	if f.Position == nil {
+		return "", fmt.Errorf("no position set")
+	}
+	return FormatGGA(f.Position, time.Now()), nil
+}
+
+// RoverGGA tracks the latest GGA from a live rover. Feed it every NMEA
+// sentence the rover outputs with Update.
+type RoverGGA struct {
+	mutex    sync.Mutex
+	parser   *parser.NMEAParser
+	sentence string
+	updated  time.Time
+	maxAge   time.Duration
+}
+
+// NewRoverGGA creates a rover GGA source. Sentences older than maxAge are
+// not uploaded; a zero maxAge disables the check.
+func NewRoverGGA(maxAge time.Duration) *RoverGGA {
+	return &RoverGGA{parser: parser.NewNMEAParser(), maxAge: maxAge}
+}
+
+// Update records a raw NMEA sentence such as
+// "$GNGGA,123519,4807.038,N,...*59" received from the rover. Other
+// sentence types, sentences with a wrong or missing checksum and GGAs
+// without a fix are ignored.
+func (r *RoverGGA) Update(sentence string) {
+	sentence = strings.TrimSpace(sentence)
+	parsed := r.parser.Parse(sentence)
+	if !parsed.Valid || !strings.HasSuffix(parsed.Type, "GGA") || len(parsed.Fields) < 6 {
+		return
+	}
+	if parsed.Fields[5] == "" || parsed.Fields[5] == "0" {
+		return
+	}
+	// String recomputes the checksum, so it only matches a sentence whose
+	// checksum is correct
+	if !strings.EqualFold(parsed.String(), sentence) {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sentence = parsed.String()
+	r.updated = time.Now()
+}
+
+// GGA returns the latest rover GGA sentence
+func (r *RoverGGA) GGA() (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.sentence == "" {
+		return "", fmt.Errorf("no GGA received from rover")
+	}
+	if r.maxAge > 0 && time.Since(r.updated) > r.maxAge {
+		return "", fmt.Errorf("rover GGA is %v old", time.Since(r.updated).Round(time.Second))
+	}
+
+	return r.sentence, nil
+}
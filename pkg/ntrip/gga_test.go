@@ -0,0 +1,152 @@
+package ntrip
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+func TestFormatGGA(t *testing.T) {
+	pos := &position.Position{
+		Latitude:   48.1173,
+		Longitude:  -11.516666,
+		Altitude:   545.4,
+		FixQuality: 4,
+		Satellites: 8,
+		HDOP:       0.9,
+	}
+	ts := time.Date(2024, 5, 14, 12, 35, 19, 500000000, time.UTC)
+
+	gga := FormatGGA(pos, ts)
+
+	expected := "$GPGGA,123519.50,4807.03800,N,01130.99996,W,4,08,0.9,545.400,M,0.0,M,,*"
+	if !strings.HasPrefix(gga, expected) {
+		t.Errorf("Expected GGA starting with %s, got %s", expected, gga)
+	}
+
+	// The checksum must match the body
+	sentence := parser.NewNMEAParser().Parse(gga)
+	if !sentence.Valid || sentence.Checksum != parser.NMEAChecksum(gga) {
+		t.Errorf("Invalid checksum in %s", gga)
+	}
+
+	// The generated sentence must round-trip through the GGA extractor
+	extracted, err := position.ExtractFromGGA(sentence)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if extracted.Latitude < 48.1172 || extracted.Latitude > 48.1174 {
+		t.Errorf("Expected latitude 48.1173, got %f", extracted.Latitude)
+	}
+	if extracted.Longitude > -11.5166 || extracted.Longitude < -11.5167 {
+		t.Errorf("Expected longitude -11.516666, got %f", extracted.Longitude)
+	}
+}
+
+func TestFormatGGADefaults(t *testing.T) {
+	// A position without fix information still produces a usable GGA
+	gga := FormatGGA(&position.Position{Latitude: -36.85, Longitude: 174.76}, time.Now())
+
+	fields := strings.Split(gga, ",")
+	if fields[2] != "3651.00000" || fields[3] != "S" || fields[5] != "E" {
+		t.Errorf("Unexpected coordinates in %s", gga)
+	}
+	if fields[6] != "1" || fields[7] != "12" || fields[8] != "1.0" {
+		t.Errorf("Expected default quality, satellites and HDOP, got %s", gga)
+	}
+}
+
+func TestFormatNMEACoordinateRounding(t *testing.T) {
+	// 0.9999999999 degrees must not print as 0 degrees 60 minutes
+	if got := formatNMEACoordinate(10.9999999999, 2, "N", "S"); got != "1100.00000,N" {
+		t.Errorf("Expected 1100.00000,N, got %s", got)
+	}
+}
+
+func TestRoverGGA(t *testing.T) {
+	rover := NewRoverGGA(time.Minute)
+
+	if _, err := rover.GGA(); err == nil {
+		t.Error("Expected error before any GGA is received")
+	}
+
+	// Sentences without a fix, with a bad checksum and other types are ignored
+	rover.Update("$GNGGA,123519,,,,,0,00,99.9,,,,,,*5B")
+	rover.Update("$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*58")
+	rover.Update("$GNRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A")
+	if _, err := rover.GGA(); err == nil {
+		t.Error("Expected error when only invalid sentences were received")
+	}
+
+	rover.Update("$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*59\r\n")
+	gga, err := rover.GGA()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gga != "$GNGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*59" {
+		t.Errorf("Unexpected GGA %s", gga)
+	}
+
+	// Stale sentences are not uploaded
+	rover.maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if _, err := rover.GGA(); err == nil {
+		t.Error("Expected error for stale GGA")
+	}
+}
+
+func TestConnectUploadsGGA(t *testing.T) {
+	lines := make(chan string, 10)
+	headers := make(chan string, 1)
+
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		headers <- req.Header.Get("Ntrip-GGA")
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		for {
+			line, err := req.Reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			lines <- strings.TrimSpace(line)
+		}
+	})
+
+	pos := &position.Position{Latitude: 51.5, Longitude: -0.1, Altitude: 50}
+	client := NewClient(fc.URL(), "", "", "VRS")
+	client.GGASource = FixedGGA{Position: pos}
+	client.GGAInterval = 50 * time.Millisecond
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	if _, ok := stream.(io.Writer); !ok {
+		t.Error("Expected stream to be writable")
+	}
+
+	// With a GGA source the client uses the raw NTRIP 2.0 request so it
+	// can keep uploading, and includes the position in the request
+	if h := <-headers; !strings.HasPrefix(h, "$GPGGA,") {
+		t.Errorf("Expected Ntrip-GGA header, got %q", h)
+	}
+
+	// One GGA immediately and then one per interval
+	for i := 0; i < 3; i++ {
+		select {
+		case line := <-lines:
+			if !strings.HasPrefix(line, "$GPGGA,") {
+				t.Errorf("Expected GGA upload, got %q", line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected GGA upload %d", i+1)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package ntrip
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+// Position is a rover or site position, used for mountpoint selection and
+// GGA upload. It is an alias so that importers outside this module can
+// construct one.
+type Position = position.Position
+
+// MountFilter selects mountpoints from a sourcetable. Zero-valued fields
+// do not restrict the result.
+type MountFilter struct {
+	Format         string   // Format prefix, e.g. "RTCM 3" matches RTCM 3.x (case-insensitive)
+	NavSystems     []string // Navigation systems that must all be present, e.g. GPS, GLO
+	MinCarrier     int      // Minimum carrier phase type (0=none, 1=L1, 2=L1+L2)
+	ExcludeFee     bool     // Drop mountpoints that charge a fee
+	Authentication string   // Required authentication (N, B or D)
+	RequireNMEA    bool     // Only mountpoints that expect a GGA from the client
+	ExcludeNMEA    bool     // Only mountpoints that stream without a GGA
+}
+
+// MountDistance is a mountpoint together with its distance from a position
+type MountDistance struct {
+	MountPoint
+	Distance float64 // Great-circle distance in kilometres
+}
+
+// Match reports whether the mountpoint satisfies the filter
+func (f MountFilter) Match(m MountPoint) bool {
+	if f.Format != "" && !strings.HasPrefix(normalizeFormat(m.Format), normalizeFormat(f.Format)) {
+		return false
+	}
+
+	if len(f.NavSystems) > 0 {
+		systems := navSystems(m.NavSystem)
+		for _, want := range f.NavSystems {
+			if !systems[canonicalNavSystem(want)] {
+				return false
+			}
+		}
+	}
+
+	if m.Carrier < f.MinCarrier {
+		return false
+	}
+
+	if f.ExcludeFee && m.Fee {
+		return false
+	}
+
+	if f.Authentication != "" && !strings.EqualFold(m.Authentication, f.Authentication) {
+		return false
+	}
+
+	if f.RequireNMEA && !m.NMEA {
+		return false
+	}
+
+	if f.ExcludeNMEA && m.NMEA {
+		return false
+	}
+
+	return true
+}
+
+// Filter returns the mountpoints that satisfy the filter, in sourcetable order
+func (s *Sourcetable) Filter(f MountFilter) []MountPoint {
+	var mounts []MountPoint
+	for _, m := range s.Mounts {
+		if f.Match(m) {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// Find returns the mountpoint with the given name, or nil if it is not listed
+func (s *Sourcetable) Find(name string) *MountPoint {
+	for i := range s.Mounts {
+		if s.Mounts[i].Name == name {
+			return &s.Mounts[i]
+		}
+	}
+	return nil
+}
+
+// Nearest returns the mountpoints that satisfy the filter ordered by
+// great-circle distance from pos. Mountpoints without coordinates are
+// skipped since they cannot be ranked.
+func (s *Sourcetable) Nearest(pos *position.Position, f MountFilter) []MountDistance {
+	var result []MountDistance
+	for _, m := range s.Filter(f) {
+		if m.Latitude == 0 && m.Longitude == 0 {
+			continue
+		}
+		result = append(result, MountDistance{
+			MountPoint: m,
+			Distance:   position.DistanceKm(pos.Latitude, pos.Longitude, m.Latitude, m.Longitude),
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Distance < result[j].Distance
+	})
+
+	return result
+}
+
+// NearestMount fetches the sourcetable and returns the closest mountpoint
+// that satisfies the filter
+func (c *Client) NearestMount(ctx context.Context, pos *position.Position, f MountFilter) (*MountDistance, error) {
+	sourcetable, err := c.GetSourcetable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := sourcetable.Nearest(pos, f)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no suitable mountpoint found in sourcetable")
+	}
+
+	return &candidates[0], nil
+}
+
+// normalizeFormat upper-cases a format string and drops spaces so that
+// "RTCM 3.2", "RTCM3.2" and "rtcm 3" compare consistently
+func normalizeFormat(format string) string {
+	return strings.ToUpper(strings.ReplaceAll(format, " ", ""))
+}
+
+// navSystems splits a sourcetable nav-system field into a set
+func navSystems(field string) map[string]bool {
+	systems := make(map[string]bool)
+	for _, s := range strings.FieldsFunc(field, func(r rune) bool {
+		return r == '+' || r == ',' || r == ' '
+	}) {
+		systems[canonicalNavSystem(s)] = true
+	}
+	return systems
+}
+
+// canonicalNavSystem maps the spellings casters use for a constellation
+// onto the short sourcetable form
+func canonicalNavSystem(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	switch name {
+	case "GLONASS":
+		return "GLO"
+	case "GALILEO":
+		return "GAL"
+	case "BEIDOU", "BDS", "BEI", "CMP":
+		return "BDS"
+	case "QZSS", "QZS":
+		return "QZS"
+	}
+	return name
+}
@@ -0,0 +1,103 @@
+package ntrip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bramburn/go_ntrip/internal/position"
+)
+
+func TestMountFilter(t *testing.T) {
+	st := loadSourcetable(t, "bkg.txt")
+	st.Mounts = append(st.Mounts, loadSourcetable(t, "emlid.txt").Mounts...)
+
+	tests := []struct {
+		name   string
+		filter MountFilter
+		want   []string
+	}{
+		{"no filter", MountFilter{}, []string{"BRUX00BEL0", "WTZR00DEU0", "REACH", "VRS_RTCM32"}},
+		{"format", MountFilter{Format: "RTCM 3.3"}, []string{"BRUX00BEL0", "WTZR00DEU0"}},
+		{"format without space", MountFilter{Format: "rtcm3"}, []string{"BRUX00BEL0", "WTZR00DEU0", "REACH", "VRS_RTCM32"}},
+		{"nav systems", MountFilter{NavSystems: []string{"Galileo", "BDS"}}, []string{"BRUX00BEL0", "WTZR00DEU0", "REACH"}},
+		{"no fee", MountFilter{ExcludeFee: true}, []string{"BRUX00BEL0", "WTZR00DEU0", "REACH"}},
+		{"authentication", MountFilter{Authentication: "n"}, []string{"REACH"}},
+		{"requires NMEA", MountFilter{RequireNMEA: true}, []string{"VRS_RTCM32"}},
+		{"excludes NMEA", MountFilter{ExcludeNMEA: true}, []string{"BRUX00BEL0", "WTZR00DEU0", "REACH"}},
+		{"carrier", MountFilter{MinCarrier: 3}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := st.Filter(tt.filter)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d mounts, got %d", len(tt.want), len(got))
+			}
+			for i, m := range got {
+				if m.Name != tt.want[i] {
+					t.Errorf("Expected mount %s at %d, got %s", tt.want[i], i, m.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestSourcetableNearest(t *testing.T) {
+	st := loadSourcetable(t, "snip.txt")
+	st.Mounts = append(st.Mounts, loadSourcetable(t, "bkg.txt").Mounts...)
+
+	// A rover in Antwerp should be closest to Brussels, then Oosterhout
+	rover := &position.Position{Latitude: 51.22, Longitude: 4.40}
+	nearest := st.Nearest(rover, MountFilter{Format: "RTCM 3"})
+
+	if len(nearest) != 4 {
+		t.Fatalf("Expected 4 ranked mounts (mounts without coordinates skipped), got %d", len(nearest))
+	}
+	if nearest[0].Name != "BRUX00BEL0" {
+		t.Errorf("Expected BRUX00BEL0 first, got %s", nearest[0].Name)
+	}
+	if nearest[1].Name != "Rover-Ref" {
+		t.Errorf("Expected Rover-Ref second, got %s", nearest[1].Name)
+	}
+	if nearest[0].Distance < 40 || nearest[0].Distance > 50 {
+		t.Errorf("Expected distance to Brussels around 47 km, got %f", nearest[0].Distance)
+	}
+	for i := 1; i < len(nearest); i++ {
+		if nearest[i].Distance < nearest[i-1].Distance {
+			t.Errorf("Mounts not sorted by distance at %d", i)
+		}
+	}
+}
+
+func TestNearestMount(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "bkg.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read sourcetable: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "gnss/sourcetable")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", "", "")
+	rover := &position.Position{Latitude: 48.5, Longitude: 12.0}
+
+	mount, err := client.NearestMount(context.Background(), rover, MountFilter{Format: "RTCM 3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mount.Name != "WTZR00DEU0" {
+		t.Errorf("Expected WTZR00DEU0, got %s", mount.Name)
+	}
+
+	_, err = client.NearestMount(context.Background(), rover, MountFilter{Format: "CMR"})
+	if err == nil {
+		t.Error("Expected error when no mount matches")
+	}
+}
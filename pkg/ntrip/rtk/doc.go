@@ -0,0 +1,59 @@
+/*
+Package rtk connects physical GNSS receivers and computes RTK (Real-Time Kinematic) positions from
+their observations and the corrections of an NTRIP mountpoint. It is built on the gnssgo package,
+which provides the core GNSS processing functionality.
+
+## GNSS Receiver
+
+The GNSSReceiver type provides an interface for connecting to physical GNSS receivers via serial ports
+and reading raw GNSS data. It handles the details of establishing and maintaining the connection and data streaming.
+
+Example usage:
+
+	// Create a new GNSS receiver
+	receiver, err := rtk.NewGNSSReceiver("COM1:9600:8:N:1")
+	if err != nil {
+	    log.Fatalf("Failed to connect to GNSS receiver: %v", err)
+	}
+	defer receiver.Close()
+
+	// Read GNSS data
+	buffer := make([]byte, 1024)
+	n, err := receiver.Read(buffer)
+	if err != nil {
+	    log.Fatalf("Failed to read GNSS data: %v", err)
+	}
+
+	// Process the GNSS data
+	processGNSS(buffer[:n])
+
+## RTK Processor
+
+The RTKProcessor type provides functionality for processing GNSS data using RTK techniques.
+It combines data from a GNSS receiver (rover) and NTRIP client (base station) to calculate precise positions.
+
+Example usage:
+
+	// Create a new RTK processor
+	processor, err := rtk.NewRTKProcessor(receiver, client)
+	if err != nil {
+	    log.Fatalf("Failed to create RTK processor: %v", err)
+	}
+
+	// Start RTK processing
+	err = processor.Start()
+	if err != nil {
+	    log.Fatalf("Failed to start RTK processing: %v", err)
+	}
+	defer processor.Stop()
+
+	// Get RTK statistics
+	stats := processor.GetStats()
+	fmt.Printf("Rover observations: %d\n", stats.RoverObs)
+	fmt.Printf("Base observations: %d\n", stats.BaseObs)
+	fmt.Printf("Solutions: %d\n", stats.Solutions)
+	fmt.Printf("Fix ratio: %.2f%%\n", stats.FixRatio*100)
+
+The processor opens its own connection to the client's mountpoint through gnssgo.
+*/
+package rtk
@@ -1,4 +1,4 @@
-package ntrip
+package rtk
 
 import (
 	"errors"
@@ -1,11 +1,14 @@
-package ntrip
+package rtk
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"sync"
 	"time"
 
 	"github.com/bramburn/gnssgo/pkg/gnssgo"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 )
 
 // RTKStats contains statistics about the RTK processing
@@ -27,7 +30,7 @@ type RTKSolution struct {
 // RTKProcessor processes GNSS data using RTK
 type RTKProcessor struct {
 	receiver  *GNSSReceiver
-	client    *Client
+	client    *ntrip.Client
 	svr       gnssgo.RtkSvr
 	mutex     sync.Mutex
 	running   bool
@@ -36,7 +39,7 @@ type RTKProcessor struct {
 }
 
 // NewRTKProcessor creates a new RTK processor
-func NewRTKProcessor(receiver *GNSSReceiver, client *Client) (*RTKProcessor, error) {
+func NewRTKProcessor(receiver *GNSSReceiver, client *ntrip.Client) (*RTKProcessor, error) {
 	if receiver == nil {
 		return nil, fmt.Errorf("receiver is nil")
 	}
@@ -90,14 +93,14 @@ func (p *RTKProcessor) Start() error {
 
 	// Configure stream paths
 	paths := []string{
-		p.receiver.port, // Rover input (physical GNSS receiver)
-		fmt.Sprintf("%s:%s@%s:%s/%s", p.client.username, p.client.password, p.client.server, p.client.port, p.client.mountpoint), // Base station input (NTRIP)
-		"",                 // Ephemeris input
-		"rtk_solution.pos", // Solution 1 output
-		"",                 // Solution 2 output
-		"",                 // Log rover
-		"",                 // Log base station
-		"",                 // Log ephemeris
+		p.receiver.port,      // Rover input (physical GNSS receiver)
+		streamPath(p.client), // Base station input (NTRIP)
+		"",                   // Ephemeris input
+		"rtk_solution.pos",   // Solution 1 output
+		"",                   // Solution 2 output
+		"",                   // Log rover
+		"",                   // Log base station
+		"",                   // Log ephemeris
 	}
 
 	// Configure stream formats
@@ -255,3 +258,16 @@ func (p *RTKProcessor) GetSolution() RTKSolution {
 
 	return sol
 }
+
+// streamPath returns the client's mountpoint in the user:pass@host:port/mount
+// form used by gnssgo NTRIP streams
+func streamPath(c *ntrip.Client) string {
+	host := c.URL
+	if u, err := url.Parse(c.URL); err == nil && u.Host != "" {
+		host = u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "2101")
+		}
+	}
+	return fmt.Sprintf("%s:%s@%s/%s", c.Username, c.Password, host, c.Mountpoint)
+}
@@ -1,9 +1,10 @@
-package ntrip
+package rtk
 
 import (
 	"testing"
 
 	"github.com/bramburn/gnssgo/pkg/gnssgo"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -52,7 +53,7 @@ func (m *MockRtkSvr) RtkSvrGetStat(stat *gnssgo.RtkSvrStat) {
 func TestNewRTKProcessor(t *testing.T) {
 	// Create mock receiver and client
 	receiver := &GNSSReceiver{port: "COM1:9600:8:N:1", open: true}
-	client := &Client{server: "example.com", port: "2101", username: "user", password: "pass", mountpoint: "MOUNT", connected: true}
+	client := ntrip.NewClient("http://example.com:2101", "user", "pass", "MOUNT")
 	
 	// Test with valid parameters
 	processor, err := NewRTKProcessor(receiver, client)
@@ -79,14 +80,7 @@ func TestNewRTKProcessor(t *testing.T) {
 func TestRTKProcessorStart(t *testing.T) {
 	// Create mock receiver and client
 	receiver := &GNSSReceiver{port: "COM1:9600:8:N:1", open: true}
-	client := &Client{
-		server: "example.com", 
-		port: "2101", 
-		username: "user", 
-		password: "pass", 
-		mountpoint: "MOUNT", 
-		connected: true,
-	}
+	client := ntrip.NewClient("http://example.com:2101", "user", "pass", "MOUNT")
 	
 	// Create processor with mock RTK server
 	processor := &RTKProcessor{
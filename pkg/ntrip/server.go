@@ -0,0 +1,203 @@
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serverAgent identifies this program to casters when acting as a source
+const serverAgent = "NTRIP go_ntrip/server"
+
+// Server publishes RTCM corrections to a caster mountpoint. It is the
+// NTRIP "server" role: a base station that sends data to the caster
+// rather than a rover that receives it.
+type Server struct {
+	URL        string
+	Username   string // Only sent with NTRIP 2.0; NTRIP 1.0 sources authenticate with the password alone
+	Password   string
+	Mountpoint string
+
+	// Protocol selects the request: ProtocolRev1 sends "SOURCE pass /mount",
+	// every other value sends an NTRIP 2.0 POST with chunked encoding
+	Protocol Protocol
+
+	// TLSConfig and Proxy are used as by Client
+	TLSConfig *tls.Config
+	Proxy     string
+}
+
+// NewServer creates a new NTRIP server for the given caster mountpoint
+func NewServer(url, username, password, mountpoint string) *Server {
+	return &Server{
+		URL:        url,
+		Username:   username,
+		Password:   password,
+		Mountpoint: mountpoint,
+	}
+}
+
+// Connect opens the mountpoint on the caster and returns a writer for the
+// RTCM data. It is equivalent to ConnectContext with a background context.
+func (s *Server) Connect() (io.WriteCloser, error) {
+	return s.ConnectContext(context.Background())
+}
+
+// ConnectContext opens the mountpoint on the caster and returns a writer
+// for the RTCM data. The context bounds the connection attempt and, once
+// connected, cancelling it closes the connection.
+func (s *Server) ConnectContext(ctx context.Context) (io.WriteCloser, error) {
+	if s.Mountpoint == "" {
+		return nil, fmt.Errorf("mountpoint is required")
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	// The client's dialer handles TLS and proxies
+	dialer := &Client{TLSConfig: s.TLSConfig, Proxy: s.Proxy}
+	conn, err := dialer.dialCaster(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to NTRIP caster: %v", err)
+	}
+
+	// Abort the handshake if the context is cancelled or the deadline passes
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, s.buildRequest(u)); err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("error sending request: %v", contextError(ctx, err))
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := readSourceResponse(reader); err != nil {
+		stop()
+		conn.Close()
+		return nil, contextError(ctx, err)
+	}
+
+	if !stop() {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to NTRIP caster: %v", ctx.Err())
+	}
+	conn.SetDeadline(time.Time{})
+
+	sc := &serverConn{conn: conn, writer: conn}
+	if s.Protocol != ProtocolRev1 {
+		sc.chunked = httputil.NewChunkedWriter(conn)
+		sc.writer = sc.chunked
+	}
+	sc.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	go sc.watch(reader)
+
+	return sc, nil
+}
+
+// buildRequest builds the request text for the configured protocol
+func (s *Server) buildRequest(u *url.URL) string {
+	path := "/" + strings.TrimPrefix(s.Mountpoint, "/")
+
+	var sb strings.Builder
+	if s.Protocol == ProtocolRev1 {
+		fmt.Fprintf(&sb, "SOURCE %s %s\r\n", s.Password, path)
+		fmt.Fprintf(&sb, "Source-Agent: %s\r\n", serverAgent)
+		sb.WriteString("\r\n")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "POST %s HTTP/1.1\r\n", path)
+	fmt.Fprintf(&sb, "Host: %s\r\n", u.Host)
+	sb.WriteString("Ntrip-Version: Ntrip/2.0\r\n")
+	fmt.Fprintf(&sb, "User-Agent: %s\r\n", serverAgent)
+	if s.Username != "" || s.Password != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(s.Username + ":" + s.Password))
+		fmt.Fprintf(&sb, "Authorization: Basic %s\r\n", credentials)
+	}
+	sb.WriteString("Content-Type: gnss/data\r\n")
+	sb.WriteString("Transfer-Encoding: chunked\r\n")
+	sb.WriteString("Connection: close\r\n")
+	sb.WriteString("\r\n")
+
+	return sb.String()
+}
+
+// readSourceResponse reads the caster's reply to a SOURCE or POST request.
+// NTRIP 1.0 casters reject a source with a plain "ERROR - ..." line rather
+// than a status code.
+func readSourceResponse(reader *bufio.Reader) error {
+	if peek, err := reader.Peek(5); err == nil && string(peek) == "ERROR" {
+		line, _ := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if strings.Contains(strings.ToLower(line), "password") {
+			return fmt.Errorf("caster rejected source: %s: %w", line, ErrUnauthorized)
+		}
+		return fmt.Errorf("caster rejected source: %s", line)
+	}
+
+	resp, err := readRawResponse(reader)
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
+
+// serverConn is an open source connection. NTRIP 2.0 data is sent with
+// chunked transfer encoding.
+type serverConn struct {
+	conn      net.Conn
+	writer    io.Writer
+	chunked   io.WriteCloser
+	stop      func() bool
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+// Write sends RTCM data to the caster
+func (s *serverConn) Write(p []byte) (int, error) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.writer.Write(p)
+}
+
+// Close ends the upload and closes the connection
+func (s *serverConn) Close() error {
+	s.closeOnce.Do(func() {
+		s.stop()
+		if s.chunked != nil {
+			// Terminate the chunked body so the caster sees a clean end
+			s.writeLock.Lock()
+			s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			if s.chunked.Close() == nil {
+				io.WriteString(s.conn, "\r\n")
+			}
+			s.writeLock.Unlock()
+		}
+	})
+	return s.conn.Close()
+}
+
+// watch discards anything the caster sends and closes the connection when
+// the caster hangs up, so that the next write fails instead of
+// disappearing into a half-closed socket
+func (s *serverConn) watch(reader *bufio.Reader) {
+	io.Copy(io.Discard, reader)
+	s.conn.Close()
+}
@@ -0,0 +1,250 @@
+package ntrip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http/httputil"
+	"testing"
+	"time"
+)
+
+func TestServerConnectRev1(t *testing.T) {
+	received := make(chan []byte, 1)
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		data, _ := io.ReadAll(req.Reader)
+		received <- data
+	})
+
+	server := NewServer(fc.URL(), "", "secret", "BASE")
+	server.Protocol = ProtocolRev1
+
+	conn, err := server.Connect()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req := fc.lastRequest(t)
+	if req.RequestLine != "SOURCE secret /BASE" {
+		t.Errorf("Unexpected request line %q", req.RequestLine)
+	}
+	if req.Header.Get("Source-Agent") != serverAgent {
+		t.Errorf("Unexpected Source-Agent %q", req.Header.Get("Source-Agent"))
+	}
+
+	frame := testFrame(1005, 19)
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	conn.Close()
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, frame) {
+			t.Errorf("Caster received %x, want %x", data, frame)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Caster received no data")
+	}
+}
+
+func TestServerConnectRev2Chunked(t *testing.T) {
+	received := make(chan []byte, 1)
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nNtrip-Version: Ntrip/2.0\r\n\r\n")
+		data, _ := io.ReadAll(httputil.NewChunkedReader(req.Reader))
+		received <- data
+	})
+
+	server := NewServer(fc.URL(), "base", "secret", "BASE")
+
+	conn, err := server.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	req := fc.lastRequest(t)
+	if req.RequestLine != "POST /BASE HTTP/1.1" {
+		t.Errorf("Unexpected request line %q", req.RequestLine)
+	}
+	if req.Header.Get("Ntrip-Version") != "Ntrip/2.0" {
+		t.Errorf("Expected Ntrip-Version header, got %q", req.Header.Get("Ntrip-Version"))
+	}
+	if req.Header.Get("Authorization") == "" {
+		t.Error("Expected Authorization header")
+	}
+	if req.Header.Get("Transfer-Encoding") != "chunked" {
+		t.Errorf("Expected chunked encoding, got %q", req.Header.Get("Transfer-Encoding"))
+	}
+
+	frames := append(testFrame(1005, 19), testFrame(1077, 40)...)
+	conn.Write(frames[:22])
+	conn.Write(frames[22:])
+	conn.Close()
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, frames) {
+			t.Errorf("Caster received %x, want %x", data, frames)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Caster did not see the end of the chunked body")
+	}
+}
+
+func TestServerConnectBadPassword(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ERROR - Bad Password\r\n")
+	})
+
+	server := NewServer(fc.URL(), "", "wrong", "BASE")
+	server.Protocol = ProtocolRev1
+
+	_, err := server.Connect()
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestServerConnectStatusError(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 409 Conflict\r\n\r\n")
+	})
+
+	server := NewServer(fc.URL(), "base", "secret", "BASE")
+
+	_, err := server.Connect()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != 409 {
+		t.Fatalf("Expected 409 StatusError, got %v", err)
+	}
+}
+
+func TestUploadReconnectsAndForwardsFrames(t *testing.T) {
+	received := make(chan []byte, 16)
+	connections := make(chan struct{}, 4)
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		connections <- struct{}{}
+		if len(connections) == 1 {
+			// Drop the first connection straight away
+			return
+		}
+		buffer := make([]byte, 1024)
+		for {
+			n, err := req.Reader.Read(buffer)
+			if n > 0 {
+				received <- append([]byte(nil), buffer[:n]...)
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+
+	server := NewServer(fc.URL(), "", "secret", "BASE")
+	server.Protocol = ProtocolRev1
+
+	sourceReader, sourceWriter := io.Pipe()
+	defer sourceWriter.Close()
+
+	upload := NewUpload(context.Background(), server, sourceReader, UploadConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+		RateWindow:     50 * time.Millisecond,
+	})
+	defer upload.Close()
+
+	// Keep producing frames interleaved with NMEA until the caster has
+	// received some over the second connection
+	frame := testFrame(1077, 40)
+	go func() {
+		for {
+			if _, err := sourceWriter.Write([]byte("$GNGGA,dummy*00\r\n")); err != nil {
+				return
+			}
+			if _, err := sourceWriter.Write(frame); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	var data []byte
+	deadline := time.After(3 * time.Second)
+	for len(data) < 3*len(frame) {
+		select {
+		case chunk := <-received:
+			data = append(data, chunk...)
+		case <-deadline:
+			t.Fatalf("Caster received only %d bytes", len(data))
+		}
+	}
+
+	if !bytes.HasPrefix(data, frame) {
+		t.Errorf("Upload should forward whole RTCM frames only, got %q", data[:len(frame)])
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	stats := upload.Stats()
+	if stats.Reconnects < 1 {
+		t.Errorf("Expected at least 1 reconnect, got %d", stats.Reconnects)
+	}
+	if stats.Frames < 3 {
+		t.Errorf("Expected at least 3 frames sent, got %d", stats.Frames)
+	}
+	if stats.Rate <= 0 {
+		t.Errorf("Expected a positive upload rate, got %f", stats.Rate)
+	}
+}
+
+func TestUploadStopsOnBadPassword(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ERROR - Bad Password\r\n")
+	})
+
+	server := NewServer(fc.URL(), "", "wrong", "BASE")
+	server.Protocol = ProtocolRev1
+
+	sourceReader, sourceWriter := io.Pipe()
+	defer sourceWriter.Close()
+
+	upload := NewUpload(context.Background(), server, sourceReader, DefaultUploadConfig())
+	defer upload.Close()
+
+	select {
+	case <-upload.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Upload did not stop")
+	}
+
+	if !errors.Is(upload.Err(), ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", upload.Err())
+	}
+}
+
+func TestUploadStopsWhenSourceEnds(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		io.Copy(io.Discard, req.Reader)
+	})
+
+	server := NewServer(fc.URL(), "", "secret", "BASE")
+	server.Protocol = ProtocolRev1
+
+	upload := NewUpload(context.Background(), server, bytes.NewReader(testFrame(1005, 19)), DefaultUploadConfig())
+	defer upload.Close()
+
+	select {
+	case <-upload.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Upload did not stop at the end of the source")
+	}
+
+	if upload.Err() == nil {
+		t.Error("Expected an error once the source ended")
+	}
+}
@@ -0,0 +1,384 @@
+package ntrip
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Session defaults
+const (
+	DefaultInitialBackoff = 1 * time.Second
+	DefaultMaxBackoff     = 60 * time.Second
+	DefaultStallTimeout   = 30 * time.Second
+)
+
+// SessionConfig holds configuration for a resilient session
+type SessionConfig struct {
+	InitialBackoff time.Duration // Delay before the first reconnect attempt
+	MaxBackoff     time.Duration // Upper bound for the reconnect delay
+	StallTimeout   time.Duration // Reconnect when no RTCM frame arrives for this long (negative disables)
+}
+
+// DefaultSessionConfig returns a default session configuration
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		StallTimeout:   DefaultStallTimeout,
+	}
+}
+
+// SessionEventType identifies a connection event
+type SessionEventType int
+
+// Session event types
+const (
+	EventConnected    SessionEventType = iota // Stream opened
+	EventDisconnected                         // Stream ended or failed
+	EventStalled                              // No RTCM frame within the stall timeout
+	EventReconnecting                         // Waiting before the next attempt
+	EventFailed                               // Permanent error, the session has stopped
+)
+
+// String returns the name of the event type
+func (t SessionEventType) String() string {
+	switch t {
+	case EventConnected:
+		return "connected"
+	case EventDisconnected:
+		return "disconnected"
+	case EventStalled:
+		return "stalled"
+	case EventReconnecting:
+		return "reconnecting"
+	case EventFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// SessionEvent reports a change in the session's connection state
+type SessionEvent struct {
+	Type    SessionEventType
+	Time    time.Time
+	Attempt int           // Consecutive failed attempts so far
+	Delay   time.Duration // Backoff delay (EventReconnecting only)
+	Err     error         // Cause of the event, if any
+}
+
+// SessionStats holds counters for a session
+type SessionStats struct {
+	Connected  bool
+	Reconnects int
+	Bytes      int64
+	Frames     int64
+	Downtime   time.Duration
+	LastFrame  time.Time
+}
+
+// Session is a long-lived NTRIP stream that reconnects with exponential
+// backoff and jitter and detects stalled streams. To callers it looks like
+// a single io.Reader; reads only fail once the session is closed, its
+// context is done, or the caster returns a permanent error such as
+// ErrUnauthorized.
+type Session struct {
+	client *Client
+	config SessionConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	pipeReader *io.PipeReader
+	pipeWriter *io.PipeWriter
+	events     chan SessionEvent
+
+	mutex     sync.Mutex
+	stats     SessionStats
+	downSince time.Time
+	done      chan struct{}
+}
+
+// NewSession creates a session for the client and starts connecting. The
+// session runs until ctx is done or Close is called.
+func NewSession(ctx context.Context, client *Client, config SessionConfig) *Session {
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.StallTimeout == 0 {
+		config.StallTimeout = DefaultStallTimeout
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+
+	s := &Session{
+		client:     client,
+		config:     config,
+		ctx:        ctx,
+		cancel:     cancel,
+		pipeReader: pr,
+		pipeWriter: pw,
+		events:     make(chan SessionEvent, 32),
+		downSince:  time.Now(),
+		done:       make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Read reads RTCM data from the current connection, waiting across reconnects
+func (s *Session) Read(p []byte) (int, error) {
+	return s.pipeReader.Read(p)
+}
+
+// Close stops the session and closes the current connection
+func (s *Session) Close() error {
+	s.cancel()
+	s.pipeReader.Close()
+	<-s.done
+	return nil
+}
+
+// Events returns the channel on which connection events are reported.
+// Events are dropped if the channel is not drained.
+func (s *Session) Events() <-chan SessionEvent {
+	return s.events
+}
+
+// Stats returns a snapshot of the session counters
+func (s *Session) Stats() SessionStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := s.stats
+	if !stats.Connected {
+		stats.Downtime += time.Since(s.downSince)
+	}
+	return stats
+}
+
+// run connects and pumps data until the session ends
+func (s *Session) run() {
+	defer close(s.done)
+	defer close(s.events)
+
+	attempt := 0
+	for {
+		gotData, err := s.connectAndPump()
+		if s.ctx.Err() != nil {
+			s.pipeWriter.CloseWithError(s.ctx.Err())
+			return
+		}
+
+		if isPermanent(err) {
+			s.emit(SessionEvent{Type: EventFailed, Attempt: attempt, Err: err})
+			s.pipeWriter.CloseWithError(err)
+			return
+		}
+
+		// A connection that delivered data resets the backoff
+		if gotData {
+			attempt = 0
+		}
+		attempt++
+
+		delay := s.backoff(attempt)
+		s.emit(SessionEvent{Type: EventReconnecting, Attempt: attempt, Delay: delay, Err: err})
+
+		select {
+		case <-s.ctx.Done():
+			s.pipeWriter.CloseWithError(s.ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+
+		s.mutex.Lock()
+		s.stats.Reconnects++
+		s.mutex.Unlock()
+	}
+}
+
+// connectAndPump opens one connection and copies it into the pipe until it
+// fails or stalls. It reports whether any RTCM frame was received.
+func (s *Session) connectAndPump() (bool, error) {
+	stream, err := s.client.ConnectContext(s.ctx)
+	if err != nil {
+		return false, err
+	}
+	defer stream.Close()
+
+	s.setConnected(true)
+	s.emit(SessionEvent{Type: EventConnected})
+
+	var (
+		frameMutex sync.Mutex
+		lastFrame  = time.Now()
+		writing    bool
+		stalled    bool
+	)
+
+	// Watchdog closes the stream when no frame arrives in time. Time spent
+	// blocked handing data to a slow reader does not count as a stall.
+	watchdogDone := make(chan struct{})
+	defer close(watchdogDone)
+	if s.config.StallTimeout > 0 {
+		go func() {
+			ticker := time.NewTicker(s.config.StallTimeout / 4)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-watchdogDone:
+					return
+				case <-ticker.C:
+					frameMutex.Lock()
+					if !writing && time.Since(lastFrame) > s.config.StallTimeout {
+						stalled = true
+						frameMutex.Unlock()
+						stream.Close()
+						return
+					}
+					frameMutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	rtcmParser := parser.NewRTCMParser()
+	buffer := make([]byte, 4096)
+	gotData := false
+
+	for {
+		n, err := stream.Read(buffer)
+		if n > 0 {
+			frames := len(rtcmParser.Process(buffer[:n]))
+
+			frameMutex.Lock()
+			if frames > 0 {
+				lastFrame = time.Now()
+				gotData = true
+			}
+			writing = true
+			frameMutex.Unlock()
+
+			s.mutex.Lock()
+			s.stats.Bytes += int64(n)
+			s.stats.Frames += int64(frames)
+			if frames > 0 {
+				s.stats.LastFrame = lastFrame
+			}
+			s.mutex.Unlock()
+
+			_, werr := s.pipeWriter.Write(buffer[:n])
+
+			frameMutex.Lock()
+			writing = false
+			frameMutex.Unlock()
+
+			if werr != nil {
+				// The reader closed the session
+				s.cancel()
+				return gotData, werr
+			}
+		}
+
+		if err != nil {
+			frameMutex.Lock()
+			wasStalled := stalled
+			frameMutex.Unlock()
+
+			s.setConnected(false)
+			if wasStalled {
+				err = ErrStalled
+				s.emit(SessionEvent{Type: EventStalled, Err: err})
+			} else if err == io.EOF {
+				err = errors.New("stream closed by caster")
+			}
+			s.emit(SessionEvent{Type: EventDisconnected, Err: err})
+			return gotData, err
+		}
+	}
+}
+
+// setConnected updates the connection state and downtime accounting
+func (s *Session) setConnected(connected bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if connected == s.stats.Connected {
+		return
+	}
+	s.stats.Connected = connected
+	if connected {
+		s.stats.Downtime += time.Since(s.downSince)
+	} else {
+		s.downSince = time.Now()
+	}
+}
+
+// backoff returns the delay before the given attempt: exponential growth
+// from InitialBackoff capped at MaxBackoff, with up to 50% jitter so that
+// many clients do not reconnect to a recovering caster in lockstep
+func (s *Session) backoff(attempt int) time.Duration {
+	return backoffDelay(s.config.InitialBackoff, s.config.MaxBackoff, attempt)
+}
+
+// backoffDelay implements the reconnect delay shared by sessions and
+// uploads
+func backoffDelay(initial, max time.Duration, attempt int) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
+
+// LogEvents writes the session's connection events to logger until the
+// session ends. It drains Events, so run it in its own goroutine.
+func LogEvents(session *Session, logger *log.Logger) {
+	for event := range session.Events() {
+		switch event.Type {
+		case EventConnected:
+			logger.Println("Connected to NTRIP server.")
+		case EventReconnecting:
+			logger.Printf("Connection lost (%v), reconnecting in %v (attempt %d)",
+				event.Err, event.Delay.Round(time.Millisecond), event.Attempt)
+		case EventStalled:
+			logger.Println("No RTCM data received, stream stalled")
+		}
+	}
+}
+
+// emit sends an event without blocking
+func (s *Session) emit(event SessionEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case s.events <- event:
+	default:
+		// Channel is full, discard the event
+	}
+}
+
+// isPermanent reports whether an error will not be fixed by reconnecting
+func isPermanent(err error) bool {
+	var notFound *ErrMountpointNotFound
+	return errors.Is(err, ErrUnauthorized) || errors.As(err, &notFound)
+}
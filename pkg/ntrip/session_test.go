@@ -0,0 +1,264 @@
+package ntrip
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testFrame builds an RTCM 3 frame with a valid CRC-24Q for the given
+// message type, padded with payloadLen-2 zero bytes
+func testFrame(messageType int, payloadLen int) []byte {
+	payload := make([]byte, payloadLen)
+	payload[0] = byte(messageType >> 4)
+	payload[1] = byte(messageType<<4) & 0xF0
+
+	frame := []byte{0xD3, byte(payloadLen>>8) & 0x03, byte(payloadLen)}
+	frame = append(frame, payload...)
+
+	crc := crc24q(frame)
+	return append(frame, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// crc24q computes the CRC-24Q used by RTCM 3
+func crc24q(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 16
+		for i := 0; i < 8; i++ {
+			crc <<= 1
+			if crc&0x1000000 != 0 {
+				crc ^= 0x1864CFB
+			}
+		}
+	}
+	return crc & 0xFFFFFF
+}
+
+// waitForEvent reads events until one of the given type arrives
+func waitForEvent(t *testing.T, s *Session, eventType SessionEventType) SessionEvent {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case event, ok := <-s.Events():
+			if !ok {
+				t.Fatalf("Events closed while waiting for %s", eventType)
+			}
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s event", eventType)
+		}
+	}
+}
+
+func fastSessionConfig() SessionConfig {
+	return SessionConfig{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		StallTimeout:   time.Second,
+	}
+}
+
+func TestSessionReconnects(t *testing.T) {
+	frame := testFrame(1005, 19)
+
+	// Each connection delivers one frame and then drops
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		conn.Write(frame)
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	session := NewSession(context.Background(), client, fastSessionConfig())
+	defer session.Close()
+
+	// Read three frames worth of data, which requires reconnecting
+	data := make([]byte, 3*len(frame))
+	if _, err := io.ReadFull(session, data); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if string(data[i*len(frame):(i+1)*len(frame)]) != string(frame) {
+			t.Errorf("Frame %d corrupted", i)
+		}
+	}
+
+	stats := session.Stats()
+	if stats.Reconnects < 2 {
+		t.Errorf("Expected at least 2 reconnects, got %d", stats.Reconnects)
+	}
+	if stats.Bytes < int64(len(data)) || stats.Frames < 3 {
+		t.Errorf("Unexpected counters: %+v", stats)
+	}
+
+	waitForEvent(t, session, EventConnected)
+	waitForEvent(t, session, EventDisconnected)
+	event := waitForEvent(t, session, EventReconnecting)
+	if event.Delay <= 0 || event.Delay > 50*time.Millisecond {
+		t.Errorf("Unexpected backoff delay %v", event.Delay)
+	}
+}
+
+func TestSessionDetectsStall(t *testing.T) {
+	var connections int32
+
+	// The caster accepts the connection but never sends a frame
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		atomic.AddInt32(&connections, 1)
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		conn.Write([]byte("not rtcm"))
+		time.Sleep(2 * time.Second)
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	config := fastSessionConfig()
+	config.StallTimeout = 100 * time.Millisecond
+	session := NewSession(context.Background(), client, config)
+	defer session.Close()
+
+	// Drain data so the session is never blocked on the reader
+	go io.Copy(io.Discard, session)
+
+	event := waitForEvent(t, session, EventStalled)
+	if !errors.Is(event.Err, ErrStalled) {
+		t.Errorf("Expected stall error, got %v", event.Err)
+	}
+	waitForEvent(t, session, EventConnected)
+
+	if atomic.LoadInt32(&connections) < 2 {
+		t.Error("Expected a new connection after the stall")
+	}
+}
+
+func TestSessionPermanentError(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.0 401 Unauthorized\r\n\r\n")
+	})
+
+	client := NewClient(fc.URL(), "user", "wrong", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	session := NewSession(context.Background(), client, fastSessionConfig())
+	defer session.Close()
+
+	_, err := session.Read(make([]byte, 16))
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+
+	if event := waitForEvent(t, session, EventFailed); !errors.Is(event.Err, ErrUnauthorized) {
+		t.Errorf("Expected failed event with ErrUnauthorized, got %v", event.Err)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		time.Sleep(2 * time.Second)
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	session := NewSession(context.Background(), client, fastSessionConfig())
+	waitForEvent(t, session, EventConnected)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := session.Read(make([]byte, 16))
+		readErr <- err
+	}()
+
+	session.Close()
+
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Error("Expected error after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after Close")
+	}
+
+	if session.Stats().Connected {
+		t.Error("Expected session to be disconnected after close")
+	}
+}
+
+// lineWriter sends each log line to a channel
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestLogEvents(t *testing.T) {
+	// Each connection drops straight away
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	session := NewSession(context.Background(), client, fastSessionConfig())
+	lines := make(lineWriter, 32)
+	done := make(chan struct{})
+	go func() {
+		LogEvents(session, log.New(lines, "", 0))
+		close(done)
+	}()
+
+	var logged []string
+	timeout := time.After(3 * time.Second)
+	for len(logged) < 2 {
+		select {
+		case line := <-lines:
+			logged = append(logged, strings.TrimSpace(line))
+		case <-timeout:
+			t.Fatalf("Timed out waiting for events, got %q", logged)
+		}
+	}
+	if logged[0] != "Connected to NTRIP server." || !strings.HasPrefix(logged[1], "Connection lost (stream closed by caster), reconnecting in ") {
+		t.Errorf("Unexpected log %q", logged)
+	}
+
+	// LogEvents returns once the session ends
+	session.Close()
+	go func() {
+		for range lines {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("LogEvents did not return after Close")
+	}
+}
+
+func TestSessionBackoff(t *testing.T) {
+	s := &Session{config: SessionConfig{InitialBackoff: time.Second, MaxBackoff: 8 * time.Second}}
+
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 8 * time.Second} {
+		for i := 0; i < 20; i++ {
+			delay := s.backoff(attempt)
+			if delay < max/2 || delay > max {
+				t.Errorf("Attempt %d: delay %v outside [%v, %v]", attempt, delay, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package ntrip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sourcetable record types
+const (
+	recordStream  = "STR"
+	recordCaster  = "CAS"
+	recordNetwork = "NET"
+
+	sourcetableEnd = "ENDSOURCETABLE"
+)
+
+// Sourcetable represents an NTRIP sourcetable
+type Sourcetable struct {
+	Casters  []CasterRecord  `json:"casters"`
+	Networks []NetworkRecord `json:"networks"`
+	Mounts   []MountPoint    `json:"mounts"`
+}
+
+// MountPoint represents a mountpoint (STR record) in an NTRIP sourcetable
+type MountPoint struct {
+	Name           string  `json:"name"`
+	Identifier     string  `json:"identifier"`
+	Format         string  `json:"format"`
+	FormatDetails  string  `json:"format_details"`
+	Carrier        int     `json:"carrier"`
+	NavSystem      string  `json:"nav_system"`
+	Network        string  `json:"network"`
+	Country        string  `json:"country"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	NMEA           bool    `json:"nmea"`
+	Solution       bool    `json:"solution"`
+	Generator      string  `json:"generator"`
+	Compression    string  `json:"compression"`
+	Authentication string  `json:"authentication"`
+	Fee            bool    `json:"fee"`
+	Bitrate        int     `json:"bitrate"`
+	Misc           string  `json:"misc"`
+}
+
+// CasterRecord represents a caster (CAS record) in an NTRIP sourcetable
+type CasterRecord struct {
+	Host         string  `json:"host"`
+	Port         int     `json:"port"`
+	Identifier   string  `json:"identifier"`
+	Operator     string  `json:"operator"`
+	NMEA         bool    `json:"nmea"`
+	Country      string  `json:"country"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	FallbackHost string  `json:"fallback_host"`
+	FallbackPort int     `json:"fallback_port"`
+	Misc         string  `json:"misc"`
+}
+
+// NetworkRecord represents a network (NET record) in an NTRIP sourcetable
+type NetworkRecord struct {
+	Identifier     string `json:"identifier"`
+	Operator       string `json:"operator"`
+	Authentication string `json:"authentication"`
+	Fee            bool   `json:"fee"`
+	NetworkInfoURL string `json:"network_info_url"`
+	StreamInfoURL  string `json:"stream_info_url"`
+	Registration   string `json:"registration"`
+	Misc           string `json:"misc"`
+}
+
+// parseSourcetable parses a sourcetable string.
+//
+// Parsing is deliberately lenient: casters in the wild send short records,
+// empty numeric fields and stray whitespace, so missing fields are left at
+// their zero value rather than rejecting the whole record. Parsing stops at
+// the ENDSOURCETABLE terminator.
+func parseSourcetable(data string) (*Sourcetable, error) {
+	sourcetable := &Sourcetable{
+		Casters:  []CasterRecord{},
+		Networks: []NetworkRecord{},
+		Mounts:   []MountPoint{},
+	}
+
+	terminated := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, sourcetableEnd) {
+			terminated = true
+			break
+		}
+
+		fields := strings.Split(line, ";")
+		switch strings.ToUpper(fields[0]) {
+		case recordStream:
+			if mount, ok := parseStreamRecord(fields); ok {
+				sourcetable.Mounts = append(sourcetable.Mounts, mount)
+			}
+		case recordCaster:
+			if caster, ok := parseCasterRecord(fields); ok {
+				sourcetable.Casters = append(sourcetable.Casters, caster)
+			}
+		case recordNetwork:
+			if network, ok := parseNetworkRecord(fields); ok {
+				sourcetable.Networks = append(sourcetable.Networks, network)
+			}
+		}
+	}
+
+	if !terminated && len(sourcetable.Mounts) == 0 && len(sourcetable.Casters) == 0 && len(sourcetable.Networks) == 0 {
+		return nil, fmt.Errorf("no sourcetable records found")
+	}
+
+	return sourcetable, nil
+}
+
+// parseStreamRecord parses the fields of a STR record
+func parseStreamRecord(fields []string) (MountPoint, bool) {
+	r := record(fields)
+	if r.str(1) == "" {
+		return MountPoint{}, false
+	}
+
+	return MountPoint{
+		Name:           r.str(1),
+		Identifier:     r.str(2),
+		Format:         r.str(3),
+		FormatDetails:  r.str(4),
+		Carrier:        r.int(5),
+		NavSystem:      r.str(6),
+		Network:        r.str(7),
+		Country:        r.str(8),
+		Latitude:       r.float(9),
+		Longitude:      r.float(10),
+		NMEA:           r.flag(11),
+		Solution:       r.flag(12),
+		Generator:      r.str(13),
+		Compression:    r.str(14),
+		Authentication: r.str(15),
+		Fee:            r.flag(16),
+		Bitrate:        r.int(17),
+		Misc:           r.rest(18),
+	}, true
+}
+
+// parseCasterRecord parses the fields of a CAS record
+func parseCasterRecord(fields []string) (CasterRecord, bool) {
+	r := record(fields)
+	if r.str(1) == "" {
+		return CasterRecord{}, false
+	}
+
+	return CasterRecord{
+		Host:         r.str(1),
+		Port:         r.int(2),
+		Identifier:   r.str(3),
+		Operator:     r.str(4),
+		NMEA:         r.flag(5),
+		Country:      r.str(6),
+		Latitude:     r.float(7),
+		Longitude:    r.float(8),
+		FallbackHost: r.str(9),
+		FallbackPort: r.int(10),
+		Misc:         r.rest(11),
+	}, true
+}
+
+// parseNetworkRecord parses the fields of a NET record
+func parseNetworkRecord(fields []string) (NetworkRecord, bool) {
+	r := record(fields)
+	if r.str(1) == "" {
+		return NetworkRecord{}, false
+	}
+
+	return NetworkRecord{
+		Identifier:     r.str(1),
+		Operator:       r.str(2),
+		Authentication: r.str(3),
+		Fee:            r.flag(4),
+		NetworkInfoURL: r.str(5),
+		StreamInfoURL:  r.str(6),
+		Registration:   r.str(7),
+		Misc:           r.rest(8),
+	}, true
+}
+
+// record provides tolerant access to the fields of a sourcetable line
+type record []string
+
+// str returns the trimmed field at index i, or "" if the record is too short
+func (r record) str(i int) string {
+	if i >= len(r) {
+		return ""
+	}
+	return strings.TrimSpace(r[i])
+}
+
+// int returns the field at index i as an integer, or 0 if absent or malformed
+func (r record) int(i int) int {
+	v, err := strconv.Atoi(r.str(i))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// float returns the field at index i as a float, or 0 if absent or malformed
+func (r record) float(i int) float64 {
+	v, err := strconv.ParseFloat(r.str(i), 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// flag returns the field at index i as a boolean. Both the numeric (1/0) and
+// the letter (Y/N) forms used by different fields are accepted.
+func (r record) flag(i int) bool {
+	switch strings.ToUpper(r.str(i)) {
+	case "1", "Y", "YES", "TRUE":
+		return true
+	}
+	return false
+}
+
+// rest returns the fields from index i onwards joined with ';'. The misc
+// field is the last one in every record and may itself contain semicolons.
+func (r record) rest(i int) string {
+	if i >= len(r) {
+		return ""
+	}
+	return strings.TrimSpace(strings.Join(r[i:], ";"))
+}
+
+// String formats the sourcetable as sent by a caster, terminated by
+// ENDSOURCETABLE
+func (s *Sourcetable) String() string {
+	var sb strings.Builder
+	for _, caster := range s.Casters {
+		sb.WriteString(caster.String())
+		sb.WriteString("\r\n")
+	}
+	for _, network := range s.Networks {
+		sb.WriteString(network.String())
+		sb.WriteString("\r\n")
+	}
+	for _, mount := range s.Mounts {
+		sb.WriteString(mount.String())
+		sb.WriteString("\r\n")
+	}
+	sb.WriteString(sourcetableEnd)
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+// String formats the mountpoint as a STR record
+func (m MountPoint) String() string {
+	return strings.Join([]string{
+		recordStream,
+		m.Name,
+		m.Identifier,
+		m.Format,
+		m.FormatDetails,
+		strconv.Itoa(m.Carrier),
+		m.NavSystem,
+		m.Network,
+		m.Country,
+		strconv.FormatFloat(m.Latitude, 'f', 2, 64),
+		strconv.FormatFloat(m.Longitude, 'f', 2, 64),
+		formatFlag(m.NMEA, "1", "0"),
+		formatFlag(m.Solution, "1", "0"),
+		m.Generator,
+		m.Compression,
+		m.Authentication,
+		formatFlag(m.Fee, "Y", "N"),
+		strconv.Itoa(m.Bitrate),
+		m.Misc,
+	}, ";")
+}
+
+// String formats the caster as a CAS record
+func (c CasterRecord) String() string {
+	return strings.Join([]string{
+		recordCaster,
+		c.Host,
+		strconv.Itoa(c.Port),
+		c.Identifier,
+		c.Operator,
+		formatFlag(c.NMEA, "1", "0"),
+		c.Country,
+		strconv.FormatFloat(c.Latitude, 'f', 2, 64),
+		strconv.FormatFloat(c.Longitude, 'f', 2, 64),
+		c.FallbackHost,
+		strconv.Itoa(c.FallbackPort),
+		c.Misc,
+	}, ";")
+}
+
+// String formats the network as a NET record
+func (n NetworkRecord) String() string {
+	return strings.Join([]string{
+		recordNetwork,
+		n.Identifier,
+		n.Operator,
+		n.Authentication,
+		formatFlag(n.Fee, "Y", "N"),
+		n.NetworkInfoURL,
+		n.StreamInfoURL,
+		n.Registration,
+		n.Misc,
+	}, ";")
+}
+
+// formatFlag returns yes or no. Sourcetables use 1/0 for some flags and
+// Y/N for others.
+func formatFlag(value bool, yes, no string) string {
+	if value {
+		return yes
+	}
+	return no
+}
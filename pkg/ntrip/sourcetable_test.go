@@ -0,0 +1,189 @@
+package ntrip
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func loadSourcetable(t *testing.T, name string) *Sourcetable {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+
+	sourcetable, err := parseSourcetable(string(data))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing %s: %v", name, err)
+	}
+
+	return sourcetable
+}
+
+func TestParseSourcetableSNIP(t *testing.T) {
+	st := loadSourcetable(t, "snip.txt")
+
+	if len(st.Casters) != 1 {
+		t.Fatalf("Expected 1 caster, got %d", len(st.Casters))
+	}
+	cas := st.Casters[0]
+	if cas.Host != "rtk2go.com" || cas.Port != 2101 {
+		t.Errorf("Expected rtk2go.com:2101, got %s:%d", cas.Host, cas.Port)
+	}
+	if cas.FallbackHost != "3.143.243.81" || cas.FallbackPort != 2101 {
+		t.Errorf("Unexpected fallback %s:%d", cas.FallbackHost, cas.FallbackPort)
+	}
+	if cas.Latitude != 34.05 || cas.Longitude != -118.24 {
+		t.Errorf("Unexpected caster position %f,%f", cas.Latitude, cas.Longitude)
+	}
+
+	if len(st.Networks) != 1 || st.Networks[0].Identifier != "SNIP" {
+		t.Fatalf("Expected network SNIP, got %+v", st.Networks)
+	}
+	if st.Networks[0].Authentication != "B" || st.Networks[0].Fee {
+		t.Errorf("Unexpected network auth/fee: %+v", st.Networks[0])
+	}
+
+	if len(st.Mounts) != 4 {
+		t.Fatalf("Expected 4 mounts, got %d", len(st.Mounts))
+	}
+
+	m := st.Mounts[0]
+	if m.Name != "AAZ_MN" || m.Identifier != "Maple Grove" {
+		t.Errorf("Unexpected mount %s (%s)", m.Name, m.Identifier)
+	}
+	if m.Format != "RTCM 3.2" {
+		t.Errorf("Expected format 'RTCM 3.2', got '%s'", m.Format)
+	}
+	if m.Carrier != 2 {
+		t.Errorf("Expected carrier 2, got %d", m.Carrier)
+	}
+	if m.NavSystem != "GPS+GLO+GAL+BDS" {
+		t.Errorf("Expected nav system GPS+GLO+GAL+BDS, got %s", m.NavSystem)
+	}
+	if m.Country != "USA" {
+		t.Errorf("Expected country USA, got %s", m.Country)
+	}
+	if m.Latitude != 45.09 || m.Longitude != -93.44 {
+		t.Errorf("Unexpected position %f,%f", m.Latitude, m.Longitude)
+	}
+	if !m.NMEA || m.Solution {
+		t.Errorf("Expected NMEA=true Solution=false, got %v %v", m.NMEA, m.Solution)
+	}
+	if m.Authentication != "B" || m.Fee {
+		t.Errorf("Unexpected auth/fee: %s %v", m.Authentication, m.Fee)
+	}
+	if m.Bitrate != 5600 {
+		t.Errorf("Expected bitrate 5600, got %d", m.Bitrate)
+	}
+
+	// Misc may contain semicolons
+	if st.Mounts[1].Misc != "source=caster;misc2" {
+		t.Errorf("Expected misc 'source=caster;misc2', got '%s'", st.Mounts[1].Misc)
+	}
+
+	// Malformed numeric fields are left at zero
+	bad := st.Mounts[2]
+	if bad.Name != "BadCoords" || bad.Latitude != 0 || bad.Longitude != 0 || bad.Bitrate != 0 {
+		t.Errorf("Expected zero values for malformed record, got %+v", bad)
+	}
+
+	// Short records are kept with the fields they have
+	short := st.Mounts[3]
+	if short.Name != "ShortRec" || short.Format != "RTCM 3" || short.Carrier != 0 {
+		t.Errorf("Unexpected short record %+v", short)
+	}
+}
+
+func TestParseSourcetableBKG(t *testing.T) {
+	st := loadSourcetable(t, "bkg.txt")
+
+	if len(st.Casters) != 1 || st.Casters[0].Identifier != "EUREF-IP" {
+		t.Fatalf("Unexpected casters %+v", st.Casters)
+	}
+	if len(st.Networks) != 2 {
+		t.Fatalf("Expected 2 networks, got %d", len(st.Networks))
+	}
+	if st.Networks[1].Registration != "https://register.rtcm-ntrip.org" {
+		t.Errorf("Unexpected registration %s", st.Networks[1].Registration)
+	}
+	if len(st.Mounts) != 2 {
+		t.Fatalf("Expected 2 mounts, got %d", len(st.Mounts))
+	}
+	if st.Mounts[0].Generator != "SEPT POLARX5" || st.Mounts[0].Compression != "none" {
+		t.Errorf("Unexpected generator/compression %s/%s", st.Mounts[0].Generator, st.Mounts[0].Compression)
+	}
+	if st.Mounts[1].Bitrate != 9600 {
+		t.Errorf("Expected bitrate 9600, got %d", st.Mounts[1].Bitrate)
+	}
+}
+
+func TestParseSourcetableLFOnly(t *testing.T) {
+	st := loadSourcetable(t, "emlid.txt")
+
+	if len(st.Mounts) != 2 {
+		t.Fatalf("Expected 2 mounts, got %d", len(st.Mounts))
+	}
+
+	vrs := st.Mounts[1]
+	if !vrs.NMEA || !vrs.Solution {
+		t.Errorf("Expected VRS mount to require NMEA and be a network solution")
+	}
+	if vrs.Authentication != "D" || !vrs.Fee {
+		t.Errorf("Expected digest auth with fee, got %s %v", vrs.Authentication, vrs.Fee)
+	}
+	if st.Mounts[0].Latitude != -36.85 {
+		t.Errorf("Expected latitude -36.85, got %f", st.Mounts[0].Latitude)
+	}
+}
+
+func TestParseSourcetableStopsAtTerminator(t *testing.T) {
+	data := "STR;ONE;;RTCM 3;\r\nENDSOURCETABLE\r\nSTR;TWO;;RTCM 3;\r\n"
+
+	st, err := parseSourcetable(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(st.Mounts) != 1 || st.Mounts[0].Name != "ONE" {
+		t.Errorf("Expected only mount ONE, got %+v", st.Mounts)
+	}
+
+	// An empty sourcetable is valid as long as it is terminated
+	st, err = parseSourcetable("SOURCETABLE 200 OK\r\n\r\nENDSOURCETABLE\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(st.Mounts) != 0 {
+		t.Errorf("Expected no mounts, got %d", len(st.Mounts))
+	}
+}
+
+func TestParseSourcetableInvalid(t *testing.T) {
+	if _, err := parseSourcetable("<html><body>Not found</body></html>"); err == nil {
+		t.Error("Expected error for non-sourcetable data")
+	}
+
+	// Records without a name are dropped
+	st, err := parseSourcetable("STR;;;RTCM 3\r\nCAS;\r\nNET\r\nENDSOURCETABLE\r\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(st.Mounts) != 0 || len(st.Casters) != 0 || len(st.Networks) != 0 {
+		t.Errorf("Expected empty sourcetable, got %+v", st)
+	}
+}
+
+func TestSourcetableStringRoundTrip(t *testing.T) {
+	st := loadSourcetable(t, "snip.txt")
+
+	formatted, err := parseSourcetable(st.String())
+	if err != nil {
+		t.Fatalf("Unexpected error parsing formatted sourcetable: %v", err)
+	}
+	if !reflect.DeepEqual(formatted, st) {
+		t.Errorf("Round trip changed the sourcetable:\n got %+v\nwant %+v", formatted, st)
+	}
+}
@@ -0,0 +1,344 @@
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPort is the IANA registered NTRIP port
+const defaultPort = "2101"
+
+// Raw response kinds, determined from the caster's status line
+const (
+	responseStream      = iota // ICY 200 OK or HTTP 200 with a data stream
+	responseSourcetable        // SOURCETABLE 200 OK or a gnss/sourcetable body
+)
+
+// rawResponse is the parsed status line and headers of a raw NTRIP reply
+type rawResponse struct {
+	Kind       int
+	StatusLine string
+	StatusCode int
+	Header     textproto.MIMEHeader
+}
+
+// rawConn is a stream opened over a raw TCP connection. Unlike a net/http
+// response body it is bidirectional, which is what allows positions to be
+// uploaded to VRS mountpoints.
+type rawConn struct {
+	conn      net.Conn
+	reader    io.Reader
+	stop      func() bool
+	writeLock sync.Mutex
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Read reads stream data from the connection
+func (r *rawConn) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
+}
+
+// Write sends data to the caster
+func (r *rawConn) Write(p []byte) (int, error) {
+	r.writeLock.Lock()
+	defer r.writeLock.Unlock()
+	return r.conn.Write(p)
+}
+
+// Close closes the underlying connection and stops any GGA upload
+func (r *rawConn) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	r.stop()
+	return r.conn.Close()
+}
+
+// uploadGGA sends a GGA immediately and then every interval until the
+// connection is closed. Failures to obtain a sentence are skipped; write
+// failures end the upload since the read side will see the error too.
+func (r *rawConn) uploadGGA(source func() string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if sentence := source(); sentence != "" {
+			if _, err := io.WriteString(r, sentence+"\r\n"); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// connectRaw opens the stream over a raw TCP connection
+func (c *Client) connectRaw(ctx context.Context, protocol Protocol) (io.ReadCloser, error) {
+	conn, reader, resp, err := c.rawRequest(ctx, c.streamURL(), protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	body := resp.body(reader)
+	if resp.Kind == responseSourcetable {
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		data, _ := readSourcetableBody(body)
+		return nil, newMountpointNotFound(c.Mountpoint, data)
+	}
+
+	// Close the connection if the context is cancelled while streaming
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	stream := &rawConn{conn: conn, reader: body, stop: stop, done: make(chan struct{})}
+	if c.GGASource != nil {
+		go stream.uploadGGA(c.currentGGA, c.ggaInterval())
+	}
+
+	return stream, nil
+}
+
+// getSourcetableRaw retrieves the sourcetable over a raw TCP connection
+func (c *Client) getSourcetableRaw(ctx context.Context, protocol Protocol) (*Sourcetable, error) {
+	// Some casters answer a request for "/" with ICY 200 OK followed by
+	// the table, so the body is parsed regardless of the response kind.
+	conn, reader, resp, err := c.rawRequest(ctx, c.URL, protocol)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Bound the read in case the caster never closes the connection
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetReadDeadline(deadline)
+	} else {
+		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	data, err := readSourcetableBody(resp.body(reader))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %v", err)
+	}
+
+	sourcetable, err := parseSourcetable(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sourcetable: %v", err)
+	}
+
+	return sourcetable, nil
+}
+
+// body returns the reader for the response body, removing chunked
+// transfer framing when the caster uses it
+func (r *rawResponse) body(reader *bufio.Reader) io.Reader {
+	if strings.EqualFold(r.Header.Get("Transfer-Encoding"), "chunked") {
+		return httputil.NewChunkedReader(reader)
+	}
+	return reader
+}
+
+// readSourcetableBody reads lines until ENDSOURCETABLE or EOF
+func readSourcetableBody(r io.Reader) (string, error) {
+	reader, ok := r.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(r)
+	}
+
+	var sb strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		sb.WriteString(line)
+		if strings.HasPrefix(strings.TrimSpace(line), sourcetableEnd) {
+			return sb.String(), nil
+		}
+		if err == io.EOF {
+			return sb.String(), nil
+		}
+		if err != nil {
+			return sb.String(), err
+		}
+	}
+}
+
+// rawRequest dials the caster, sends an NTRIP request for rawURL and reads
+// the response status line and headers
+func (c *Client) rawRequest(ctx context.Context, rawURL string, protocol Protocol) (net.Conn, *bufio.Reader, *rawResponse, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	conn, err := c.dialCaster(ctx, u)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error connecting to NTRIP caster: %v", err)
+	}
+
+	// Abort the handshake if the context is cancelled or the deadline passes
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, c.buildRawRequest(u, protocol)); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("error sending request: %v", contextError(ctx, err))
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := readRawResponse(reader)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("error reading response: %w", contextError(ctx, err))
+	}
+
+	if resp.StatusCode != 200 {
+		conn.Close()
+		return nil, nil, nil, statusError(resp.StatusCode)
+	}
+
+	if !stop() {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("error connecting to NTRIP caster: %v", ctx.Err())
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, reader, resp, nil
+}
+
+// buildRawRequest builds the request text for the given protocol revision
+func (c *Client) buildRawRequest(u *url.URL, protocol Protocol) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var sb strings.Builder
+	if protocol == ProtocolRev2 {
+		fmt.Fprintf(&sb, "GET %s HTTP/1.1\r\n", path)
+		fmt.Fprintf(&sb, "Host: %s\r\n", u.Host)
+		sb.WriteString("Ntrip-Version: Ntrip/2.0\r\n")
+		fmt.Fprintf(&sb, "User-Agent: %s\r\n", userAgent)
+		sb.WriteString("Connection: close\r\n")
+		if gga := c.currentGGA(); gga != "" {
+			fmt.Fprintf(&sb, "Ntrip-GGA: %s\r\n", gga)
+		}
+	} else {
+		fmt.Fprintf(&sb, "GET %s HTTP/1.0\r\n", path)
+		fmt.Fprintf(&sb, "User-Agent: %s\r\n", userAgent)
+		sb.WriteString("Accept: */*\r\n")
+	}
+
+	if c.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		fmt.Fprintf(&sb, "Authorization: Basic %s\r\n", credentials)
+	}
+	sb.WriteString("\r\n")
+
+	return sb.String()
+}
+
+// readRawResponse reads and classifies the caster's status line. NTRIP 1.0
+// casters reply "ICY 200 OK" to stream requests and "SOURCETABLE 200 OK"
+// to sourcetable requests; NTRIP 2.0 casters reply with a normal HTTP
+// status line and headers.
+func readRawResponse(reader *bufio.Reader) (*rawResponse, error) {
+	tp := textproto.NewReader(reader)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &rawResponse{StatusLine: line, Header: textproto.MIMEHeader{}}
+
+	switch {
+	case strings.HasPrefix(line, "ICY 200"):
+		resp.Kind = responseStream
+		resp.StatusCode = 200
+		return resp, nil
+
+	case strings.HasPrefix(line, "SOURCETABLE 200"):
+		resp.Kind = responseSourcetable
+		resp.StatusCode = 200
+		// Headers are optional and end with an empty line
+		resp.Header, err = readOptionalHeader(reader)
+		return resp, err
+
+	case strings.HasPrefix(line, "HTTP/1."):
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("malformed status line: %q", line)
+		}
+		resp.StatusCode, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed status line: %q", line)
+		}
+		resp.Header, err = tp.ReadMIMEHeader()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		resp.Kind = responseStream
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "gnss/sourcetable") {
+			resp.Kind = responseSourcetable
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("unexpected response from caster: %q", line)
+}
+
+// readOptionalHeader reads "Key: value" lines following a SOURCETABLE
+// status line. Older casters start the table immediately, so reading stops
+// without consuming anything at the first line that is not a header.
+func readOptionalHeader(reader *bufio.Reader) (textproto.MIMEHeader, error) {
+	header := textproto.MIMEHeader{}
+	for {
+		peek, err := reader.Peek(4)
+		if err != nil || string(peek[:3]) == "STR" || string(peek[:3]) == "CAS" ||
+			string(peek[:3]) == "NET" || string(peek) == "ENDS" {
+			return header, nil
+		}
+
+		line, err := reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" || err != nil {
+			return header, nil
+		}
+
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			header.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	}
+}
+
+// contextError prefers the context error over a network timeout caused by
+// cancelling the handshake
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// The connection deadline is the context deadline, which can pass
+	// before the context itself reports it
+	var netErr net.Error
+	if deadline, ok := ctx.Deadline(); ok && errors.As(err, &netErr) && netErr.Timeout() && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
@@ -0,0 +1,433 @@
+package ntrip
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCaster is a minimal NTRIP caster built on net.Listener that answers
+// every connection with a scripted reply
+type fakeCaster struct {
+	listener net.Listener
+	requests chan fakeRequest
+	reply    func(req fakeRequest, conn net.Conn)
+}
+
+// fakeRequest is a request received by the fake caster
+type fakeRequest struct {
+	RequestLine string
+	Header      textproto.MIMEHeader
+	Reader      *bufio.Reader // Data sent by the client after the headers
+}
+
+func newFakeCaster(t *testing.T, reply func(req fakeRequest, conn net.Conn)) *fakeCaster {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	return newFakeCasterOn(t, listener, reply)
+}
+
+// newFakeCasterOn serves the fake caster on an existing listener, such as
+// a TLS listener
+func newFakeCasterOn(t *testing.T, listener net.Listener, reply func(req fakeRequest, conn net.Conn)) *fakeCaster {
+	t.Helper()
+
+	fc := &fakeCaster{
+		listener: listener,
+		requests: make(chan fakeRequest, 10),
+		reply:    reply,
+	}
+	go fc.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return fc
+}
+
+func (fc *fakeCaster) serve() {
+	for {
+		conn, err := fc.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			tp := textproto.NewReader(reader)
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			header, _ := tp.ReadMIMEHeader()
+			req := fakeRequest{RequestLine: line, Header: header, Reader: reader}
+			fc.requests <- req
+			fc.reply(req, conn)
+		}()
+	}
+}
+
+func (fc *fakeCaster) URL() string {
+	return "http://" + fc.listener.Addr().String()
+}
+
+func (fc *fakeCaster) lastRequest(t *testing.T) fakeRequest {
+	t.Helper()
+	select {
+	case req := <-fc.requests:
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("Fake caster received no request")
+		return fakeRequest{}
+	}
+}
+
+const fakeSourcetable = "STR;MOUNT;Fake;RTCM 3.2;1005(10),1077(1);2;GPS;FAKE;GBR;51.5;-0.1;0;0;fake;none;B;N;2400;\r\n" +
+	"ENDSOURCETABLE\r\n"
+
+func TestConnectRawRev1ICY(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "ICY 200 OK\r\n")
+		conn.Write([]byte{0xD3, 0x00, 0x01, 0xAA})
+	})
+
+	client := NewClient(fc.URL(), "user", "pass", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Error reading from stream: %v", err)
+	}
+	if string(data) != "\xD3\x00\x01\xAA" {
+		t.Errorf("Unexpected stream data %x", data)
+	}
+
+	req := fc.lastRequest(t)
+	if req.RequestLine != "GET /MOUNT HTTP/1.0" {
+		t.Errorf("Expected NTRIP 1.0 request line, got %q", req.RequestLine)
+	}
+	if !strings.HasPrefix(req.Header.Get("User-Agent"), "NTRIP ") {
+		t.Errorf("Expected User-Agent starting with NTRIP, got %q", req.Header.Get("User-Agent"))
+	}
+	if req.Header.Get("Authorization") != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Unexpected Authorization header %q", req.Header.Get("Authorization"))
+	}
+	if req.Header.Get("Ntrip-Version") != "" {
+		t.Error("NTRIP 1.0 request should not send Ntrip-Version")
+	}
+}
+
+func TestConnectRawRev2(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: gnss/data\r\n\r\nRTCM data")
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, _ := io.ReadAll(stream)
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got %q", data)
+	}
+
+	req := fc.lastRequest(t)
+	if req.RequestLine != "GET /MOUNT HTTP/1.1" {
+		t.Errorf("Expected NTRIP 2.0 request line, got %q", req.RequestLine)
+	}
+	if req.Header.Get("Ntrip-Version") != "Ntrip/2.0" {
+		t.Errorf("Expected Ntrip-Version header, got %q", req.Header.Get("Ntrip-Version"))
+	}
+	if req.Header.Get("Host") == "" {
+		t.Error("Expected Host header")
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Error("Expected no Authorization header without username")
+	}
+}
+
+func TestConnectRawUnauthorized(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.0 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"/MOUNT\"\r\n\r\n")
+	})
+
+	for _, protocol := range []Protocol{ProtocolRev1, ProtocolRev2} {
+		client := NewClient(fc.URL(), "user", "wrong", "MOUNT")
+		client.Protocol = protocol
+
+		_, err := client.ConnectContext(context.Background())
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", protocol, err)
+		}
+	}
+}
+
+func TestAutoFallsBackToRev1(t *testing.T) {
+	tests := map[string]string{
+		"bad request":  "HTTP/1.1 400 Bad Request\r\n\r\n",
+		"not found":    "HTTP/1.0 404 Not Found\r\n\r\n",
+		"closed early": "",
+	}
+
+	for name, rev2Reply := range tests {
+		t.Run(name, func(t *testing.T) {
+			fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+				if req.Header.Get("Ntrip-Version") != "" {
+					io.WriteString(conn, rev2Reply)
+					return
+				}
+				io.WriteString(conn, "ICY 200 OK\r\nRTCM data")
+			})
+
+			client := NewClient(fc.URL(), "user", "pass", "MOUNT")
+			stream, err := client.ConnectContext(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer stream.Close()
+
+			data, _ := io.ReadAll(stream)
+			if string(data) != "RTCM data" {
+				t.Errorf("Expected 'RTCM data', got %q", data)
+			}
+			if req := fc.lastRequest(t); req.Header.Get("Ntrip-Version") != "Ntrip/2.0" {
+				t.Errorf("Expected an NTRIP 2.0 request first, got %q", req.RequestLine)
+			}
+			if req := fc.lastRequest(t); !strings.HasSuffix(req.RequestLine, "HTTP/1.0") || req.Header.Get("Ntrip-Version") != "" {
+				t.Errorf("Expected an NTRIP 1.0 retry, got %q", req.RequestLine)
+			}
+		})
+	}
+
+	// Rejected credentials are not retried
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 401 Unauthorized\r\n\r\n")
+	})
+	client := NewClient(fc.URL(), "user", "wrong", "MOUNT")
+	if _, err := client.ConnectContext(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	fc.lastRequest(t)
+	select {
+	case req := <-fc.requests:
+		t.Errorf("Unexpected retry %q", req.RequestLine)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAutoReadsNTRIP1Replies(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		if strings.HasSuffix(strings.Fields(req.RequestLine)[1], "/MOUNT") {
+			io.WriteString(conn, "ICY 200 OK\r\nRTCM data")
+			return
+		}
+		io.WriteString(conn, "SOURCETABLE 200 OK\r\n"+fakeSourcetable)
+	})
+
+	client := NewClient(fc.URL(), "user", "pass", "MOUNT")
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, _ := io.ReadAll(stream)
+	if string(data) != "RTCM data" {
+		t.Errorf("Expected 'RTCM data', got %q", data)
+	}
+
+	// The NTRIP 1.0 status line is read on the connection of the NTRIP 2.0
+	// request, without a second attempt
+	if req := fc.lastRequest(t); req.Header.Get("Ntrip-Version") != "Ntrip/2.0" {
+		t.Errorf("Expected an NTRIP 2.0 request, got %q", req.RequestLine)
+	}
+
+	sourcetable, err := client.GetSourcetable(context.Background())
+	if err != nil {
+		t.Fatalf("GetSourcetable failed: %v", err)
+	}
+	if len(sourcetable.Mounts) != 1 || sourcetable.Mounts[0].Name != "MOUNT" {
+		t.Errorf("Unexpected sourcetable %+v", sourcetable.Mounts)
+	}
+	fc.lastRequest(t)
+
+	select {
+	case req := <-fc.requests:
+		t.Errorf("Unexpected second request %q", req.RequestLine)
+	default:
+	}
+}
+
+func TestConnectRawSourcetableReply(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "SOURCETABLE 200 OK\r\n"+fakeSourcetable)
+	})
+
+	client := NewClient(fc.URL(), "", "", "MISSING")
+	client.Protocol = ProtocolRev1
+
+	_, err := client.ConnectContext(context.Background())
+	var notFound *ErrMountpointNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected ErrMountpointNotFound, got %v", err)
+	}
+	if notFound.Mountpoint != "MISSING" {
+		t.Errorf("Expected mountpoint MISSING, got %s", notFound.Mountpoint)
+	}
+	if len(notFound.Alternatives) != 1 || notFound.Alternatives[0].Name != "MOUNT" {
+		t.Errorf("Expected alternative MOUNT, got %+v", notFound.Alternatives)
+	}
+}
+
+func TestConnectRawChunked(t *testing.T) {
+	frame := []byte{0xD3, 0x00, 0x03, 0x3E, 0xD0, 0x00, 0x12, 0x34, 0x56}
+
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: gnss/data\r\nTransfer-Encoding: chunked\r\n\r\n")
+		// Split the frame across two chunks to make sure framing is removed
+		fmt.Fprintf(conn, "%x\r\n%s\r\n", 4, frame[:4])
+		fmt.Fprintf(conn, "%x\r\n%s\r\n", len(frame)-4, frame[4:])
+		io.WriteString(conn, "0\r\n\r\n")
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev2
+
+	stream, err := client.ConnectContext(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Error reading from stream: %v", err)
+	}
+	if string(data) != string(frame) {
+		t.Errorf("Expected pure RTCM bytes %x, got %x", frame, data)
+	}
+}
+
+func TestConnectRawChunkedSourcetable(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: gnss/sourcetable\r\nTransfer-Encoding: chunked\r\n\r\n")
+		fmt.Fprintf(conn, "%x\r\n%s\r\n0\r\n\r\n", len(fakeSourcetable), fakeSourcetable)
+	})
+
+	client := NewClient(fc.URL(), "", "", "MISSING")
+	client.Protocol = ProtocolRev2
+
+	_, err := client.ConnectContext(context.Background())
+	var notFound *ErrMountpointNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Expected ErrMountpointNotFound, got %v", err)
+	}
+	if len(notFound.Alternatives) != 1 {
+		t.Errorf("Expected 1 alternative, got %d", len(notFound.Alternatives))
+	}
+}
+
+func TestGetSourcetableRaw(t *testing.T) {
+	replies := map[string]string{
+		"rev1 bare":         "SOURCETABLE 200 OK\r\n" + fakeSourcetable,
+		"rev1 with headers": "SOURCETABLE 200 OK\r\nServer: NTRIP Caster 1.0\r\nContent-Type: text/plain\r\n\r\n" + fakeSourcetable,
+		"rev2":              "HTTP/1.1 200 OK\r\nContent-Type: gnss/sourcetable\r\n\r\n" + fakeSourcetable,
+	}
+
+	for name, reply := range replies {
+		t.Run(name, func(t *testing.T) {
+			fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+				io.WriteString(conn, reply)
+			})
+
+			client := NewClient(fc.URL(), "", "", "")
+			client.Protocol = ProtocolRev1
+
+			st, err := client.GetSourcetable(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(st.Mounts) != 1 || st.Mounts[0].Name != "MOUNT" || st.Mounts[0].Bitrate != 2400 {
+				t.Errorf("Unexpected sourcetable %+v", st.Mounts)
+			}
+			if req := fc.lastRequest(t); req.RequestLine != "GET / HTTP/1.0" {
+				t.Errorf("Expected request for /, got %q", req.RequestLine)
+			}
+		})
+	}
+}
+
+func TestGetSourcetableAutoFallsBackToRev1(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		io.WriteString(conn, "SOURCETABLE 200 OK\r\n"+fakeSourcetable)
+	})
+
+	client := NewClient(fc.URL(), "", "", "")
+
+	st, err := client.GetSourcetable(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(st.Mounts) != 1 {
+		t.Errorf("Expected 1 mount, got %d", len(st.Mounts))
+	}
+}
+
+func TestConnectRawTimeout(t *testing.T) {
+	fc := newFakeCaster(t, func(req fakeRequest, conn net.Conn) {
+		time.Sleep(500 * time.Millisecond)
+	})
+
+	client := NewClient(fc.URL(), "", "", "MOUNT")
+	client.Protocol = ProtocolRev1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := client.ConnectContext(ctx)
+	if err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Errorf("Expected deadline exceeded error, got: %v", err)
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := map[string]Protocol{
+		"":     ProtocolAuto,
+		"auto": ProtocolAuto,
+		"HTTP": ProtocolHTTP,
+		"1.0":  ProtocolRev1,
+		"rev2": ProtocolRev2,
+	}
+	for name, want := range tests {
+		got, err := ParseProtocol(name)
+		if err != nil || got != want {
+			t.Errorf("ParseProtocol(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseProtocol("ntrip3"); err == nil {
+		t.Error("Expected error for unknown protocol")
+	}
+}
@@ -0,0 +1,368 @@
+package ntrip
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bramburn/go_ntrip/internal/device"
+	"github.com/bramburn/go_ntrip/internal/parser"
+)
+
+// Upload defaults
+const (
+	DefaultRateWindow = 5 * time.Second
+	uploadQueueSize   = 64
+)
+
+// UploadConfig holds configuration for an upload
+type UploadConfig struct {
+	InitialBackoff time.Duration // Delay before the first reconnect attempt
+	MaxBackoff     time.Duration // Upper bound for the reconnect delay
+	RateWindow     time.Duration // Period over which the upload rate is measured
+}
+
+// DefaultUploadConfig returns a default upload configuration
+func DefaultUploadConfig() UploadConfig {
+	return UploadConfig{
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+		RateWindow:     DefaultRateWindow,
+	}
+}
+
+// UploadStats holds counters for an upload
+type UploadStats struct {
+	Connected  bool
+	Reconnects int
+	Bytes      int64   // Bytes sent to the caster
+	Frames     int64   // RTCM frames sent to the caster
+	Dropped    int64   // Frames discarded while the caster was unreachable
+	Rate       float64 // Bytes per second over the last rate window
+	Downtime   time.Duration
+	LastFrame  time.Time
+}
+
+// DeviceReader adapts a GNSS device to an io.Reader so it can be used as
+// an upload source
+type DeviceReader struct {
+	Device device.GNSSDevice
+}
+
+// Read reads raw data from the device
+func (r DeviceReader) Read(p []byte) (int, error) {
+	return r.Device.ReadRaw(p)
+}
+
+// Upload is a long-lived connection that publishes RTCM from a local
+// source, such as a base receiver, to a caster mountpoint. Only complete
+// RTCM frames are forwarded, so NMEA or other output interleaved on the
+// same port is dropped. The connection is re-established with backoff
+// when it fails, and frames produced while the caster is unreachable are
+// discarded rather than sent late.
+type Upload struct {
+	server *Server
+	source io.Reader
+	config UploadConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	frames chan []byte
+	events chan SessionEvent
+
+	mutex     sync.Mutex
+	stats     UploadStats
+	err       error
+	downSince time.Time
+	done      chan struct{}
+}
+
+// NewUpload starts reading from source and publishing to the server's
+// mountpoint. The upload runs until ctx is done, Close is called, the
+// source returns an error, or the caster returns a permanent error such
+// as ErrUnauthorized.
+func NewUpload(ctx context.Context, server *Server, source io.Reader, config UploadConfig) *Upload {
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.RateWindow <= 0 {
+		config.RateWindow = DefaultRateWindow
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	u := &Upload{
+		server:    server,
+		source:    source,
+		config:    config,
+		ctx:       ctx,
+		cancel:    cancel,
+		frames:    make(chan []byte, uploadQueueSize),
+		events:    make(chan SessionEvent, 32),
+		downSince: time.Now(),
+		done:      make(chan struct{}),
+	}
+
+	go u.readSource()
+	go u.run()
+
+	return u
+}
+
+// Close stops the upload and closes the connection. The source is not
+// closed.
+func (u *Upload) Close() error {
+	u.cancel()
+	<-u.done
+	return nil
+}
+
+// Done returns a channel that is closed when the upload has stopped
+func (u *Upload) Done() <-chan struct{} {
+	return u.done
+}
+
+// Err returns the error that stopped the upload, or nil while it runs
+func (u *Upload) Err() error {
+	select {
+	case <-u.done:
+	default:
+		return nil
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.err != nil {
+		return u.err
+	}
+	return u.ctx.Err()
+}
+
+// Events returns the channel on which connection events are reported.
+// Events are dropped if the channel is not drained.
+func (u *Upload) Events() <-chan SessionEvent {
+	return u.events
+}
+
+// Stats returns a snapshot of the upload counters
+func (u *Upload) Stats() UploadStats {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	stats := u.stats
+	if !stats.Connected {
+		stats.Downtime += time.Since(u.downSince)
+	}
+	return stats
+}
+
+// readSource splits the source into RTCM frames and queues them. The
+// queue never blocks the source: a serial port that is not drained
+// overflows, so frames are dropped instead when the queue is full.
+func (u *Upload) readSource() {
+	defer close(u.frames)
+
+	rtcmParser := parser.NewRTCMParser()
+	buffer := make([]byte, 4096)
+
+	for u.ctx.Err() == nil {
+		n, err := u.source.Read(buffer)
+		for _, message := range rtcmParser.Process(buffer[:n]) {
+			select {
+			case u.frames <- message.Frame:
+			default:
+				u.addDropped(1)
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("source closed")
+			}
+			u.setErr(err)
+			return
+		}
+	}
+}
+
+// run connects and sends frames until the upload ends
+func (u *Upload) run() {
+	defer close(u.done)
+	defer close(u.events)
+	defer u.cancel()
+
+	attempt := 0
+	for {
+		sent, err := u.connectAndSend()
+		if u.ctx.Err() != nil {
+			return
+		}
+
+		if sourceErr := u.getErr(); sourceErr != nil {
+			u.emit(SessionEvent{Type: EventFailed, Attempt: attempt, Err: sourceErr})
+			return
+		}
+
+		if isPermanent(err) {
+			u.setErr(err)
+			u.emit(SessionEvent{Type: EventFailed, Attempt: attempt, Err: err})
+			return
+		}
+
+		// A connection that carried data resets the backoff
+		if sent {
+			attempt = 0
+		}
+		attempt++
+
+		delay := backoffDelay(u.config.InitialBackoff, u.config.MaxBackoff, attempt)
+		u.emit(SessionEvent{Type: EventReconnecting, Attempt: attempt, Delay: delay, Err: err})
+
+		// Frames produced while waiting would be stale by the time they
+		// reach a rover, so they are discarded
+		timer := time.NewTimer(delay)
+	wait:
+		for {
+			select {
+			case <-u.ctx.Done():
+				timer.Stop()
+				return
+			case _, ok := <-u.frames:
+				if !ok {
+					timer.Stop()
+					u.emit(SessionEvent{Type: EventFailed, Attempt: attempt, Err: u.getErr()})
+					return
+				}
+				u.addDropped(1)
+			case <-timer.C:
+				break wait
+			}
+		}
+
+		u.mutex.Lock()
+		u.stats.Reconnects++
+		u.mutex.Unlock()
+	}
+}
+
+// connectAndSend opens one connection and writes queued frames to it
+// until it fails. It reports whether any frame was sent.
+func (u *Upload) connectAndSend() (bool, error) {
+	conn, err := u.server.ConnectContext(u.ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Discard frames queued while connecting
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-u.frames:
+			if !ok {
+				return false, nil
+			}
+			u.addDropped(1)
+		default:
+			drained = true
+		}
+	}
+
+	u.setConnected(true)
+	u.emit(SessionEvent{Type: EventConnected})
+
+	ticker := time.NewTicker(u.config.RateWindow)
+	defer ticker.Stop()
+	windowStart := time.Now()
+	var windowBytes int64
+	sent := false
+
+	for {
+		select {
+		case <-u.ctx.Done():
+			u.setConnected(false)
+			return sent, u.ctx.Err()
+
+		case now := <-ticker.C:
+			u.mutex.Lock()
+			u.stats.Rate = float64(windowBytes) / now.Sub(windowStart).Seconds()
+			u.mutex.Unlock()
+			windowStart = now
+			windowBytes = 0
+
+		case frame, ok := <-u.frames:
+			if !ok {
+				u.setConnected(false)
+				return sent, nil
+			}
+
+			if _, err := conn.Write(frame); err != nil {
+				u.setConnected(false)
+				u.emit(SessionEvent{Type: EventDisconnected, Err: err})
+				return sent, err
+			}
+			sent = true
+			windowBytes += int64(len(frame))
+
+			u.mutex.Lock()
+			u.stats.Bytes += int64(len(frame))
+			u.stats.Frames++
+			u.stats.LastFrame = time.Now()
+			u.mutex.Unlock()
+		}
+	}
+}
+
+// setErr records the error that stops the upload
+func (u *Upload) setErr(err error) {
+	u.mutex.Lock()
+	u.err = err
+	u.mutex.Unlock()
+}
+
+// getErr returns the recorded error, if any
+func (u *Upload) getErr() error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.err
+}
+
+// addDropped counts frames that were not sent
+func (u *Upload) addDropped(n int64) {
+	u.mutex.Lock()
+	u.stats.Dropped += n
+	u.mutex.Unlock()
+}
+
+// setConnected updates the connection state and downtime accounting
+func (u *Upload) setConnected(connected bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if connected == u.stats.Connected {
+		return
+	}
+	u.stats.Connected = connected
+	if connected {
+		u.stats.Downtime += time.Since(u.downSince)
+	} else {
+		u.downSince = time.Now()
+		u.stats.Rate = 0
+	}
+}
+
+// emit sends an event without blocking
+func (u *Upload) emit(event SessionEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case u.events <- event:
+	default:
+		// Channel is full, discard the event
+	}
+}
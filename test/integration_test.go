@@ -7,8 +7,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/bramburn/go_ntrip/internal/ntrip"
 	"github.com/bramburn/go_ntrip/internal/rtk"
+	"github.com/bramburn/go_ntrip/pkg/ntrip"
 )
 
 func TestNTRIPClientRTKIntegration(t *testing.T) {
@@ -64,7 +64,7 @@ func TestNTRIPClientRTKIntegration(t *testing.T) {
 	defer cancel()
 
 	// Connect to NTRIP server
-	stream, err := client.Connect(ctx)
+	stream, err := client.ConnectContext(ctx)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}